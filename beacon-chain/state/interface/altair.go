@@ -0,0 +1,108 @@
+package iface
+
+import (
+	"context"
+
+	types "github.com/prysmaticlabs/eth2-types"
+	pbp2p "github.com/prysmaticlabs/prysm/proto/beacon/p2p/v1"
+)
+
+// BeaconStateAltair has read and write access to the beacon state
+// methods introduced in the Altair hard fork.
+type BeaconStateAltair interface {
+	ReadOnlyBeaconStateAltair
+	WriteOnlyBeaconStateAltair
+	Copy() BeaconStateAltair
+	HashTreeRoot(ctx context.Context) ([32]byte, error)
+}
+
+// ReadOnlyBeaconStateAltair defines a struct which only has read access to Altair beacon state methods.
+type ReadOnlyBeaconStateAltair interface {
+	ReadOnlySyncCommittee
+	ReadOnlyParticipation
+	ReadOnlyInactivityScores
+	InnerStateUnsafe() interface{}
+	CloneInnerState() interface{}
+	Slot() types.Slot
+	IsNil() bool
+}
+
+// WriteOnlyBeaconStateAltair defines a struct which only has write access to Altair beacon state methods.
+type WriteOnlyBeaconStateAltair interface {
+	WriteOnlySyncCommittee
+	WriteOnlyParticipation
+	WriteOnlyInactivityScores
+	SetSlot(val types.Slot) error
+}
+
+// ReadOnlySyncCommittee defines a struct which only has read access to sync committee methods.
+type ReadOnlySyncCommittee interface {
+	CurrentSyncCommittee() (*pbp2p.SyncCommittee, error)
+	CurrentSyncCommitteeIndices(pubKey [48]byte) ([]uint64, error)
+	CurrentSyncCommitteeAggregatePubkey() ([48]byte, error)
+	CurrentSyncCommitteePubkeyAtIndex(idx uint64) ([48]byte, error)
+	SyncCommitteeParticipantCount(bitfield []byte) (uint64, error)
+	NextSyncCommittee() (*pbp2p.SyncCommittee, error)
+	NextSyncCommitteeIndices(pubKey [48]byte) ([]uint64, error)
+	NextSyncCommitteeAggregatePubkey() ([48]byte, error)
+	NextSyncCommitteePubkeyAtIndex(idx uint64) ([48]byte, error)
+}
+
+// WriteOnlySyncCommittee defines a struct which only has write access to sync committee methods.
+type WriteOnlySyncCommittee interface {
+	SetCurrentSyncCommittee(val *pbp2p.SyncCommittee) error
+	SetNextSyncCommittee(val *pbp2p.SyncCommittee) error
+	SetSyncCommittees(current, next *pbp2p.SyncCommittee) error
+	RotateSyncCommittee(newNext *pbp2p.SyncCommittee) error
+}
+
+// ReadOnlyParticipation defines a struct which only has read access to participation methods.
+type ReadOnlyParticipation interface {
+	CurrentEpochParticipation() ([]byte, error)
+	PreviousEpochParticipation() ([]byte, error)
+	CurrentEpochParticipationAtIndex(idx uint64) (byte, error)
+	PreviousEpochParticipationAtIndex(idx uint64) (byte, error)
+	ValidateParticipationLengths() error
+	ParticipationBitsEqual(other BeaconStateAltair) (bool, error)
+	ParticipationFlagsAtIndex(idx uint64) (ParticipationFlags, error)
+}
+
+// ParticipationFlags are the participation flags set for a validator in an epoch.
+type ParticipationFlags struct {
+	TimelySource bool
+	TimelyTarget bool
+	TimelyHead   bool
+}
+
+// WriteOnlyParticipation defines a struct which only has write access to participation methods.
+type WriteOnlyParticipation interface {
+	SetCurrentEpochParticipation(val []byte) error
+	SetPreviousEpochParticipation(val []byte) error
+	AppendCurrentParticipationBits(val byte) error
+	AppendPreviousParticipationBits(val byte) error
+	AppendCurrentParticipationBitsBatch(vals []byte) error
+	AppendPreviousParticipationBitsBatch(vals []byte) error
+	SetCurrentEpochParticipationAtIndex(idx uint64, val byte) error
+	SetPreviousEpochParticipationAtIndex(idx uint64, val byte) error
+	ApplyParticipationFlags(indices []uint64, flag int, currentEpoch bool) error
+	ClearParticipationForIndices(indices []uint64, currentEpoch bool) error
+	SwapEpochParticipation() error
+	ResetPreviousEpochParticipation(validatorCount uint64) error
+}
+
+// ReadOnlyInactivityScores defines a struct which only has read access to inactivity score methods.
+type ReadOnlyInactivityScores interface {
+	InactivityScores() ([]uint64, error)
+	InactivityScoresLength() (uint64, error)
+	InactivityScoreStats() (nonZero, max uint64, mean float64, err error)
+}
+
+// WriteOnlyInactivityScores defines a struct which only has write access to inactivity score methods.
+type WriteOnlyInactivityScores interface {
+	AppendInactivityScore(s uint64) error
+	AppendInactivityScores(scores []uint64) error
+	SetInactivityScores(scores []uint64) error
+	UpdateInactivityScoreAtIndex(idx, score uint64) error
+	ApplyInactivityScoreDeltas(deltas map[uint64]int64) error
+	ResetInactivityScoreAtIndex(idx uint64) error
+}
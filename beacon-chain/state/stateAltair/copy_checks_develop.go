@@ -0,0 +1,16 @@
+// +build develop
+
+package stateAltair
+
+import (
+	"fmt"
+)
+
+// checkStateBeforeCopy verifies state invariants whenever a state is copied, to catch
+// bugs where they are introduced. It is only enabled in develop builds.
+// This assumes that a lock is already held on BeaconState.
+func checkStateBeforeCopy(b *BeaconState) {
+	if err := b.validateParticipationLengths(); err != nil {
+		panic(fmt.Sprintf("copying inconsistent beacon state: %v", err))
+	}
+}
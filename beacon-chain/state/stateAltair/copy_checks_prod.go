@@ -0,0 +1,6 @@
+// +build !develop
+
+package stateAltair
+
+// checkStateBeforeCopy is a no-op outside of develop builds.
+func checkStateBeforeCopy(*BeaconState) {}
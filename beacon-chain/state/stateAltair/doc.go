@@ -0,0 +1,9 @@
+// Package stateAltair defines how the beacon chain state for eth2
+// functions in the running beacon node after the Altair hard fork.
+//
+// It follows the same conventions as package stateV0: getters have
+// an external version which carries out the short-circuit conditions and
+// obtains a read lock, and an internal version which assumes the lock is
+// already held by the caller. Setters mark the fields they modify as dirty
+// so that only those fields are re-hashed when computing the hash tree root.
+package stateAltair
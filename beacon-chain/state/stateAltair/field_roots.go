@@ -0,0 +1,175 @@
+package stateAltair
+
+import (
+	"context"
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+	"github.com/prysmaticlabs/prysm/beacon-chain/state/stateutil"
+	pbp2p "github.com/prysmaticlabs/prysm/proto/beacon/p2p/v1"
+	ethpb "github.com/prysmaticlabs/prysm/proto/eth/v1alpha1"
+	"github.com/prysmaticlabs/prysm/shared/bytesutil"
+	"github.com/prysmaticlabs/prysm/shared/hashutil"
+	"github.com/prysmaticlabs/prysm/shared/htrutils"
+	"github.com/prysmaticlabs/prysm/shared/params"
+	"go.opencensus.io/trace"
+)
+
+// computeFieldRoots returns the hash tree root computations of every field in
+// the Altair beacon state as a list of 32 byte roots.
+func computeFieldRoots(ctx context.Context, state *pbp2p.BeaconStateAltair) ([][]byte, error) {
+	ctx, span := trace.StartSpan(ctx, "beaconStateAltair.computeFieldRoots")
+	defer span.End()
+
+	if state == nil {
+		return nil, errors.New("nil state")
+	}
+	fieldRoots := make([][]byte, fieldCount)
+	for i := 0; i < fieldCount; i++ {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		root, err := fieldRoot(state, fieldIndex(i))
+		if err != nil {
+			return nil, err
+		}
+		fieldRoots[i] = root[:]
+	}
+	return fieldRoots, nil
+}
+
+// fieldRoot computes the hash tree root of a single field of the Altair beacon state.
+func fieldRoot(state *pbp2p.BeaconStateAltair, field fieldIndex) ([32]byte, error) {
+	hasher := hashutil.CustomSHA256Hasher()
+	switch field {
+	case genesisTime:
+		return htrutils.Uint64Root(state.GenesisTime), nil
+	case genesisValidatorRoot:
+		return bytesutil.ToBytes32(state.GenesisValidatorsRoot), nil
+	case slot:
+		return htrutils.Uint64Root(uint64(state.Slot)), nil
+	case fork:
+		root, err := htrutils.ForkRoot(state.Fork)
+		return root, errors.Wrap(err, "could not compute fork merkleization")
+	case latestBlockHeader:
+		root, err := stateutil.BlockHeaderRoot(state.LatestBlockHeader)
+		return root, errors.Wrap(err, "could not compute block header merkleization")
+	case blockRoots:
+		root, err := arraysRoot(state.BlockRoots, uint64(params.BeaconConfig().SlotsPerHistoricalRoot))
+		return root, errors.Wrap(err, "could not compute block roots merkleization")
+	case stateRoots:
+		root, err := arraysRoot(state.StateRoots, uint64(params.BeaconConfig().SlotsPerHistoricalRoot))
+		return root, errors.Wrap(err, "could not compute state roots merkleization")
+	case historicalRoots:
+		root, err := htrutils.HistoricalRootsRoot(state.HistoricalRoots)
+		return root, errors.Wrap(err, "could not compute historical roots merkleization")
+	case eth1Data:
+		if state.Eth1Data == nil {
+			return [32]byte{}, errors.New("nil eth1 data")
+		}
+		root, err := stateutil.Eth1DataRootWithHasher(hasher, state.Eth1Data)
+		return root, errors.Wrap(err, "could not compute eth1data merkleization")
+	case eth1DataVotes:
+		root, err := stateutil.Eth1DatasRoot(state.Eth1DataVotes)
+		return root, errors.Wrap(err, "could not compute eth1data votes merkleization")
+	case eth1DepositIndex:
+		return htrutils.Uint64Root(state.Eth1DepositIndex), nil
+	case validators:
+		root, err := validatorRegistryRoot(state.Validators)
+		return root, errors.Wrap(err, "could not compute validator registry merkleization")
+	case balances:
+		root, err := stateutil.Uint64ListRootWithRegistryLimit(state.Balances)
+		return root, errors.Wrap(err, "could not compute validator balances merkleization")
+	case randaoMixes:
+		root, err := arraysRoot(state.RandaoMixes, uint64(params.BeaconConfig().EpochsPerHistoricalVector))
+		return root, errors.Wrap(err, "could not compute randao roots merkleization")
+	case slashings:
+		root, err := htrutils.SlashingsRoot(state.Slashings)
+		return root, errors.Wrap(err, "could not compute slashings merkleization")
+	case previousEpochParticipationBits:
+		root, err := participationBitsRoot(state.PreviousEpochParticipation)
+		return root, errors.Wrap(err, "could not compute previous epoch participation merkleization")
+	case currentEpochParticipationBits:
+		root, err := participationBitsRoot(state.CurrentEpochParticipation)
+		return root, errors.Wrap(err, "could not compute current epoch participation merkleization")
+	case justificationBits:
+		return bytesutil.ToBytes32(state.JustificationBits), nil
+	case previousJustifiedCheckpoint:
+		root, err := htrutils.CheckpointRoot(hasher, state.PreviousJustifiedCheckpoint)
+		return root, errors.Wrap(err, "could not compute previous justified checkpoint merkleization")
+	case currentJustifiedCheckpoint:
+		root, err := htrutils.CheckpointRoot(hasher, state.CurrentJustifiedCheckpoint)
+		return root, errors.Wrap(err, "could not compute current justified checkpoint merkleization")
+	case finalizedCheckpoint:
+		root, err := htrutils.CheckpointRoot(hasher, state.FinalizedCheckpoint)
+		return root, errors.Wrap(err, "could not compute finalized checkpoint merkleization")
+	case inactivityScores:
+		root, err := stateutil.Uint64ListRootWithRegistryLimit(state.InactivityScores)
+		return root, errors.Wrap(err, "could not compute inactivity scores merkleization")
+	case currentSyncCommittee:
+		root, err := syncCommitteeRoot(state.CurrentSyncCommittee)
+		return root, errors.Wrap(err, "could not compute current sync committee merkleization")
+	case nextSyncCommittee:
+		root, err := syncCommitteeRoot(state.NextSyncCommittee)
+		return root, errors.Wrap(err, "could not compute next sync committee merkleization")
+	}
+	return [32]byte{}, errors.New("invalid field index provided")
+}
+
+// arraysRoot computes the hash tree root of a fixed size vector of 32 byte roots.
+func arraysRoot(input [][]byte, length uint64) ([32]byte, error) {
+	hasher := hashutil.CustomSHA256Hasher()
+	leaves := make([][32]byte, length)
+	for i, chunk := range input {
+		if uint64(i) >= length {
+			return [32]byte{}, errors.Errorf("vector of length %d exceeds limit %d", len(input), length)
+		}
+		copy(leaves[i][:], chunk)
+	}
+	return htrutils.BitwiseMerkleizeArrays(hasher, leaves, length, length)
+}
+
+// validatorRegistryRoot computes the hash tree root of the validator registry,
+// mixed in with the number of validators.
+func validatorRegistryRoot(vals []*ethpb.Validator) ([32]byte, error) {
+	hasher := hashutil.CustomSHA256Hasher()
+	roots, err := stateutil.HandleValidatorSlice(vals, nil, true)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	validatorsRootsRoot, err := htrutils.BitwiseMerkleizeArrays(
+		hasher, roots, uint64(len(roots)), params.BeaconConfig().ValidatorRegistryLimit,
+	)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	lengthRoot := make([]byte, 32)
+	binary.LittleEndian.PutUint64(lengthRoot, uint64(len(vals)))
+	return htrutils.MixInLength(validatorsRootsRoot, lengthRoot), nil
+}
+
+// participationBitsRoot computes the hash tree root of a list of participation
+// flags, with one byte per validator, mixed in with the length of the list.
+func participationBitsRoot(bits []byte) ([32]byte, error) {
+	hasher := hashutil.CustomSHA256Hasher()
+	chunks, err := htrutils.Pack([][]byte{bits})
+	if err != nil {
+		return [32]byte{}, err
+	}
+	limit := (params.BeaconConfig().ValidatorRegistryLimit + 31) / 32
+	bitsRoot, err := htrutils.BitwiseMerkleize(hasher, chunks, uint64(len(chunks)), limit)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	lengthRoot := make([]byte, 32)
+	binary.LittleEndian.PutUint64(lengthRoot, uint64(len(bits)))
+	return htrutils.MixInLength(bitsRoot, lengthRoot), nil
+}
+
+// syncCommitteeRoot computes the hash tree root of a sync committee.
+func syncCommitteeRoot(committee *pbp2p.SyncCommittee) ([32]byte, error) {
+	if committee == nil {
+		return [32]byte{}, errors.New("nil sync committee")
+	}
+	return committee.HashTreeRoot()
+}
@@ -0,0 +1,126 @@
+package stateAltair
+
+import (
+	"encoding/binary"
+	"sort"
+
+	"github.com/prysmaticlabs/prysm/beacon-chain/state/stateutil"
+	"github.com/prysmaticlabs/prysm/shared/params"
+)
+
+const (
+	// uint64sPerChunk is the number of uint64 values packed into a single
+	// 32 byte chunk of a merkleized list.
+	uint64sPerChunk = 4
+	// bytesPerChunk is the number of single byte values packed into a single
+	// 32 byte chunk of a merkleized list.
+	bytesPerChunk = 32
+)
+
+// packedListRoot computes the root of a list of basic values packed into 32 byte
+// chunks, such as the inactivity scores or the participation bits. The trie layers
+// of the field are cached, so that only the chunks of the dirty indices are re-hashed.
+// This assumes that a lock is already held on BeaconState.
+func (b *BeaconState) packedListRoot(
+	field fieldIndex,
+	length, elemsPerChunk, limit uint64,
+	chunkAt func(chunkIdx uint64) [32]byte,
+) ([32]byte, error) {
+	if b.rebuildTrie[field] || b.fieldLayers[field] == nil {
+		numChunks := (length + elemsPerChunk - 1) / elemsPerChunk
+		chunks := make([][32]byte, numChunks)
+		for i := uint64(0); i < numChunks; i++ {
+			chunks[i] = chunkAt(i)
+		}
+		layers := stateutil.ReturnTrieLayerVariable(chunks, limit)
+		b.fieldLayers[field] = layers
+		b.dirtyIndices[field] = []uint64{}
+		delete(b.rebuildTrie, field)
+		return stateutil.AddInMixin(*layers[len(layers)-1][0], length)
+	}
+
+	chunkIndices := make([]uint64, 0, len(b.dirtyIndices[field]))
+	seen := make(map[uint64]bool, len(b.dirtyIndices[field]))
+	for _, idx := range b.dirtyIndices[field] {
+		chunkIdx := idx / elemsPerChunk
+		if seen[chunkIdx] {
+			continue
+		}
+		seen[chunkIdx] = true
+		chunkIndices = append(chunkIndices, chunkIdx)
+	}
+	sort.Slice(chunkIndices, func(i, j int) bool {
+		return chunkIndices[i] < chunkIndices[j]
+	})
+
+	layers := b.fieldLayers[field]
+	root := *layers[len(layers)-1][0]
+	if len(chunkIndices) > 0 {
+		chunks := make([][32]byte, len(chunkIndices))
+		for i, chunkIdx := range chunkIndices {
+			chunks[i] = chunkAt(chunkIdx)
+		}
+		var err error
+		root, layers, err = stateutil.RecomputeFromLayerVariable(chunks, chunkIndices, layers)
+		if err != nil {
+			return [32]byte{}, err
+		}
+		b.fieldLayers[field] = layers
+	}
+	b.dirtyIndices[field] = []uint64{}
+	return stateutil.AddInMixin(root, length)
+}
+
+// packedUint64ListRoot computes the root of a list of uint64 values bounded by
+// the validator registry limit.
+// This assumes that a lock is already held on BeaconState.
+func (b *BeaconState) packedUint64ListRoot(field fieldIndex, vals []uint64) ([32]byte, error) {
+	limit := (params.BeaconConfig().ValidatorRegistryLimit*8 + 31) / 32
+	return b.packedListRoot(field, uint64(len(vals)), uint64sPerChunk, limit, func(chunkIdx uint64) [32]byte {
+		return packUint64Chunk(vals, chunkIdx)
+	})
+}
+
+// packedBytesListRoot computes the root of a list of single byte values bounded
+// by the validator registry limit.
+// This assumes that a lock is already held on BeaconState.
+func (b *BeaconState) packedBytesListRoot(field fieldIndex, vals []byte) ([32]byte, error) {
+	limit := (params.BeaconConfig().ValidatorRegistryLimit + 31) / 32
+	return b.packedListRoot(field, uint64(len(vals)), bytesPerChunk, limit, func(chunkIdx uint64) [32]byte {
+		var chunk [32]byte
+		start := chunkIdx * bytesPerChunk
+		if start < uint64(len(vals)) {
+			copy(chunk[:], vals[start:])
+		}
+		return chunk
+	})
+}
+
+// packUint64Chunk returns the 32 byte chunk at the given chunk index of a
+// packed list of uint64 values.
+func packUint64Chunk(vals []uint64, chunkIdx uint64) [32]byte {
+	var chunk [32]byte
+	start := chunkIdx * uint64sPerChunk
+	for i := uint64(0); i < uint64sPerChunk && start+i < uint64(len(vals)); i++ {
+		binary.LittleEndian.PutUint64(chunk[i*8:], vals[start+i])
+	}
+	return chunk
+}
+
+// copyFieldLayers returns a copy of the provided trie layers. The leaves are
+// replaced rather than mutated on recomputation, so the pointers themselves
+// can be shared.
+func copyFieldLayers(layers [][]*[32]byte) [][]*[32]byte {
+	if layers == nil {
+		return nil
+	}
+	dst := make([][]*[32]byte, len(layers))
+	for i, layer := range layers {
+		if layer == nil {
+			continue
+		}
+		dst[i] = make([]*[32]byte, len(layer))
+		copy(dst[i], layer)
+	}
+	return dst
+}
@@ -0,0 +1,60 @@
+package stateAltair
+
+import (
+	"context"
+	"testing"
+
+	pbp2p "github.com/prysmaticlabs/prysm/proto/beacon/p2p/v1"
+	"github.com/prysmaticlabs/prysm/shared/testutil/assert"
+	"github.com/prysmaticlabs/prysm/shared/testutil/require"
+)
+
+func TestBeaconState_ParticipationRootCache(t *testing.T) {
+	ctx := context.Background()
+	participation := make([]byte, 100)
+	for i := range participation {
+		participation[i] = byte(i % 8)
+	}
+	st, err := InitializeFromProto(&pbp2p.BeaconStateAltair{
+		CurrentEpochParticipation: participation,
+	})
+	require.NoError(t, err)
+
+	field := currentEpochParticipationBits
+	root, err := st.rootSelector(ctx, field)
+	require.NoError(t, err)
+	want, err := participationBitsRoot(participation)
+	require.NoError(t, err)
+	assert.Equal(t, want, root)
+	layers := st.fieldLayers[field]
+	require.Equal(t, 4, len(layers[0]))
+	leaves := make([]*[32]byte, len(layers[0]))
+	copy(leaves, layers[0])
+
+	// Without any mutation, the cached trie is reused as is.
+	root, err = st.rootSelector(ctx, field)
+	require.NoError(t, err)
+	assert.Equal(t, want, root)
+	for i := range leaves {
+		assert.Equal(t, leaves[i], st.fieldLayers[field][0][i])
+	}
+
+	// Mutating a single index only invalidates the chunk which contains it.
+	require.NoError(t, st.SetCurrentEpochParticipationAtIndex(40, 7))
+	assert.Equal(t, true, st.dirtyFields[field])
+	assert.DeepEqual(t, []uint64{40}, st.dirtyIndices[field])
+	participation[40] = 7
+	root, err = st.rootSelector(ctx, field)
+	require.NoError(t, err)
+	want, err = participationBitsRoot(participation)
+	require.NoError(t, err)
+	assert.Equal(t, want, root)
+	assert.Equal(t, 0, len(st.dirtyIndices[field]))
+	for i := range leaves {
+		if i == 1 {
+			assert.NotEqual(t, leaves[i], st.fieldLayers[field][0][i])
+			continue
+		}
+		assert.Equal(t, leaves[i], st.fieldLayers[field][0][i])
+	}
+}
@@ -0,0 +1,76 @@
+package stateAltair
+
+import (
+	"math"
+	"math/bits"
+)
+
+// InactivityScores of validators participating in consensus on the beacon chain.
+func (b *BeaconState) InactivityScores() ([]uint64, error) {
+	if !b.hasInnerState() {
+		return nil, ErrNilInnerState
+	}
+	if b.state.InactivityScores == nil {
+		return nil, nil
+	}
+
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	return b.inactivityScores(), nil
+}
+
+// inactivityScores of validators participating in consensus on the beacon chain.
+// This assumes that a lock is already held on BeaconState.
+func (b *BeaconState) inactivityScores() []uint64 {
+	if !b.hasInnerState() {
+		return nil
+	}
+
+	res := make([]uint64, len(b.state.InactivityScores))
+	copy(res, b.state.InactivityScores)
+	return res
+}
+
+// InactivityScoresLength returns the number of inactivity scores in the state,
+// without copying the scores.
+func (b *BeaconState) InactivityScoresLength() (uint64, error) {
+	if !b.hasInnerState() {
+		return 0, ErrNilInnerState
+	}
+
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	return uint64(len(b.state.InactivityScores)), nil
+}
+
+// InactivityScoreStats returns the number of non-zero inactivity scores, the maximum
+// score and the mean score of all validators, computed in a single pass over the scores.
+// The sum of the scores is accumulated in 128 bits, so it cannot overflow.
+func (b *BeaconState) InactivityScoreStats() (nonZero, max uint64, mean float64, err error) {
+	if !b.hasInnerState() {
+		return 0, 0, 0, ErrNilInnerState
+	}
+
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	scores := b.state.InactivityScores
+	if len(scores) == 0 {
+		return 0, 0, 0, nil
+	}
+	var sumHi, sumLo, carry uint64
+	for _, score := range scores {
+		if score != 0 {
+			nonZero++
+		}
+		if score > max {
+			max = score
+		}
+		sumLo, carry = bits.Add64(sumLo, score, 0)
+		sumHi += carry
+	}
+	sum := float64(sumHi)*math.Exp2(64) + float64(sumLo)
+	return nonZero, max, sum / float64(len(scores)), nil
+}
@@ -0,0 +1,155 @@
+package stateAltair
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	iface "github.com/prysmaticlabs/prysm/beacon-chain/state/interface"
+)
+
+// CurrentEpochParticipation corresponding to participation bits on the beacon chain.
+func (b *BeaconState) CurrentEpochParticipation() ([]byte, error) {
+	if !b.hasInnerState() {
+		return nil, ErrNilInnerState
+	}
+	if b.state.CurrentEpochParticipation == nil {
+		return nil, nil
+	}
+
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	return b.currentEpochParticipation(), nil
+}
+
+// PreviousEpochParticipation corresponding to participation bits on the beacon chain.
+func (b *BeaconState) PreviousEpochParticipation() ([]byte, error) {
+	if !b.hasInnerState() {
+		return nil, ErrNilInnerState
+	}
+	if b.state.PreviousEpochParticipation == nil {
+		return nil, nil
+	}
+
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	return b.previousEpochParticipation(), nil
+}
+
+// currentEpochParticipation corresponding to participation bits on the beacon chain.
+// This assumes that a lock is already held on BeaconState.
+func (b *BeaconState) currentEpochParticipation() []byte {
+	if !b.hasInnerState() {
+		return nil
+	}
+	tmp := make([]byte, len(b.state.CurrentEpochParticipation))
+	copy(tmp, b.state.CurrentEpochParticipation)
+	return tmp
+}
+
+// previousEpochParticipation corresponding to participation bits on the beacon chain.
+// This assumes that a lock is already held on BeaconState.
+func (b *BeaconState) previousEpochParticipation() []byte {
+	if !b.hasInnerState() {
+		return nil
+	}
+	tmp := make([]byte, len(b.state.PreviousEpochParticipation))
+	copy(tmp, b.state.PreviousEpochParticipation)
+	return tmp
+}
+
+// CurrentEpochParticipationAtIndex returns the current epoch participation
+// bits of the validator at the given index.
+func (b *BeaconState) CurrentEpochParticipationAtIndex(idx uint64) (byte, error) {
+	if !b.hasInnerState() {
+		return 0, ErrNilInnerState
+	}
+
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	if uint64(len(b.state.CurrentEpochParticipation)) <= idx {
+		return 0, fmt.Errorf("index of %d does not exist", idx)
+	}
+	return b.state.CurrentEpochParticipation[idx], nil
+}
+
+// PreviousEpochParticipationAtIndex returns the previous epoch participation
+// bits of the validator at the given index.
+func (b *BeaconState) PreviousEpochParticipationAtIndex(idx uint64) (byte, error) {
+	if !b.hasInnerState() {
+		return 0, ErrNilInnerState
+	}
+
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	if uint64(len(b.state.PreviousEpochParticipation)) <= idx {
+		return 0, fmt.Errorf("index of %d does not exist", idx)
+	}
+	return b.state.PreviousEpochParticipation[idx], nil
+}
+
+// ParticipationFlagsAtIndex returns the participation flags set in the current epoch
+// participation bits of the validator at the given index.
+func (b *BeaconState) ParticipationFlagsAtIndex(idx uint64) (iface.ParticipationFlags, error) {
+	bits, err := b.CurrentEpochParticipationAtIndex(idx)
+	if err != nil {
+		return iface.ParticipationFlags{}, err
+	}
+	return iface.ParticipationFlags{
+		TimelySource: HasTimelySourceFlag(bits),
+		TimelyTarget: HasTimelyTargetFlag(bits),
+		TimelyHead:   HasTimelyHeadFlag(bits),
+	}, nil
+}
+
+// ValidateParticipationLengths checks that the current and previous epoch participation
+// lists and the inactivity scores list each have exactly one entry per validator in the
+// registry. The returned error names every list of the wrong length and by how much.
+func (b *BeaconState) ValidateParticipationLengths() error {
+	if !b.hasInnerState() {
+		return ErrNilInnerState
+	}
+
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	return b.validateParticipationLengths()
+}
+
+// validateParticipationLengths checks the participation and inactivity score list
+// lengths against the validator count.
+// This assumes that a lock is already held on BeaconState.
+func (b *BeaconState) validateParticipationLengths() error {
+	numValidators := len(b.state.Validators)
+	lists := []struct {
+		name   string
+		length int
+	}{
+		{"current epoch participation", len(b.state.CurrentEpochParticipation)},
+		{"previous epoch participation", len(b.state.PreviousEpochParticipation)},
+		{"inactivity scores", len(b.state.InactivityScores)},
+	}
+	mismatches := make([]string, 0)
+	for _, list := range lists {
+		switch {
+		case list.length < numValidators:
+			mismatches = append(mismatches, fmt.Sprintf(
+				"%s has %d entries, %d fewer than the %d validators",
+				list.name, list.length, numValidators-list.length, numValidators,
+			))
+		case list.length > numValidators:
+			mismatches = append(mismatches, fmt.Sprintf(
+				"%s has %d entries, %d more than the %d validators",
+				list.name, list.length, list.length-numValidators, numValidators,
+			))
+		}
+	}
+	if len(mismatches) > 0 {
+		return errors.New(strings.Join(mismatches, "; "))
+	}
+	return nil
+}
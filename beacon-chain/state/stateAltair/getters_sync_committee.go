@@ -0,0 +1,222 @@
+package stateAltair
+
+import (
+	"bytes"
+	"fmt"
+	"math/bits"
+
+	"github.com/pkg/errors"
+	pbp2p "github.com/prysmaticlabs/prysm/proto/beacon/p2p/v1"
+	"github.com/prysmaticlabs/prysm/shared/bytesutil"
+	"google.golang.org/protobuf/proto"
+)
+
+// CurrentSyncCommittee of the current sync committee in beacon chain state.
+func (b *BeaconState) CurrentSyncCommittee() (*pbp2p.SyncCommittee, error) {
+	if !b.hasInnerState() {
+		return nil, ErrNilInnerState
+	}
+
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	return b.currentSyncCommittee(), nil
+}
+
+// currentSyncCommittee of the current sync committee in beacon chain state.
+// This assumes that a lock is already held on BeaconState.
+func (b *BeaconState) currentSyncCommittee() *pbp2p.SyncCommittee {
+	if !b.hasInnerState() {
+		return nil
+	}
+
+	return copySyncCommittee(b.state.CurrentSyncCommittee)
+}
+
+// CurrentSyncCommitteeAggregatePubkey returns a copy of the aggregate public key of the
+// current sync committee, without copying the rest of the committee.
+func (b *BeaconState) CurrentSyncCommitteeAggregatePubkey() ([48]byte, error) {
+	if !b.hasInnerState() {
+		return [48]byte{}, ErrNilInnerState
+	}
+
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	return syncCommitteeAggregatePubkey(b.state.CurrentSyncCommittee)
+}
+
+// CurrentSyncCommitteeIndices returns all the positions at which the given public key
+// appears in the current sync committee. A validator that is not a member of the
+// committee receives an empty slice.
+func (b *BeaconState) CurrentSyncCommitteeIndices(pubKey [48]byte) ([]uint64, error) {
+	if !b.hasInnerState() {
+		return nil, ErrNilInnerState
+	}
+
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	return syncCommitteeIndices(b.state.CurrentSyncCommittee, pubKey), nil
+}
+
+// CurrentSyncCommitteePubkeyAtIndex returns a copy of the public key at the given position
+// of the current sync committee, without copying the rest of the committee.
+func (b *BeaconState) CurrentSyncCommitteePubkeyAtIndex(idx uint64) ([48]byte, error) {
+	if !b.hasInnerState() {
+		return [48]byte{}, ErrNilInnerState
+	}
+
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	return syncCommitteePubkeyAtIndex(b.state.CurrentSyncCommittee, idx)
+}
+
+// SyncCommitteeParticipantCount returns the number of participants set in a sync
+// aggregate bitfield for the current sync committee. The bitfield must have exactly
+// one bit per committee member, so an aggregate of the wrong length is rejected.
+func (b *BeaconState) SyncCommitteeParticipantCount(bitfield []byte) (uint64, error) {
+	if !b.hasInnerState() {
+		return 0, ErrNilInnerState
+	}
+
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	committee := b.state.CurrentSyncCommittee
+	if committee == nil {
+		return 0, errors.New("current sync committee is nil")
+	}
+	size := len(committee.Pubkeys)
+	if wanted := (size + 7) / 8; len(bitfield) != wanted {
+		return 0, fmt.Errorf("sync aggregate bitfield has length %d, wanted %d for committee size %d", len(bitfield), wanted, size)
+	}
+	// Bits in the last byte past the end of the committee must not be set.
+	if rem := size % 8; rem != 0 && bitfield[len(bitfield)-1]>>rem != 0 {
+		return 0, fmt.Errorf("sync aggregate bitfield has bits set beyond committee size %d", size)
+	}
+
+	count := uint64(0)
+	for _, by := range bitfield {
+		count += uint64(bits.OnesCount8(by))
+	}
+	return count, nil
+}
+
+// NextSyncCommittee of the next sync committee in beacon chain state.
+func (b *BeaconState) NextSyncCommittee() (*pbp2p.SyncCommittee, error) {
+	if !b.hasInnerState() {
+		return nil, ErrNilInnerState
+	}
+
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	return b.nextSyncCommittee(), nil
+}
+
+// nextSyncCommittee of the next sync committee in beacon chain state.
+// This assumes that a lock is already held on BeaconState.
+func (b *BeaconState) nextSyncCommittee() *pbp2p.SyncCommittee {
+	if !b.hasInnerState() {
+		return nil
+	}
+
+	return copySyncCommittee(b.state.NextSyncCommittee)
+}
+
+// NextSyncCommitteeIndices returns all the positions at which the given public key
+// appears in the next sync committee, so that duties can be prepared before the
+// committees rotate. A validator that is not a member of the committee receives an
+// empty slice.
+func (b *BeaconState) NextSyncCommitteeIndices(pubKey [48]byte) ([]uint64, error) {
+	if !b.hasInnerState() {
+		return nil, ErrNilInnerState
+	}
+
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	return syncCommitteeIndices(b.state.NextSyncCommittee, pubKey), nil
+}
+
+// NextSyncCommitteePubkeyAtIndex returns a copy of the public key at the given position
+// of the next sync committee, without copying the rest of the committee.
+func (b *BeaconState) NextSyncCommitteePubkeyAtIndex(idx uint64) ([48]byte, error) {
+	if !b.hasInnerState() {
+		return [48]byte{}, ErrNilInnerState
+	}
+
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	return syncCommitteePubkeyAtIndex(b.state.NextSyncCommittee, idx)
+}
+
+// NextSyncCommitteeAggregatePubkey returns a copy of the aggregate public key of the
+// next sync committee, without copying the rest of the committee.
+func (b *BeaconState) NextSyncCommitteeAggregatePubkey() ([48]byte, error) {
+	if !b.hasInnerState() {
+		return [48]byte{}, ErrNilInnerState
+	}
+
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	return syncCommitteeAggregatePubkey(b.state.NextSyncCommittee)
+}
+
+// syncCommitteeIndices returns the positions at which the public key appears in a sync
+// committee, which is an empty slice for a nil committee.
+func syncCommitteeIndices(committee *pbp2p.SyncCommittee, pubKey [48]byte) []uint64 {
+	indices := make([]uint64, 0)
+	if committee == nil {
+		return indices
+	}
+	for i, pk := range committee.Pubkeys {
+		if bytes.Equal(pk, pubKey[:]) {
+			indices = append(indices, uint64(i))
+		}
+	}
+	return indices
+}
+
+// syncCommitteePubkeyAtIndex copies the public key at the given position of a sync
+// committee into a fixed size array, checking the position against the committee size.
+func syncCommitteePubkeyAtIndex(committee *pbp2p.SyncCommittee, idx uint64) ([48]byte, error) {
+	if committee == nil {
+		return [48]byte{}, errors.New("sync committee is nil")
+	}
+	if uint64(len(committee.Pubkeys)) <= idx {
+		return [48]byte{}, fmt.Errorf("index %d is out of range for sync committee size %d", idx, len(committee.Pubkeys))
+	}
+	pubKey := committee.Pubkeys[idx]
+	if len(pubKey) != 48 {
+		return [48]byte{}, fmt.Errorf("sync committee public key at index %d has length %d, wanted 48", idx, len(pubKey))
+	}
+	return bytesutil.ToBytes48(pubKey), nil
+}
+
+// syncCommitteeAggregatePubkey copies the aggregate public key of a sync committee
+// into a fixed size array.
+func syncCommitteeAggregatePubkey(committee *pbp2p.SyncCommittee) ([48]byte, error) {
+	if committee == nil {
+		return [48]byte{}, errors.New("sync committee is nil")
+	}
+	if len(committee.AggregatePubkey) != 48 {
+		return [48]byte{}, fmt.Errorf(
+			"sync committee aggregate public key has length %d, wanted 48", len(committee.AggregatePubkey),
+		)
+	}
+	return bytesutil.ToBytes48(committee.AggregatePubkey), nil
+}
+
+// copySyncCommittee returns a deep copy of the provided sync committee,
+// so that callers cannot mutate the committee held by the state.
+func copySyncCommittee(committee *pbp2p.SyncCommittee) *pbp2p.SyncCommittee {
+	if committee == nil {
+		return nil
+	}
+	return proto.Clone(committee).(*pbp2p.SyncCommittee)
+}
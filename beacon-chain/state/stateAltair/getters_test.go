@@ -0,0 +1,325 @@
+package stateAltair_test
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	iface "github.com/prysmaticlabs/prysm/beacon-chain/state/interface"
+	"github.com/prysmaticlabs/prysm/beacon-chain/state/stateAltair"
+	pbp2p "github.com/prysmaticlabs/prysm/proto/beacon/p2p/v1"
+	"github.com/prysmaticlabs/prysm/shared/testutil/assert"
+	"github.com/prysmaticlabs/prysm/shared/testutil/require"
+)
+
+func TestBeaconState_NextSyncCommittee(t *testing.T) {
+	st, err := stateAltair.InitializeFromProto(&pbp2p.BeaconStateAltair{})
+	require.NoError(t, err)
+
+	committee, err := st.NextSyncCommittee()
+	require.NoError(t, err)
+	assert.Equal(t, (*pbp2p.SyncCommittee)(nil), committee)
+
+	want := testSyncCommittee(5)
+	require.NoError(t, st.SetNextSyncCommittee(want))
+	committee, err = st.NextSyncCommittee()
+	require.NoError(t, err)
+	assert.DeepEqual(t, want, committee)
+
+	// Mutating the returned committee should not mutate the state.
+	committee.AggregatePubkey[0] = 0xff
+	committee.Pubkeys[0][0] = 0xff
+	committee, err = st.NextSyncCommittee()
+	require.NoError(t, err)
+	assert.DeepEqual(t, want, committee)
+
+	// Mutating the committee passed to the setter should not mutate the state.
+	want.Pubkeys[1][0] = 0xff
+	committee, err = st.NextSyncCommittee()
+	require.NoError(t, err)
+	assert.DeepEqual(t, testSyncCommittee(5), committee)
+}
+
+func TestBeaconState_CurrentSyncCommitteeIndices(t *testing.T) {
+	st, err := stateAltair.InitializeFromProto(&pbp2p.BeaconStateAltair{})
+	require.NoError(t, err)
+
+	var member, nonMember [48]byte
+	for i := range member {
+		member[i] = 7
+		nonMember[i] = 8
+	}
+
+	// No committee set yet.
+	indices, err := st.CurrentSyncCommitteeIndices(member)
+	require.NoError(t, err)
+	assert.DeepEqual(t, []uint64{}, indices)
+
+	committee := testSyncCommittee(1)
+	committee.Pubkeys[3] = member[:]
+	committee.Pubkeys[100] = member[:]
+	committee.Pubkeys[511] = member[:]
+	require.NoError(t, st.SetCurrentSyncCommittee(committee))
+
+	indices, err = st.CurrentSyncCommitteeIndices(member)
+	require.NoError(t, err)
+	assert.DeepEqual(t, []uint64{3, 100, 511}, indices)
+
+	indices, err = st.CurrentSyncCommitteeIndices(nonMember)
+	require.NoError(t, err)
+	assert.DeepEqual(t, []uint64{}, indices)
+}
+
+func TestBeaconState_NextSyncCommitteeIndices(t *testing.T) {
+	st, err := stateAltair.InitializeFromProto(&pbp2p.BeaconStateAltair{})
+	require.NoError(t, err)
+
+	var member [48]byte
+	for i := range member {
+		member[i] = 7
+	}
+
+	// No committee set yet.
+	indices, err := st.NextSyncCommitteeIndices(member)
+	require.NoError(t, err)
+	assert.DeepEqual(t, []uint64{}, indices)
+
+	current := testSyncCommittee(1)
+	current.Pubkeys[3] = member[:]
+	next := testSyncCommittee(1)
+	next.Pubkeys[42] = member[:]
+	next.Pubkeys[300] = member[:]
+	require.NoError(t, st.SetSyncCommittees(current, next))
+
+	// Only membership in the next committee is reported.
+	indices, err = st.NextSyncCommitteeIndices(member)
+	require.NoError(t, err)
+	assert.DeepEqual(t, []uint64{42, 300}, indices)
+
+	require.NoError(t, st.SetNextSyncCommittee(testSyncCommittee(1)))
+	indices, err = st.NextSyncCommitteeIndices(member)
+	require.NoError(t, err)
+	assert.DeepEqual(t, []uint64{}, indices)
+}
+
+func TestBeaconState_SyncCommitteeParticipantCount(t *testing.T) {
+	st, err := stateAltair.InitializeFromProto(&pbp2p.BeaconStateAltair{})
+	require.NoError(t, err)
+	_, err = st.SyncCommitteeParticipantCount(make([]byte, syncCommitteeSize/8))
+	assert.ErrorContains(t, "current sync committee is nil", err)
+
+	require.NoError(t, st.SetCurrentSyncCommittee(testSyncCommittee(1)))
+	bitfield := make([]byte, syncCommitteeSize/8)
+	count, err := st.SyncCommitteeParticipantCount(bitfield)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), count)
+
+	bitfield[0] = 0b10110001
+	bitfield[len(bitfield)-1] = 0xFF
+	count, err = st.SyncCommitteeParticipantCount(bitfield)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(12), count)
+
+	// Mismatched lengths are rejected rather than truncated.
+	_, err = st.SyncCommitteeParticipantCount(bitfield[1:])
+	assert.ErrorContains(t, "wanted 64 for committee size 512", err)
+	_, err = st.SyncCommitteeParticipantCount(append(bitfield, 1))
+	assert.ErrorContains(t, "wanted 64 for committee size 512", err)
+
+	// Bits beyond the end of a committee that does not fill its last byte are rejected.
+	committee := testSyncCommittee(1)
+	committee.Pubkeys = committee.Pubkeys[:10]
+	st, err = stateAltair.InitializeFromProto(&pbp2p.BeaconStateAltair{CurrentSyncCommittee: committee})
+	require.NoError(t, err)
+	count, err = st.SyncCommitteeParticipantCount([]byte{0xFF, 0b11})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(10), count)
+	_, err = st.SyncCommitteeParticipantCount([]byte{0xFF, 0b111})
+	assert.ErrorContains(t, "bits set beyond committee size 10", err)
+}
+
+func TestBeaconState_SyncCommitteeAggregatePubkey(t *testing.T) {
+	st, err := stateAltair.InitializeFromProto(&pbp2p.BeaconStateAltair{})
+	require.NoError(t, err)
+	_, err = st.CurrentSyncCommitteeAggregatePubkey()
+	assert.ErrorContains(t, "sync committee is nil", err)
+	_, err = st.NextSyncCommitteeAggregatePubkey()
+	assert.ErrorContains(t, "sync committee is nil", err)
+
+	require.NoError(t, st.SetCurrentSyncCommittee(testSyncCommittee(1)))
+	require.NoError(t, st.SetNextSyncCommittee(testSyncCommittee(2)))
+	current, err := st.CurrentSyncCommitteeAggregatePubkey()
+	require.NoError(t, err)
+	assert.Equal(t, [48]byte{1}, current)
+	next, err := st.NextSyncCommitteeAggregatePubkey()
+	require.NoError(t, err)
+	assert.Equal(t, [48]byte{2}, next)
+
+	// Mutating the returned key does not mutate the state.
+	current[0] = 0xff
+	current, err = st.CurrentSyncCommitteeAggregatePubkey()
+	require.NoError(t, err)
+	assert.Equal(t, [48]byte{1}, current)
+}
+
+func TestBeaconState_SyncCommitteePubkeyAtIndex(t *testing.T) {
+	st, err := stateAltair.InitializeFromProto(&pbp2p.BeaconStateAltair{})
+	require.NoError(t, err)
+	_, err = st.CurrentSyncCommitteePubkeyAtIndex(0)
+	assert.ErrorContains(t, "sync committee is nil", err)
+	_, err = st.NextSyncCommitteePubkeyAtIndex(0)
+	assert.ErrorContains(t, "sync committee is nil", err)
+
+	current := testSyncCommittee(1)
+	current.Pubkeys[5][0] = 0xff
+	next := testSyncCommittee(2)
+	next.Pubkeys[syncCommitteeSize-1][0] = 0xee
+	require.NoError(t, st.SetSyncCommittees(current, next))
+
+	pubKey, err := st.CurrentSyncCommitteePubkeyAtIndex(5)
+	require.NoError(t, err)
+	assert.DeepEqual(t, current.Pubkeys[5], pubKey[:])
+	pubKey, err = st.NextSyncCommitteePubkeyAtIndex(syncCommitteeSize - 1)
+	require.NoError(t, err)
+	assert.DeepEqual(t, next.Pubkeys[syncCommitteeSize-1], pubKey[:])
+
+	// Positions past the end of the committee are rejected.
+	_, err = st.CurrentSyncCommitteePubkeyAtIndex(syncCommitteeSize)
+	assert.ErrorContains(t, "index 512 is out of range for sync committee size 512", err)
+	_, err = st.NextSyncCommitteePubkeyAtIndex(math.MaxUint64)
+	assert.ErrorContains(t, "is out of range for sync committee size 512", err)
+
+	// Mutating the returned key does not mutate the state.
+	pubKey[0] = 0
+	pubKey, err = st.NextSyncCommitteePubkeyAtIndex(syncCommitteeSize - 1)
+	require.NoError(t, err)
+	assert.Equal(t, byte(0xee), pubKey[0])
+}
+
+func TestBeaconState_SyncCommittees_NilInnerState(t *testing.T) {
+	st := &stateAltair.BeaconState{}
+	_, err := st.CurrentSyncCommittee()
+	assert.ErrorContains(t, stateAltair.ErrNilInnerState.Error(), err)
+	_, err = st.NextSyncCommittee()
+	assert.ErrorContains(t, stateAltair.ErrNilInnerState.Error(), err)
+	_, err = st.CurrentSyncCommitteeIndices([48]byte{})
+	assert.ErrorContains(t, stateAltair.ErrNilInnerState.Error(), err)
+	_, err = st.NextSyncCommitteeIndices([48]byte{})
+	assert.ErrorContains(t, stateAltair.ErrNilInnerState.Error(), err)
+	_, err = st.SyncCommitteeParticipantCount(nil)
+	assert.ErrorContains(t, stateAltair.ErrNilInnerState.Error(), err)
+	_, err = st.CurrentSyncCommitteeAggregatePubkey()
+	assert.ErrorContains(t, stateAltair.ErrNilInnerState.Error(), err)
+	_, err = st.NextSyncCommitteeAggregatePubkey()
+	assert.ErrorContains(t, stateAltair.ErrNilInnerState.Error(), err)
+	_, err = st.CurrentSyncCommitteePubkeyAtIndex(0)
+	assert.ErrorContains(t, stateAltair.ErrNilInnerState.Error(), err)
+	_, err = st.NextSyncCommitteePubkeyAtIndex(0)
+	assert.ErrorContains(t, stateAltair.ErrNilInnerState.Error(), err)
+	assert.ErrorContains(t, stateAltair.ErrNilInnerState.Error(), st.SetNextSyncCommittee(testSyncCommittee(1)))
+}
+
+func TestBeaconState_EpochParticipationAtIndex(t *testing.T) {
+	st, err := stateAltair.InitializeFromProto(&pbp2p.BeaconStateAltair{
+		PreviousEpochParticipation: []byte{1, 2, 3},
+		CurrentEpochParticipation:  []byte{4, 5},
+	})
+	require.NoError(t, err)
+
+	bits, err := st.PreviousEpochParticipationAtIndex(2)
+	require.NoError(t, err)
+	assert.Equal(t, byte(3), bits)
+	bits, err = st.CurrentEpochParticipationAtIndex(1)
+	require.NoError(t, err)
+	assert.Equal(t, byte(5), bits)
+
+	_, err = st.PreviousEpochParticipationAtIndex(3)
+	assert.ErrorContains(t, "index of 3 does not exist", err)
+	_, err = st.CurrentEpochParticipationAtIndex(2)
+	assert.ErrorContains(t, "index of 2 does not exist", err)
+}
+
+func TestBeaconState_ParticipationFlagsAtIndex(t *testing.T) {
+	st, err := stateAltair.InitializeFromProto(&pbp2p.BeaconStateAltair{
+		PreviousEpochParticipation: []byte{0b111, 0b111},
+		CurrentEpochParticipation:  []byte{0b000, 0b101, 0b11111010},
+	})
+	require.NoError(t, err)
+
+	flags, err := st.ParticipationFlagsAtIndex(0)
+	require.NoError(t, err)
+	assert.Equal(t, iface.ParticipationFlags{}, flags)
+	flags, err = st.ParticipationFlagsAtIndex(1)
+	require.NoError(t, err)
+	assert.Equal(t, iface.ParticipationFlags{TimelySource: true, TimelyHead: true}, flags)
+	// Bits outside of the participation flags are ignored.
+	flags, err = st.ParticipationFlagsAtIndex(2)
+	require.NoError(t, err)
+	assert.Equal(t, iface.ParticipationFlags{TimelyTarget: true}, flags)
+
+	_, err = st.ParticipationFlagsAtIndex(3)
+	assert.ErrorContains(t, "index of 3 does not exist", err)
+}
+
+func TestBeaconState_ValidateParticipationLengths(t *testing.T) {
+	st, err := stateAltair.InitializeFromProto(testAltairState(t, 10))
+	require.NoError(t, err)
+	require.NoError(t, st.ValidateParticipationLengths())
+
+	pbState := testAltairState(t, 10)
+	pbState.CurrentEpochParticipation = pbState.CurrentEpochParticipation[:9]
+	pbState.InactivityScores = append(pbState.InactivityScores, 0, 0)
+	st, err = stateAltair.InitializeFromProto(pbState)
+	require.NoError(t, err)
+	err = st.ValidateParticipationLengths()
+	assert.ErrorContains(t, "current epoch participation has 9 entries, 1 fewer than the 10 validators", err)
+	assert.ErrorContains(t, "inactivity scores has 12 entries, 2 more than the 10 validators", err)
+	assert.Equal(t, false, strings.Contains(err.Error(), "previous epoch participation"))
+
+	assert.ErrorContains(t, stateAltair.ErrNilInnerState.Error(), (&stateAltair.BeaconState{}).ValidateParticipationLengths())
+}
+
+func TestBeaconState_InactivityScoresLength(t *testing.T) {
+	st, err := stateAltair.InitializeFromProto(&pbp2p.BeaconStateAltair{})
+	require.NoError(t, err)
+	length, err := st.InactivityScoresLength()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), length)
+
+	require.NoError(t, st.SetInactivityScores([]uint64{1, 2, 3}))
+	require.NoError(t, st.AppendInactivityScore(4))
+	length, err = st.InactivityScoresLength()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), length)
+
+	_, err = (&stateAltair.BeaconState{}).InactivityScoresLength()
+	assert.ErrorContains(t, stateAltair.ErrNilInnerState.Error(), err)
+}
+
+func TestBeaconState_InactivityScoreStats(t *testing.T) {
+	st, err := stateAltair.InitializeFromProto(&pbp2p.BeaconStateAltair{})
+	require.NoError(t, err)
+	nonZero, max, mean, err := st.InactivityScoreStats()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), nonZero)
+	assert.Equal(t, uint64(0), max)
+	assert.Equal(t, float64(0), mean)
+
+	require.NoError(t, st.SetInactivityScores([]uint64{0, 4, 0, 8}))
+	nonZero, max, mean, err = st.InactivityScoreStats()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), nonZero)
+	assert.Equal(t, uint64(8), max)
+	assert.Equal(t, float64(3), mean)
+
+	// The sum of the scores overflows a uint64.
+	require.NoError(t, st.SetInactivityScores([]uint64{math.MaxUint64, math.MaxUint64}))
+	nonZero, max, mean, err = st.InactivityScoreStats()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), nonZero)
+	assert.Equal(t, uint64(math.MaxUint64), max)
+	assert.Equal(t, float64(math.MaxUint64), mean)
+
+	_, _, _, err = (&stateAltair.BeaconState{}).InactivityScoreStats()
+	assert.ErrorContains(t, stateAltair.ErrNilInnerState.Error(), err)
+}
@@ -0,0 +1,100 @@
+package stateAltair_test
+
+import (
+	"testing"
+
+	pbp2p "github.com/prysmaticlabs/prysm/proto/beacon/p2p/v1"
+	ethpb "github.com/prysmaticlabs/prysm/proto/eth/v1alpha1"
+	"github.com/prysmaticlabs/prysm/shared/params"
+)
+
+const syncCommitteeSize = 512
+
+// testAltairState returns a fully populated Altair beacon state protobuf
+// with the given number of validators.
+func testAltairState(t testing.TB, numValidators int) *pbp2p.BeaconStateAltair {
+	cfg := params.BeaconConfig()
+	zeroRoots := func(n uint64) [][]byte {
+		roots := make([][]byte, n)
+		for i := range roots {
+			roots[i] = make([]byte, 32)
+		}
+		return roots
+	}
+
+	vals := make([]*ethpb.Validator, numValidators)
+	balances := make([]uint64, numValidators)
+	scores := make([]uint64, numValidators)
+	previousParticipation := make([]byte, numValidators)
+	currentParticipation := make([]byte, numValidators)
+	for i := 0; i < numValidators; i++ {
+		pubKey := make([]byte, cfg.BLSPubkeyLength)
+		pubKey[0] = byte(i)
+		vals[i] = &ethpb.Validator{
+			PublicKey:                  pubKey,
+			WithdrawalCredentials:      make([]byte, 32),
+			EffectiveBalance:           cfg.MaxEffectiveBalance,
+			ActivationEligibilityEpoch: cfg.FarFutureEpoch,
+			ActivationEpoch:            cfg.FarFutureEpoch,
+			ExitEpoch:                  cfg.FarFutureEpoch,
+			WithdrawableEpoch:          cfg.FarFutureEpoch,
+		}
+		balances[i] = cfg.MaxEffectiveBalance
+		scores[i] = uint64(i)
+		previousParticipation[i] = byte(i % 8)
+		currentParticipation[i] = byte(i % 4)
+	}
+
+	return &pbp2p.BeaconStateAltair{
+		GenesisValidatorsRoot: make([]byte, 32),
+		Slot:                  5,
+		Fork: &pbp2p.Fork{
+			PreviousVersion: make([]byte, 4),
+			CurrentVersion:  make([]byte, 4),
+		},
+		LatestBlockHeader: &ethpb.BeaconBlockHeader{
+			ParentRoot: make([]byte, 32),
+			StateRoot:  make([]byte, 32),
+			BodyRoot:   make([]byte, 32),
+		},
+		BlockRoots:      zeroRoots(uint64(cfg.SlotsPerHistoricalRoot)),
+		StateRoots:      zeroRoots(uint64(cfg.SlotsPerHistoricalRoot)),
+		HistoricalRoots: [][]byte{},
+		Eth1Data: &ethpb.Eth1Data{
+			DepositRoot: make([]byte, 32),
+			BlockHash:   make([]byte, 32),
+		},
+		Eth1DataVotes:               []*ethpb.Eth1Data{},
+		Validators:                  vals,
+		Balances:                    balances,
+		RandaoMixes:                 zeroRoots(uint64(cfg.EpochsPerHistoricalVector)),
+		Slashings:                   make([]uint64, cfg.EpochsPerSlashingsVector),
+		PreviousEpochParticipation:  previousParticipation,
+		CurrentEpochParticipation:   currentParticipation,
+		JustificationBits:           []byte{0},
+		PreviousJustifiedCheckpoint: &ethpb.Checkpoint{Root: make([]byte, 32)},
+		CurrentJustifiedCheckpoint:  &ethpb.Checkpoint{Root: make([]byte, 32)},
+		FinalizedCheckpoint:         &ethpb.Checkpoint{Root: make([]byte, 32)},
+		InactivityScores:            scores,
+		CurrentSyncCommittee:        testSyncCommittee(1),
+		NextSyncCommittee:           testSyncCommittee(2),
+	}
+}
+
+// testSyncCommittee returns a sync committee whose public keys are all
+// filled with the given byte.
+func testSyncCommittee(fill byte) *pbp2p.SyncCommittee {
+	pubKeys := make([][]byte, syncCommitteeSize)
+	for i := range pubKeys {
+		pubKeys[i] = make([]byte, params.BeaconConfig().BLSPubkeyLength)
+		for j := range pubKeys[i] {
+			pubKeys[i][j] = fill
+		}
+	}
+	aggregate := make([]byte, params.BeaconConfig().BLSPubkeyLength)
+	aggregate[0] = fill
+	return &pbp2p.SyncCommittee{
+		Pubkeys:         pubKeys,
+		AggregatePubkey: aggregate,
+	}
+}
@@ -0,0 +1,37 @@
+package stateAltair
+
+// Participation flag indices, as defined in the Altair consensus specification. Each
+// flag occupies the bit at its index in a validator's epoch participation byte.
+const (
+	TimelySourceFlagIndex = 0
+	TimelyTargetFlagIndex = 1
+	TimelyHeadFlagIndex   = 2
+)
+
+// HasTimelySourceFlag returns true if the timely source flag is set in the participation bits.
+func HasTimelySourceFlag(b byte) bool {
+	return HasFlag(b, TimelySourceFlagIndex)
+}
+
+// HasTimelyTargetFlag returns true if the timely target flag is set in the participation bits.
+func HasTimelyTargetFlag(b byte) bool {
+	return HasFlag(b, TimelyTargetFlagIndex)
+}
+
+// HasTimelyHeadFlag returns true if the timely head flag is set in the participation bits.
+func HasTimelyHeadFlag(b byte) bool {
+	return HasFlag(b, TimelyHeadFlagIndex)
+}
+
+// HasFlag returns true if the flag at the given index is set in the participation bits.
+// The flag index is expected to be one of the participation flag indices defined above.
+func HasFlag(b byte, flag int) bool {
+	f := byte(1 << flag)
+	return b&f == f
+}
+
+// AddFlag returns the participation bits with the flag at the given index set.
+// The flag index is expected to be one of the participation flag indices defined above.
+func AddFlag(b byte, flag int) byte {
+	return b | byte(1<<flag)
+}
@@ -0,0 +1,56 @@
+package stateAltair_test
+
+import (
+	"testing"
+
+	"github.com/prysmaticlabs/prysm/beacon-chain/state/stateAltair"
+	"github.com/prysmaticlabs/prysm/shared/testutil/assert"
+)
+
+func TestParticipationFlags_BitPositions(t *testing.T) {
+	// Flag indices from the Altair specification.
+	assert.Equal(t, 0, stateAltair.TimelySourceFlagIndex)
+	assert.Equal(t, 1, stateAltair.TimelyTargetFlagIndex)
+	assert.Equal(t, 2, stateAltair.TimelyHeadFlagIndex)
+
+	assert.Equal(t, byte(0b001), stateAltair.AddFlag(0, stateAltair.TimelySourceFlagIndex))
+	assert.Equal(t, byte(0b010), stateAltair.AddFlag(0, stateAltair.TimelyTargetFlagIndex))
+	assert.Equal(t, byte(0b100), stateAltair.AddFlag(0, stateAltair.TimelyHeadFlagIndex))
+}
+
+func TestParticipationFlags_HasFlag(t *testing.T) {
+	tests := []struct {
+		name   string
+		b      byte
+		source bool
+		target bool
+		head   bool
+	}{
+		{name: "none", b: 0b000},
+		{name: "source", b: 0b001, source: true},
+		{name: "target", b: 0b010, target: true},
+		{name: "head", b: 0b100, head: true},
+		{name: "source and head", b: 0b101, source: true, head: true},
+		{name: "all", b: 0b111, source: true, target: true, head: true},
+		{name: "unrelated bits", b: 0b11111000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.source, stateAltair.HasTimelySourceFlag(tt.b))
+			assert.Equal(t, tt.target, stateAltair.HasTimelyTargetFlag(tt.b))
+			assert.Equal(t, tt.head, stateAltair.HasTimelyHeadFlag(tt.b))
+		})
+	}
+}
+
+func TestParticipationFlags_AddFlag(t *testing.T) {
+	b := stateAltair.AddFlag(0, stateAltair.TimelyTargetFlagIndex)
+	b = stateAltair.AddFlag(b, stateAltair.TimelyHeadFlagIndex)
+	assert.Equal(t, false, stateAltair.HasTimelySourceFlag(b))
+	assert.Equal(t, true, stateAltair.HasTimelyTargetFlag(b))
+	assert.Equal(t, true, stateAltair.HasTimelyHeadFlag(b))
+
+	// Adding an already set flag is a no-op.
+	assert.Equal(t, b, stateAltair.AddFlag(b, stateAltair.TimelyHeadFlagIndex))
+	assert.Equal(t, byte(0b111), stateAltair.AddFlag(b, stateAltair.TimelySourceFlagIndex))
+}
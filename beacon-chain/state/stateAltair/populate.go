@@ -0,0 +1,62 @@
+package stateAltair
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	pbp2p "github.com/prysmaticlabs/prysm/proto/beacon/p2p/v1"
+)
+
+// AltairFields holds the fields introduced to the beacon state in the Altair hard
+// fork, as decoded from the consensus spec test fixtures.
+type AltairFields struct {
+	CurrentSyncCommittee       *pbp2p.SyncCommittee
+	NextSyncCommittee          *pbp2p.SyncCommittee
+	PreviousEpochParticipation []byte
+	CurrentEpochParticipation  []byte
+	InactivityScores           []uint64
+}
+
+// PopulateAltairFields sets the Altair fields of the beacon state through the regular
+// setters, so that a state loaded from spec test vectors goes through the same
+// validation as one built by the node. The participation and inactivity score lists
+// must have exactly one entry per validator in the registry of the state.
+func PopulateAltairFields(st *BeaconState, fields *AltairFields) error {
+	if st == nil || !st.hasInnerState() {
+		return ErrNilInnerState
+	}
+	if fields == nil {
+		return errors.New("nil altair fields")
+	}
+	st.lock.RLock()
+	numValidators := len(st.state.Validators)
+	st.lock.RUnlock()
+
+	if err := st.SetSyncCommittees(fields.CurrentSyncCommittee, fields.NextSyncCommittee); err != nil {
+		return err
+	}
+	if err := validateListLength("previous epoch participation", len(fields.PreviousEpochParticipation), numValidators); err != nil {
+		return err
+	}
+	if err := st.SetPreviousEpochParticipation(fields.PreviousEpochParticipation); err != nil {
+		return err
+	}
+	if err := validateListLength("current epoch participation", len(fields.CurrentEpochParticipation), numValidators); err != nil {
+		return err
+	}
+	if err := st.SetCurrentEpochParticipation(fields.CurrentEpochParticipation); err != nil {
+		return err
+	}
+	if err := validateListLength("inactivity scores", len(fields.InactivityScores), numValidators); err != nil {
+		return err
+	}
+	return st.SetInactivityScores(fields.InactivityScores)
+}
+
+// validateListLength checks that a per validator list has one entry per validator.
+func validateListLength(name string, length, numValidators int) error {
+	if length != numValidators {
+		return fmt.Errorf("%s has %d entries, wanted %d", name, length, numValidators)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package stateAltair_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prysmaticlabs/prysm/beacon-chain/state/stateAltair"
+	"github.com/prysmaticlabs/prysm/shared/testutil/assert"
+	"github.com/prysmaticlabs/prysm/shared/testutil/require"
+)
+
+func TestPopulateAltairFields(t *testing.T) {
+	pbState := testAltairState(t, 33)
+	st, err := stateAltair.InitializeFromProto(pbState)
+	require.NoError(t, err)
+	_, err = st.HashTreeRoot(context.Background())
+	require.NoError(t, err)
+
+	fields := &stateAltair.AltairFields{
+		CurrentSyncCommittee:       testSyncCommittee(1),
+		NextSyncCommittee:          testSyncCommittee(2),
+		PreviousEpochParticipation: make([]byte, 33),
+		CurrentEpochParticipation:  make([]byte, 33),
+		InactivityScores:           make([]uint64, 33),
+	}
+	for i := 0; i < 33; i++ {
+		fields.PreviousEpochParticipation[i] = byte(i % 3)
+		fields.CurrentEpochParticipation[i] = byte(i % 5)
+		fields.InactivityScores[i] = uint64(i * 7)
+	}
+	require.NoError(t, stateAltair.PopulateAltairFields(st, fields))
+
+	pbState.CurrentSyncCommittee = fields.CurrentSyncCommittee
+	pbState.NextSyncCommittee = fields.NextSyncCommittee
+	pbState.PreviousEpochParticipation = fields.PreviousEpochParticipation
+	pbState.CurrentEpochParticipation = fields.CurrentEpochParticipation
+	pbState.InactivityScores = fields.InactivityScores
+	root, err := st.HashTreeRoot(context.Background())
+	require.NoError(t, err)
+	want, err := pbState.HashTreeRoot()
+	require.NoError(t, err)
+	assert.DeepEqual(t, want, root)
+
+	// The provided lists are copied into the state.
+	fields.InactivityScores[0] = 1000
+	scores, err := st.InactivityScores()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), scores[0])
+}
+
+func TestPopulateAltairFields_InvalidLengths(t *testing.T) {
+	validFields := func() *stateAltair.AltairFields {
+		return &stateAltair.AltairFields{
+			CurrentSyncCommittee:       testSyncCommittee(1),
+			NextSyncCommittee:          testSyncCommittee(2),
+			PreviousEpochParticipation: make([]byte, 4),
+			CurrentEpochParticipation:  make([]byte, 4),
+			InactivityScores:           make([]uint64, 4),
+		}
+	}
+	tests := []struct {
+		name    string
+		modify  func(f *stateAltair.AltairFields)
+		wantErr string
+	}{
+		{
+			name:    "nil next sync committee",
+			modify:  func(f *stateAltair.AltairFields) { f.NextSyncCommittee = nil },
+			wantErr: "invalid next sync committee: nil sync committee",
+		},
+		{
+			name:    "short sync committee",
+			modify:  func(f *stateAltair.AltairFields) { f.CurrentSyncCommittee.Pubkeys = f.CurrentSyncCommittee.Pubkeys[1:] },
+			wantErr: "sync committee has 511 public keys, wanted 512",
+		},
+		{
+			name:    "short previous epoch participation",
+			modify:  func(f *stateAltair.AltairFields) { f.PreviousEpochParticipation = make([]byte, 3) },
+			wantErr: "previous epoch participation has 3 entries, wanted 4",
+		},
+		{
+			name:    "long current epoch participation",
+			modify:  func(f *stateAltair.AltairFields) { f.CurrentEpochParticipation = make([]byte, 5) },
+			wantErr: "current epoch participation has 5 entries, wanted 4",
+		},
+		{
+			name:    "missing inactivity scores",
+			modify:  func(f *stateAltair.AltairFields) { f.InactivityScores = nil },
+			wantErr: "inactivity scores has 0 entries, wanted 4",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st, err := stateAltair.InitializeFromProto(testAltairState(t, 4))
+			require.NoError(t, err)
+			fields := validFields()
+			tt.modify(fields)
+			assert.ErrorContains(t, tt.wantErr, stateAltair.PopulateAltairFields(st, fields))
+		})
+	}
+	st, err := stateAltair.InitializeFromProto(testAltairState(t, 4))
+	require.NoError(t, err)
+	assert.ErrorContains(t, "nil altair fields", stateAltair.PopulateAltairFields(st, nil))
+}
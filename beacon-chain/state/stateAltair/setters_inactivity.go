@@ -0,0 +1,149 @@
+package stateAltair
+
+import (
+	"math"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// SetInactivityScores for the beacon state. The provided scores are copied,
+// replacing the existing inactivity scores in a single operation.
+func (b *BeaconState) SetInactivityScores(scores []uint64) error {
+	if !b.hasInnerState() {
+		return ErrNilInnerState
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	res := make([]uint64, len(scores))
+	copy(res, scores)
+	b.state.InactivityScores = res
+	b.markFieldAsDirty(inactivityScores)
+	b.rebuildTrie[inactivityScores] = true
+	return nil
+}
+
+// AppendInactivityScore for the beacon state. Appends the new score
+// to the end of list.
+func (b *BeaconState) AppendInactivityScore(s uint64) error {
+	if !b.hasInnerState() {
+		return ErrNilInnerState
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.state.InactivityScores = append(b.state.InactivityScores, s)
+	b.markFieldAsDirty(inactivityScores)
+	b.addDirtyIndices(inactivityScores, []uint64{uint64(len(b.state.InactivityScores) - 1)})
+	return nil
+}
+
+// AppendInactivityScores for the beacon state. Appends all the provided scores
+// to the end of the list, growing it once rather than per element. An empty
+// input is a no-op.
+func (b *BeaconState) AppendInactivityScores(scores []uint64) error {
+	if !b.hasInnerState() {
+		return ErrNilInnerState
+	}
+	if len(scores) == 0 {
+		return nil
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	oldLen := len(b.state.InactivityScores)
+	res := make([]uint64, oldLen+len(scores))
+	copy(res, b.state.InactivityScores)
+	copy(res[oldLen:], scores)
+	b.state.InactivityScores = res
+	b.markFieldAsDirty(inactivityScores)
+	if len(scores) > indicesLimit {
+		b.rebuildTrie[inactivityScores] = true
+		b.dirtyIndices[inactivityScores] = []uint64{}
+		return nil
+	}
+	indices := make([]uint64, len(scores))
+	for i := range indices {
+		indices[i] = uint64(oldLen + i)
+	}
+	b.addDirtyIndices(inactivityScores, indices)
+	return nil
+}
+
+// UpdateInactivityScoreAtIndex for the beacon state. This method updates the
+// inactivity score at a specific index to a new value.
+func (b *BeaconState) UpdateInactivityScoreAtIndex(idx, score uint64) error {
+	if !b.hasInnerState() {
+		return ErrNilInnerState
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if uint64(len(b.state.InactivityScores)) <= idx {
+		return errors.Errorf("invalid index provided %d", idx)
+	}
+
+	b.state.InactivityScores[idx] = score
+	b.markFieldAsDirty(inactivityScores)
+	b.addDirtyIndices(inactivityScores, []uint64{idx})
+	return nil
+}
+
+// ApplyInactivityScoreDeltas for the beacon state. This method adds each signed delta to the
+// inactivity score at its validator index, clamping the score at zero. All indices are checked
+// before any score is modified, and only the leaves of the scores which changed are dirtied.
+func (b *BeaconState) ApplyInactivityScoreDeltas(deltas map[uint64]int64) error {
+	if !b.hasInnerState() {
+		return ErrNilInnerState
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	// Indices are sorted so that scores are updated in a deterministic order.
+	indices := make([]uint64, 0, len(deltas))
+	for idx := range deltas {
+		if uint64(len(b.state.InactivityScores)) <= idx {
+			return errors.Errorf("invalid index provided %d", idx)
+		}
+		indices = append(indices, idx)
+	}
+	sort.Slice(indices, func(i, j int) bool {
+		return indices[i] < indices[j]
+	})
+	scores := make([]uint64, len(indices))
+	for i, idx := range indices {
+		score, delta := b.state.InactivityScores[idx], deltas[idx]
+		if delta >= 0 {
+			if score > math.MaxUint64-uint64(delta) {
+				return errors.Errorf("inactivity score at index %d overflows", idx)
+			}
+			scores[i] = score + uint64(delta)
+			continue
+		}
+		// The decrease is computed so that negating math.MinInt64 does not overflow.
+		if decrease := uint64(-(delta + 1)) + 1; decrease < score {
+			scores[i] = score - decrease
+		}
+	}
+
+	changed := make([]uint64, 0, len(indices))
+	for i, idx := range indices {
+		if b.state.InactivityScores[idx] == scores[i] {
+			continue
+		}
+		b.state.InactivityScores[idx] = scores[i]
+		changed = append(changed, idx)
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	b.markFieldAsDirty(inactivityScores)
+	b.addDirtyIndices(inactivityScores, changed)
+	return nil
+}
+
+// ResetInactivityScoreAtIndex for the beacon state. This method sets the
+// inactivity score at a specific index back to zero, dirtying only that leaf.
+func (b *BeaconState) ResetInactivityScoreAtIndex(idx uint64) error {
+	return b.UpdateInactivityScoreAtIndex(idx, 0)
+}
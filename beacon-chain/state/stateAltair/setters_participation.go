@@ -0,0 +1,287 @@
+package stateAltair
+
+import (
+	"github.com/pkg/errors"
+)
+
+// SetCurrentEpochParticipation for the beacon state. The provided participation
+// bits are copied, replacing the existing list in a single operation. The list
+// must not be nil, though it may be empty.
+func (b *BeaconState) SetCurrentEpochParticipation(val []byte) error {
+	if !b.hasInnerState() {
+		return ErrNilInnerState
+	}
+	if val == nil {
+		return errors.New("nil current epoch participation")
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	res := make([]byte, len(val))
+	copy(res, val)
+	b.state.CurrentEpochParticipation = res
+	b.markFieldAsDirty(currentEpochParticipationBits)
+	b.rebuildTrie[currentEpochParticipationBits] = true
+	return nil
+}
+
+// SetPreviousEpochParticipation for the beacon state. The provided participation
+// bits are copied, replacing the existing list in a single operation. The list
+// must not be nil, though it may be empty.
+func (b *BeaconState) SetPreviousEpochParticipation(val []byte) error {
+	if !b.hasInnerState() {
+		return ErrNilInnerState
+	}
+	if val == nil {
+		return errors.New("nil previous epoch participation")
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	res := make([]byte, len(val))
+	copy(res, val)
+	b.state.PreviousEpochParticipation = res
+	b.markFieldAsDirty(previousEpochParticipationBits)
+	b.rebuildTrie[previousEpochParticipationBits] = true
+	return nil
+}
+
+// AppendCurrentParticipationBits for the beacon state. Appends the new value
+// to the end of list.
+func (b *BeaconState) AppendCurrentParticipationBits(val byte) error {
+	if !b.hasInnerState() {
+		return ErrNilInnerState
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.state.CurrentEpochParticipation = append(b.state.CurrentEpochParticipation, val)
+	b.markFieldAsDirty(currentEpochParticipationBits)
+	b.addDirtyIndices(currentEpochParticipationBits, []uint64{uint64(len(b.state.CurrentEpochParticipation) - 1)})
+	return nil
+}
+
+// AppendPreviousParticipationBits for the beacon state. Appends the new value
+// to the end of list.
+func (b *BeaconState) AppendPreviousParticipationBits(val byte) error {
+	if !b.hasInnerState() {
+		return ErrNilInnerState
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.state.PreviousEpochParticipation = append(b.state.PreviousEpochParticipation, val)
+	b.markFieldAsDirty(previousEpochParticipationBits)
+	b.addDirtyIndices(previousEpochParticipationBits, []uint64{uint64(len(b.state.PreviousEpochParticipation) - 1)})
+	return nil
+}
+
+// AppendCurrentParticipationBitsBatch for the beacon state. Appends all the new values
+// to the end of the list at once, marking the field as dirty a single time. Appending
+// an empty list is a no-op.
+func (b *BeaconState) AppendCurrentParticipationBitsBatch(vals []byte) error {
+	if !b.hasInnerState() {
+		return ErrNilInnerState
+	}
+	if len(vals) == 0 {
+		return nil
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.state.CurrentEpochParticipation = append(b.state.CurrentEpochParticipation, vals...)
+	b.markFieldAsDirty(currentEpochParticipationBits)
+	b.addDirtyIndices(currentEpochParticipationBits, appendedIndices(len(b.state.CurrentEpochParticipation), len(vals)))
+	return nil
+}
+
+// AppendPreviousParticipationBitsBatch for the beacon state. Appends all the new values
+// to the end of the list at once, marking the field as dirty a single time. Appending
+// an empty list is a no-op.
+func (b *BeaconState) AppendPreviousParticipationBitsBatch(vals []byte) error {
+	if !b.hasInnerState() {
+		return ErrNilInnerState
+	}
+	if len(vals) == 0 {
+		return nil
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.state.PreviousEpochParticipation = append(b.state.PreviousEpochParticipation, vals...)
+	b.markFieldAsDirty(previousEpochParticipationBits)
+	b.addDirtyIndices(previousEpochParticipationBits, appendedIndices(len(b.state.PreviousEpochParticipation), len(vals)))
+	return nil
+}
+
+// appendedIndices returns the indices of the last n entries of a list of the given length.
+func appendedIndices(length, n int) []uint64 {
+	indices := make([]uint64, n)
+	for i := range indices {
+		indices[i] = uint64(length - n + i)
+	}
+	return indices
+}
+
+// SetCurrentEpochParticipationAtIndex for the beacon state. This method updates the
+// current epoch participation bits of the validator at a specific index.
+func (b *BeaconState) SetCurrentEpochParticipationAtIndex(idx uint64, val byte) error {
+	if !b.hasInnerState() {
+		return ErrNilInnerState
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if uint64(len(b.state.CurrentEpochParticipation)) <= idx {
+		return errors.Errorf("invalid index provided %d", idx)
+	}
+	b.state.CurrentEpochParticipation[idx] = val
+	b.markFieldAsDirty(currentEpochParticipationBits)
+	b.addDirtyIndices(currentEpochParticipationBits, []uint64{idx})
+	return nil
+}
+
+// SetPreviousEpochParticipationAtIndex for the beacon state. This method updates the
+// previous epoch participation bits of the validator at a specific index.
+func (b *BeaconState) SetPreviousEpochParticipationAtIndex(idx uint64, val byte) error {
+	if !b.hasInnerState() {
+		return ErrNilInnerState
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if uint64(len(b.state.PreviousEpochParticipation)) <= idx {
+		return errors.Errorf("invalid index provided %d", idx)
+	}
+	b.state.PreviousEpochParticipation[idx] = val
+	b.markFieldAsDirty(previousEpochParticipationBits)
+	b.addDirtyIndices(previousEpochParticipationBits, []uint64{idx})
+	return nil
+}
+
+// ApplyParticipationFlags sets the participation flag at the given flag index in the
+// current or previous epoch participation bits of each of the given validator indices.
+// All indices are checked before any participation bits are modified, and the field trie
+// is only updated for the validators whose participation bits changed.
+func (b *BeaconState) ApplyParticipationFlags(indices []uint64, flag int, currentEpoch bool) error {
+	if !b.hasInnerState() {
+		return ErrNilInnerState
+	}
+	if flag < TimelySourceFlagIndex || flag > TimelyHeadFlagIndex {
+		return errors.Errorf("invalid participation flag index %d", flag)
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	participation, field := b.state.PreviousEpochParticipation, previousEpochParticipationBits
+	if currentEpoch {
+		participation, field = b.state.CurrentEpochParticipation, currentEpochParticipationBits
+	}
+	for _, idx := range indices {
+		if uint64(len(participation)) <= idx {
+			return errors.Errorf("invalid index provided %d", idx)
+		}
+	}
+	changed := make([]uint64, 0, len(indices))
+	for _, idx := range indices {
+		if HasFlag(participation[idx], flag) {
+			continue
+		}
+		participation[idx] = AddFlag(participation[idx], flag)
+		changed = append(changed, idx)
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	b.markFieldAsDirty(field)
+	b.addDirtyIndices(field, changed)
+	return nil
+}
+
+// ClearParticipationForIndices zeroes the current or previous epoch participation bits of
+// each of the given validator indices, such as for validators exiting at an epoch boundary.
+// All indices are checked before any participation bits are modified, and the field trie
+// is only updated for the validators whose participation bits changed.
+func (b *BeaconState) ClearParticipationForIndices(indices []uint64, currentEpoch bool) error {
+	if !b.hasInnerState() {
+		return ErrNilInnerState
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	participation, field := b.state.PreviousEpochParticipation, previousEpochParticipationBits
+	if currentEpoch {
+		participation, field = b.state.CurrentEpochParticipation, currentEpochParticipationBits
+	}
+	for _, idx := range indices {
+		if uint64(len(participation)) <= idx {
+			return errors.Errorf("invalid index provided %d", idx)
+		}
+	}
+	changed := make([]uint64, 0, len(indices))
+	for _, idx := range indices {
+		if participation[idx] == 0 {
+			continue
+		}
+		participation[idx] = 0
+		changed = append(changed, idx)
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	b.markFieldAsDirty(field)
+	b.addDirtyIndices(field, changed)
+	return nil
+}
+
+// SwapEpochParticipation for the beacon state. At the epoch transition, the current
+// epoch participation becomes the previous epoch participation, and the current epoch
+// participation is reset to a zeroed list of the same length. The cached field trie of
+// the current epoch participation is moved over to the previous epoch participation.
+func (b *BeaconState) SwapEpochParticipation() error {
+	if !b.hasInnerState() {
+		return ErrNilInnerState
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	current := b.state.CurrentEpochParticipation
+	b.state.PreviousEpochParticipation = current
+	b.state.CurrentEpochParticipation = make([]byte, len(current))
+
+	b.fieldLayers[previousEpochParticipationBits] = b.fieldLayers[currentEpochParticipationBits]
+	b.dirtyIndices[previousEpochParticipationBits] = b.dirtyIndices[currentEpochParticipationBits]
+	if b.rebuildTrie[currentEpochParticipationBits] {
+		b.rebuildTrie[previousEpochParticipationBits] = true
+	} else {
+		delete(b.rebuildTrie, previousEpochParticipationBits)
+	}
+	delete(b.fieldLayers, currentEpochParticipationBits)
+	b.dirtyIndices[currentEpochParticipationBits] = []uint64{}
+	b.rebuildTrie[currentEpochParticipationBits] = true
+
+	b.markFieldAsDirty(previousEpochParticipationBits)
+	b.markFieldAsDirty(currentEpochParticipationBits)
+	return nil
+}
+
+// ResetPreviousEpochParticipation replaces the previous epoch participation with a
+// zeroed list of the given length, in a single allocation. The field trie of the
+// previous epoch participation is rebuilt once on the next hash tree root.
+func (b *BeaconState) ResetPreviousEpochParticipation(validatorCount uint64) error {
+	if !b.hasInnerState() {
+		return ErrNilInnerState
+	}
+	if validatorCount == 0 {
+		return errors.New("validator count must be non-zero")
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.state.PreviousEpochParticipation = make([]byte, validatorCount)
+	delete(b.fieldLayers, previousEpochParticipationBits)
+	b.dirtyIndices[previousEpochParticipationBits] = []uint64{}
+	b.rebuildTrie[previousEpochParticipationBits] = true
+	b.markFieldAsDirty(previousEpochParticipationBits)
+	return nil
+}
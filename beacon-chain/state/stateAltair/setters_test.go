@@ -0,0 +1,632 @@
+package stateAltair_test
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/prysmaticlabs/prysm/beacon-chain/state/stateAltair"
+	pbp2p "github.com/prysmaticlabs/prysm/proto/beacon/p2p/v1"
+	"github.com/prysmaticlabs/prysm/shared/testutil/assert"
+	"github.com/prysmaticlabs/prysm/shared/testutil/require"
+)
+
+func TestBeaconState_SetInactivityScores(t *testing.T) {
+	pbState := testAltairState(t, 32)
+	st, err := stateAltair.InitializeFromProto(pbState)
+	require.NoError(t, err)
+	_, err = st.HashTreeRoot(context.Background())
+	require.NoError(t, err)
+
+	scores := make([]uint64, 32)
+	for i := range scores {
+		scores[i] = uint64(i * 2)
+	}
+	require.NoError(t, st.SetInactivityScores(scores))
+
+	// Mutating the input slice should not mutate the state.
+	scores[0] = 1000
+	got, err := st.InactivityScores()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), got[0])
+	assert.Equal(t, uint64(62), got[31])
+
+	root, err := st.HashTreeRoot(context.Background())
+	require.NoError(t, err)
+	pbState.InactivityScores = got
+	want, err := pbState.HashTreeRoot()
+	require.NoError(t, err)
+	assert.DeepEqual(t, want, root)
+}
+
+func TestBeaconState_SetInactivityScores_NilInnerState(t *testing.T) {
+	st := &stateAltair.BeaconState{}
+	assert.ErrorContains(t, stateAltair.ErrNilInnerState.Error(), st.SetInactivityScores([]uint64{1}))
+}
+
+func TestBeaconState_UpdateInactivityScoreAtIndex(t *testing.T) {
+	pbState := testAltairState(t, 33)
+	st, err := stateAltair.InitializeFromProto(pbState)
+	require.NoError(t, err)
+	_, err = st.HashTreeRoot(context.Background())
+	require.NoError(t, err)
+
+	// The first hash tree root after an update builds the cached field trie,
+	// subsequent updates only recompute the branches of the dirty chunks.
+	for i, idx := range []uint64{0, 5, 32, 5} {
+		score := uint64(100 + i)
+		require.NoError(t, st.UpdateInactivityScoreAtIndex(idx, score))
+		pbState.InactivityScores[idx] = score
+
+		root, err := st.HashTreeRoot(context.Background())
+		require.NoError(t, err)
+		want, err := pbState.HashTreeRoot()
+		require.NoError(t, err)
+		assert.DeepEqual(t, want, root)
+	}
+
+	// Appending to the list should extend the cached field trie.
+	require.NoError(t, st.AppendInactivityScore(7))
+	pbState.InactivityScores = append(pbState.InactivityScores, 7)
+	root, err := st.HashTreeRoot(context.Background())
+	require.NoError(t, err)
+	want, err := pbState.HashTreeRoot()
+	require.NoError(t, err)
+	assert.DeepEqual(t, want, root)
+
+	scores, err := st.InactivityScores()
+	require.NoError(t, err)
+	assert.DeepEqual(t, pbState.InactivityScores, scores)
+}
+
+func TestBeaconState_ApplyInactivityScoreDeltas(t *testing.T) {
+	pbState := testAltairState(t, 40)
+	for i := range pbState.InactivityScores {
+		pbState.InactivityScores[i] = 10
+	}
+	st, err := stateAltair.InitializeFromProto(pbState)
+	require.NoError(t, err)
+	_, err = st.HashTreeRoot(context.Background())
+	require.NoError(t, err)
+
+	deltas := map[uint64]int64{
+		0:  5,
+		3:  -4,
+		7:  -10,
+		12: -25,
+		20: 0,
+		39: math.MinInt64,
+	}
+	require.NoError(t, st.ApplyInactivityScoreDeltas(deltas))
+	pbState.InactivityScores[0] = 15
+	pbState.InactivityScores[3] = 6
+	pbState.InactivityScores[7] = 0
+	pbState.InactivityScores[12] = 0
+	pbState.InactivityScores[39] = 0
+
+	scores, err := st.InactivityScores()
+	require.NoError(t, err)
+	assert.DeepEqual(t, pbState.InactivityScores, scores)
+	root, err := st.HashTreeRoot(context.Background())
+	require.NoError(t, err)
+	want, err := pbState.HashTreeRoot()
+	require.NoError(t, err)
+	assert.DeepEqual(t, want, root)
+}
+
+func TestBeaconState_ApplyInactivityScoreDeltas_Invalid(t *testing.T) {
+	pbState := testAltairState(t, 4)
+	pbState.InactivityScores[1] = math.MaxUint64 - 1
+	st, err := stateAltair.InitializeFromProto(pbState)
+	require.NoError(t, err)
+
+	// No score is modified if any index is out of range or any score overflows.
+	err = st.ApplyInactivityScoreDeltas(map[uint64]int64{0: 1, 4: 1})
+	assert.ErrorContains(t, "invalid index provided 4", err)
+	err = st.ApplyInactivityScoreDeltas(map[uint64]int64{0: 1, 1: 2})
+	assert.ErrorContains(t, "inactivity score at index 1 overflows", err)
+	scores, err := st.InactivityScores()
+	require.NoError(t, err)
+	assert.DeepEqual(t, []uint64{0, math.MaxUint64 - 1, 2, 3}, scores)
+
+	require.NoError(t, st.ApplyInactivityScoreDeltas(map[uint64]int64{1: 1}))
+	scores, err = st.InactivityScores()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(math.MaxUint64), scores[1])
+}
+func TestBeaconState_AppendInactivityScores(t *testing.T) {
+	pbState := testAltairState(t, 33)
+	st, err := stateAltair.InitializeFromProto(pbState)
+	require.NoError(t, err)
+	_, err = st.HashTreeRoot(context.Background())
+	require.NoError(t, err)
+
+	// An empty append is a no-op.
+	require.NoError(t, st.AppendInactivityScores([]uint64{}))
+	scores, err := st.InactivityScores()
+	require.NoError(t, err)
+	assert.Equal(t, 33, len(scores))
+
+	for _, n := range []int{1, 7, 10000} {
+		added := make([]uint64, n)
+		for i := range added {
+			added[i] = uint64(i + 1)
+		}
+		require.NoError(t, st.AppendInactivityScores(added))
+		pbState.InactivityScores = append(pbState.InactivityScores, added...)
+
+		// Mutating the input slice should not mutate the state.
+		added[0] = 1000
+
+		root, err := st.HashTreeRoot(context.Background())
+		require.NoError(t, err)
+		want, err := pbState.HashTreeRoot()
+		require.NoError(t, err)
+		assert.DeepEqual(t, want, root)
+	}
+
+	scores, err = st.InactivityScores()
+	require.NoError(t, err)
+	assert.DeepEqual(t, pbState.InactivityScores, scores)
+}
+
+func TestBeaconState_AppendInactivityScores_NilInnerState(t *testing.T) {
+	st := &stateAltair.BeaconState{}
+	assert.ErrorContains(t, stateAltair.ErrNilInnerState.Error(), st.AppendInactivityScores([]uint64{1}))
+}
+
+func TestBeaconState_UpdateInactivityScoreAtIndex_OutOfRange(t *testing.T) {
+	st, err := stateAltair.InitializeFromProto(testAltairState(t, 4))
+	require.NoError(t, err)
+	assert.ErrorContains(t, "invalid index provided 4", st.UpdateInactivityScoreAtIndex(4, 1))
+}
+
+func TestBeaconState_ResetInactivityScoreAtIndex(t *testing.T) {
+	pbState := testAltairState(t, 33)
+	for i := range pbState.InactivityScores {
+		pbState.InactivityScores[i] = uint64(i + 1)
+	}
+	st, err := stateAltair.InitializeFromProto(pbState)
+	require.NoError(t, err)
+	_, err = st.HashTreeRoot(context.Background())
+	require.NoError(t, err)
+
+	for _, idx := range []uint64{0, 5, 32, 5} {
+		require.NoError(t, st.ResetInactivityScoreAtIndex(idx))
+		pbState.InactivityScores[idx] = 0
+
+		root, err := st.HashTreeRoot(context.Background())
+		require.NoError(t, err)
+		want, err := pbState.HashTreeRoot()
+		require.NoError(t, err)
+		assert.DeepEqual(t, want, root)
+	}
+
+	scores, err := st.InactivityScores()
+	require.NoError(t, err)
+	assert.DeepEqual(t, pbState.InactivityScores, scores)
+	assert.ErrorContains(t, "invalid index provided 33", st.ResetInactivityScoreAtIndex(33))
+}
+
+func TestBeaconState_AppendParticipationBitsBatch(t *testing.T) {
+	pbState := testAltairState(t, 33)
+	st, err := stateAltair.InitializeFromProto(pbState)
+	require.NoError(t, err)
+	_, err = st.HashTreeRoot(context.Background())
+	require.NoError(t, err)
+
+	// An empty append is a no-op.
+	require.NoError(t, st.AppendCurrentParticipationBitsBatch([]byte{}))
+	require.NoError(t, st.AppendPreviousParticipationBitsBatch(nil))
+	current, err := st.CurrentEpochParticipation()
+	require.NoError(t, err)
+	assert.Equal(t, 33, len(current))
+
+	for _, n := range []int{1, 7, 10000} {
+		added := make([]byte, n)
+		for i := range added {
+			added[i] = byte(i % 8)
+		}
+		require.NoError(t, st.AppendCurrentParticipationBitsBatch(added))
+		pbState.CurrentEpochParticipation = append(pbState.CurrentEpochParticipation, added...)
+		require.NoError(t, st.AppendPreviousParticipationBitsBatch(added[:n/2]))
+		pbState.PreviousEpochParticipation = append(pbState.PreviousEpochParticipation, added[:n/2]...)
+
+		// Mutating the input slice should not mutate the state.
+		added[0] = 7
+
+		root, err := st.HashTreeRoot(context.Background())
+		require.NoError(t, err)
+		want, err := pbState.HashTreeRoot()
+		require.NoError(t, err)
+		assert.DeepEqual(t, want, root)
+	}
+
+	current, err = st.CurrentEpochParticipation()
+	require.NoError(t, err)
+	assert.DeepEqual(t, pbState.CurrentEpochParticipation, current)
+	previous, err := st.PreviousEpochParticipation()
+	require.NoError(t, err)
+	assert.DeepEqual(t, pbState.PreviousEpochParticipation, previous)
+}
+
+func TestBeaconState_AppendParticipationBitsBatch_NilInnerState(t *testing.T) {
+	st := &stateAltair.BeaconState{}
+	assert.ErrorContains(t, stateAltair.ErrNilInnerState.Error(), st.AppendCurrentParticipationBitsBatch([]byte{1}))
+	assert.ErrorContains(t, stateAltair.ErrNilInnerState.Error(), st.AppendPreviousParticipationBitsBatch([]byte{1}))
+}
+
+func TestBeaconState_SetEpochParticipationAtIndex(t *testing.T) {
+	pbState := testAltairState(t, 70)
+	st, err := stateAltair.InitializeFromProto(pbState)
+	require.NoError(t, err)
+	_, err = st.HashTreeRoot(context.Background())
+	require.NoError(t, err)
+
+	for i, idx := range []uint64{0, 31, 32, 69, 31} {
+		val := byte(i + 1)
+		require.NoError(t, st.SetCurrentEpochParticipationAtIndex(idx, val))
+		require.NoError(t, st.SetPreviousEpochParticipationAtIndex(idx, val<<2))
+		pbState.CurrentEpochParticipation[idx] = val
+		pbState.PreviousEpochParticipation[idx] = val << 2
+
+		root, err := st.HashTreeRoot(context.Background())
+		require.NoError(t, err)
+		want, err := pbState.HashTreeRoot()
+		require.NoError(t, err)
+		assert.DeepEqual(t, want, root)
+	}
+
+	// Appending to the list should extend the cached field trie.
+	require.NoError(t, st.AppendCurrentParticipationBits(3))
+	pbState.CurrentEpochParticipation = append(pbState.CurrentEpochParticipation, 3)
+	root, err := st.HashTreeRoot(context.Background())
+	require.NoError(t, err)
+	want, err := pbState.HashTreeRoot()
+	require.NoError(t, err)
+	assert.DeepEqual(t, want, root)
+
+	bits, err := st.CurrentEpochParticipationAtIndex(31)
+	require.NoError(t, err)
+	assert.Equal(t, byte(5), bits)
+}
+
+func TestBeaconState_SetEpochParticipationAtIndex_OutOfRange(t *testing.T) {
+	st, err := stateAltair.InitializeFromProto(testAltairState(t, 4))
+	require.NoError(t, err)
+	assert.ErrorContains(t, "invalid index provided 4", st.SetCurrentEpochParticipationAtIndex(4, 1))
+	assert.ErrorContains(t, "invalid index provided 5", st.SetPreviousEpochParticipationAtIndex(5, 1))
+}
+
+func TestBeaconState_SetEpochParticipation(t *testing.T) {
+	pbState := testAltairState(t, 70)
+	st, err := stateAltair.InitializeFromProto(pbState)
+	require.NoError(t, err)
+	_, err = st.HashTreeRoot(context.Background())
+	require.NoError(t, err)
+
+	current := make([]byte, 70)
+	previous := make([]byte, 70)
+	for i := range current {
+		current[i] = byte(i % 8)
+		previous[i] = byte((i + 3) % 8)
+	}
+	require.NoError(t, st.SetCurrentEpochParticipation(current))
+	require.NoError(t, st.SetPreviousEpochParticipation(previous))
+	pbState.CurrentEpochParticipation = append([]byte{}, current...)
+	pbState.PreviousEpochParticipation = append([]byte{}, previous...)
+
+	// Mutating the input slices should not mutate the state.
+	current[0], previous[0] = 0xff, 0xff
+	got, err := st.CurrentEpochParticipation()
+	require.NoError(t, err)
+	assert.DeepEqual(t, pbState.CurrentEpochParticipation, got)
+	got, err = st.PreviousEpochParticipation()
+	require.NoError(t, err)
+	assert.DeepEqual(t, pbState.PreviousEpochParticipation, got)
+
+	root, err := st.HashTreeRoot(context.Background())
+	require.NoError(t, err)
+	want, err := pbState.HashTreeRoot()
+	require.NoError(t, err)
+	assert.DeepEqual(t, want, root)
+}
+
+func TestBeaconState_SetEpochParticipation_Invalid(t *testing.T) {
+	st, err := stateAltair.InitializeFromProto(testAltairState(t, 4))
+	require.NoError(t, err)
+	assert.ErrorContains(t, "nil current epoch participation", st.SetCurrentEpochParticipation(nil))
+	assert.ErrorContains(t, "nil previous epoch participation", st.SetPreviousEpochParticipation(nil))
+	got, err := st.CurrentEpochParticipation()
+	require.NoError(t, err)
+	assert.Equal(t, 4, len(got))
+
+	empty := &stateAltair.BeaconState{}
+	assert.ErrorContains(t, stateAltair.ErrNilInnerState.Error(), empty.SetCurrentEpochParticipation([]byte{}))
+	assert.ErrorContains(t, stateAltair.ErrNilInnerState.Error(), empty.SetPreviousEpochParticipation([]byte{}))
+}
+
+func TestBeaconState_ApplyParticipationFlags(t *testing.T) {
+	pbState := testAltairState(t, 70)
+	pbState.CurrentEpochParticipation[5] = stateAltair.AddFlag(0, stateAltair.TimelyTargetFlagIndex)
+	st, err := stateAltair.InitializeFromProto(pbState)
+	require.NoError(t, err)
+	_, err = st.HashTreeRoot(context.Background())
+	require.NoError(t, err)
+
+	indices := []uint64{5, 10, 69, 10}
+	require.NoError(t, st.ApplyParticipationFlags(indices, stateAltair.TimelyHeadFlagIndex, true /* currentEpoch */))
+	require.NoError(t, st.ApplyParticipationFlags(indices, stateAltair.TimelySourceFlagIndex, false /* currentEpoch */))
+	for _, idx := range indices {
+		pbState.CurrentEpochParticipation[idx] = stateAltair.AddFlag(pbState.CurrentEpochParticipation[idx], stateAltair.TimelyHeadFlagIndex)
+		pbState.PreviousEpochParticipation[idx] = stateAltair.AddFlag(pbState.PreviousEpochParticipation[idx], stateAltair.TimelySourceFlagIndex)
+	}
+
+	current, err := st.CurrentEpochParticipation()
+	require.NoError(t, err)
+	assert.DeepEqual(t, pbState.CurrentEpochParticipation, current)
+	assert.Equal(t, byte(0b110), current[5])
+	previous, err := st.PreviousEpochParticipation()
+	require.NoError(t, err)
+	assert.DeepEqual(t, pbState.PreviousEpochParticipation, previous)
+
+	root, err := st.HashTreeRoot(context.Background())
+	require.NoError(t, err)
+	want, err := pbState.HashTreeRoot()
+	require.NoError(t, err)
+	assert.DeepEqual(t, want, root)
+}
+
+func TestBeaconState_ApplyParticipationFlags_Invalid(t *testing.T) {
+	st, err := stateAltair.InitializeFromProto(testAltairState(t, 4))
+	require.NoError(t, err)
+
+	// No participation bits are modified if any index is out of range.
+	err = st.ApplyParticipationFlags([]uint64{0, 4}, stateAltair.TimelySourceFlagIndex, true /* currentEpoch */)
+	assert.ErrorContains(t, "invalid index provided 4", err)
+	bits, err := st.CurrentEpochParticipationAtIndex(0)
+	require.NoError(t, err)
+	assert.Equal(t, byte(0), bits)
+
+	err = st.ApplyParticipationFlags([]uint64{0}, 3, false /* currentEpoch */)
+	assert.ErrorContains(t, "invalid participation flag index 3", err)
+	err = st.ApplyParticipationFlags([]uint64{0}, -1, false /* currentEpoch */)
+	assert.ErrorContains(t, "invalid participation flag index -1", err)
+}
+
+func TestBeaconState_ClearParticipationForIndices(t *testing.T) {
+	pbState := testAltairState(t, 70)
+	for i := range pbState.CurrentEpochParticipation {
+		pbState.CurrentEpochParticipation[i] = 0b111
+		pbState.PreviousEpochParticipation[i] = 0b011
+	}
+	pbState.CurrentEpochParticipation[10] = 0
+	st, err := stateAltair.InitializeFromProto(pbState)
+	require.NoError(t, err)
+	_, err = st.HashTreeRoot(context.Background())
+	require.NoError(t, err)
+
+	indices := []uint64{5, 10, 69, 5}
+	require.NoError(t, st.ClearParticipationForIndices(indices, true /* currentEpoch */))
+	require.NoError(t, st.ClearParticipationForIndices(indices[:1], false /* currentEpoch */))
+	for _, idx := range indices {
+		pbState.CurrentEpochParticipation[idx] = 0
+	}
+	pbState.PreviousEpochParticipation[5] = 0
+
+	current, err := st.CurrentEpochParticipation()
+	require.NoError(t, err)
+	assert.DeepEqual(t, pbState.CurrentEpochParticipation, current)
+	assert.Equal(t, byte(0b111), current[6])
+	previous, err := st.PreviousEpochParticipation()
+	require.NoError(t, err)
+	assert.DeepEqual(t, pbState.PreviousEpochParticipation, previous)
+	assert.Equal(t, byte(0b011), previous[10])
+
+	root, err := st.HashTreeRoot(context.Background())
+	require.NoError(t, err)
+	want, err := pbState.HashTreeRoot()
+	require.NoError(t, err)
+	assert.DeepEqual(t, want, root)
+}
+
+func TestBeaconState_ClearParticipationForIndices_Invalid(t *testing.T) {
+	pbState := testAltairState(t, 4)
+	pbState.CurrentEpochParticipation[0] = 0b111
+	st, err := stateAltair.InitializeFromProto(pbState)
+	require.NoError(t, err)
+
+	// No participation bits are modified if any index is out of range.
+	err = st.ClearParticipationForIndices([]uint64{0, 4}, true /* currentEpoch */)
+	assert.ErrorContains(t, "invalid index provided 4", err)
+	bits, err := st.CurrentEpochParticipationAtIndex(0)
+	require.NoError(t, err)
+	assert.Equal(t, byte(0b111), bits)
+
+	// Clearing no indices is a no-op.
+	require.NoError(t, st.ClearParticipationForIndices(nil, false /* currentEpoch */))
+}
+
+func TestBeaconState_SwapEpochParticipation(t *testing.T) {
+	pbState := testAltairState(t, 70)
+	st, err := stateAltair.InitializeFromProto(pbState)
+	require.NoError(t, err)
+	_, err = st.HashTreeRoot(context.Background())
+	require.NoError(t, err)
+
+	// Leave a dirty index in the current participation before swapping.
+	require.NoError(t, st.SetCurrentEpochParticipationAtIndex(69, 7))
+	pbState.CurrentEpochParticipation[69] = 7
+	wantPrevious := make([]byte, len(pbState.CurrentEpochParticipation))
+	copy(wantPrevious, pbState.CurrentEpochParticipation)
+
+	require.NoError(t, st.SwapEpochParticipation())
+	pbState.PreviousEpochParticipation = wantPrevious
+	pbState.CurrentEpochParticipation = make([]byte, 70)
+
+	previous, err := st.PreviousEpochParticipation()
+	require.NoError(t, err)
+	assert.DeepEqual(t, wantPrevious, previous)
+	current, err := st.CurrentEpochParticipation()
+	require.NoError(t, err)
+	assert.DeepEqual(t, make([]byte, 70), current)
+
+	root, err := st.HashTreeRoot(context.Background())
+	require.NoError(t, err)
+	want, err := pbState.HashTreeRoot()
+	require.NoError(t, err)
+	assert.DeepEqual(t, want, root)
+
+	// Both field tries keep being updated correctly after the swap.
+	require.NoError(t, st.SetCurrentEpochParticipationAtIndex(3, 1))
+	require.NoError(t, st.SetPreviousEpochParticipationAtIndex(40, 2))
+	pbState.CurrentEpochParticipation[3] = 1
+	pbState.PreviousEpochParticipation[40] = 2
+	root, err = st.HashTreeRoot(context.Background())
+	require.NoError(t, err)
+	want, err = pbState.HashTreeRoot()
+	require.NoError(t, err)
+	assert.DeepEqual(t, want, root)
+}
+
+func TestBeaconState_ResetPreviousEpochParticipation(t *testing.T) {
+	pbState := testAltairState(t, 70)
+	for i := range pbState.PreviousEpochParticipation {
+		pbState.PreviousEpochParticipation[i] = 7
+	}
+	st, err := stateAltair.InitializeFromProto(pbState)
+	require.NoError(t, err)
+	_, err = st.HashTreeRoot(context.Background())
+	require.NoError(t, err)
+
+	// Leave a dirty index in the previous participation before resetting.
+	require.NoError(t, st.SetPreviousEpochParticipationAtIndex(69, 3))
+	assert.ErrorContains(t, "validator count must be non-zero", st.ResetPreviousEpochParticipation(0))
+
+	// The validator count may differ from the current length of the list.
+	require.NoError(t, st.ResetPreviousEpochParticipation(72))
+	pbState.PreviousEpochParticipation = make([]byte, 72)
+	previous, err := st.PreviousEpochParticipation()
+	require.NoError(t, err)
+	assert.DeepEqual(t, make([]byte, 72), previous)
+
+	root, err := st.HashTreeRoot(context.Background())
+	require.NoError(t, err)
+	want, err := pbState.HashTreeRoot()
+	require.NoError(t, err)
+	assert.DeepEqual(t, want, root)
+
+	// The field trie keeps being updated correctly after the reset.
+	require.NoError(t, st.SetPreviousEpochParticipationAtIndex(40, 2))
+	pbState.PreviousEpochParticipation[40] = 2
+	root, err = st.HashTreeRoot(context.Background())
+	require.NoError(t, err)
+	want, err = pbState.HashTreeRoot()
+	require.NoError(t, err)
+	assert.DeepEqual(t, want, root)
+
+	assert.ErrorContains(
+		t, stateAltair.ErrNilInnerState.Error(), (&stateAltair.BeaconState{}).ResetPreviousEpochParticipation(1),
+	)
+}
+
+func TestBeaconState_SwapEpochParticipation_NilInnerState(t *testing.T) {
+	st := &stateAltair.BeaconState{}
+	assert.ErrorContains(t, stateAltair.ErrNilInnerState.Error(), st.SwapEpochParticipation())
+}
+
+func TestBeaconState_SetSyncCommittee_Validation(t *testing.T) {
+	st, err := stateAltair.InitializeFromProto(&pbp2p.BeaconStateAltair{})
+	require.NoError(t, err)
+
+	tooSmall := testSyncCommittee(1)
+	tooSmall.Pubkeys = tooSmall.Pubkeys[:511]
+	badPubKey := testSyncCommittee(1)
+	badPubKey.Pubkeys[10] = badPubKey.Pubkeys[10][:47]
+	badAggregate := testSyncCommittee(1)
+	badAggregate.AggregatePubkey = append(badAggregate.AggregatePubkey, 0)
+
+	tests := []struct {
+		name      string
+		committee *pbp2p.SyncCommittee
+		wantErr   string
+	}{
+		{name: "nil committee", committee: nil, wantErr: "nil sync committee"},
+		{name: "wrong committee size", committee: tooSmall, wantErr: "sync committee has 511 public keys, wanted 512"},
+		{name: "wrong public key length", committee: badPubKey, wantErr: "sync committee public key at index 10 has length 47, wanted 48"},
+		{name: "wrong aggregate length", committee: badAggregate, wantErr: "sync committee aggregate public key has length 49, wanted 48"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ErrorContains(t, "invalid current sync committee: "+tt.wantErr, st.SetCurrentSyncCommittee(tt.committee))
+			assert.ErrorContains(t, "invalid next sync committee: "+tt.wantErr, st.SetNextSyncCommittee(tt.committee))
+			assert.ErrorContains(t, "invalid next sync committee: "+tt.wantErr, st.RotateSyncCommittee(tt.committee))
+		})
+	}
+
+	// Rejected committees leave the state untouched.
+	current, err := st.CurrentSyncCommittee()
+	require.NoError(t, err)
+	assert.Equal(t, true, current == nil)
+	next, err := st.NextSyncCommittee()
+	require.NoError(t, err)
+	assert.Equal(t, true, next == nil)
+}
+
+func TestBeaconState_SetSyncCommittees(t *testing.T) {
+	pbState := testAltairState(t, 8)
+	st, err := stateAltair.InitializeFromProto(pbState)
+	require.NoError(t, err)
+	_, err = st.HashTreeRoot(context.Background())
+	require.NoError(t, err)
+
+	// An invalid committee leaves both committees untouched, even if the other is valid.
+	tooSmall := testSyncCommittee(9)
+	tooSmall.Pubkeys = tooSmall.Pubkeys[1:]
+	assert.ErrorContains(t, "invalid current sync committee", st.SetSyncCommittees(tooSmall, testSyncCommittee(8)))
+	assert.ErrorContains(t, "invalid next sync committee", st.SetSyncCommittees(testSyncCommittee(8), tooSmall))
+	assert.ErrorContains(t, "invalid next sync committee: nil sync committee", st.SetSyncCommittees(testSyncCommittee(8), nil))
+	current, err := st.CurrentSyncCommittee()
+	require.NoError(t, err)
+	assert.DeepEqual(t, pbState.CurrentSyncCommittee, current)
+	next, err := st.NextSyncCommittee()
+	require.NoError(t, err)
+	assert.DeepEqual(t, pbState.NextSyncCommittee, next)
+
+	require.NoError(t, st.SetSyncCommittees(testSyncCommittee(5), testSyncCommittee(6)))
+	root, err := st.HashTreeRoot(context.Background())
+	require.NoError(t, err)
+	pbState.CurrentSyncCommittee = testSyncCommittee(5)
+	pbState.NextSyncCommittee = testSyncCommittee(6)
+	want, err := pbState.HashTreeRoot()
+	require.NoError(t, err)
+	assert.DeepEqual(t, want, root)
+}
+
+func TestBeaconState_RotateSyncCommittee(t *testing.T) {
+	pbState := testAltairState(t, 8)
+	st, err := stateAltair.InitializeFromProto(pbState)
+	require.NoError(t, err)
+	_, err = st.HashTreeRoot(context.Background())
+	require.NoError(t, err)
+
+	newNext := testSyncCommittee(7)
+	require.NoError(t, st.RotateSyncCommittee(newNext))
+	// Mutating the provided committee should not mutate the state.
+	newNext.Pubkeys[0][0] = 0xff
+
+	current, err := st.CurrentSyncCommittee()
+	require.NoError(t, err)
+	assert.DeepEqual(t, testSyncCommittee(2), current)
+	next, err := st.NextSyncCommittee()
+	require.NoError(t, err)
+	assert.DeepEqual(t, testSyncCommittee(7), next)
+
+	root, err := st.HashTreeRoot(context.Background())
+	require.NoError(t, err)
+	pbState.CurrentSyncCommittee = testSyncCommittee(2)
+	pbState.NextSyncCommittee = testSyncCommittee(7)
+	want, err := pbState.HashTreeRoot()
+	require.NoError(t, err)
+	assert.DeepEqual(t, want, root)
+}
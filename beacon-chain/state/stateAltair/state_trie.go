@@ -0,0 +1,220 @@
+package stateAltair
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	iface "github.com/prysmaticlabs/prysm/beacon-chain/state/interface"
+	"github.com/prysmaticlabs/prysm/beacon-chain/state/stateutil"
+	pbp2p "github.com/prysmaticlabs/prysm/proto/beacon/p2p/v1"
+	"github.com/prysmaticlabs/prysm/shared/bytesutil"
+	"go.opencensus.io/trace"
+	"google.golang.org/protobuf/proto"
+)
+
+// InitializeFromProto the beacon state from a protobuf representation.
+func InitializeFromProto(st *pbp2p.BeaconStateAltair) (*BeaconState, error) {
+	return InitializeFromProtoUnsafe(proto.Clone(st).(*pbp2p.BeaconStateAltair))
+}
+
+// InitializeFromProtoUnsafe directly uses the beacon state protobuf pointer
+// and sets it as the inner state of the BeaconState type.
+func InitializeFromProtoUnsafe(st *pbp2p.BeaconStateAltair) (*BeaconState, error) {
+	if st == nil {
+		return nil, errors.New("received nil state")
+	}
+
+	b := &BeaconState{
+		state:        st,
+		dirtyFields:  make(map[fieldIndex]bool, fieldCount),
+		dirtyIndices: make(map[fieldIndex][]uint64, fieldCount),
+		rebuildTrie:  make(map[fieldIndex]bool, fieldCount),
+		fieldLayers:  make(map[fieldIndex][][]*[32]byte),
+	}
+
+	for i := 0; i < fieldCount; i++ {
+		b.dirtyFields[fieldIndex(i)] = true
+		b.dirtyIndices[fieldIndex(i)] = []uint64{}
+	}
+	return b, nil
+}
+
+// Copy returns a deep copy of the beacon state.
+func (b *BeaconState) Copy() iface.BeaconStateAltair {
+	if !b.hasInnerState() {
+		return nil
+	}
+
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	checkStateBeforeCopy(b)
+
+	dst := &BeaconState{
+		state:        proto.Clone(b.state).(*pbp2p.BeaconStateAltair),
+		dirtyFields:  make(map[fieldIndex]bool, fieldCount),
+		dirtyIndices: make(map[fieldIndex][]uint64, fieldCount),
+		rebuildTrie:  make(map[fieldIndex]bool, fieldCount),
+		fieldLayers:  make(map[fieldIndex][][]*[32]byte, len(b.fieldLayers)),
+	}
+
+	for i := range b.dirtyFields {
+		dst.dirtyFields[i] = true
+	}
+
+	for i := range b.dirtyIndices {
+		indices := make([]uint64, len(b.dirtyIndices[i]))
+		copy(indices, b.dirtyIndices[i])
+		dst.dirtyIndices[i] = indices
+	}
+
+	for i := range b.rebuildTrie {
+		dst.rebuildTrie[i] = true
+	}
+
+	for i, layers := range b.fieldLayers {
+		dst.fieldLayers[i] = copyFieldLayers(layers)
+	}
+
+	if b.merkleLayers != nil {
+		dst.merkleLayers = make([][][]byte, len(b.merkleLayers))
+		for i, layer := range b.merkleLayers {
+			dst.merkleLayers[i] = make([][]byte, len(layer))
+			for j, content := range layer {
+				dst.merkleLayers[i][j] = make([]byte, len(content))
+				copy(dst.merkleLayers[i][j], content)
+			}
+		}
+	}
+	return dst
+}
+
+// HashTreeRoot of the beacon state retrieves the Merkle root of the trie
+// representation of the beacon state based on the eth2 Simple Serialize specification.
+func (b *BeaconState) HashTreeRoot(ctx context.Context) ([32]byte, error) {
+	ctx, span := trace.StartSpan(ctx, "beaconStateAltair.HashTreeRoot")
+	defer span.End()
+
+	if !b.hasInnerState() {
+		return [32]byte{}, ErrNilInnerState
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if err := b.initializeMerkleLayers(ctx); err != nil {
+		return [32]byte{}, err
+	}
+	for field := range b.dirtyFields {
+		if err := b.recomputeDirtyField(ctx, field); err != nil {
+			return [32]byte{}, err
+		}
+	}
+	return bytesutil.ToBytes32(b.merkleLayers[len(b.merkleLayers)-1][0]), nil
+}
+
+// ParticipationBitsEqual reports whether the previous and current epoch participation of
+// the state are equal to those of the other state, by comparing the cached roots of both
+// fields rather than copying the participation lists. Roots which are not cached yet are
+// computed and cached first.
+func (b *BeaconState) ParticipationBitsEqual(other iface.BeaconStateAltair) (bool, error) {
+	otherState, ok := other.(*BeaconState)
+	if !ok {
+		return false, errors.Errorf("cannot compare participation with a state of type %T", other)
+	}
+	previousRoot, currentRoot, err := b.participationRoots()
+	if err != nil {
+		return false, err
+	}
+	otherPreviousRoot, otherCurrentRoot, err := otherState.participationRoots()
+	if err != nil {
+		return false, err
+	}
+	return previousRoot == otherPreviousRoot && currentRoot == otherCurrentRoot, nil
+}
+
+// participationRoots returns the roots of the previous and current epoch participation,
+// computing and caching them if they are not cached yet.
+func (b *BeaconState) participationRoots() (previous, current [32]byte, err error) {
+	ctx, span := trace.StartSpan(context.Background(), "beaconStateAltair.participationRoots")
+	defer span.End()
+
+	if !b.hasInnerState() {
+		return [32]byte{}, [32]byte{}, ErrNilInnerState
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if err := b.initializeMerkleLayers(ctx); err != nil {
+		return [32]byte{}, [32]byte{}, err
+	}
+	for _, field := range []fieldIndex{previousEpochParticipationBits, currentEpochParticipationBits} {
+		if b.dirtyFields[field] {
+			if err := b.recomputeDirtyField(ctx, field); err != nil {
+				return [32]byte{}, [32]byte{}, err
+			}
+		}
+	}
+	previous = bytesutil.ToBytes32(b.merkleLayers[0][previousEpochParticipationBits])
+	current = bytesutil.ToBytes32(b.merkleLayers[0][currentEpochParticipationBits])
+	return previous, current, nil
+}
+
+// initializeMerkleLayers computes the field roots and Merkle layers of the state if they
+// have not been computed yet.
+// This assumes that a lock is already held on BeaconState.
+func (b *BeaconState) initializeMerkleLayers(ctx context.Context) error {
+	if len(b.merkleLayers) > 0 {
+		return nil
+	}
+	fieldRoots, err := computeFieldRoots(ctx, b.state)
+	if err != nil {
+		return err
+	}
+	layers := stateutil.Merkleize(fieldRoots)
+	b.merkleLayers = layers
+	b.dirtyFields = make(map[fieldIndex]bool, fieldCount)
+	return nil
+}
+
+// recomputeDirtyField updates the cached root of a dirty field and the Merkle layers above it.
+// This assumes that a lock is already held on BeaconState.
+func (b *BeaconState) recomputeDirtyField(ctx context.Context, field fieldIndex) error {
+	root, err := b.rootSelector(ctx, field)
+	if err != nil {
+		return err
+	}
+	b.merkleLayers[0][field] = root[:]
+	b.recomputeRoot(int(field))
+	delete(b.dirtyFields, field)
+	return nil
+}
+
+// IsNil checks if the state and the underlying proto
+// object are nil.
+func (b *BeaconState) IsNil() bool {
+	return b == nil || b.state == nil
+}
+
+func (b *BeaconState) rootSelector(ctx context.Context, field fieldIndex) ([32]byte, error) {
+	_, span := trace.StartSpan(ctx, "beaconStateAltair.rootSelector")
+	defer span.End()
+	span.AddAttributes(trace.StringAttribute("field", field.String()))
+
+	switch field {
+	case inactivityScores:
+		return b.packedUint64ListRoot(field, b.state.InactivityScores)
+	case previousEpochParticipationBits:
+		return b.packedBytesListRoot(field, b.state.PreviousEpochParticipation)
+	case currentEpochParticipationBits:
+		return b.packedBytesListRoot(field, b.state.CurrentEpochParticipation)
+	}
+
+	root, err := fieldRoot(b.state, field)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	b.dirtyIndices[field] = []uint64{}
+	return root, nil
+}
@@ -0,0 +1,135 @@
+package stateAltair_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prysmaticlabs/prysm/beacon-chain/state/stateAltair"
+	pbp2p "github.com/prysmaticlabs/prysm/proto/beacon/p2p/v1"
+	"github.com/prysmaticlabs/prysm/shared/testutil/assert"
+	"github.com/prysmaticlabs/prysm/shared/testutil/require"
+)
+
+func TestInitializeFromProto(t *testing.T) {
+	type test struct {
+		name  string
+		state *pbp2p.BeaconStateAltair
+		error string
+	}
+	initTests := []test{
+		{
+			name:  "nil state",
+			state: nil,
+			error: "received nil state",
+		},
+		{
+			name:  "empty state",
+			state: &pbp2p.BeaconStateAltair{},
+		},
+		{
+			name:  "full state",
+			state: testAltairState(t, 64),
+		},
+	}
+	for _, tt := range initTests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := stateAltair.InitializeFromProto(tt.state)
+			if tt.error != "" {
+				assert.ErrorContains(t, tt.error, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestBeaconState_HashTreeRoot(t *testing.T) {
+	pbState := testAltairState(t, 64)
+	want, err := pbState.HashTreeRoot()
+	require.NoError(t, err)
+
+	st, err := stateAltair.InitializeFromProto(pbState)
+	require.NoError(t, err)
+	got, err := st.HashTreeRoot(context.Background())
+	require.NoError(t, err)
+	assert.DeepEqual(t, want, got)
+
+	// Modify fields and ensure the recomputed root matches the
+	// root of the modified protobuf.
+	require.NoError(t, st.SetSlot(100))
+	require.NoError(t, st.SetNextSyncCommittee(testSyncCommittee(3)))
+	require.NoError(t, st.AppendCurrentParticipationBits(7))
+	require.NoError(t, st.AppendInactivityScore(10))
+	got, err = st.HashTreeRoot(context.Background())
+	require.NoError(t, err)
+
+	pbState.Slot = 100
+	pbState.NextSyncCommittee = testSyncCommittee(3)
+	pbState.CurrentEpochParticipation = append(pbState.CurrentEpochParticipation, 7)
+	pbState.InactivityScores = append(pbState.InactivityScores, 10)
+	want, err = pbState.HashTreeRoot()
+	require.NoError(t, err)
+	assert.DeepEqual(t, want, got)
+}
+
+func TestBeaconState_Copy(t *testing.T) {
+	st, err := stateAltair.InitializeFromProto(testAltairState(t, 16))
+	require.NoError(t, err)
+	_, err = st.HashTreeRoot(context.Background())
+	require.NoError(t, err)
+
+	cp := st.Copy()
+	require.NoError(t, cp.SetNextSyncCommittee(testSyncCommittee(9)))
+	require.NoError(t, cp.AppendInactivityScore(1))
+
+	committee, err := st.NextSyncCommittee()
+	require.NoError(t, err)
+	assert.DeepEqual(t, testSyncCommittee(2), committee)
+	scores, err := st.InactivityScores()
+	require.NoError(t, err)
+	assert.Equal(t, 16, len(scores))
+
+	r1, err := st.HashTreeRoot(context.Background())
+	require.NoError(t, err)
+	r2, err := cp.HashTreeRoot(context.Background())
+	require.NoError(t, err)
+	assert.NotEqual(t, r1, r2)
+}
+
+func TestBeaconState_ParticipationBitsEqual(t *testing.T) {
+	st, err := stateAltair.InitializeFromProto(testAltairState(t, 16))
+	require.NoError(t, err)
+	other, err := stateAltair.InitializeFromProto(testAltairState(t, 16))
+	require.NoError(t, err)
+
+	// Both roots are cold.
+	equal, err := st.ParticipationBitsEqual(other)
+	require.NoError(t, err)
+	assert.Equal(t, true, equal)
+
+	// Cached roots are recomputed once the participation is modified.
+	require.NoError(t, other.SetCurrentEpochParticipationAtIndex(3, 7))
+	equal, err = st.ParticipationBitsEqual(other)
+	require.NoError(t, err)
+	assert.Equal(t, false, equal)
+	require.NoError(t, st.SetCurrentEpochParticipationAtIndex(3, 7))
+	equal, err = st.ParticipationBitsEqual(other)
+	require.NoError(t, err)
+	assert.Equal(t, true, equal)
+
+	require.NoError(t, st.SetPreviousEpochParticipationAtIndex(0, 7))
+	equal, err = st.ParticipationBitsEqual(other)
+	require.NoError(t, err)
+	assert.Equal(t, false, equal)
+
+	// Comparing does not change the state root.
+	copied := st.Copy()
+	wantRoot, err := copied.HashTreeRoot(context.Background())
+	require.NoError(t, err)
+	root, err := st.HashTreeRoot(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, wantRoot, root)
+	equal, err = st.ParticipationBitsEqual(copied)
+	require.NoError(t, err)
+	assert.Equal(t, true, equal)
+}
@@ -0,0 +1,122 @@
+package stateAltair
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+	iface "github.com/prysmaticlabs/prysm/beacon-chain/state/interface"
+	pbp2p "github.com/prysmaticlabs/prysm/proto/beacon/p2p/v1"
+)
+
+// Ensure type BeaconState below implements BeaconStateAltair interface.
+var _ iface.BeaconStateAltair = (*BeaconState)(nil)
+
+type fieldIndex int
+
+// Below we define a set of useful enum values for the field
+// indices of the Altair beacon state. For example, genesisTime is the
+// 0th field of the beacon state. This is helpful when we are
+// updating the Merkle branches up the trie representation
+// of the beacon state.
+const (
+	genesisTime fieldIndex = iota
+	genesisValidatorRoot
+	slot
+	fork
+	latestBlockHeader
+	blockRoots
+	stateRoots
+	historicalRoots
+	eth1Data
+	eth1DataVotes
+	eth1DepositIndex
+	validators
+	balances
+	randaoMixes
+	slashings
+	previousEpochParticipationBits
+	currentEpochParticipationBits
+	justificationBits
+	previousJustifiedCheckpoint
+	currentJustifiedCheckpoint
+	finalizedCheckpoint
+	inactivityScores
+	currentSyncCommittee
+	nextSyncCommittee
+)
+
+// fieldCount is the number of fields in the Altair beacon state.
+const fieldCount = int(nextSyncCommittee) + 1
+
+// ErrNilInnerState returns when the inner state is nil and no copy set or get
+// operations can be performed on state.
+var ErrNilInnerState = errors.New("nil inner state")
+
+// BeaconState defines a struct containing utilities for the eth2 chain state after
+// the Altair hard fork, defining getters and setters for its respective values and
+// helpful functions such as HashTreeRoot().
+type BeaconState struct {
+	state        *pbp2p.BeaconStateAltair
+	lock         sync.RWMutex
+	dirtyFields  map[fieldIndex]bool
+	dirtyIndices map[fieldIndex][]uint64
+	rebuildTrie  map[fieldIndex]bool
+	fieldLayers  map[fieldIndex][][]*[32]byte
+	merkleLayers [][][]byte
+}
+
+// String returns the name of the field index.
+func (f fieldIndex) String() string {
+	switch f {
+	case genesisTime:
+		return "genesisTime"
+	case genesisValidatorRoot:
+		return "genesisValidatorRoot"
+	case slot:
+		return "slot"
+	case fork:
+		return "fork"
+	case latestBlockHeader:
+		return "latestBlockHeader"
+	case blockRoots:
+		return "blockRoots"
+	case stateRoots:
+		return "stateRoots"
+	case historicalRoots:
+		return "historicalRoots"
+	case eth1Data:
+		return "eth1Data"
+	case eth1DataVotes:
+		return "eth1DataVotes"
+	case eth1DepositIndex:
+		return "eth1DepositIndex"
+	case validators:
+		return "validators"
+	case balances:
+		return "balances"
+	case randaoMixes:
+		return "randaoMixes"
+	case slashings:
+		return "slashings"
+	case previousEpochParticipationBits:
+		return "previousEpochParticipationBits"
+	case currentEpochParticipationBits:
+		return "currentEpochParticipationBits"
+	case justificationBits:
+		return "justificationBits"
+	case previousJustifiedCheckpoint:
+		return "previousJustifiedCheckpoint"
+	case currentJustifiedCheckpoint:
+		return "currentJustifiedCheckpoint"
+	case finalizedCheckpoint:
+		return "finalizedCheckpoint"
+	case inactivityScores:
+		return "inactivityScores"
+	case currentSyncCommittee:
+		return "currentSyncCommittee"
+	case nextSyncCommittee:
+		return "nextSyncCommittee"
+	default:
+		return ""
+	}
+}
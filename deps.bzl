@@ -815,6 +815,8 @@ def prysm_deps():
         name = "com_github_ferranbt_fastssz",
         importpath = "github.com/ferranbt/fastssz",
         nofuzz = True,
+        patch_args = ["-p1"],
+        patches = ["@prysm//third_party:com_github_ferranbt_fastssz-byte-lists.patch"],
         sum = "h1:zhTRgKvm7CQxlGwJ7KfqT1AYDr2Q/caS6qrC7fwEtxU=",
         version = "v0.0.0-20210526181520-7df50c8568f8",
     )
@@ -1912,18 +1912,30 @@ func (b *BeaconStateAltair) HashTreeRootWith(hh *ssz.Hasher) (err error) {
 	}
 
 	// Field (15) 'PreviousEpochParticipation'
-	if len(b.PreviousEpochParticipation) > 1099511627776 {
-		err = ssz.ErrBytesLength
-		return
+	{
+		if len(b.PreviousEpochParticipation) > 1099511627776 {
+			err = ssz.ErrBytesLength
+			return
+		}
+		subIndx := hh.Index()
+		hh.Append(b.PreviousEpochParticipation)
+		hh.FillUpTo32()
+		numItems := uint64(len(b.PreviousEpochParticipation))
+		hh.MerkleizeWithMixin(subIndx, numItems, ssz.CalculateLimit(1099511627776, numItems, 1))
 	}
-	hh.PutBytes(b.PreviousEpochParticipation)
 
 	// Field (16) 'CurrentEpochParticipation'
-	if len(b.CurrentEpochParticipation) > 1099511627776 {
-		err = ssz.ErrBytesLength
-		return
+	{
+		if len(b.CurrentEpochParticipation) > 1099511627776 {
+			err = ssz.ErrBytesLength
+			return
+		}
+		subIndx := hh.Index()
+		hh.Append(b.CurrentEpochParticipation)
+		hh.FillUpTo32()
+		numItems := uint64(len(b.CurrentEpochParticipation))
+		hh.MerkleizeWithMixin(subIndx, numItems, ssz.CalculateLimit(1099511627776, numItems, 1))
 	}
-	hh.PutBytes(b.CurrentEpochParticipation)
 
 	// Field (17) 'JustificationBits'
 	if len(b.JustificationBits) != 1 {
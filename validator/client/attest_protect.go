@@ -68,11 +68,26 @@ func (v *validator) slashableAttestationCheck(
 		}
 		switch slashingKind {
 		case kv.DoubleVote:
-			log.Warn("Attestation is slashable as it is a double vote")
+			entry := log.WithField("targetEpoch", indexedAtt.Data.Target.Epoch)
+			var doubleVoteErr *kv.DoubleVoteError
+			if errors.As(err, &doubleVoteErr) {
+				entry = entry.WithField(
+					"existingSigningRoot", fmt.Sprintf("%#x", doubleVoteErr.ExistingSigningRoot),
+				).WithField(
+					"incomingSigningRoot", fmt.Sprintf("%#x", doubleVoteErr.IncomingSigningRoot),
+				)
+			}
+			entry.Warn("Attestation is slashable as it is a double vote")
 		case kv.SurroundingVote:
 			log.Warn("Attestation is slashable as it is surrounding a previous attestation")
 		case kv.SurroundedVote:
 			log.Warn("Attestation is slashable as it is surrounded by a previous attestation")
+		case kv.MinimalProtectionViolation:
+			log.Warn("Attestation is not safe to sign under minimal slashing protection")
+		case kv.SuspiciousFutureTarget:
+			log.WithField("targetEpoch", indexedAtt.Data.Target.Epoch).Warn(
+				"Attestation target epoch is suspiciously far beyond the highest signed target epoch",
+			)
 		}
 		return errors.Wrap(err, failedAttLocalProtectionErr)
 	}
@@ -4,6 +4,7 @@ package iface
 import (
 	"context"
 	"io"
+	"time"
 
 	types "github.com/prysmaticlabs/eth2-types"
 	ethpb "github.com/prysmaticlabs/prysm/proto/eth/v1alpha1"
@@ -11,18 +12,23 @@ import (
 	"github.com/prysmaticlabs/prysm/validator/db/kv"
 )
 
-// Ensure the kv store implements the interface.
+// Ensure the kv stores implement the interface.
 var _ = ValidatorDB(&kv.Store{})
+var _ = ValidatorDB(&kv.InMemoryStore{})
 
 // ValidatorDB defines the necessary methods for a Prysm validator DB.
 type ValidatorDB interface {
 	io.Closer
 	backuputil.BackupExporter
 	DatabasePath() string
+	MinimalSlashingProtection() bool
 	ClearDB() error
+	Compact(ctx context.Context) error
 	RunUpMigrations(ctx context.Context) error
+	RunMigrations(ctx context.Context) error
 	RunDownMigrations(ctx context.Context) error
 	UpdatePublicKeysBuckets(publicKeys [][48]byte) error
+	ImportInterchangeData(ctx context.Context, data *kv.InterchangeData) error
 
 	// Genesis information related methods.
 	GenesisValidatorsRoot(ctx context.Context) ([]byte, error)
@@ -35,6 +41,15 @@ type ValidatorDB interface {
 	ProposalHistoryForSlot(ctx context.Context, publicKey [48]byte, slot types.Slot) ([32]byte, bool, error)
 	SaveProposalHistoryForSlot(ctx context.Context, pubKey [48]byte, slot types.Slot, signingRoot []byte) error
 	ProposedPublicKeys(ctx context.Context) ([][48]byte, error)
+	CheckSlashableBlockProposal(
+		ctx context.Context, pubKey [48]byte, signingRoot [32]byte, slot types.Slot,
+	) (kv.SlashingKind, error)
+	ProposalSlotIsSafe(
+		ctx context.Context, pubKey [48]byte, slot types.Slot, signingRoot [32]byte,
+	) (bool, kv.SlashingKind, error)
+	SaveBlockProposal(ctx context.Context, pubKey [48]byte, signingRoot [32]byte, slot types.Slot) error
+	FlushProposalBatch(ctx context.Context) error
+	PruneProposals(ctx context.Context, currentSlot types.Slot) error
 
 	// Attester protection related methods.
 	// Methods to store and read blacklisted public keys from EIP-3076
@@ -42,9 +57,19 @@ type ValidatorDB interface {
 	EIPImportBlacklistedPublicKeys(ctx context.Context) ([][48]byte, error)
 	SaveEIPImportBlacklistedPublicKeys(ctx context.Context, publicKeys [][48]byte) error
 	SigningRootAtTargetEpoch(ctx context.Context, publicKey [48]byte, target types.Epoch) ([32]byte, error)
+	SigningRootAtTarget(ctx context.Context, publicKey [48]byte, target types.Epoch) ([32]byte, bool, error)
+	SigningRootsAtTargetEpoch(ctx context.Context, publicKey [48]byte, target types.Epoch) ([][32]byte, error)
 	LowestSignedTargetEpoch(ctx context.Context, publicKey [48]byte) (types.Epoch, bool, error)
 	LowestSignedSourceEpoch(ctx context.Context, publicKey [48]byte) (types.Epoch, bool, error)
+	HighestSignedTargetEpoch(ctx context.Context, publicKey [48]byte) (types.Epoch, bool, error)
 	AttestedPublicKeys(ctx context.Context) ([][48]byte, error)
+	AttestationRecordCount(ctx context.Context, publicKey [48]byte) (uint64, error)
+	TotalAttestationRecordCount(ctx context.Context) (uint64, error)
+	AllAttestationBoundaries(ctx context.Context) (map[[48]byte]kv.EpochBounds, error)
+	ClearAttestationHistoryForPubKeys(ctx context.Context, publicKeys [][48]byte) error
+	VerifyAttestationBounds(ctx context.Context, publicKey [48]byte) error
+	SelfTestSlashingProtection(ctx context.Context, publicKey [48]byte) (bool, error)
+	FlushAttestationBatch(ctx context.Context) error
 	CheckSlashableAttestation(
 		ctx context.Context, pubKey [48]byte, signingRoot [32]byte, att *ethpb.IndexedAttestation,
 	) (kv.SlashingKind, error)
@@ -54,9 +79,19 @@ type ValidatorDB interface {
 	SaveAttestationsForPubKey(
 		ctx context.Context, pubKey [48]byte, signingRoots [][32]byte, atts []*ethpb.IndexedAttestation,
 	) error
+	SaveAttestationRecordsForPubKey(ctx context.Context, pubKey [48]byte, records []*kv.AttestationRecord) error
 	AttestationHistoryForPubKey(
 		ctx context.Context, pubKey [48]byte,
 	) ([]*kv.AttestationRecord, error)
+	TargetForSource(ctx context.Context, publicKey [48]byte, source types.Epoch) (types.Epoch, bool, error)
+	FirstSignedTimestamp(ctx context.Context, publicKey [48]byte) (time.Time, bool, error)
+	ForEachAttestation(
+		ctx context.Context, pubKey [48]byte, fn func(source, target types.Epoch, signingRoot [32]byte) error,
+	) error
+
+	// Sync committee protection related methods.
+	SaveSyncCommitteeMessage(ctx context.Context, pubKey [48]byte, slot types.Slot, signingRoot [32]byte) error
+	CheckSyncCommitteeMessage(ctx context.Context, pubKey [48]byte, slot types.Slot, signingRoot [32]byte) error
 
 	// Graffiti ordered index related methods
 	SaveGraffitiOrderedIndex(ctx context.Context, index uint64) error
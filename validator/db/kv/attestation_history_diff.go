@@ -0,0 +1,221 @@
+package kv
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+
+	types "github.com/prysmaticlabs/eth2-types"
+	"go.opencensus.io/trace"
+)
+
+// PubKeyDiffKind describes how the attesting history of a public key differs between two databases.
+type PubKeyDiffKind int
+
+// The ways the attesting history of a public key can differ between two databases.
+const (
+	// MissingPubKey means only one of the databases has attesting history for the public key.
+	MissingPubKey PubKeyDiffKind = iota
+	// DivergentLowestSourceEpoch means the lowest signed source epochs differ.
+	DivergentLowestSourceEpoch
+	// DivergentLowestTargetEpoch means the lowest signed target epochs differ.
+	DivergentLowestTargetEpoch
+	// DivergentHighestTargetEpoch means the highest signed target epochs differ.
+	DivergentHighestTargetEpoch
+	// MissingTargetEpoch means only one of the databases has a signing root at a target epoch.
+	MissingTargetEpoch
+	// DifferingSigningRoot means the databases have different signing roots at a target epoch.
+	DifferingSigningRoot
+)
+
+// PubKeyDiff is a difference between the attesting history of a public key in two databases.
+type PubKeyDiff struct {
+	PubKey      [48]byte
+	Kind        PubKeyDiffKind
+	Description string
+}
+
+// Summary of the attesting history of a public key used to compare databases.
+type attestationHistorySummary struct {
+	lowestSource, lowestTarget, highestTarget                   types.Epoch
+	lowestSourceExists, lowestTargetExists, highestTargetExists bool
+	signingRoots                                                map[types.Epoch][32]byte
+}
+
+func (h *attestationHistorySummary) isEmpty() bool {
+	return !h.lowestSourceExists && !h.lowestTargetExists && !h.highestTargetExists && len(h.signingRoots) == 0
+}
+
+// DiffAttestationHistory compares the attesting history of every public key in the database
+// with the other database, for example to verify a migration. For each public key, the lowest
+// signed source and target epochs, the highest signed target epoch and the signing root at every
+// attested target epoch are compared. The differences are returned ordered by public key, with
+// differing target epochs in ascending order. No differences are returned if the databases match.
+func (s *Store) DiffAttestationHistory(ctx context.Context, other *Store) ([]PubKeyDiff, error) {
+	ctx, span := trace.StartSpan(ctx, "Validator.DiffAttestationHistory")
+	defer span.End()
+
+	pubKeys, err := attestedPublicKeysUnion(ctx, s, other)
+	if err != nil {
+		return nil, err
+	}
+	diffs := make([]PubKeyDiff, 0)
+	for _, pubKey := range pubKeys {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		summary, err := s.attestationHistorySummary(ctx, pubKey)
+		if err != nil {
+			return nil, err
+		}
+		otherSummary, err := other.attestationHistorySummary(ctx, pubKey)
+		if err != nil {
+			return nil, err
+		}
+		diffs = append(diffs, diffAttestationHistorySummaries(pubKey, summary, otherSummary)...)
+	}
+	return diffs, nil
+}
+
+func attestedPublicKeysUnion(ctx context.Context, stores ...*Store) ([][48]byte, error) {
+	seen := make(map[[48]byte]bool)
+	pubKeys := make([][48]byte, 0)
+	for _, store := range stores {
+		attested, err := store.AttestedPublicKeys(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, pubKey := range attested {
+			if !seen[pubKey] {
+				seen[pubKey] = true
+				pubKeys = append(pubKeys, pubKey)
+			}
+		}
+	}
+	sort.Slice(pubKeys, func(i, j int) bool {
+		return bytes.Compare(pubKeys[i][:], pubKeys[j][:]) < 0
+	})
+	return pubKeys, nil
+}
+
+func (s *Store) attestationHistorySummary(ctx context.Context, pubKey [48]byte) (*attestationHistorySummary, error) {
+	summary := &attestationHistorySummary{signingRoots: make(map[types.Epoch][32]byte)}
+	var err error
+	summary.lowestSource, summary.lowestSourceExists, err = s.LowestSignedSourceEpoch(ctx, pubKey)
+	if err != nil {
+		return nil, err
+	}
+	summary.lowestTarget, summary.lowestTargetExists, err = s.LowestSignedTargetEpoch(ctx, pubKey)
+	if err != nil {
+		return nil, err
+	}
+	summary.highestTarget, summary.highestTargetExists, err = s.HighestSignedTargetEpoch(ctx, pubKey)
+	if err != nil {
+		return nil, err
+	}
+	err = s.ForEachAttestation(ctx, pubKey, func(_, target types.Epoch, signingRoot [32]byte) error {
+		summary.signingRoots[target] = signingRoot
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+func diffAttestationHistorySummaries(pubKey [48]byte, summary, other *attestationHistorySummary) []PubKeyDiff {
+	if summary.isEmpty() && other.isEmpty() {
+		return nil
+	}
+	if summary.isEmpty() || other.isEmpty() {
+		database := "this"
+		if other.isEmpty() {
+			database = "the other"
+		}
+		return []PubKeyDiff{{
+			PubKey:      pubKey,
+			Kind:        MissingPubKey,
+			Description: fmt.Sprintf("public key has no attesting history in %s database", database),
+		}}
+	}
+
+	diffs := make([]PubKeyDiff, 0)
+	bounds := []struct {
+		kind        PubKeyDiffKind
+		name        string
+		epoch       types.Epoch
+		exists      bool
+		otherEpoch  types.Epoch
+		otherExists bool
+	}{
+		{DivergentLowestSourceEpoch, "lowest signed source epoch", summary.lowestSource, summary.lowestSourceExists, other.lowestSource, other.lowestSourceExists},
+		{DivergentLowestTargetEpoch, "lowest signed target epoch", summary.lowestTarget, summary.lowestTargetExists, other.lowestTarget, other.lowestTargetExists},
+		{DivergentHighestTargetEpoch, "highest signed target epoch", summary.highestTarget, summary.highestTargetExists, other.highestTarget, other.highestTargetExists},
+	}
+	for _, bound := range bounds {
+		if bound.exists == bound.otherExists && bound.epoch == bound.otherEpoch {
+			continue
+		}
+		diffs = append(diffs, PubKeyDiff{
+			PubKey: pubKey,
+			Kind:   bound.kind,
+			Description: fmt.Sprintf(
+				"%s is %s, %s in the other database",
+				bound.name,
+				epochOrNone(bound.epoch, bound.exists),
+				epochOrNone(bound.otherEpoch, bound.otherExists),
+			),
+		})
+	}
+
+	targets := make([]types.Epoch, 0, len(summary.signingRoots)+len(other.signingRoots))
+	for target := range summary.signingRoots {
+		targets = append(targets, target)
+	}
+	for target := range other.signingRoots {
+		if _, ok := summary.signingRoots[target]; !ok {
+			targets = append(targets, target)
+		}
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		return targets[i] < targets[j]
+	})
+	for _, target := range targets {
+		signingRoot, ok := summary.signingRoots[target]
+		otherSigningRoot, otherOk := other.signingRoots[target]
+		switch {
+		case !otherOk:
+			diffs = append(diffs, PubKeyDiff{
+				PubKey:      pubKey,
+				Kind:        MissingTargetEpoch,
+				Description: fmt.Sprintf("target epoch %d is missing from the other database", target),
+			})
+		case !ok:
+			diffs = append(diffs, PubKeyDiff{
+				PubKey:      pubKey,
+				Kind:        MissingTargetEpoch,
+				Description: fmt.Sprintf("target epoch %d is missing from this database", target),
+			})
+		case signingRoot != otherSigningRoot:
+			diffs = append(diffs, PubKeyDiff{
+				PubKey: pubKey,
+				Kind:   DifferingSigningRoot,
+				Description: fmt.Sprintf(
+					"signing root at target epoch %d is %#x, %#x in the other database",
+					target,
+					signingRoot,
+					otherSigningRoot,
+				),
+			})
+		}
+	}
+	return diffs
+}
+
+func epochOrNone(epoch types.Epoch, exists bool) string {
+	if !exists {
+		return "not set"
+	}
+	return fmt.Sprintf("%d", epoch)
+}
@@ -0,0 +1,64 @@
+package kv
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	ethpb "github.com/prysmaticlabs/prysm/proto/eth/v1alpha1"
+	"github.com/prysmaticlabs/prysm/shared/testutil/assert"
+	"github.com/prysmaticlabs/prysm/shared/testutil/require"
+)
+
+func TestStore_DiffAttestationHistory(t *testing.T) {
+	ctx := context.Background()
+	pubKeys := [][48]byte{{1}, {2}, {3}, {4}}
+	source := setupDB(t, pubKeys)
+	destination := setupDB(t, pubKeys)
+
+	atts := []*ethpb.IndexedAttestation{createAttestation(1, 2), createAttestation(2, 3)}
+	signingRoots := [][32]byte{{1}, {2}}
+	for _, store := range []*Store{source, destination} {
+		require.NoError(t, store.SaveAttestationsForPubKey(ctx, pubKeys[0], signingRoots, atts))
+	}
+	diffs, err := source.DiffAttestationHistory(ctx, destination)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(diffs))
+
+	// The second key only has history in the source database.
+	require.NoError(t, source.SaveAttestationsForPubKey(ctx, pubKeys[1], signingRoots, atts))
+	// The third key has a differing signing root.
+	require.NoError(t, source.SaveAttestationsForPubKey(ctx, pubKeys[2], signingRoots, atts))
+	require.NoError(t, destination.SaveAttestationsForPubKey(ctx, pubKeys[2], [][32]byte{{1}, {3}}, atts))
+	// The fourth key has an extra attestation in the destination database.
+	require.NoError(t, source.SaveAttestationsForPubKey(ctx, pubKeys[3], signingRoots, atts))
+	require.NoError(t, destination.SaveAttestationsForPubKey(
+		ctx, pubKeys[3], [][32]byte{{1}, {2}, {3}}, append(atts, createAttestation(3, 4)),
+	))
+
+	diffs, err = source.DiffAttestationHistory(ctx, destination)
+	require.NoError(t, err)
+	require.Equal(t, 4, len(diffs))
+	assert.Equal(t, pubKeys[1], diffs[0].PubKey)
+	assert.Equal(t, MissingPubKey, diffs[0].Kind)
+	assert.Equal(t, "public key has no attesting history in the other database", diffs[0].Description)
+	assert.Equal(t, pubKeys[2], diffs[1].PubKey)
+	assert.Equal(t, DifferingSigningRoot, diffs[1].Kind)
+	assert.Equal(
+		t,
+		fmt.Sprintf("signing root at target epoch 3 is %#x, %#x in the other database", [32]byte{2}, [32]byte{3}),
+		diffs[1].Description,
+	)
+	assert.Equal(t, pubKeys[3], diffs[2].PubKey)
+	assert.Equal(t, DivergentHighestTargetEpoch, diffs[2].Kind)
+	assert.Equal(t, "highest signed target epoch is 3, 4 in the other database", diffs[2].Description)
+	assert.Equal(t, pubKeys[3], diffs[3].PubKey)
+	assert.Equal(t, MissingTargetEpoch, diffs[3].Kind)
+	assert.Equal(t, "target epoch 4 is missing from this database", diffs[3].Description)
+
+	// Comparing the other way around reports the same public keys.
+	diffs, err = destination.DiffAttestationHistory(ctx, source)
+	require.NoError(t, err)
+	require.Equal(t, 4, len(diffs))
+	assert.Equal(t, "public key has no attesting history in this database", diffs[0].Description)
+}
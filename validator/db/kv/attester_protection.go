@@ -2,16 +2,22 @@ package kv
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"hash/fnv"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/pkg/errors"
 	types "github.com/prysmaticlabs/eth2-types"
 	ethpb "github.com/prysmaticlabs/prysm/proto/eth/v1alpha1"
+	"github.com/prysmaticlabs/prysm/shared/abool"
 	"github.com/prysmaticlabs/prysm/shared/bytesutil"
+	"github.com/prysmaticlabs/prysm/shared/params"
 	"github.com/prysmaticlabs/prysm/shared/slashutil"
 	"github.com/prysmaticlabs/prysm/shared/traceutil"
+	"github.com/sirupsen/logrus"
 	bolt "go.etcd.io/bbolt"
 	"go.opencensus.io/trace"
 )
@@ -39,27 +45,81 @@ func NewQueuedAttestationRecords() *QueuedAttestationRecords {
 // QueuedAttestationRecords is a thread-safe struct for managing a queue of
 // attestation records to save to validator database.
 type QueuedAttestationRecords struct {
-	records []*AttestationRecord
-	lock    sync.RWMutex
+	sending  []*AttestationRecord
+	records  []*AttestationRecord
+	flushing []*AttestationRecord
+	lock     sync.RWMutex
+}
+
+// Send marks a record as being sent to the batching routine, which appends it to the
+// queue once received. The record is visible to PendingForPubKey from then on.
+func (p *QueuedAttestationRecords) Send(ar *AttestationRecord) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.sending = append(p.sending, ar)
+}
+
+// CancelSend should be called if a record marked by Send is not sent after all.
+func (p *QueuedAttestationRecords) CancelSend(ar *AttestationRecord) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.removeSending(ar)
 }
 
 // Append a new attestation record to the queue.
 func (p *QueuedAttestationRecords) Append(ar *AttestationRecord) {
 	p.lock.Lock()
 	defer p.lock.Unlock()
+	p.removeSending(ar)
 	p.records = append(p.records, ar)
 }
 
+// Records are received in the order they are sent, so they are usually found first.
+func (p *QueuedAttestationRecords) removeSending(ar *AttestationRecord) {
+	for i, sending := range p.sending {
+		if sending == ar {
+			p.sending = append(p.sending[:i], p.sending[i+1:]...)
+			return
+		}
+	}
+}
+
 // Flush all records. This method returns the current pending records and resets
-// the pending records slice.
+// the pending records slice. The returned records remain visible to PendingForPubKey
+// until FlushCompleted is called, so they can be checked while being written to the DB.
 func (p *QueuedAttestationRecords) Flush() []*AttestationRecord {
 	p.lock.Lock()
 	defer p.lock.Unlock()
 	recs := p.records
+	p.flushing = recs
 	p.records = make([]*AttestationRecord, 0, attestationBatchCapacity)
 	return recs
 }
 
+// FlushCompleted should be called once the records returned by Flush have been
+// written to the DB, or queued again after a failed write.
+func (p *QueuedAttestationRecords) FlushCompleted() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.flushing = nil
+}
+
+// PendingForPubKey returns the records for a public key which are being sent to the
+// batching routine, queued or currently being flushed, and thus may not be in the DB yet.
+func (p *QueuedAttestationRecords) PendingForPubKey(pubKey [48]byte) []*AttestationRecord {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	pending := make([]*AttestationRecord, 0)
+	for _, recs := range [][]*AttestationRecord{p.flushing, p.records, p.sending} {
+		for _, ar := range recs {
+			if ar.PubKey == pubKey {
+				pending = append(pending, ar)
+			}
+		}
+	}
+	return pending
+}
+
 // Len returns the current length of records.
 func (p *QueuedAttestationRecords) Len() int {
 	p.lock.RLock()
@@ -67,29 +127,170 @@ func (p *QueuedAttestationRecords) Len() int {
 	return len(p.records)
 }
 
-// A wrapper over an error received from a background routine
-// saving batched attestations for slashing protection.
-// This wrapper allows us to send this response over event feeds,
-// as our event feed does not allow sending `nil` values to
-// subscribers.
-type saveAttestationsResponse struct {
-	err error
+// attestationBatch is one shard of the attestation records batched in memory before
+// being flushed to the DB. Public keys are assigned to shards by hash, and each shard
+// has its own queue, flush lock and write interval timer, so that saving attestations
+// for validators in different shards does not serialize on a single batch.
+type attestationBatch struct {
+	records         *QueuedAttestationRecords
+	recordsChan     chan *AttestationRecord
+	acks            *recordAcks
+	flushInProgress abool.AtomicBool
+	flushLock       sync.Mutex
 }
 
+func newAttestationBatches(numShards, capacity int) []*attestationBatch {
+	batches := make([]*attestationBatch, numShards)
+	for i := range batches {
+		batches[i] = &attestationBatch{
+			records:     NewQueuedAttestationRecords(),
+			recordsChan: make(chan *AttestationRecord, capacity),
+			acks:        newRecordAcks(),
+		}
+	}
+	return batches
+}
+
+// Returns the attestation batch shard the records of a public key are queued in.
+func (s *Store) attestationBatchFor(pubKey [48]byte) *attestationBatch {
+	if len(s.attestationBatches) == 1 {
+		return s.attestationBatches[0]
+	}
+	h := fnv.New32a()
+	// Writing to a hash never returns an error.
+	_, _ = h.Write(pubKey[:])
+	return s.attestationBatches[h.Sum32()%uint32(len(s.attestationBatches))]
+}
+
+// Returns the number of attestation records queued across all batch shards.
+func (s *Store) batchedAttestationsLen() int {
+	total := 0
+	for _, batch := range s.attestationBatches {
+		total += batch.records.Len()
+	}
+	return total
+}
+
+// Returns whether any attestation batch shard is being flushed to the DB.
+func (s *Store) attestationFlushInProgress() bool {
+	for _, batch := range s.attestationBatches {
+		if batch.flushInProgress.IsSet() {
+			return true
+		}
+	}
+	return false
+}
+
+// The surround vote checks scan up to a weak subjectivity period worth of epochs,
+// so they check for context cancellation every this many iterations.
+const surroundCheckCancellationInterval = 2048
+
 // Enums representing the types of slashable events for attesters.
 const (
 	NotSlashable SlashingKind = iota
 	DoubleVote
 	SurroundingVote
 	SurroundedVote
+	DoubleProposal
+	MinimalProtectionViolation
+	SuspiciousFutureTarget
 )
 
+// String returns the name of a slashing kind, as used in logs and API responses.
+func (k SlashingKind) String() string {
+	switch k {
+	case NotSlashable:
+		return "NotSlashable"
+	case DoubleVote:
+		return "DoubleVote"
+	case SurroundingVote:
+		return "SurroundingVote"
+	case SurroundedVote:
+		return "SurroundedVote"
+	case DoubleProposal:
+		return "DoubleProposal"
+	case MinimalProtectionViolation:
+		return "MinimalProtectionViolation"
+	case SuspiciousFutureTarget:
+		return "SuspiciousFutureTarget"
+	default:
+		return fmt.Sprintf("SlashingKind(%d)", int(k))
+	}
+}
+
+// ParseSlashingKind returns the slashing kind with the given name.
+func ParseSlashingKind(name string) (SlashingKind, error) {
+	for k := NotSlashable; k <= SuspiciousFutureTarget; k++ {
+		if k.String() == name {
+			return k, nil
+		}
+	}
+	return 0, fmt.Errorf("%s is not a slashing kind", name)
+}
+
+// MarshalJSON encodes a slashing kind as its name, so that encoded values do not
+// depend on the order of the slashing kinds.
+func (k SlashingKind) MarshalJSON() ([]byte, error) {
+	if k < NotSlashable || k > SuspiciousFutureTarget {
+		return nil, fmt.Errorf("cannot marshal unknown slashing kind %d", int(k))
+	}
+	return json.Marshal(k.String())
+}
+
+// UnmarshalJSON decodes a slashing kind from its name.
+func (k *SlashingKind) UnmarshalJSON(enc []byte) error {
+	var name string
+	if err := json.Unmarshal(enc, &name); err != nil {
+		return err
+	}
+	kind, err := ParseSlashingKind(name)
+	if err != nil {
+		return err
+	}
+	*k = kind
+	return nil
+}
+
 var (
-	doubleVoteMessage      = "double vote found, existing attestation at target epoch %d with conflicting signing root %#x"
+	doubleVoteMessage      = "double vote found, existing attestation at target epoch %d with conflicting signing root %#x, incoming signing root %#x"
 	surroundingVoteMessage = "attestation with (source %d, target %d) surrounds another with (source %d, target %d)"
 	surroundedVoteMessage  = "attestation with (source %d, target %d) is surrounded by another with (source %d, target %d)"
+	minimalSourceMessage   = "attestation with source epoch %d is lower than the lowest signed source epoch %d"
+	minimalTargetMessage   = "attestation with target epoch %d is lower than or equal to the highest signed target epoch %d"
+	missingBoundMessage    = "public key %#x has no lowest signed source epoch but has attested with source epoch %d"
+	lowestSourceMessage    = "public key %#x has lowest signed source epoch %d but has attested with source epoch %d"
+	highestTargetMessage   = "public key %#x has highest signed target epoch %d but has attested with target epoch %d"
+	futureTargetMessage    = "attestation with target epoch %d is more than %d epochs beyond the highest signed target epoch %d"
 )
 
+// DoubleVoteError is returned when an incoming attestation has a different
+// signing root than an attestation already signed at the same target epoch.
+type DoubleVoteError struct {
+	TargetEpoch         types.Epoch
+	ExistingSigningRoot [32]byte
+	IncomingSigningRoot [32]byte
+}
+
+// Error returns a description of the double vote, including both signing roots.
+func (e *DoubleVoteError) Error() string {
+	return fmt.Sprintf(doubleVoteMessage, e.TargetEpoch, e.ExistingSigningRoot, e.IncomingSigningRoot)
+}
+
+// SuspiciousFutureTargetError is returned, if enabled, when an incoming attestation has a
+// target epoch more than the weak subjectivity period beyond the highest signed target epoch.
+// The attestation is not slashable, so callers may choose to ignore this error.
+type SuspiciousFutureTargetError struct {
+	TargetEpoch        types.Epoch
+	HighestTargetEpoch types.Epoch
+}
+
+// Error returns a description of the suspicious target epoch.
+func (e *SuspiciousFutureTargetError) Error() string {
+	return fmt.Sprintf(
+		futureTargetMessage, e.TargetEpoch, params.BeaconConfig().WeakSubjectivityPeriod, e.HighestTargetEpoch,
+	)
+}
+
 // AttestationHistoryForPubKey retrieves a list of attestation records for data
 // we have stored in the database for the given validator public key.
 func (s *Store) AttestationHistoryForPubKey(ctx context.Context, pubKey [48]byte) ([]*AttestationRecord, error) {
@@ -102,33 +303,149 @@ func (s *Store) AttestationHistoryForPubKey(ctx context.Context, pubKey [48]byte
 		if pkBucket == nil {
 			return nil
 		}
-		signingRootsBucket := pkBucket.Bucket(attestationSigningRootsBucket)
-		sourceEpochsBucket := pkBucket.Bucket(attestationSourceEpochsBucket)
-
-		return sourceEpochsBucket.ForEach(func(sourceBytes, targetEpochsList []byte) error {
-			targetEpochs := make([]types.Epoch, 0)
-			for i := 0; i < len(targetEpochsList); i += 8 {
-				epoch := bytesutil.BytesToEpochBigEndian(targetEpochsList[i : i+8])
-				targetEpochs = append(targetEpochs, epoch)
+		signingRootsBucket := pkBucket.Bucket(s.epochKeys.signingRootsBucket)
+		newRecord := func(sourceEpoch, targetEpoch types.Epoch) *AttestationRecord {
+			record := &AttestationRecord{
+				Source: sourceEpoch,
+				Target: targetEpoch,
 			}
-			sourceEpoch := bytesutil.BytesToEpochBigEndian(sourceBytes)
-			for _, targetEpoch := range targetEpochs {
-				record := &AttestationRecord{
-					Source: sourceEpoch,
-					Target: targetEpoch,
-				}
-				signingRoot := signingRootsBucket.Get(bytesutil.EpochToBytesBigEndian(targetEpoch))
-				if signingRoot != nil {
-					copy(record.SigningRoot[:], signingRoot)
+			signingRoot := s.epochKeys.get(signingRootsBucket, targetEpoch)
+			if signingRoot != nil {
+				copy(record.SigningRoot[:], signingRoot)
+			}
+			return record
+		}
+		if sourceEpochsBucket := pkBucket.Bucket(s.epochKeys.sourceEpochsBucket); sourceEpochsBucket != nil {
+			if err := sourceEpochsBucket.ForEach(func(sourceBytes, targetEpochsList []byte) error {
+				targetEpochs := s.epochKeys.decodeList(targetEpochsList)
+				sourceEpoch := s.epochKeys.decode(sourceBytes)
+				for _, targetEpoch := range targetEpochs {
+					records = append(records, newRecord(sourceEpoch, targetEpoch))
 				}
-				records = append(records, record)
+				return nil
+			}); err != nil {
+				return err
 			}
+		}
+
+		// Attestations held by sequential runs are expanded, keeping records ordered by source epoch.
+		runs := s.sequentialRuns(pkBucket)
+		if len(runs) == 0 {
 			return nil
+		}
+		for _, run := range runs {
+			for sourceEpoch := run.start; sourceEpoch < run.end; sourceEpoch++ {
+				records = append(records, newRecord(sourceEpoch, sourceEpoch+1))
+			}
+		}
+		sort.SliceStable(records, func(i, j int) bool {
+			return records[i].Source < records[j].Source
 		})
+		return nil
 	})
 	return records, err
 }
 
+// TargetForSource returns the target epoch attested with the given source epoch by a
+// validator public key, and whether one is recorded. Several target epochs may be
+// recorded for a single source epoch, in which case the highest one is returned, as it
+// is the one which matters when explaining surround vote detection.
+func (s *Store) TargetForSource(
+	ctx context.Context, pubKey [48]byte, source types.Epoch,
+) (types.Epoch, bool, error) {
+	ctx, span := trace.StartSpan(ctx, "Validator.TargetForSource")
+	defer span.End()
+	var target types.Epoch
+	var exists bool
+	err := s.view(func(tx *bolt.Tx) error {
+		pkBucket := tx.Bucket(pubKeysBucket).Bucket(pubKey[:])
+		if pkBucket == nil {
+			return nil
+		}
+		for _, targetEpoch := range s.epochKeys.decodeList(
+			s.epochKeys.get(pkBucket.Bucket(s.epochKeys.sourceEpochsBucket), source),
+		) {
+			if !exists || targetEpoch > target {
+				target = targetEpoch
+			}
+			exists = true
+		}
+		if s.inSequentialRun(pkBucket, source, source+1) && (!exists || source+1 > target) {
+			target, exists = source+1, true
+		}
+		return nil
+	})
+	return target, exists, err
+}
+
+// ForEachAttestation calls fn for every attestation record stored for the given validator
+// public key, without loading the whole history into memory. Records are visited in
+// ascending target epoch order, and records sharing a target epoch in ascending source
+// epoch order. Iteration stops at the first error returned by fn, which is then returned.
+// The callback runs inside a read transaction and must not write to the database.
+func (s *Store) ForEachAttestation(
+	ctx context.Context, pubKey [48]byte, fn func(source, target types.Epoch, signingRoot [32]byte) error,
+) error {
+	ctx, span := trace.StartSpan(ctx, "Validator.ForEachAttestation")
+	defer span.End()
+	return s.view(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(pubKeysBucket)
+		pkBucket := bucket.Bucket(pubKey[:])
+		if pkBucket == nil {
+			return nil
+		}
+		signingRootsBucket := pkBucket.Bucket(s.epochKeys.signingRootsBucket)
+		signingRootAt := func(targetEpoch types.Epoch) [32]byte {
+			var signingRoot [32]byte
+			copy(signingRoot[:], s.epochKeys.get(signingRootsBucket, targetEpoch))
+			return signingRoot
+		}
+		// Attestations held by sequential runs are merged in target epoch order.
+		runPairs := newSequentialRunPairs(s.sequentialRuns(pkBucket))
+		visitRunPairsBefore := func(targetEpoch types.Epoch, all bool) error {
+			for runTarget, ok := runPairs.peek(); ok && (all || runTarget < targetEpoch); runTarget, ok = runPairs.peek() {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				if err := fn(runTarget-1, runTarget, signingRootAt(runTarget)); err != nil {
+					return err
+				}
+				runPairs.advance()
+			}
+			return nil
+		}
+
+		if targetEpochsBucket := pkBucket.Bucket(s.epochKeys.targetEpochsBucket); targetEpochsBucket != nil {
+			// Target epochs are encoded big-endian, so the cursor walks them in ascending order.
+			c := targetEpochsBucket.Cursor()
+			for targetBytes, sourceEpochsList := c.First(); targetBytes != nil; targetBytes, sourceEpochsList = c.Next() {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				targetEpoch := s.epochKeys.decode(targetBytes)
+				if err := visitRunPairsBefore(targetEpoch, false); err != nil {
+					return err
+				}
+				sourceEpochs := s.epochKeys.decodeList(sourceEpochsList)
+				if runTarget, ok := runPairs.peek(); ok && runTarget == targetEpoch {
+					sourceEpochs = append(sourceEpochs, targetEpoch-1)
+					runPairs.advance()
+				}
+				sort.Slice(sourceEpochs, func(i, j int) bool {
+					return sourceEpochs[i] < sourceEpochs[j]
+				})
+				signingRoot := signingRootAt(targetEpoch)
+				for _, sourceEpoch := range sourceEpochs {
+					if err := fn(sourceEpoch, targetEpoch, signingRoot); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return visitRunPairsBefore(0, true)
+	})
+}
+
 // CheckSlashableAttestation verifies an incoming attestation is
 // not a double vote for a validator public key nor a surround vote.
 func (s *Store) CheckSlashableAttestation(
@@ -136,77 +453,236 @@ func (s *Store) CheckSlashableAttestation(
 ) (SlashingKind, error) {
 	ctx, span := trace.StartSpan(ctx, "Validator.CheckSlashableAttestation")
 	defer span.End()
+	slashKind, err := s.checkSlashableAttestation(ctx, pubKey, signingRoot, att)
+	// Only an attestation which is not slashable is checked for a suspicious target epoch,
+	// so that a slashable one is always reported as such.
+	if err == nil && slashKind == NotSlashable && s.detectSuspiciousFutureTargets {
+		if err := s.checkSuspiciousFutureTarget(pubKey, att); err != nil {
+			traceutil.AnnotateError(span, err)
+			return SuspiciousFutureTarget, err
+		}
+	}
+	traceutil.AnnotateError(span, err)
+	s.notifySlashingDetection(pubKey, slashKind, att)
+	return slashKind, err
+}
+
+// Checks an incoming attestation against the batched and stored attesting history of a
+// public key, without calling the slashing detection hook.
+func (s *Store) checkSlashableAttestation(
+	ctx context.Context, pubKey [48]byte, signingRoot [32]byte, att *ethpb.IndexedAttestation,
+) (SlashingKind, error) {
+	// Records which are batched but not yet flushed are checked before the DB.
+	// A record is only removed from the batch once it has been written, so it is
+	// always visible either here or in the DB view opened below.
+	slashKind, err := s.checkPendingAttestations(pubKey, signingRoot, att)
+	if err != nil {
+		return slashKind, err
+	}
+	return s.checkStoredAttestations(ctx, pubKey, signingRoot, att)
+}
+
+// Checks an incoming attestation against the attesting history of a public key stored in
+// the DB, unless the signed epochs cache shows it is newer than the whole history.
+func (s *Store) checkStoredAttestations(
+	ctx context.Context, pubKey [48]byte, signingRoot [32]byte, att *ethpb.IndexedAttestation,
+) (SlashingKind, error) {
+	// Attestations newer than the whole attesting history are allowed without reading the DB.
+	// The cache never rejects an attestation, which is otherwise checked against the DB below.
+	if s.signedEpochs != nil && s.signedEpochs.isSafe(pubKey, att.Data.Source.Epoch, att.Data.Target.Epoch) {
+		return NotSlashable, nil
+	}
 	var slashKind SlashingKind
 	err := s.view(func(tx *bolt.Tx) error {
 		if ctx.Err() != nil {
 			return ctx.Err()
 		}
+		if s.minimalSlashingProtection {
+			var err error
+			slashKind, err = s.checkMinimalSlashableAttestation(tx, pubKey, att)
+			return err
+		}
 		bucket := tx.Bucket(pubKeysBucket)
 		pkBucket := bucket.Bucket(pubKey[:])
 		if pkBucket == nil {
 			return nil
 		}
 
-		// First we check for double votes.
-		signingRootsBucket := pkBucket.Bucket(attestationSigningRootsBucket)
+		// First we check for double votes. There may be several signing roots
+		// stored per target epoch if all signing roots are kept.
+		signingRootsBucket := pkBucket.Bucket(s.epochKeys.signingRootsBucket)
 		if signingRootsBucket != nil {
-			targetEpochBytes := bytesutil.EpochToBytesBigEndian(att.Data.Target.Epoch)
-			existingSigningRoot := signingRootsBucket.Get(targetEpochBytes)
-			if existingSigningRoot != nil {
-				var existing [32]byte
-				copy(existing[:], existingSigningRoot)
+			existingSigningRoots := s.epochKeys.get(signingRootsBucket, att.Data.Target.Epoch)
+			for _, existing := range decodeSigningRoots(existingSigningRoots) {
 				if slashutil.SigningRootsDiffer(existing, signingRoot) {
 					slashKind = DoubleVote
-					return fmt.Errorf(doubleVoteMessage, att.Data.Target.Epoch, existingSigningRoot)
+					return &DoubleVoteError{
+						TargetEpoch:         att.Data.Target.Epoch,
+						ExistingSigningRoot: existing,
+						IncomingSigningRoot: signingRoot,
+					}
 				}
 			}
 		}
 
-		sourceEpochsBucket := pkBucket.Bucket(attestationSourceEpochsBucket)
-		targetEpochsBucket := pkBucket.Bucket(attestationTargetEpochsBucket)
-		if sourceEpochsBucket == nil {
-			return nil
-		}
+		sourceEpochsBucket := pkBucket.Bucket(s.epochKeys.sourceEpochsBucket)
+		targetEpochsBucket := pkBucket.Bucket(s.epochKeys.targetEpochsBucket)
 
 		// Is this attestation surrounding any other?
 		var err error
-		slashKind, err = s.checkSurroundingVote(sourceEpochsBucket, att)
-		if err != nil {
-			return err
+		if sourceEpochsBucket != nil {
+			slashKind, err = s.checkSurroundingVote(ctx, sourceEpochsBucket, att)
+			if err != nil {
+				return err
+			}
+		}
+		if runsBucket := pkBucket.Bucket(s.epochKeys.sequentialRunsBucket); runsBucket != nil {
+			slashKind, err = s.checkSurroundingSequentialRuns(ctx, runsBucket, att)
+			if err != nil {
+				return err
+			}
 		}
+		// Sequential attestations never surround another attestation, so runs are not checked here.
 		if targetEpochsBucket == nil {
 			return nil
 		}
 
 		// Is this attestation surrounded by any other?
-		slashKind, err = s.checkSurroundedVote(targetEpochsBucket, att)
+		slashKind, err = s.checkSurroundedVote(ctx, targetEpochsBucket, att)
 		if err != nil {
 			return err
 		}
 		return nil
 	})
-
-	traceutil.AnnotateError(span, err)
 	return slashKind, err
 }
 
+// Checks whether the target epoch of an incoming attestation is more than the weak subjectivity
+// period beyond the highest target epoch signed by the public key, including batched records.
+func (s *Store) checkSuspiciousFutureTarget(pubKey [48]byte, att *ethpb.IndexedAttestation) error {
+	var highestTarget types.Epoch
+	var exists bool
+	if err := s.view(func(tx *bolt.Tx) error {
+		highestTarget, exists = s.highestSignedTargetEpoch(tx, pubKey)
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, ar := range s.attestationBatchFor(pubKey).records.PendingForPubKey(pubKey) {
+		if !exists || ar.Target > highestTarget {
+			highestTarget = ar.Target
+			exists = true
+		}
+	}
+	if !exists || att.Data.Target.Epoch <= highestTarget+params.BeaconConfig().WeakSubjectivityPeriod {
+		return nil
+	}
+	return &SuspiciousFutureTargetError{
+		TargetEpoch:        att.Data.Target.Epoch,
+		HighestTargetEpoch: highestTarget,
+	}
+}
+
+// Calls the configured slashing detection hook, if any, for a slashable attestation.
+// The hook runs in its own goroutine so that it cannot hold up the slashing check.
+func (s *Store) notifySlashingDetection(pubKey [48]byte, kind SlashingKind, att *ethpb.IndexedAttestation) {
+	if s.slashingDetectionHook == nil || kind == NotSlashable {
+		return
+	}
+	go s.slashingDetectionHook(pubKey, kind, att.Data.Source.Epoch, att.Data.Target.Epoch)
+}
+
+// Checks an incoming attestation against the batched attestation records of the
+// same public key which may not have been flushed to the DB yet.
+func (s *Store) checkPendingAttestations(
+	pubKey [48]byte, signingRoot [32]byte, att *ethpb.IndexedAttestation,
+) (SlashingKind, error) {
+	pending := s.attestationBatchFor(pubKey).records.PendingForPubKey(pubKey)
+	return checkAttestationRecords(pending, s.minimalSlashingProtection, signingRoot, att)
+}
+
+// Checks an incoming attestation against a list of attestation records of the same public key.
+func checkAttestationRecords(
+	records []*AttestationRecord, minimal bool, signingRoot [32]byte, att *ethpb.IndexedAttestation,
+) (SlashingKind, error) {
+	for _, ar := range records {
+		if minimal {
+			if att.Data.Target.Epoch <= ar.Target {
+				return MinimalProtectionViolation, fmt.Errorf(
+					minimalTargetMessage, att.Data.Target.Epoch, ar.Target,
+				)
+			}
+			continue
+		}
+		if ar.Target == att.Data.Target.Epoch && slashutil.SigningRootsDiffer(ar.SigningRoot, signingRoot) {
+			return DoubleVote, &DoubleVoteError{
+				TargetEpoch:         att.Data.Target.Epoch,
+				ExistingSigningRoot: ar.SigningRoot,
+				IncomingSigningRoot: signingRoot,
+			}
+		}
+		existingAtt := &ethpb.IndexedAttestation{
+			Data: &ethpb.AttestationData{
+				Source: &ethpb.Checkpoint{Epoch: ar.Source},
+				Target: &ethpb.Checkpoint{Epoch: ar.Target},
+			},
+		}
+		if slashutil.IsSurround(att, existingAtt) {
+			return SurroundingVote, fmt.Errorf(
+				surroundingVoteMessage, att.Data.Source.Epoch, att.Data.Target.Epoch, ar.Source, ar.Target,
+			)
+		}
+		if slashutil.IsSurround(existingAtt, att) {
+			return SurroundedVote, fmt.Errorf(
+				surroundedVoteMessage, att.Data.Source.Epoch, att.Data.Target.Epoch, ar.Source, ar.Target,
+			)
+		}
+	}
+	return NotSlashable, nil
+}
+
+// With minimal slashing protection, an incoming attestation is rejected if its source epoch
+// is lower than the lowest signed source epoch or if its target epoch is lower than or
+// equal to the highest signed target epoch for the validator public key.
+func (s *Store) checkMinimalSlashableAttestation(
+	tx *bolt.Tx, pubKey [48]byte, att *ethpb.IndexedAttestation,
+) (SlashingKind, error) {
+	lowestSourceBytes := tx.Bucket(lowestSignedSourceBucket).Get(pubKey[:])
+	if len(lowestSourceBytes) >= 8 {
+		lowestSourceEpoch := bytesutil.BytesToEpochBigEndian(lowestSourceBytes)
+		if att.Data.Source.Epoch < lowestSourceEpoch {
+			return MinimalProtectionViolation, fmt.Errorf(
+				minimalSourceMessage, att.Data.Source.Epoch, lowestSourceEpoch,
+			)
+		}
+	}
+	highestTargetEpoch, exists := s.highestSignedTargetEpoch(tx, pubKey)
+	if exists && att.Data.Target.Epoch <= highestTargetEpoch {
+		return MinimalProtectionViolation, fmt.Errorf(
+			minimalTargetMessage, att.Data.Target.Epoch, highestTargetEpoch,
+		)
+	}
+	return NotSlashable, nil
+}
+
 // Iterate from the back of the bucket since we are looking for target_epoch > att.target_epoch
 func (s *Store) checkSurroundedVote(
-	targetEpochsBucket *bolt.Bucket, att *ethpb.IndexedAttestation,
+	ctx context.Context, targetEpochsBucket *bolt.Bucket, att *ethpb.IndexedAttestation,
 ) (SlashingKind, error) {
 	c := targetEpochsBucket.Cursor()
+	iterations := 0
 	for k, v := c.Last(); k != nil; k, v = c.Prev() {
-		existingTargetEpoch := bytesutil.BytesToEpochBigEndian(k)
+		iterations++
+		if iterations%surroundCheckCancellationInterval == 0 && ctx.Err() != nil {
+			return NotSlashable, ctx.Err()
+		}
+		existingTargetEpoch := s.epochKeys.decode(k)
 		if existingTargetEpoch <= att.Data.Target.Epoch {
 			break
 		}
 
 		// There can be multiple source epochs attested per target epoch.
-		attestedSourceEpochs := make([]types.Epoch, 0, len(v)/8)
-		for i := 0; i < len(v); i += 8 {
-			sourceEpoch := bytesutil.BytesToEpochBigEndian(v[i : i+8])
-			attestedSourceEpochs = append(attestedSourceEpochs, sourceEpoch)
-		}
+		attestedSourceEpochs := s.epochKeys.decodeList(v)
 
 		for _, existingSourceEpoch := range attestedSourceEpochs {
 			existingAtt := &ethpb.IndexedAttestation{
@@ -232,21 +708,22 @@ func (s *Store) checkSurroundedVote(
 
 // Iterate from the back of the bucket since we are looking for source_epoch > att.source_epoch
 func (s *Store) checkSurroundingVote(
-	sourceEpochsBucket *bolt.Bucket, att *ethpb.IndexedAttestation,
+	ctx context.Context, sourceEpochsBucket *bolt.Bucket, att *ethpb.IndexedAttestation,
 ) (SlashingKind, error) {
 	c := sourceEpochsBucket.Cursor()
+	iterations := 0
 	for k, v := c.Last(); k != nil; k, v = c.Prev() {
-		existingSourceEpoch := bytesutil.BytesToEpochBigEndian(k)
+		iterations++
+		if iterations%surroundCheckCancellationInterval == 0 && ctx.Err() != nil {
+			return NotSlashable, ctx.Err()
+		}
+		existingSourceEpoch := s.epochKeys.decode(k)
 		if existingSourceEpoch <= att.Data.Source.Epoch {
 			break
 		}
 
 		// There can be multiple target epochs attested per source epoch.
-		attestedTargetEpochs := make([]types.Epoch, 0, len(v)/8)
-		for i := 0; i < len(v); i += 8 {
-			targetEpoch := bytesutil.BytesToEpochBigEndian(v[i : i+8])
-			attestedTargetEpochs = append(attestedTargetEpochs, targetEpoch)
-		}
+		attestedTargetEpochs := s.epochKeys.decodeList(v)
 
 		for _, existingTargetEpoch := range attestedTargetEpochs {
 			existingAtt := &ethpb.IndexedAttestation{
@@ -285,6 +762,9 @@ func (s *Store) SaveAttestationsForPubKey(
 	}
 	records := make([]*AttestationRecord, len(atts))
 	for i, a := range atts {
+		if err := validateAttestation(a); err != nil {
+			return err
+		}
 		records[i] = &AttestationRecord{
 			PubKey:      pubKey,
 			Source:      a.Data.Source.Epoch,
@@ -295,6 +775,23 @@ func (s *Store) SaveAttestationsForPubKey(
 	return s.saveAttestationRecords(ctx, records)
 }
 
+// SaveAttestationRecordsForPubKey stores attestation records for a validator public key
+// in a single transaction, bypassing the batching done by SaveAttestationForPubKey. This
+// is meant for importing a whole attesting history at once. Every record must be for
+// the given public key.
+func (s *Store) SaveAttestationRecordsForPubKey(
+	ctx context.Context, pubKey [48]byte, records []*AttestationRecord,
+) error {
+	ctx, span := trace.StartSpan(ctx, "Validator.SaveAttestationRecordsForPubKey")
+	defer span.End()
+	for _, record := range records {
+		if record.PubKey != pubKey {
+			return fmt.Errorf("attestation record public key %#x does not match %#x", record.PubKey, pubKey)
+		}
+	}
+	return s.saveAttestationRecords(ctx, records)
+}
+
 // SaveAttestationForPubKey saves an attestation for a validator public
 // key for local validator slashing protection.
 func (s *Store) SaveAttestationForPubKey(
@@ -302,194 +799,473 @@ func (s *Store) SaveAttestationForPubKey(
 ) error {
 	ctx, span := trace.StartSpan(ctx, "Validator.SaveAttestationForPubKey")
 	defer span.End()
-	s.batchedAttestationsChan <- &AttestationRecord{
+	// Records are not batched in read-only mode, so we return
+	// an error rather than waiting on a flush that never happens.
+	if s.readOnly {
+		return ErrReadOnly
+	}
+	// If the context is already cancelled, we drop the record
+	// without queueing it for saving to the DB.
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	// A record which cannot be stored would fail its whole batch, so it is rejected before being queued.
+	if err := validateAttestation(att); err != nil {
+		return err
+	}
+	if err := s.checkEpochKeysFit(att.Data.Source.Epoch, att.Data.Target.Epoch); err != nil {
+		return err
+	}
+	// A decreasing target epoch is only rejected before the record is queued if the store is
+	// configured to do so. Otherwise, it is logged when the batch is flushed.
+	if s.rejectDecreasingTargets {
+		if err := s.checkDecreasingTarget(ctx, pubKey, att.Data.Target.Epoch); err != nil {
+			return err
+		}
+	}
+	batch := s.attestationBatchFor(pubKey)
+	record := &AttestationRecord{
 		PubKey:      pubKey,
 		Source:      att.Data.Source.Epoch,
 		Target:      att.Data.Target.Epoch,
 		SigningRoot: signingRoot,
 	}
-	// Subscribe to be notified when the attestation record queued
-	// for saving to the DB is indeed saved. If an error occurred
-	// during the process of saving the attestation record, the sender
-	// will give us that error. We use a buffered channel
-	// to prevent blocking the sender from notifying us of the result.
-	responseChan := make(chan saveAttestationsResponse, 1)
-	defer close(responseChan)
-	sub := s.batchAttestationsFlushedFeed.Subscribe(responseChan)
-	defer sub.Unsubscribe()
-	res := <-responseChan
-	return res.err
-}
-
-// Meant to run as a background routine, this function checks whether:
-// (a) we have reached a max capacity of batched attestations in the Store or
-// (b) attestationBatchWriteInterval has passed
+	// Register to be notified when the flush which writes this very record
+	// to the DB completes. If an error occurred during the process of saving
+	// the attestation record, the flush will give us that error.
+	responseChan := batch.acks.register(record)
+	defer batch.acks.cancel(record)
+	// The record is checked by CheckSlashableAttestation while waiting in the channel.
+	batch.records.Send(record)
+	select {
+	case batch.recordsChan <- record:
+	case <-ctx.Done():
+		batch.records.CancelSend(record)
+		return ctx.Err()
+	}
+	// Once queued, the record is flushed along with the rest of its batch in
+	// a single DB transaction, so it is either fully saved or not saved at all
+	// even if we stop waiting for the result due to a cancelled context.
+	select {
+	case res := <-responseChan:
+		if res.err != nil {
+			return res.err
+		}
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
+
+// Returns true if the attesting history of a public key already holds an attestation record
+// with the same source and target epochs and signing root. With minimal slashing protection,
+// the attesting history is not kept, so records are never found.
+func (s *Store) attestationSaved(tx *bolt.Tx, record *AttestationRecord) bool {
+	if s.minimalSlashingProtection {
+		return false
+	}
+	pkBucket := tx.Bucket(pubKeysBucket).Bucket(record.PubKey[:])
+	if pkBucket == nil {
+		return false
+	}
+	signingRootsBucket := pkBucket.Bucket(s.epochKeys.signingRootsBucket)
+	if signingRootsBucket == nil {
+		return false
+	}
+	source, target := record.Source, record.Target
+	if !signingRootsContain(s.epochKeys.get(signingRootsBucket, target), record.SigningRoot) {
+		return false
+	}
+	if s.inSequentialRun(pkBucket, source, target) {
+		return true
+	}
+	sourceEpochsBucket := pkBucket.Bucket(s.epochKeys.sourceEpochsBucket)
+	targetEpochsBucket := pkBucket.Bucket(s.epochKeys.targetEpochsBucket)
+	if sourceEpochsBucket == nil || targetEpochsBucket == nil {
+		return false
+	}
+	return s.epochKeys.listContains(s.epochKeys.get(sourceEpochsBucket, source), s.epochKeys.encode(target)) &&
+		s.epochKeys.listContains(s.epochKeys.get(targetEpochsBucket, target), s.epochKeys.encode(source))
+}
+
+// Logs the batched attestation records with a lower target epoch than the highest target epoch
+// signed by their validator, as stored or within the batch itself. A correctly functioning
+// validator never votes backwards, so such a record is a sign of an upstream bug.
+func logDecreasingTargets(tx *bolt.Tx, records []*AttestationRecord) {
+	highestTargetBucket := tx.Bucket(highestSignedTargetBucket)
+	highestTargets := make(map[[48]byte]types.Epoch)
+	for _, record := range records {
+		highestTarget, ok := highestTargets[record.PubKey]
+		if !ok {
+			highestTargetBytes := highestTargetBucket.Get(record.PubKey[:])
+			if len(highestTargetBytes) < 8 {
+				highestTargets[record.PubKey] = record.Target
+				continue
+			}
+			highestTarget = bytesutil.BytesToEpochBigEndian(highestTargetBytes)
+		}
+		if record.Target < highestTarget {
+			logDecreasingTarget(record.PubKey, record.Target, highestTarget)
+		} else {
+			highestTarget = record.Target
+		}
+		highestTargets[record.PubKey] = highestTarget
+	}
+}
+
+func logDecreasingTarget(pubKey [48]byte, target, highestTarget types.Epoch) {
+	log.WithFields(logrus.Fields{
+		"publicKey":                fmt.Sprintf("%#x", bytesutil.Trunc(pubKey[:])),
+		"targetEpoch":              target,
+		"highestSignedTargetEpoch": highestTarget,
+	}).Warn("Saving attestation with a lower target epoch than the highest signed target epoch")
+}
+
+// Checks an incoming target epoch against the highest target epoch signed by the
+// validator, including batched records not yet written, and rejects a lower one.
+func (s *Store) checkDecreasingTarget(ctx context.Context, pubKey [48]byte, target types.Epoch) error {
+	highestTarget, exists, err := s.HighestSignedTargetEpoch(ctx, pubKey)
+	if err != nil {
+		return errors.Wrap(err, "could not get highest signed target epoch")
+	}
+	for _, ar := range s.attestationBatchFor(pubKey).records.PendingForPubKey(pubKey) {
+		if !exists || ar.Target > highestTarget {
+			highestTarget = ar.Target
+			exists = true
+		}
+	}
+	if !exists || target >= highestTarget {
+		return nil
+	}
+	logDecreasingTarget(pubKey, target, highestTarget)
+	return fmt.Errorf(
+		"attestation target epoch %d is lower than highest signed target epoch %d",
+		target,
+		highestTarget,
+	)
+}
+
+// Meant to run as a background routine for each attestation batch shard, this function checks whether:
+// (a) we have reached a max capacity of batched attestations in the shard or
+// (b) the configured attestation batch write interval has passed
 // Based on whichever comes first, this function then proceeds
 // to flush the attestations to the DB all at once in a single boltDB
 // transaction for efficiency. Then, batched attestations slice is emptied out.
-func (s *Store) batchAttestationWrites(ctx context.Context) {
-	ticker := time.NewTicker(attestationBatchWriteInterval)
+func (s *Store) batchAttestationWrites(ctx context.Context, batch *attestationBatch) {
+	ticker := time.NewTicker(s.attestationBatchWriteInterval)
 	defer ticker.Stop()
+	rb := &recordBatch{
+		recordType:  "attestation",
+		capacity:    s.attestationBatchCapacity,
+		numRecords:  batch.records.Len,
+		queueLength: s.batchedAttestationsLen,
+		flush: func(ctx context.Context, reason string) {
+			batch.flushLock.Lock()
+			defer batch.flushLock.Unlock()
+			s.flushAttestationRecords(ctx, batch, batch.records.Flush(), reason)
+			batch.records.FlushCompleted()
+		},
+		flushInProgress: &batch.flushInProgress,
+		metrics:         attestationBatchMetrics,
+	}
 	for {
 		select {
-		case v := <-s.batchedAttestationsChan:
-			s.batchedAttestations.Append(v)
-			if numRecords := s.batchedAttestations.Len(); numRecords >= attestationBatchCapacity {
-				log.WithField("numRecords", numRecords).Debug(
-					"Reached max capacity of batched attestation records, flushing to DB",
-				)
-				if s.batchedAttestationsFlushInProgress.IsNotSet() {
-					s.flushAttestationRecords(ctx, s.batchedAttestations.Flush())
-				}
-			}
+		case v := <-batch.recordsChan:
+			batch.records.Append(v)
+			rb.recordQueued(ctx)
 		case <-ticker.C:
-			if numRecords := s.batchedAttestations.Len(); numRecords > 0 {
-				log.WithField("numRecords", numRecords).Debug(
-					"Batched attestation records write interval reached, flushing to DB",
-				)
-				if s.batchedAttestationsFlushInProgress.IsNotSet() {
-					s.flushAttestationRecords(ctx, s.batchedAttestations.Flush())
-				}
-			}
+			rb.writeIntervalReached(ctx)
 		case <-ctx.Done():
 			return
 		}
 	}
 }
 
+// FlushAttestationBatch immediately writes all batched attestation records to the
+// database, waiting for any flush already in progress. If the context is done before
+// the records are written, an error is returned as they may not have been saved.
+func (s *Store) FlushAttestationBatch(ctx context.Context) error {
+	ctx, span := trace.StartSpan(ctx, "Validator.FlushAttestationBatch")
+	defer span.End()
+	err := flushBatchBeforeDeadline(ctx, "attestation", func() error {
+		var flushErr error
+		for _, batch := range s.attestationBatches {
+			if err := s.flushAttestationBatch(ctx, batch); err != nil && flushErr == nil {
+				flushErr = err
+			}
+		}
+		return flushErr
+	})
+	traceutil.AnnotateError(span, err)
+	return err
+}
+
+// Immediately writes the records of a single attestation batch shard to the database.
+func (s *Store) flushAttestationBatch(ctx context.Context, batch *attestationBatch) error {
+	batch.flushLock.Lock()
+	defer batch.flushLock.Unlock()
+	return s.flushLockedAttestationBatch(ctx, batch)
+}
+
+// Writes the records of an attestation batch shard whose flush lock is held by the caller.
+func (s *Store) flushLockedAttestationBatch(ctx context.Context, batch *attestationBatch) error {
+	// Records may still be waiting in the channel if the batching routine has stopped.
+	for drained := false; !drained; {
+		select {
+		case v := <-batch.recordsChan:
+			batch.records.Append(v)
+		default:
+			drained = true
+		}
+	}
+	if batch.records.Len() == 0 {
+		return nil
+	}
+	err := s.flushAttestationRecords(ctx, batch, batch.records.Flush(), flushReasonExplicit)
+	batch.records.FlushCompleted()
+	return err
+}
+
 // Flushes a list of batched attestations to the database
 // and resets the list of batched attestations for future writes.
-// This function notifies all subscribers for flushed attestations
+// This function notifies the callers waiting on each of the records
 // of the result of the save operation.
-func (s *Store) flushAttestationRecords(ctx context.Context, records []*AttestationRecord) {
-	if s.batchedAttestationsFlushInProgress.IsSet() {
-		// This should never happen. This method should not be called when a flush is already in
-		// progress. If you are seeing this log, check the atomic bool before calling this method.
-		log.Error("Attempted to flush attestation records when already in progress")
-		return
+func (s *Store) flushAttestationRecords(
+	ctx context.Context, batch *attestationBatch, records []*AttestationRecord, reason string,
+) error {
+	pubKeys := make(map[[48]byte]bool)
+	for _, ar := range records {
+		pubKeys[ar.PubKey] = true
 	}
-	s.batchedAttestationsFlushInProgress.Set()
-	defer s.batchedAttestationsFlushInProgress.UnSet()
+	return flushBatchedRecords(
+		"attestation",
+		reason,
+		len(records),
+		len(pubKeys),
+		&batch.flushInProgress,
+		attestationBatchMetrics,
+		func() error {
+			err := saveWithRetries(ctx, "attestation", func() error {
+				return s.saveBatchedAttestationRecords(ctx, records)
+			})
+			// If there was any error, retry the records since the TX would have been reverted.
+			if err != nil {
+				for _, ar := range records {
+					batch.records.Append(ar)
+				}
+			}
+			return err
+		},
+		func(err error) {
+			for _, ar := range records {
+				batch.acks.ack(ar, err)
+			}
+		},
+	)
+}
 
-	start := time.Now()
-	err := s.saveAttestationRecords(ctx, records)
-	// If there was any error, retry the records since the TX would have been reverted.
-	if err == nil {
-		log.WithField("duration", time.Since(start)).Debug("Successfully flushed batched attestations to DB")
-	} else {
-		// This should never happen.
-		log.WithError(err).Error("Failed to batch save attestation records, retrying in queue")
-		for _, ar := range records {
-			s.batchedAttestations.Append(ar)
+// Saves attestation records flushed from the batches of SaveAttestationForPubKey. Records which
+// are already saved, such as retries after a transient error, are skipped, so that a batch of
+// retries does not open a write transaction, and records with a decreasing target epoch are
+// logged unless they were rejected before being queued. Public keys saving their first
+// attestation have the time of the flush recorded as their first signed timestamp.
+func (s *Store) saveBatchedAttestationRecords(ctx context.Context, records []*AttestationRecord) error {
+	unsaved := make([]*AttestationRecord, 0, len(records))
+	if err := s.view(func(tx *bolt.Tx) error {
+		for _, record := range records {
+			if !s.attestationSaved(tx, record) {
+				unsaved = append(unsaved, record)
+			}
+		}
+		if !s.rejectDecreasingTargets {
+			logDecreasingTargets(tx, unsaved)
 		}
+		return nil
+	}); err != nil {
+		return err
 	}
-	// Forward the error, if any, to all subscribers via an event feed.
-	// We use a struct wrapper around the error as the event feed
-	// cannot handle sending a raw `nil` in case there is no error.
-	s.batchAttestationsFlushedFeed.Send(saveAttestationsResponse{
-		err: err,
-	})
+	if len(unsaved) == 0 {
+		return nil
+	}
+	return s.writeAttestationRecords(ctx, unsaved, time.Now())
 }
 
 // Saves a list of attestation records to the database in a single boltDB
 // transaction to minimize write lock contention compared to doing them
 // all in individual, isolated boltDB transactions.
 func (s *Store) saveAttestationRecords(ctx context.Context, atts []*AttestationRecord) error {
+	return s.writeAttestationRecords(ctx, atts, time.Time{})
+}
+
+// Writes attestation records in a single transaction, recording the given time as the first
+// signed timestamp of their public keys which have none, unless it is the zero time.
+func (s *Store) writeAttestationRecords(ctx context.Context, atts []*AttestationRecord, signedAt time.Time) error {
 	ctx, span := trace.StartSpan(ctx, "Validator.saveAttestationRecords")
 	defer span.End()
 	return s.update(func(tx *bolt.Tx) error {
-		// Initialize buckets for the lowest target and source epochs.
-		lowestSourceBucket, err := tx.CreateBucketIfNotExists(lowestSignedSourceBucket)
-		if err != nil {
-			return err
+		if !signedAt.IsZero() {
+			if err := saveFirstSignedTimestamps(tx, atts, signedAt); err != nil {
+				return errors.Wrap(err, "could not save first signed timestamps")
+			}
 		}
-		lowestTargetBucket, err := tx.CreateBucketIfNotExists(lowestSignedTargetBucket)
-		if err != nil {
+		return s.putAttestationRecords(tx, atts)
+	})
+}
+
+// Writes attestation records within a transaction, updating the signed epoch bounds of their public keys.
+func (s *Store) putAttestationRecords(tx *bolt.Tx, atts []*AttestationRecord) error {
+	// Initialize buckets for the lowest target and source epochs and the highest target epoch.
+	lowestSourceBucket, err := tx.CreateBucketIfNotExists(lowestSignedSourceBucket)
+	if err != nil {
+		return err
+	}
+	lowestTargetBucket, err := tx.CreateBucketIfNotExists(lowestSignedTargetBucket)
+	if err != nil {
+		return err
+	}
+	highestTargetBucket, err := tx.CreateBucketIfNotExists(highestSignedTargetBucket)
+	if err != nil {
+		return err
+	}
+	bucket := tx.Bucket(pubKeysBucket)
+	for _, att := range atts {
+		if err := s.checkEpochKeysFit(att.Source, att.Target); err != nil {
 			return err
 		}
-		bucket := tx.Bucket(pubKeysBucket)
-		for _, att := range atts {
-			pkBucket, err := bucket.CreateBucketIfNotExists(att.PubKey[:])
-			if err != nil {
-				return errors.Wrap(err, "could not create public key bucket")
+		// If the incoming source epoch is lower than the lowest signed source epoch, override.
+		lowestSignedSourceBytes := lowestSourceBucket.Get(att.PubKey[:])
+		var lowestSignedSourceEpoch types.Epoch
+		if len(lowestSignedSourceBytes) >= 8 {
+			lowestSignedSourceEpoch = bytesutil.BytesToEpochBigEndian(lowestSignedSourceBytes)
+		}
+		if len(lowestSignedSourceBytes) == 0 || att.Source < lowestSignedSourceEpoch {
+			if err := lowestSourceBucket.Put(
+				att.PubKey[:], bytesutil.EpochToBytesBigEndian(att.Source),
+			); err != nil {
+				return err
 			}
-			sourceEpochBytes := bytesutil.EpochToBytesBigEndian(att.Source)
-			targetEpochBytes := bytesutil.EpochToBytesBigEndian(att.Target)
+		}
 
-			signingRootsBucket, err := pkBucket.CreateBucketIfNotExists(attestationSigningRootsBucket)
-			if err != nil {
-				return errors.Wrap(err, "could not create signing roots bucket")
-			}
-			if err := signingRootsBucket.Put(targetEpochBytes, att.SigningRoot[:]); err != nil {
-				return errors.Wrapf(err, "could not save signing signing root for epoch %d", att.Target)
-			}
-			sourceEpochsBucket, err := pkBucket.CreateBucketIfNotExists(attestationSourceEpochsBucket)
-			if err != nil {
-				return errors.Wrap(err, "could not create source epochs bucket")
+		// If the incoming target epoch is lower than the lowest signed target epoch, override.
+		lowestSignedTargetBytes := lowestTargetBucket.Get(att.PubKey[:])
+		var lowestSignedTargetEpoch types.Epoch
+		if len(lowestSignedTargetBytes) >= 8 {
+			lowestSignedTargetEpoch = bytesutil.BytesToEpochBigEndian(lowestSignedTargetBytes)
+		}
+		if len(lowestSignedTargetBytes) == 0 || att.Target < lowestSignedTargetEpoch {
+			if err := lowestTargetBucket.Put(
+				att.PubKey[:], bytesutil.EpochToBytesBigEndian(att.Target),
+			); err != nil {
+				return err
 			}
+		}
 
-			// There can be multiple attested target epochs per source epoch.
-			// If a previous list exists, we append to that list with the incoming target epoch.
-			// Otherwise, we initialize it using the incoming target epoch.
-			var existingAttestedTargetsBytes []byte
-			if existing := sourceEpochsBucket.Get(sourceEpochBytes); existing != nil {
-				existingAttestedTargetsBytes = append(existing, targetEpochBytes...)
-			} else {
-				existingAttestedTargetsBytes = targetEpochBytes
+		// If the incoming target epoch is higher than the highest signed target epoch, override.
+		highestSignedTargetBytes := highestTargetBucket.Get(att.PubKey[:])
+		var highestSignedTargetEpoch types.Epoch
+		if len(highestSignedTargetBytes) >= 8 {
+			highestSignedTargetEpoch = bytesutil.BytesToEpochBigEndian(highestSignedTargetBytes)
+		}
+		if len(highestSignedTargetBytes) == 0 || att.Target > highestSignedTargetEpoch {
+			if err := highestTargetBucket.Put(
+				att.PubKey[:], bytesutil.EpochToBytesBigEndian(att.Target),
+			); err != nil {
+				return err
 			}
+		}
 
-			if err := sourceEpochsBucket.Put(sourceEpochBytes, existingAttestedTargetsBytes); err != nil {
-				return errors.Wrapf(err, "could not save source epoch %d for epoch %d", att.Source, att.Target)
-			}
+		pkBucket, err := bucket.CreateBucketIfNotExists(att.PubKey[:])
+		if err != nil {
+			return errors.Wrap(err, "could not create public key bucket")
+		}
+		// With minimal slashing protection, we do not keep the full attesting history.
+		if s.minimalSlashingProtection {
+			continue
+		}
+		// The cache is updated before the record is written, so that it is never behind the DB.
+		if !s.isMirrorTx(tx) {
+			s.cacheSignedEpochs(pkBucket, att.PubKey, att.Source, att.Target)
+		}
+		sourceEpochBytes := s.epochKeys.encode(att.Source)
+		targetEpochBytes := s.epochKeys.encode(att.Target)
 
-			targetEpochsBucket, err := pkBucket.CreateBucketIfNotExists(attestationTargetEpochsBucket)
+		signingRootsBucket, err := pkBucket.CreateBucketIfNotExists(s.epochKeys.signingRootsBucket)
+		if err != nil {
+			return errors.Wrap(err, "could not create signing roots bucket")
+		}
+		// The fill percent only applies to the bucket within the current transaction.
+		signingRootsBucket.FillPercent = s.attestationFillPercent
+		signingRoots := att.SigningRoot[:]
+		// When keeping all signing roots, distinct roots are appended after the
+		// first stored root, which remains the one used by all other readers.
+		if existing := signingRootsBucket.Get(targetEpochBytes); s.keepAllSigningRoots && len(existing) > 0 {
+			if signingRootsContain(existing, att.SigningRoot) {
+				signingRoots = existing
+			} else {
+				signingRoots = append(append(make([]byte, 0, len(existing)+32), existing...), att.SigningRoot[:]...)
+			}
+		}
+		if err := signingRootsBucket.Put(targetEpochBytes, signingRoots); err != nil {
+			return errors.Wrapf(err, "could not save signing signing root for epoch %d", att.Target)
+		}
+		if att.Target == att.Source+1 {
+			inRun, err := s.saveSequentialAttestation(pkBucket, att.Source)
 			if err != nil {
-				return errors.Wrap(err, "could not create target epochs bucket")
+				return err
 			}
-			var existingAttestedSourceBytes []byte
-			if existing := targetEpochsBucket.Get(targetEpochBytes); existing != nil {
-				existingAttestedSourceBytes = append(existing, sourceEpochBytes...)
-			} else {
-				existingAttestedSourceBytes = sourceEpochBytes
+			if inRun {
+				continue
 			}
+		}
+		sourceEpochsBucket, err := pkBucket.CreateBucketIfNotExists(s.epochKeys.sourceEpochsBucket)
+		if err != nil {
+			return errors.Wrap(err, "could not create source epochs bucket")
+		}
+		sourceEpochsBucket.FillPercent = s.attestationFillPercent
 
-			if err := targetEpochsBucket.Put(targetEpochBytes, existingAttestedSourceBytes); err != nil {
-				return errors.Wrapf(err, "could not save target epoch %d for epoch %d", att.Target, att.Source)
+		// There can be multiple attested target epochs per source epoch.
+		// If a previous list exists, we append to that list with the incoming target epoch
+		// unless it is already present, so saving the same record twice is idempotent.
+		// Otherwise, we initialize it using the incoming target epoch.
+		var existingAttestedTargetsBytes []byte
+		if existing := sourceEpochsBucket.Get(sourceEpochBytes); existing != nil {
+			if s.epochKeys.listContains(existing, targetEpochBytes) {
+				existingAttestedTargetsBytes = existing
+			} else {
+				existingAttestedTargetsBytes = append(existing, targetEpochBytes...)
 			}
+		} else {
+			existingAttestedTargetsBytes = targetEpochBytes
+		}
 
-			// If the incoming source epoch is lower than the lowest signed source epoch, override.
-			lowestSignedSourceBytes := lowestSourceBucket.Get(att.PubKey[:])
-			var lowestSignedSourceEpoch types.Epoch
-			if len(lowestSignedSourceBytes) >= 8 {
-				lowestSignedSourceEpoch = bytesutil.BytesToEpochBigEndian(lowestSignedSourceBytes)
-			}
-			if len(lowestSignedSourceBytes) == 0 || att.Source < lowestSignedSourceEpoch {
-				if err := lowestSourceBucket.Put(
-					att.PubKey[:], bytesutil.EpochToBytesBigEndian(att.Source),
-				); err != nil {
-					return err
-				}
-			}
+		if err := sourceEpochsBucket.Put(sourceEpochBytes, existingAttestedTargetsBytes); err != nil {
+			return errors.Wrapf(err, "could not save source epoch %d for epoch %d", att.Source, att.Target)
+		}
 
-			// If the incoming target epoch is lower than the lowest signed target epoch, override.
-			lowestSignedTargetBytes := lowestTargetBucket.Get(att.PubKey[:])
-			var lowestSignedTargetEpoch types.Epoch
-			if len(lowestSignedTargetBytes) >= 8 {
-				lowestSignedTargetEpoch = bytesutil.BytesToEpochBigEndian(lowestSignedTargetBytes)
-			}
-			if len(lowestSignedTargetBytes) == 0 || att.Target < lowestSignedTargetEpoch {
-				if err := lowestTargetBucket.Put(
-					att.PubKey[:], bytesutil.EpochToBytesBigEndian(att.Target),
-				); err != nil {
-					return err
-				}
+		targetEpochsBucket, err := pkBucket.CreateBucketIfNotExists(s.epochKeys.targetEpochsBucket)
+		if err != nil {
+			return errors.Wrap(err, "could not create target epochs bucket")
+		}
+		var existingAttestedSourceBytes []byte
+		if existing := targetEpochsBucket.Get(targetEpochBytes); existing != nil {
+			if s.epochKeys.listContains(existing, sourceEpochBytes) {
+				existingAttestedSourceBytes = existing
+			} else {
+				existingAttestedSourceBytes = append(existing, sourceEpochBytes...)
 			}
+		} else {
+			existingAttestedSourceBytes = sourceEpochBytes
 		}
-		return nil
-	})
+
+		if err := targetEpochsBucket.Put(targetEpochBytes, existingAttestedSourceBytes); err != nil {
+			return errors.Wrapf(err, "could not save target epoch %d for epoch %d", att.Target, att.Source)
+		}
+	}
+	return nil
 }
 
-// AttestedPublicKeys retrieves all public keys that have attested.
+// AttestedPublicKeys retrieves all public keys that have attested. The public
+// keys are sorted in ascending byte order, as bolt iterates over keys in order.
 func (s *Store) AttestedPublicKeys(ctx context.Context) ([][48]byte, error) {
 	ctx, span := trace.StartSpan(ctx, "Validator.AttestedPublicKeys")
 	defer span.End()
@@ -507,27 +1283,477 @@ func (s *Store) AttestedPublicKeys(ctx context.Context) ([][48]byte, error) {
 	return attestedPublicKeys, err
 }
 
+// AttestationRecordCount returns the number of attestation records stored for a public key,
+// which is the number of records returned by AttestationHistoryForPubKey. Records are counted
+// from the lengths of the target epochs lists of the source epochs bucket, as several records
+// may share a source or a target epoch, and from the bounds of the sequential runs.
+func (s *Store) AttestationRecordCount(ctx context.Context, pubKey [48]byte) (uint64, error) {
+	ctx, span := trace.StartSpan(ctx, "Validator.AttestationRecordCount")
+	defer span.End()
+	var count uint64
+	err := s.view(func(tx *bolt.Tx) error {
+		count = s.attestationRecordCount(tx.Bucket(pubKeysBucket).Bucket(pubKey[:]))
+		return nil
+	})
+	return count, err
+}
+
+// TotalAttestationRecordCount returns the number of attestation records stored
+// across all public keys in the database.
+func (s *Store) TotalAttestationRecordCount(ctx context.Context) (uint64, error) {
+	ctx, span := trace.StartSpan(ctx, "Validator.TotalAttestationRecordCount")
+	defer span.End()
+	var total uint64
+	err := s.view(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(pubKeysBucket)
+		return bucket.ForEach(func(pubKey []byte, _ []byte) error {
+			total += s.attestationRecordCount(bucket.Bucket(pubKey))
+			return nil
+		})
+	})
+	return total, err
+}
+
+// EpochBounds are the lowest source epoch and the highest target epoch of the attesting
+// history of a validator public key.
+type EpochBounds struct {
+	LowestSource  types.Epoch
+	HighestTarget types.Epoch
+}
+
+// AllAttestationBoundaries returns the epoch bounds of every public key with an attesting
+// history, read in a single transaction. Only the first key of the source epochs bucket,
+// the last key of the target epochs bucket and the first and last sequential runs of each
+// public key are read, so no history is loaded. With minimal slashing protection, no history
+// is kept and the lowest signed source and highest signed target epochs are returned instead.
+// Batched records which are not yet written are not included.
+func (s *Store) AllAttestationBoundaries(ctx context.Context) (map[[48]byte]EpochBounds, error) {
+	ctx, span := trace.StartSpan(ctx, "Validator.AllAttestationBoundaries")
+	defer span.End()
+	boundaries := make(map[[48]byte]EpochBounds)
+	err := s.view(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(pubKeysBucket)
+		return bucket.ForEach(func(pubKey []byte, _ []byte) error {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			pk := bytesutil.ToBytes48(pubKey)
+			var bounds EpochBounds
+			var exists bool
+			if s.minimalSlashingProtection {
+				bounds, exists = s.attestationBoundsForPubKey(tx, pk)
+			} else {
+				bounds, exists = s.attestationBoundaries(bucket.Bucket(pubKey))
+			}
+			if exists {
+				boundaries[pk] = bounds
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		traceutil.AnnotateError(span, err)
+		return nil, err
+	}
+	return boundaries, nil
+}
+
+// Reads the epoch bounds of the attesting history stored in a public key bucket. Epochs are
+// encoded big-endian, so the bounds are the first source and last target epoch keys, or
+// those of the first and last sequential runs.
+func (s *Store) attestationBoundaries(pkBucket *bolt.Bucket) (EpochBounds, bool) {
+	var bounds EpochBounds
+	var hasSource, hasTarget bool
+	if pkBucket == nil {
+		return bounds, false
+	}
+	if sourceEpochsBucket := pkBucket.Bucket(s.epochKeys.sourceEpochsBucket); sourceEpochsBucket != nil {
+		if k, _ := sourceEpochsBucket.Cursor().First(); k != nil {
+			bounds.LowestSource, hasSource = s.epochKeys.decode(k), true
+		}
+	}
+	if targetEpochsBucket := pkBucket.Bucket(s.epochKeys.targetEpochsBucket); targetEpochsBucket != nil {
+		if k, _ := targetEpochsBucket.Cursor().Last(); k != nil {
+			bounds.HighestTarget, hasTarget = s.epochKeys.decode(k), true
+		}
+	}
+	if runsBucket := pkBucket.Bucket(s.epochKeys.sequentialRunsBucket); runsBucket != nil {
+		c := runsBucket.Cursor()
+		if start, _ := c.First(); start != nil && (!hasSource || s.epochKeys.decode(start) < bounds.LowestSource) {
+			bounds.LowestSource, hasSource = s.epochKeys.decode(start), true
+		}
+		if _, end := c.Last(); end != nil && (!hasTarget || s.epochKeys.decode(end) > bounds.HighestTarget) {
+			bounds.HighestTarget, hasTarget = s.epochKeys.decode(end), true
+		}
+	}
+	return bounds, hasSource && hasTarget
+}
+
+// Reads the lowest signed source and highest signed target epochs of a public key.
+func (s *Store) attestationBoundsForPubKey(tx *bolt.Tx, pubKey [48]byte) (EpochBounds, bool) {
+	// 8 because bytesutil.BytesToEpochBigEndian will return 0 if input is less than 8 bytes.
+	lowestSourceBytes := tx.Bucket(lowestSignedSourceBucket).Get(pubKey[:])
+	if len(lowestSourceBytes) < 8 {
+		return EpochBounds{}, false
+	}
+	highestTarget, exists := s.highestSignedTargetEpoch(tx, pubKey)
+	if !exists {
+		return EpochBounds{}, false
+	}
+	return EpochBounds{
+		LowestSource:  bytesutil.BytesToEpochBigEndian(lowestSourceBytes),
+		HighestTarget: highestTarget,
+	}, true
+}
+
+func (s *Store) attestationRecordCount(pkBucket *bolt.Bucket) uint64 {
+	if pkBucket == nil {
+		return 0
+	}
+	var count uint64
+	if sourceEpochsBucket := pkBucket.Bucket(s.epochKeys.sourceEpochsBucket); sourceEpochsBucket != nil {
+		c := sourceEpochsBucket.Cursor()
+		for k, targetEpochsList := c.First(); k != nil; k, targetEpochsList = c.Next() {
+			count += uint64(len(targetEpochsList) / s.epochKeys.size)
+		}
+	}
+	for _, run := range s.sequentialRuns(pkBucket) {
+		count += uint64(run.end - run.start)
+	}
+	return count
+}
+
+// ClearAttestationHistoryForPubKeys deletes the attestation and proposal history
+// of the specified public keys, along with their signed epoch bounds and first signed
+// timestamps, in a single transaction. Public keys without any history are ignored.
+// Records of the public keys which are still batched are written first, so that they
+// are cleared as well rather than saved once the history is gone.
+func (s *Store) ClearAttestationHistoryForPubKeys(ctx context.Context, pubKeys [][48]byte) error {
+	ctx, span := trace.StartSpan(ctx, "Validator.ClearAttestationHistoryForPubKeys")
+	defer span.End()
+	if err := s.FlushProposalBatch(ctx); err != nil {
+		return errors.Wrap(err, "could not flush batched proposals")
+	}
+	// The flush locks of the batch shards are held until the history is deleted, so that
+	// none of their records is written in between. They are taken in shard order, which
+	// prevents concurrent calls from deadlocking.
+	locked := make([]bool, len(s.attestationBatches))
+	for _, pubKey := range pubKeys {
+		for i, batch := range s.attestationBatches {
+			if batch == s.attestationBatchFor(pubKey) {
+				locked[i] = true
+			}
+		}
+	}
+	for i, batch := range s.attestationBatches {
+		if !locked[i] {
+			continue
+		}
+		batch.flushLock.Lock()
+		defer batch.flushLock.Unlock()
+		if err := s.flushLockedAttestationBatch(ctx, batch); err != nil {
+			return errors.Wrap(err, "could not flush batched attestations")
+		}
+	}
+	err := s.update(func(tx *bolt.Tx) error {
+		attestationsBucket := tx.Bucket(pubKeysBucket)
+		proposalsBucket := tx.Bucket(historicProposalsBucket)
+		for _, pubKey := range pubKeys {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if attestationsBucket.Bucket(pubKey[:]) != nil {
+				if err := attestationsBucket.DeleteBucket(pubKey[:]); err != nil {
+					return errors.Wrapf(err, "could not delete attestation history for public key %#x", pubKey)
+				}
+			}
+			if proposalsBucket.Bucket(pubKey[:]) != nil {
+				if err := proposalsBucket.DeleteBucket(pubKey[:]); err != nil {
+					return errors.Wrapf(err, "could not delete proposal history for public key %#x", pubKey)
+				}
+			}
+			for _, name := range [][]byte{
+				lowestSignedSourceBucket,
+				lowestSignedTargetBucket,
+				highestSignedTargetBucket,
+				lowestSignedProposalsBucket,
+				highestSignedProposalsBucket,
+				firstSignedTimestampsBucket,
+			} {
+				bucket := tx.Bucket(name)
+				if bucket == nil {
+					continue
+				}
+				if err := bucket.Delete(pubKey[:]); err != nil {
+					return errors.Wrapf(err, "could not delete %s entry for public key %#x", name, pubKey)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// The cached epochs would otherwise be stricter than the now empty history.
+	if s.signedEpochs != nil {
+		for _, pubKey := range pubKeys {
+			s.signedEpochs.remove(pubKey)
+		}
+	}
+	return nil
+}
+
+// VerifyAttestationBounds verifies the lowest signed source epoch and the highest signed
+// target epoch recorded for a validator public key are consistent with every source and
+// target epoch pair stored in its attesting history, returning an error describing the
+// first inconsistency found. Databases created before the highest signed target epoch
+// was recorded only have their lowest signed source epoch verified.
+func (s *Store) VerifyAttestationBounds(ctx context.Context, pubKey [48]byte) error {
+	ctx, span := trace.StartSpan(ctx, "Validator.VerifyAttestationBounds")
+	defer span.End()
+	err := s.view(func(tx *bolt.Tx) error {
+		pkBucket := tx.Bucket(pubKeysBucket).Bucket(pubKey[:])
+		if pkBucket == nil {
+			return nil
+		}
+		// 8 because bytesutil.BytesToEpochBigEndian will return 0 if input is less than 8 bytes.
+		lowestSourceBytes := tx.Bucket(lowestSignedSourceBucket).Get(pubKey[:])
+		highestTargetBytes := tx.Bucket(highestSignedTargetBucket).Get(pubKey[:])
+		verifyBounds := func(source types.Epoch, targets []types.Epoch) error {
+			if len(lowestSourceBytes) < 8 {
+				return fmt.Errorf(missingBoundMessage, pubKey, source)
+			}
+			if lowestSource := bytesutil.BytesToEpochBigEndian(lowestSourceBytes); lowestSource > source {
+				return fmt.Errorf(lowestSourceMessage, pubKey, lowestSource, source)
+			}
+			if len(highestTargetBytes) < 8 {
+				return nil
+			}
+			highestTarget := bytesutil.BytesToEpochBigEndian(highestTargetBytes)
+			for _, target := range targets {
+				if target > highestTarget {
+					return fmt.Errorf(highestTargetMessage, pubKey, highestTarget, target)
+				}
+			}
+			return nil
+		}
+		if sourceEpochsBucket := pkBucket.Bucket(s.epochKeys.sourceEpochsBucket); sourceEpochsBucket != nil {
+			if err := sourceEpochsBucket.ForEach(func(sourceBytes, targetEpochsList []byte) error {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				return verifyBounds(s.epochKeys.decode(sourceBytes), s.epochKeys.decodeList(targetEpochsList))
+			}); err != nil {
+				return err
+			}
+		}
+		// The first source epoch and last target epoch of a sequential run bound all of its attestations.
+		for _, run := range s.sequentialRuns(pkBucket) {
+			if err := verifyBounds(run.start, []types.Epoch{run.end}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	traceutil.AnnotateError(span, err)
+	return err
+}
+
+// SelfTestSlashingProtection verifies that slashing protection would reject a known
+// slashable attestation for a validator public key. Using the stored attesting history,
+// it constructs an attestation surrounding a recorded one with a target beyond the highest
+// recorded target, and returns true if the slashing protection checks reject it as a
+// surrounding vote, or as a minimal protection violation when minimal slashing protection
+// is enabled. If every recorded attestation has source epoch 0, which cannot be surrounded,
+// a double vote at the highest recorded target is used instead. The slashing detection hook
+// is not called, and the check is read-only, so the stored history is never modified.
+func (s *Store) SelfTestSlashingProtection(ctx context.Context, pubKey [48]byte) (bool, error) {
+	ctx, span := trace.StartSpan(ctx, "Validator.SelfTestSlashingProtection")
+	defer span.End()
+
+	var att *ethpb.IndexedAttestation
+	var signingRoot [32]byte
+	var expected SlashingKind
+	if s.minimalSlashingProtection {
+		lowestSource, sourceExists, err := s.LowestSignedSourceEpoch(ctx, pubKey)
+		if err != nil {
+			return false, err
+		}
+		highestTarget, targetExists, err := s.HighestSignedTargetEpoch(ctx, pubKey)
+		if err != nil {
+			return false, err
+		}
+		if !sourceExists || !targetExists {
+			return false, fmt.Errorf("no attestation history to self-test against for public key %#x", pubKey)
+		}
+		// An attestation at the highest signed target is rejected whatever its source epoch.
+		att = createSelfTestAttestation(lowestSource, highestTarget)
+		if lowestSource > 0 {
+			att = createSelfTestAttestation(lowestSource-1, highestTarget+1)
+		}
+		expected = MinimalProtectionViolation
+	} else {
+		history, err := s.AttestationHistoryForPubKey(ctx, pubKey)
+		if err != nil {
+			return false, err
+		}
+		if len(history) == 0 {
+			return false, fmt.Errorf("no attestation history to self-test against for public key %#x", pubKey)
+		}
+		att, signingRoot, expected = selfTestAttestation(history)
+	}
+
+	slashingKind, err := s.checkSlashableAttestation(ctx, pubKey, signingRoot, att)
+	if slashingKind == NotSlashable && err != nil {
+		return false, err
+	}
+	if slashingKind != expected {
+		log.WithFields(logrus.Fields{
+			"publicKey": fmt.Sprintf("%#x", bytesutil.Trunc(pubKey[:])),
+			"source":    att.Data.Source.Epoch,
+			"target":    att.Data.Target.Epoch,
+			"result":    slashingKind,
+		}).Warn("Slashing protection self-test did not reject a slashable attestation")
+		return false, nil
+	}
+	return true, nil
+}
+
+// Returns a slashable attestation with respect to a non-empty attesting history, along with
+// its signing root and the kind of slashing it is expected to be rejected as. An attestation
+// with a lower source than the highest recorded source and a higher target than the highest
+// recorded target surrounds that recorded attestation. If the highest recorded source is 0,
+// an attestation at the highest recorded target with a differing signing root is returned.
+func selfTestAttestation(history []*AttestationRecord) (*ethpb.IndexedAttestation, [32]byte, SlashingKind) {
+	highest := history[0]
+	var highestSource types.Epoch
+	for _, record := range history {
+		if record.Source > highestSource {
+			highestSource = record.Source
+		}
+		if record.Target > highest.Target {
+			highest = record
+		}
+	}
+	if highestSource > 0 {
+		return createSelfTestAttestation(highestSource-1, highest.Target+1), [32]byte{}, SurroundingVote
+	}
+	signingRoot := highest.SigningRoot
+	signingRoot[0] ^= 0xff
+	return createSelfTestAttestation(highest.Source, highest.Target), signingRoot, DoubleVote
+}
+
+// Returns an error if an attestation is structurally invalid, that is if its data or checkpoints
+// are missing or if its target epoch is lower than its source epoch, so it is never stored.
+func validateAttestation(att *ethpb.IndexedAttestation) error {
+	if att == nil || att.Data == nil {
+		return errors.New("attestation data is nil")
+	}
+	if att.Data.Source == nil {
+		return errors.New("attestation source checkpoint is nil")
+	}
+	if att.Data.Target == nil {
+		return errors.New("attestation target checkpoint is nil")
+	}
+	if att.Data.Target.Epoch < att.Data.Source.Epoch {
+		return fmt.Errorf(
+			"attestation target epoch %d is lower than its source epoch %d",
+			att.Data.Target.Epoch,
+			att.Data.Source.Epoch,
+		)
+	}
+	return nil
+}
+
+func createSelfTestAttestation(source, target types.Epoch) *ethpb.IndexedAttestation {
+	return &ethpb.IndexedAttestation{
+		Data: &ethpb.AttestationData{
+			Source: &ethpb.Checkpoint{Epoch: source},
+			Target: &ethpb.Checkpoint{Epoch: target},
+		},
+	}
+}
+
 // SigningRootAtTargetEpoch checks for an existing signing root at a specified
 // target epoch for a given validator public key.
 func (s *Store) SigningRootAtTargetEpoch(ctx context.Context, pubKey [48]byte, target types.Epoch) ([32]byte, error) {
-	ctx, span := trace.StartSpan(ctx, "Validator.SigningRootAtTargetEpoch")
+	signingRoot, _, err := s.SigningRootAtTarget(ctx, pubKey, target)
+	return signingRoot, err
+}
+
+// SigningRootAtTarget returns the signing root stored at a specified target epoch
+// for a given validator public key, and whether one is stored. When all signing roots
+// are kept, this is the first one saved. The zero root is returned if none is stored.
+func (s *Store) SigningRootAtTarget(
+	ctx context.Context, pubKey [48]byte, target types.Epoch,
+) ([32]byte, bool, error) {
+	ctx, span := trace.StartSpan(ctx, "Validator.SigningRootAtTarget")
 	defer span.End()
 	var signingRoot [32]byte
+	var exists bool
 	err := s.view(func(tx *bolt.Tx) error {
 		bucket := tx.Bucket(pubKeysBucket)
 		pkBucket := bucket.Bucket(pubKey[:])
 		if pkBucket == nil {
 			return nil
 		}
-		signingRootsBucket := pkBucket.Bucket(attestationSigningRootsBucket)
-		if signingRootsBucket == nil {
+		sr := s.epochKeys.get(pkBucket.Bucket(s.epochKeys.signingRootsBucket), target)
+		if sr == nil {
 			return nil
 		}
-		sr := signingRootsBucket.Get(bytesutil.EpochToBytesBigEndian(target))
+		exists = true
 		copy(signingRoot[:], sr)
 		return nil
 	})
-	return signingRoot, err
+	return signingRoot, exists, err
+}
+
+// SigningRootsAtTargetEpoch returns all distinct signing roots stored at a target
+// epoch for a given validator public key, in the order they were first saved.
+// Unless the store keeps all signing roots, at most a single root is stored.
+func (s *Store) SigningRootsAtTargetEpoch(ctx context.Context, pubKey [48]byte, target types.Epoch) ([][32]byte, error) {
+	ctx, span := trace.StartSpan(ctx, "Validator.SigningRootsAtTargetEpoch")
+	defer span.End()
+	signingRoots := make([][32]byte, 0)
+	err := s.view(func(tx *bolt.Tx) error {
+		pkBucket := tx.Bucket(pubKeysBucket).Bucket(pubKey[:])
+		if pkBucket == nil {
+			return nil
+		}
+		signingRoots = append(signingRoots, decodeSigningRoots(
+			s.epochKeys.get(pkBucket.Bucket(s.epochKeys.signingRootsBucket), target),
+		)...)
+		return nil
+	})
+	return signingRoots, err
+}
+
+// Decodes a list of concatenated 32 byte signing roots. A value shorter
+// than 32 bytes is padded, as done when reading a single signing root.
+func decodeSigningRoots(enc []byte) [][32]byte {
+	if len(enc) == 0 {
+		return nil
+	}
+	signingRoots := make([][32]byte, 0, (len(enc)+31)/32)
+	for i := 0; i < len(enc); i += 32 {
+		var sr [32]byte
+		end := i + 32
+		if end > len(enc) {
+			end = len(enc)
+		}
+		copy(sr[:], enc[i:end])
+		signingRoots = append(signingRoots, sr)
+	}
+	return signingRoots
+}
+
+func signingRootsContain(enc []byte, signingRoot [32]byte) bool {
+	for _, sr := range decodeSigningRoots(enc) {
+		if sr == signingRoot {
+			return true
+		}
+	}
+	return false
 }
 
 // LowestSignedSourceEpoch returns the lowest signed source epoch for a validator public key.
@@ -575,3 +1801,52 @@ func (s *Store) LowestSignedTargetEpoch(ctx context.Context, publicKey [48]byte)
 	})
 	return lowestSignedTargetEpoch, exists, err
 }
+
+// HighestSignedTargetEpoch returns the highest signed target epoch for a validator public key.
+// If no data exists, returning 0 is a sensible default and the returned boolean is false.
+func (s *Store) HighestSignedTargetEpoch(ctx context.Context, publicKey [48]byte) (types.Epoch, bool, error) {
+	ctx, span := trace.StartSpan(ctx, "Validator.HighestSignedTargetEpoch")
+	defer span.End()
+
+	var err error
+	var highestTargetEpoch types.Epoch
+	var exists bool
+	err = s.view(func(tx *bolt.Tx) error {
+		highestTargetEpoch, exists = s.highestSignedTargetEpoch(tx, publicKey)
+		return nil
+	})
+	return highestTargetEpoch, exists, err
+}
+
+// The highest signed target epoch is tracked in its own bucket. Attesting history
+// saved before that bucket existed is also taken into account by reading the last
+// key of the public key's signing roots bucket with a bolt cursor, as epochs are
+// stored as big-endian keys.
+func (s *Store) highestSignedTargetEpoch(tx *bolt.Tx, publicKey [48]byte) (types.Epoch, bool) {
+	var highestTargetEpoch types.Epoch
+	var exists bool
+	if bucket := tx.Bucket(highestSignedTargetBucket); bucket != nil {
+		// 8 because bytesutil.BytesToEpochBigEndian will return 0 if input is less than 8 bytes.
+		if highestTargetBytes := bucket.Get(publicKey[:]); len(highestTargetBytes) >= 8 {
+			exists = true
+			highestTargetEpoch = bytesutil.BytesToEpochBigEndian(highestTargetBytes)
+		}
+	}
+	pkBucket := tx.Bucket(pubKeysBucket).Bucket(publicKey[:])
+	if pkBucket == nil {
+		return highestTargetEpoch, exists
+	}
+	signingRootsBucket := pkBucket.Bucket(s.epochKeys.signingRootsBucket)
+	if signingRootsBucket == nil {
+		return highestTargetEpoch, exists
+	}
+	lastTargetBytes, _ := signingRootsBucket.Cursor().Last()
+	if len(lastTargetBytes) < s.epochKeys.size {
+		return highestTargetEpoch, exists
+	}
+	lastTargetEpoch := s.epochKeys.decode(lastTargetBytes)
+	if !exists || lastTargetEpoch > highestTargetEpoch {
+		highestTargetEpoch = lastTargetEpoch
+	}
+	return highestTargetEpoch, true
+}
@@ -0,0 +1,195 @@
+package kv
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	fuzz "github.com/google/gofuzz"
+	types "github.com/prysmaticlabs/eth2-types"
+	"github.com/prysmaticlabs/prysm/shared/slashutil"
+	"github.com/prysmaticlabs/prysm/shared/testutil/assert"
+	"github.com/prysmaticlabs/prysm/shared/testutil/require"
+)
+
+// Epochs of fuzzed attestations are drawn from a small range, so that they often share
+// a target epoch with, surround, or are surrounded by the attestations in the history.
+const fuzzEpochRange = 32
+
+// Signing roots of fuzzed attestations are drawn from a few values, including the zero
+// root, so that identical and differing signing roots at the same target are both common.
+var fuzzSigningRoots = [][32]byte{{}, {1}, {2}}
+
+func TestFuzzCheckSlashableAttestation_1000(t *testing.T) {
+	ctx := context.Background()
+	fuzzer := fuzz.NewWithSeed(0)
+	validatorDB := setupDBWithConfig(t, &Config{NoSync: true})
+
+	for i := 0; i < 1000; i++ {
+		historyKey := [48]byte{byte(i), byte(i >> 8), 1}
+		mirrorKey := [48]byte{byte(i), byte(i >> 8), 2}
+
+		// The history holds a single attestation per target epoch, as is the case
+		// unless all signing roots are kept.
+		var numRecords uint8
+		fuzzer.Fuzz(&numRecords)
+		history := make([]*AttestationRecord, 0)
+		attestedTargets := make(map[types.Epoch]bool)
+		for j := 0; j < int(numRecords%8)+1; j++ {
+			record := fuzzAttestationRecord(fuzzer, historyKey)
+			if attestedTargets[record.Target] {
+				continue
+			}
+			attestedTargets[record.Target] = true
+			history = append(history, record)
+		}
+		require.NoError(t, validatorDB.saveAttestationRecords(ctx, history))
+
+		incoming := fuzzAttestationRecord(fuzzer, historyKey)
+		incomingAtt := createAttestation(incoming.Source, incoming.Target)
+		slashingKind, err := validatorDB.CheckSlashableAttestation(ctx, historyKey, incoming.SigningRoot, incomingAtt)
+		want := expectedSlashingKind(history, incoming)
+		require.Equal(t, want, slashingKind, "Wrong slashing kind for %v against history %v", incoming, history)
+		assert.Equal(t, want != NotSlashable, err != nil)
+
+		// Surround detection is symmetric: once the incoming attestation is saved on its own,
+		// each attestation of the history is surrounded by it exactly when it surrounded that
+		// attestation, and surrounds it exactly when it was surrounded by that attestation.
+		mirror := &AttestationRecord{
+			PubKey:      mirrorKey,
+			Source:      incoming.Source,
+			Target:      incoming.Target,
+			SigningRoot: incoming.SigningRoot,
+		}
+		require.NoError(t, validatorDB.saveAttestationRecords(ctx, []*AttestationRecord{mirror}))
+		for _, record := range history {
+			existingAtt := createAttestation(record.Source, record.Target)
+			slashingKind, _ := validatorDB.CheckSlashableAttestation(ctx, mirrorKey, record.SigningRoot, existingAtt)
+			assert.Equal(t, slashutil.IsSurround(incomingAtt, existingAtt), slashingKind == SurroundedVote)
+			assert.Equal(t, slashutil.IsSurround(existingAtt, incomingAtt), slashingKind == SurroundingVote)
+		}
+	}
+}
+
+func TestFuzzCheckSlashableAttestation_54kEpochsCorpus(t *testing.T) {
+	for _, compactSequential := range []bool{false, true} {
+		t.Run(fmt.Sprintf("compact sequential attestations %v", compactSequential), func(t *testing.T) {
+			ctx := context.Background()
+			fuzzer := fuzz.NewWithSeed(0)
+			pubKey := [48]byte{1}
+			validatorDB := setupDBWithConfig(t, &Config{
+				PubKeys:                       [][48]byte{pubKey},
+				NoSync:                        true,
+				CompactSequentialAttestations: compactSequential,
+			})
+
+			// Attest to every (source = epoch, target = epoch + 1) sequential pair since genesis
+			// up to the weak subjectivity period epoch, as in the 54k epochs table tests.
+			numEpochs := types.Epoch(54000)
+			history := make([]*AttestationRecord, 0, numEpochs)
+			for epoch := types.Epoch(1); epoch < numEpochs; epoch++ {
+				history = append(history, &AttestationRecord{
+					PubKey:      pubKey,
+					Source:      epoch - 1,
+					Target:      epoch,
+					SigningRoot: [32]byte{1},
+				})
+			}
+			require.NoError(t, validatorDB.saveAttestationRecords(ctx, history))
+
+			// The seed corpus holds the attestations of the 54k epochs table tests, along with
+			// double votes and safe votes around the start and end of the history.
+			corpus := []*AttestationRecord{
+				{Source: numEpochs / 2, Target: numEpochs},
+				{Source: 0, Target: numEpochs},
+				{Source: numEpochs - 3, Target: numEpochs},
+				{Source: numEpochs, Target: numEpochs + 1},
+				{Source: numEpochs - 1, Target: numEpochs},
+				{Source: 1, Target: numEpochs - 2},
+				{Source: 0, Target: 1, SigningRoot: [32]byte{1}},
+				{Source: 0, Target: 1, SigningRoot: [32]byte{2}},
+				{Source: numEpochs - 2, Target: numEpochs - 1, SigningRoot: [32]byte{1}},
+				{Source: numEpochs - 2, Target: numEpochs - 1},
+			}
+			// Mutations of the corpus shift both epochs by a few epochs and change the signing root.
+			for i := 0; i < 200; i++ {
+				seed := corpus[i%10]
+				var sourceShift, targetShift int8
+				var rootIndex uint8
+				fuzzer.Fuzz(&sourceShift)
+				fuzzer.Fuzz(&targetShift)
+				fuzzer.Fuzz(&rootIndex)
+				source := shiftEpoch(seed.Source, sourceShift%4)
+				target := shiftEpoch(seed.Target, targetShift%4)
+				if target < source {
+					source, target = target, source
+				}
+				corpus = append(corpus, &AttestationRecord{
+					Source:      source,
+					Target:      target,
+					SigningRoot: fuzzSigningRoots[int(rootIndex)%len(fuzzSigningRoots)],
+				})
+			}
+
+			for _, incoming := range corpus {
+				incoming.PubKey = pubKey
+				att := createAttestation(incoming.Source, incoming.Target)
+				slashingKind, err := validatorDB.CheckSlashableAttestation(ctx, pubKey, incoming.SigningRoot, att)
+				want := expectedSlashingKind(history, incoming)
+				require.Equal(t, want, slashingKind, "Wrong slashing kind for source %d and target %d", incoming.Source, incoming.Target)
+				assert.Equal(t, want != NotSlashable, err != nil)
+			}
+		})
+	}
+}
+
+// Returns a random attestation record whose source epoch is not greater than its target epoch.
+func fuzzAttestationRecord(fuzzer *fuzz.Fuzzer, pubKey [48]byte) *AttestationRecord {
+	var source, target uint16
+	var rootIndex uint8
+	fuzzer.Fuzz(&source)
+	fuzzer.Fuzz(&target)
+	fuzzer.Fuzz(&rootIndex)
+	record := &AttestationRecord{
+		PubKey:      pubKey,
+		Source:      types.Epoch(source % fuzzEpochRange),
+		Target:      types.Epoch(target % fuzzEpochRange),
+		SigningRoot: fuzzSigningRoots[int(rootIndex)%len(fuzzSigningRoots)],
+	}
+	if record.Target < record.Source {
+		record.Source, record.Target = record.Target, record.Source
+	}
+	return record
+}
+
+// Classifies an incoming attestation against a history by comparing it with every attestation
+// of the history, reporting the kinds of slashing in the order CheckSlashableAttestation does.
+func expectedSlashingKind(history []*AttestationRecord, incoming *AttestationRecord) SlashingKind {
+	incomingAtt := createAttestation(incoming.Source, incoming.Target)
+	for _, record := range history {
+		if record.Target == incoming.Target && slashutil.SigningRootsDiffer(record.SigningRoot, incoming.SigningRoot) {
+			return DoubleVote
+		}
+	}
+	for _, record := range history {
+		if slashutil.IsSurround(incomingAtt, createAttestation(record.Source, record.Target)) {
+			return SurroundingVote
+		}
+	}
+	for _, record := range history {
+		if slashutil.IsSurround(createAttestation(record.Source, record.Target), incomingAtt) {
+			return SurroundedVote
+		}
+	}
+	return NotSlashable
+}
+
+func shiftEpoch(epoch types.Epoch, shift int8) types.Epoch {
+	if shift < 0 && types.Epoch(-shift) > epoch {
+		return 0
+	}
+	if shift < 0 {
+		return epoch - types.Epoch(-shift)
+	}
+	return epoch + types.Epoch(shift)
+}
@@ -2,15 +2,20 @@ package kv
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"sync"
 	"testing"
+	"time"
 
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
 	types "github.com/prysmaticlabs/eth2-types"
 	ethpb "github.com/prysmaticlabs/prysm/proto/eth/v1alpha1"
 	"github.com/prysmaticlabs/prysm/shared/bytesutil"
+	"github.com/prysmaticlabs/prysm/shared/params"
 	"github.com/prysmaticlabs/prysm/shared/testutil/assert"
 	"github.com/prysmaticlabs/prysm/shared/testutil/require"
 	logTest "github.com/sirupsen/logrus/hooks/test"
@@ -42,11 +47,201 @@ func TestPendingAttestationRecords_Len(t *testing.T) {
 	assert.Equal(t, queue.Len(), 0)
 }
 
+func TestPendingAttestationRecords_PendingForPubKey(t *testing.T) {
+	queue := NewQueuedAttestationRecords()
+	queue.Append(&AttestationRecord{PubKey: [48]byte{1}, Target: 1})
+	queue.Append(&AttestationRecord{PubKey: [48]byte{2}, Target: 2})
+	assert.Equal(t, 1, len(queue.PendingForPubKey([48]byte{1})))
+
+	// Records being flushed are still pending until the flush completes.
+	queue.Flush()
+	queue.Append(&AttestationRecord{PubKey: [48]byte{1}, Target: 3})
+	assert.Equal(t, 2, len(queue.PendingForPubKey([48]byte{1})))
+	queue.FlushCompleted()
+	pending := queue.PendingForPubKey([48]byte{1})
+	require.Equal(t, 1, len(pending))
+	assert.Equal(t, types.Epoch(3), pending[0].Target)
+	assert.Equal(t, 0, len(queue.PendingForPubKey([48]byte{3})))
+
+	// Records being sent to the batching routine are pending until appended or cancelled.
+	sent := &AttestationRecord{PubKey: [48]byte{3}, Target: 4}
+	queue.Send(sent)
+	assert.Equal(t, 1, len(queue.PendingForPubKey([48]byte{3})))
+	queue.Append(sent)
+	assert.Equal(t, 1, len(queue.PendingForPubKey([48]byte{3})))
+	cancelled := &AttestationRecord{PubKey: [48]byte{4}, Target: 5}
+	queue.Send(cancelled)
+	assert.Equal(t, 1, len(queue.PendingForPubKey([48]byte{4})))
+	queue.CancelSend(cancelled)
+	assert.Equal(t, 0, len(queue.PendingForPubKey([48]byte{4})))
+}
+
+func TestStore_CheckSlashableAttestation_SentRecord(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pubKey := [48]byte{1}
+	// The batching routines stop with the context of the store, so that a record
+	// sent to the channel is never received.
+	storeCtx, stop := context.WithCancel(context.Background())
+	validatorDB, err := NewKVStore(storeCtx, t.TempDir(), &Config{PubKeys: [][48]byte{pubKey}})
+	require.NoError(t, err, "Failed to instantiate DB")
+	t.Cleanup(func() {
+		require.NoError(t, validatorDB.Close(), "Failed to close database")
+	})
+	stop()
+	time.Sleep(10 * time.Millisecond)
+
+	saved := make(chan error, 1)
+	go func() {
+		saved <- validatorDB.SaveAttestationForPubKey(ctx, pubKey, [32]byte{1}, createAttestation(1, 2))
+	}()
+	batch := validatorDB.attestationBatchFor(pubKey)
+	for len(batch.recordsChan) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	slashingKind, err := validatorDB.CheckSlashableAttestation(ctx, pubKey, [32]byte{2}, createAttestation(1, 2))
+	require.NotNil(t, err)
+	assert.Equal(t, DoubleVote, slashingKind)
+	cancel()
+	require.ErrorContains(t, context.Canceled.Error(), <-saved)
+}
+
+func TestSlashingKind_JSONRoundTrip(t *testing.T) {
+	tests := []struct {
+		kind SlashingKind
+		name string
+	}{
+		{kind: NotSlashable, name: "NotSlashable"},
+		{kind: DoubleVote, name: "DoubleVote"},
+		{kind: SurroundingVote, name: "SurroundingVote"},
+		{kind: SurroundedVote, name: "SurroundedVote"},
+		{kind: DoubleProposal, name: "DoubleProposal"},
+		{kind: MinimalProtectionViolation, name: "MinimalProtectionViolation"},
+		{kind: SuspiciousFutureTarget, name: "SuspiciousFutureTarget"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.name, tt.kind.String())
+			enc, err := json.Marshal(tt.kind)
+			require.NoError(t, err)
+			assert.Equal(t, `"`+tt.name+`"`, string(enc))
+			var decoded SlashingKind
+			require.NoError(t, json.Unmarshal(enc, &decoded))
+			assert.Equal(t, tt.kind, decoded)
+		})
+	}
+}
+
+func TestSlashingKind_JSONInvalid(t *testing.T) {
+	assert.Equal(t, "SlashingKind(42)", SlashingKind(42).String())
+	_, err := json.Marshal(SlashingKind(42))
+	assert.ErrorContains(t, "cannot marshal unknown slashing kind 42", err)
+
+	var kind SlashingKind
+	assert.ErrorContains(t, "Slashable is not a slashing kind", json.Unmarshal([]byte(`"Slashable"`), &kind))
+	assert.NotNil(t, json.Unmarshal([]byte(`1`), &kind))
+	assert.Equal(t, NotSlashable, kind)
+
+	// Slashing kinds are encoded by name within other values.
+	enc, err := json.Marshal(map[string]SlashingKind{"kind": SurroundedVote})
+	require.NoError(t, err)
+	assert.Equal(t, `{"kind":"SurroundedVote"}`, string(enc))
+}
+
+// The methods of a slashing protection store the attestation slashing checks are tested with.
+type attestationProtectionStore interface {
+	CheckSlashableAttestation(
+		ctx context.Context, pubKey [48]byte, signingRoot [32]byte, att *ethpb.IndexedAttestation,
+	) (SlashingKind, error)
+	SaveAttestationForPubKey(
+		ctx context.Context, pubKey [48]byte, signingRoot [32]byte, att *ethpb.IndexedAttestation,
+	) error
+}
+
+// Every slashing protection store the attestation slashing checks are run against.
+var attestationProtectionStores = []struct {
+	name  string
+	setup func(t testing.TB, pubKeys [][48]byte) attestationProtectionStore
+}{
+	{
+		name: "bolt",
+		setup: func(t testing.TB, pubKeys [][48]byte) attestationProtectionStore {
+			return setupDB(t, pubKeys)
+		},
+	},
+	{
+		name: "bolt with compact epoch keys",
+		setup: func(t testing.TB, pubKeys [][48]byte) attestationProtectionStore {
+			return setupDBWithConfig(t, &Config{PubKeys: pubKeys, CompactEpochKeys: true})
+		},
+	},
+	{
+		name: "in memory",
+		setup: func(t testing.TB, pubKeys [][48]byte) attestationProtectionStore {
+			return setupInMemoryDB(t, pubKeys)
+		},
+	},
+}
+
+// Writes every (source, target) pair straight into the attesting history of a public key,
+// without any signing root, so that incoming attestations are only checked for surround
+// votes. Every pair must have a distinct source and target epoch.
+func saveAttestationPairs(
+	t testing.TB, validatorDB attestationProtectionStore, pubKey [48]byte, pairs [][2]types.Epoch,
+) {
+	var db *Store
+	switch store := validatorDB.(type) {
+	case *Store:
+		db = store
+	case *InMemoryStore:
+		db = store.Store
+	default:
+		t.Fatalf("Unsupported slashing protection store %T", validatorDB)
+	}
+	err := db.update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(pubKeysBucket)
+		pkBucket, err := bucket.CreateBucketIfNotExists(pubKey[:])
+		if err != nil {
+			return err
+		}
+		sourceEpochsBucket, err := pkBucket.CreateBucketIfNotExists(db.epochKeys.sourceEpochsBucket)
+		if err != nil {
+			return err
+		}
+		targetEpochsBucket, err := pkBucket.CreateBucketIfNotExists(db.epochKeys.targetEpochsBucket)
+		if err != nil {
+			return err
+		}
+		for _, pair := range pairs {
+			sourceEpoch := db.epochKeys.encode(pair[0])
+			targetEpoch := db.epochKeys.encode(pair[1])
+			if err := sourceEpochsBucket.Put(sourceEpoch, targetEpoch); err != nil {
+				return err
+			}
+			if err := targetEpochsBucket.Put(targetEpoch, sourceEpoch); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+}
+
 func TestStore_CheckSlashableAttestation_DoubleVote(t *testing.T) {
+	for _, store := range attestationProtectionStores {
+		t.Run(store.name, func(t *testing.T) {
+			testCheckSlashableAttestationDoubleVote(t, store.setup)
+		})
+	}
+}
+
+func testCheckSlashableAttestationDoubleVote(
+	t *testing.T, setup func(t testing.TB, pubKeys [][48]byte) attestationProtectionStore,
+) {
 	ctx := context.Background()
 	numValidators := 1
 	pubKeys := make([][48]byte, numValidators)
-	validatorDB := setupDB(t, pubKeys)
+	validatorDB := setup(t, pubKeys)
 	tests := []struct {
 		name                string
 		existingAttestation *ethpb.IndexedAttestation
@@ -106,6 +301,11 @@ func TestStore_CheckSlashableAttestation_DoubleVote(t *testing.T) {
 			if tt.want {
 				require.NotNil(t, err)
 				assert.Equal(t, DoubleVote, slashingKind)
+				var doubleVoteErr *DoubleVoteError
+				require.Equal(t, true, errors.As(err, &doubleVoteErr))
+				assert.Equal(t, tt.incomingAttestation.Data.Target.Epoch, doubleVoteErr.TargetEpoch)
+				assert.Equal(t, tt.existingSigningRoot, doubleVoteErr.ExistingSigningRoot)
+				assert.Equal(t, tt.incomingSigningRoot, doubleVoteErr.IncomingSigningRoot)
 			} else {
 				require.NoError(t, err)
 			}
@@ -114,101 +314,389 @@ func TestStore_CheckSlashableAttestation_DoubleVote(t *testing.T) {
 }
 
 func TestStore_CheckSlashableAttestation_SurroundVote_MultipleTargetsPerSource(t *testing.T) {
-	ctx := context.Background()
-	numValidators := 1
-	pubKeys := make([][48]byte, numValidators)
-	validatorDB := setupDB(t, pubKeys)
+	for _, store := range attestationProtectionStores {
+		t.Run(store.name, func(t *testing.T) {
+			ctx := context.Background()
+			numValidators := 1
+			pubKeys := make([][48]byte, numValidators)
+			validatorDB := store.setup(t, pubKeys)
 
-	// Create an attestation with source 1 and target 50, save it.
-	firstAtt := createAttestation(1, 50)
-	err := validatorDB.SaveAttestationForPubKey(ctx, pubKeys[0], [32]byte{0}, firstAtt)
-	require.NoError(t, err)
+			// Create an attestation with source 1 and target 50, save it.
+			firstAtt := createAttestation(1, 50)
+			err := validatorDB.SaveAttestationForPubKey(ctx, pubKeys[0], [32]byte{0}, firstAtt)
+			require.NoError(t, err)
 
-	// Create an attestation with source 1 and target 100, save it.
-	secondAtt := createAttestation(1, 100)
-	err = validatorDB.SaveAttestationForPubKey(ctx, pubKeys[0], [32]byte{1}, secondAtt)
-	require.NoError(t, err)
+			// Create an attestation with source 1 and target 100, save it.
+			secondAtt := createAttestation(1, 100)
+			err = validatorDB.SaveAttestationForPubKey(ctx, pubKeys[0], [32]byte{1}, secondAtt)
+			require.NoError(t, err)
 
-	// Create an attestation with source 0 and target 51, which should surround
-	// our first attestation. Given there can be multiple attested target epochs per
-	// source epoch, we expect our logic to be able to catch this slashable offense.
-	evilAtt := createAttestation(firstAtt.Data.Source.Epoch-1, firstAtt.Data.Target.Epoch+1)
-	slashable, err := validatorDB.CheckSlashableAttestation(ctx, pubKeys[0], [32]byte{2}, evilAtt)
-	require.NotNil(t, err)
-	assert.Equal(t, SurroundingVote, slashable)
+			// Create an attestation with source 0 and target 51, which should surround
+			// our first attestation. Given there can be multiple attested target epochs per
+			// source epoch, we expect our logic to be able to catch this slashable offense.
+			evilAtt := createAttestation(firstAtt.Data.Source.Epoch-1, firstAtt.Data.Target.Epoch+1)
+			slashable, err := validatorDB.CheckSlashableAttestation(ctx, pubKeys[0], [32]byte{2}, evilAtt)
+			require.NotNil(t, err)
+			assert.Equal(t, SurroundingVote, slashable)
+		})
+	}
 }
 
 func TestStore_CheckSlashableAttestation_SurroundVote_54kEpochs(t *testing.T) {
-	ctx := context.Background()
-	numValidators := 1
-	numEpochs := types.Epoch(54000)
-	pubKeys := make([][48]byte, numValidators)
-	validatorDB := setupDB(t, pubKeys)
+	for _, store := range attestationProtectionStores {
+		t.Run(store.name, func(t *testing.T) {
+			ctx := context.Background()
+			numValidators := 1
+			numEpochs := types.Epoch(54000)
+			pubKeys := make([][48]byte, numValidators)
+			validatorDB := store.setup(t, pubKeys)
 
-	// Attest to every (source = epoch, target = epoch + 1) sequential pair
-	// since genesis up to and including the weak subjectivity period epoch (54,000).
-	err := validatorDB.update(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket(pubKeysBucket)
-		pkBucket, err := bucket.CreateBucketIfNotExists(pubKeys[0][:])
-		if err != nil {
-			return err
-		}
-		sourceEpochsBucket, err := pkBucket.CreateBucketIfNotExists(attestationSourceEpochsBucket)
-		if err != nil {
-			return err
-		}
-		for epoch := types.Epoch(1); epoch < numEpochs; epoch++ {
-			att := createAttestation(epoch-1, epoch)
-			sourceEpoch := bytesutil.EpochToBytesBigEndian(att.Data.Source.Epoch)
-			targetEpoch := bytesutil.EpochToBytesBigEndian(att.Data.Target.Epoch)
-			if err := sourceEpochsBucket.Put(sourceEpoch, targetEpoch); err != nil {
-				return err
+			// Attest to every (source = epoch, target = epoch + 1) sequential pair
+			// since genesis up to and including the weak subjectivity period epoch (54,000).
+			pairs := make([][2]types.Epoch, 0, numEpochs)
+			for epoch := types.Epoch(1); epoch < numEpochs; epoch++ {
+				pairs = append(pairs, [2]types.Epoch{epoch - 1, epoch})
 			}
-		}
-		return nil
+			saveAttestationPairs(t, validatorDB, pubKeys[0], pairs)
+
+			tests := []struct {
+				name        string
+				signingRoot [32]byte
+				attestation *ethpb.IndexedAttestation
+				want        SlashingKind
+			}{
+				{
+					name:        "surround vote at half of the weak subjectivity period",
+					signingRoot: [32]byte{},
+					attestation: createAttestation(numEpochs/2, numEpochs),
+					want:        SurroundingVote,
+				},
+				{
+					name:        "spanning genesis to weak subjectivity period surround vote",
+					signingRoot: [32]byte{},
+					attestation: createAttestation(0, numEpochs),
+					want:        SurroundingVote,
+				},
+				{
+					name:        "simple surround vote at end of weak subjectivity period",
+					signingRoot: [32]byte{},
+					attestation: createAttestation(numEpochs-3, numEpochs),
+					want:        SurroundingVote,
+				},
+				{
+					name:        "non-slashable vote",
+					signingRoot: [32]byte{},
+					attestation: createAttestation(numEpochs, numEpochs+1),
+					want:        NotSlashable,
+				},
+			}
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					slashingKind, err := validatorDB.CheckSlashableAttestation(ctx, pubKeys[0], tt.signingRoot, tt.attestation)
+					if tt.want != NotSlashable {
+						require.NotNil(t, err)
+					}
+					assert.Equal(t, tt.want, slashingKind)
+				})
+			}
+		})
+	}
+}
+
+func TestStore_CheckSlashableAttestation_SurroundedVote_54kEpochs(t *testing.T) {
+	for _, store := range attestationProtectionStores {
+		t.Run(store.name, func(t *testing.T) {
+			ctx := context.Background()
+			numValidators := 1
+			numEpochs := types.Epoch(54000)
+			pubKeys := make([][48]byte, numValidators)
+			validatorDB := store.setup(t, pubKeys)
+
+			// Attest to every (source = epoch - 1, target = epoch + 54,000) pair since genesis
+			// up to the weak subjectivity period epoch (54,000). None of these attestations
+			// surround each other, but each one is wide enough to surround incoming votes.
+			pairs := make([][2]types.Epoch, 0, numEpochs)
+			for epoch := types.Epoch(1); epoch < numEpochs; epoch++ {
+				pairs = append(pairs, [2]types.Epoch{epoch - 1, epoch + numEpochs})
+			}
+			saveAttestationPairs(t, validatorDB, pubKeys[0], pairs)
+
+			tests := []struct {
+				name        string
+				signingRoot [32]byte
+				attestation *ethpb.IndexedAttestation
+				want        SlashingKind
+			}{
+				{
+					name:        "surrounded vote at half of the weak subjectivity period",
+					signingRoot: [32]byte{},
+					attestation: createAttestation(numEpochs/2, numEpochs/2+2),
+					want:        SurroundedVote,
+				},
+				{
+					name:        "spanning genesis to weak subjectivity period surrounded vote",
+					signingRoot: [32]byte{},
+					attestation: createAttestation(1, numEpochs),
+					want:        SurroundedVote,
+				},
+				{
+					name:        "simple surrounded vote at end of weak subjectivity period",
+					signingRoot: [32]byte{},
+					attestation: createAttestation(numEpochs-1, 2*numEpochs-2),
+					want:        SurroundedVote,
+				},
+				{
+					name:        "non-slashable vote",
+					signingRoot: [32]byte{},
+					attestation: createAttestation(numEpochs, 2*numEpochs+1),
+					want:        NotSlashable,
+				},
+			}
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					slashingKind, err := validatorDB.CheckSlashableAttestation(ctx, pubKeys[0], tt.signingRoot, tt.attestation)
+					if tt.want != NotSlashable {
+						require.NotNil(t, err)
+					} else {
+						require.NoError(t, err)
+					}
+					assert.Equal(t, tt.want, slashingKind)
+				})
+			}
+		})
+	}
+}
+
+func TestStore_CheckSlashableAttestation_SurroundedVote_SavedAttestations(t *testing.T) {
+	for _, store := range attestationProtectionStores {
+		t.Run(store.name, func(t *testing.T) {
+			ctx := context.Background()
+			numValidators := 1
+			pubKeys := make([][48]byte, numValidators)
+			validatorDB := store.setup(t, pubKeys)
+
+			// Create an attestation with source 1 and target 50, save it.
+			firstAtt := createAttestation(1, 50)
+			err := validatorDB.SaveAttestationForPubKey(ctx, pubKeys[0], [32]byte{0}, firstAtt)
+			require.NoError(t, err)
+
+			// Create an attestation with source 2 and target 49, which is surrounded
+			// by our first attestation.
+			evilAtt := createAttestation(firstAtt.Data.Source.Epoch+1, firstAtt.Data.Target.Epoch-1)
+			slashable, err := validatorDB.CheckSlashableAttestation(ctx, pubKeys[0], [32]byte{1}, evilAtt)
+			require.NotNil(t, err)
+			assert.Equal(t, SurroundedVote, slashable)
+		})
+	}
+}
+
+func TestStore_CheckSlashableAttestation_MinimalSlashingProtection(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	validatorDB, err := NewKVStore(ctx, t.TempDir(), &Config{
+		PubKeys:                   [][48]byte{pubKey},
+		MinimalSlashingProtection: true,
 	})
-	require.NoError(t, err)
+	require.NoError(t, err, "Failed to instantiate DB")
+	t.Cleanup(func() {
+		require.NoError(t, validatorDB.Close(), "Failed to close database")
+		require.NoError(t, validatorDB.ClearDB(), "Failed to clear database")
+	})
+	require.NoError(t, validatorDB.SaveAttestationsForPubKey(
+		ctx,
+		pubKey,
+		[][32]byte{{1}, {2}},
+		[]*ethpb.IndexedAttestation{createAttestation(10, 11), createAttestation(12, 20)},
+	))
 
 	tests := []struct {
 		name        string
-		signingRoot [32]byte
 		attestation *ethpb.IndexedAttestation
 		want        SlashingKind
 	}{
 		{
-			name:        "surround vote at half of the weak subjectivity period",
-			signingRoot: [32]byte{},
-			attestation: createAttestation(numEpochs/2, numEpochs),
-			want:        SurroundingVote,
+			name:        "source lower than lowest signed source",
+			attestation: createAttestation(9, 21),
+			want:        MinimalProtectionViolation,
 		},
 		{
-			name:        "spanning genesis to weak subjectivity period surround vote",
-			signingRoot: [32]byte{},
-			attestation: createAttestation(0, numEpochs),
-			want:        SurroundingVote,
+			name:        "target equal to highest signed target",
+			attestation: createAttestation(12, 20),
+			want:        MinimalProtectionViolation,
 		},
 		{
-			name:        "simple surround vote at end of weak subjectivity period",
-			signingRoot: [32]byte{},
-			attestation: createAttestation(numEpochs-3, numEpochs),
-			want:        SurroundingVote,
+			name:        "target lower than highest signed target",
+			attestation: createAttestation(13, 15),
+			want:        MinimalProtectionViolation,
 		},
 		{
-			name:        "non-slashable vote",
-			signingRoot: [32]byte{},
-			attestation: createAttestation(numEpochs, numEpochs+1),
+			name:        "safe attestation",
+			attestation: createAttestation(10, 21),
 			want:        NotSlashable,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			slashingKind, err := validatorDB.CheckSlashableAttestation(ctx, pubKeys[0], tt.signingRoot, tt.attestation)
-			if tt.want != NotSlashable {
+			slashingKind, err := validatorDB.CheckSlashableAttestation(ctx, pubKey, [32]byte{3}, tt.attestation)
+			if tt.want == NotSlashable {
+				require.NoError(t, err)
+			} else {
 				require.NotNil(t, err)
 			}
 			assert.Equal(t, tt.want, slashingKind)
 		})
 	}
+
+	// No full attesting history should have been written.
+	history, err := validatorDB.AttestationHistoryForPubKey(ctx, pubKey)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(history))
+	highestTarget, exists, err := validatorDB.HighestSignedTargetEpoch(ctx, pubKey)
+	require.NoError(t, err)
+	require.Equal(t, true, exists)
+	assert.Equal(t, types.Epoch(20), highestTarget)
+}
+
+func TestStore_MinimalSlashingProtection_ExistingFullHistory(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	dirPath := t.TempDir()
+	fullDB, err := NewKVStore(ctx, dirPath, &Config{PubKeys: [][48]byte{pubKey}})
+	require.NoError(t, err, "Failed to instantiate DB")
+	require.NoError(t, fullDB.SaveAttestationsForPubKey(
+		ctx,
+		pubKey,
+		[][32]byte{{1}},
+		[]*ethpb.IndexedAttestation{createAttestation(10, 20)},
+	))
+	// Simulate history written before the highest signed target bucket existed.
+	require.NoError(t, fullDB.update(func(tx *bolt.Tx) error {
+		return tx.Bucket(highestSignedTargetBucket).Delete(pubKey[:])
+	}))
+	require.NoError(t, fullDB.Close())
+
+	minimalDB, err := NewKVStore(ctx, dirPath, &Config{
+		PubKeys:                   [][48]byte{pubKey},
+		MinimalSlashingProtection: true,
+	})
+	require.NoError(t, err, "Failed to instantiate DB")
+	t.Cleanup(func() {
+		require.NoError(t, minimalDB.Close(), "Failed to close database")
+		require.NoError(t, minimalDB.ClearDB(), "Failed to clear database")
+	})
+	slashingKind, err := minimalDB.CheckSlashableAttestation(ctx, pubKey, [32]byte{2}, createAttestation(11, 19))
+	require.NotNil(t, err)
+	assert.Equal(t, MinimalProtectionViolation, slashingKind)
+	slashingKind, err = minimalDB.CheckSlashableAttestation(ctx, pubKey, [32]byte{2}, createAttestation(11, 21))
+	require.NoError(t, err)
+	assert.Equal(t, NotSlashable, slashingKind)
+}
+
+func TestStore_CheckSlashableAttestation_SlashingDetectionHook(t *testing.T) {
+	type detection struct {
+		pubKey [48]byte
+		kind   SlashingKind
+		source types.Epoch
+		target types.Epoch
+	}
+	detections := make(chan detection, 1)
+	pubKey := [48]byte{1}
+	validatorDB := setupDBWithConfig(t, &Config{
+		PubKeys: [][48]byte{pubKey},
+		SlashingDetectionHook: func(pubKey [48]byte, kind SlashingKind, source, target types.Epoch) {
+			detections <- detection{pubKey: pubKey, kind: kind, source: source, target: target}
+		},
+	})
+	ctx := context.Background()
+	require.NoError(t, validatorDB.SaveAttestationForPubKey(ctx, pubKey, [32]byte{1}, createAttestation(2, 4)))
+
+	// Safe attestations do not call the hook.
+	slashingKind, err := validatorDB.CheckSlashableAttestation(ctx, pubKey, [32]byte{1}, createAttestation(4, 5))
+	require.NoError(t, err)
+	assert.Equal(t, NotSlashable, slashingKind)
+
+	tests := []struct {
+		att  *ethpb.IndexedAttestation
+		want detection
+	}{
+		{
+			att:  createAttestation(3, 4),
+			want: detection{pubKey: pubKey, kind: DoubleVote, source: 3, target: 4},
+		},
+		{
+			att:  createAttestation(1, 5),
+			want: detection{pubKey: pubKey, kind: SurroundingVote, source: 1, target: 5},
+		},
+	}
+	for _, tt := range tests {
+		slashingKind, err := validatorDB.CheckSlashableAttestation(ctx, pubKey, [32]byte{2}, tt.att)
+		require.NotNil(t, err)
+		require.Equal(t, tt.want.kind, slashingKind)
+		select {
+		case got := <-detections:
+			assert.DeepEqual(t, tt.want, got)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Slashing detection hook was not called")
+		}
+	}
+	select {
+	case got := <-detections:
+		t.Fatalf("Unexpected slashing detection %v", got)
+	default:
+	}
+}
+
+func TestStore_CheckSlashableAttestation_SuspiciousFutureTarget(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	validatorDB := setupDBWithConfig(t, &Config{
+		PubKeys:                       [][48]byte{pubKey},
+		DetectSuspiciousFutureTargets: true,
+	})
+	wsPeriod := params.BeaconConfig().WeakSubjectivityPeriod
+
+	// Public keys without attesting history are never flagged.
+	slashingKind, err := validatorDB.CheckSlashableAttestation(ctx, pubKey, [32]byte{1}, createAttestation(0, 2*wsPeriod))
+	require.NoError(t, err)
+	assert.Equal(t, NotSlashable, slashingKind)
+
+	require.NoError(t, validatorDB.saveAttestationRecords(ctx, []*AttestationRecord{
+		{PubKey: pubKey, Source: 9, Target: 10, SigningRoot: [32]byte{1}},
+	}))
+	slashingKind, err = validatorDB.CheckSlashableAttestation(ctx, pubKey, [32]byte{1}, createAttestation(10, 10+wsPeriod))
+	require.NoError(t, err)
+	assert.Equal(t, NotSlashable, slashingKind)
+
+	slashingKind, err = validatorDB.CheckSlashableAttestation(ctx, pubKey, [32]byte{1}, createAttestation(10, 11+wsPeriod))
+	assert.Equal(t, SuspiciousFutureTarget, slashingKind)
+	var futureTargetErr *SuspiciousFutureTargetError
+	require.Equal(t, true, errors.As(err, &futureTargetErr))
+	assert.Equal(t, 11+wsPeriod, futureTargetErr.TargetEpoch)
+	assert.Equal(t, types.Epoch(10), futureTargetErr.HighestTargetEpoch)
+
+	// A slashable attestation is reported as such rather than as suspicious.
+	slashingKind, err = validatorDB.CheckSlashableAttestation(ctx, pubKey, [32]byte{1}, createAttestation(8, 11+wsPeriod))
+	require.NotNil(t, err)
+	assert.Equal(t, SurroundingVote, slashingKind)
+
+	// Batched records which are not yet written are taken into account.
+	validatorDB.attestationBatchFor(pubKey).records.Append(&AttestationRecord{PubKey: pubKey, Source: 10, Target: 20})
+	slashingKind, err = validatorDB.CheckSlashableAttestation(ctx, pubKey, [32]byte{1}, createAttestation(10, 11+wsPeriod))
+	require.NoError(t, err)
+	assert.Equal(t, NotSlashable, slashingKind)
+}
+
+func TestStore_CheckSlashableAttestation_SuspiciousFutureTarget_Disabled(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	validatorDB := setupDB(t, [][48]byte{pubKey})
+	require.NoError(t, validatorDB.saveAttestationRecords(ctx, []*AttestationRecord{
+		{PubKey: pubKey, Source: 9, Target: 10, SigningRoot: [32]byte{1}},
+	}))
+	att := createAttestation(10, 11+params.BeaconConfig().WeakSubjectivityPeriod)
+	slashingKind, err := validatorDB.CheckSlashableAttestation(ctx, pubKey, [32]byte{1}, att)
+	require.NoError(t, err)
+	assert.Equal(t, NotSlashable, slashingKind)
 }
 
 func TestLowestSignedSourceEpoch_SaveRetrieve(t *testing.T) {
@@ -329,6 +817,51 @@ func TestLowestSignedTargetEpoch_SaveRetrieveReplace(t *testing.T) {
 	require.Equal(t, types.Epoch(199), got)
 }
 
+func TestHighestSignedTargetEpoch_SaveRetrieve(t *testing.T) {
+	ctx := context.Background()
+	p0 := [48]byte{0}
+	p1 := [48]byte{1}
+	validatorDB := setupDB(t, [][48]byte{p0, p1})
+
+	// No history yet.
+	got, exists, err := validatorDB.HighestSignedTargetEpoch(ctx, p0)
+	require.NoError(t, err)
+	require.Equal(t, false, exists)
+	require.Equal(t, types.Epoch(0), got)
+
+	// Epoch zero is distinguishable from no history.
+	require.NoError(
+		t,
+		validatorDB.SaveAttestationForPubKey(ctx, p0, [32]byte{}, createAttestation(0, 0)),
+	)
+	got, exists, err = validatorDB.HighestSignedTargetEpoch(ctx, p0)
+	require.NoError(t, err)
+	require.Equal(t, true, exists)
+	require.Equal(t, types.Epoch(0), got)
+
+	// Can replace with a higher target, regardless of insertion order.
+	require.NoError(
+		t,
+		validatorDB.SaveAttestationForPubKey(ctx, p0, [32]byte{}, createAttestation(300, 301)),
+	)
+	require.NoError(
+		t,
+		validatorDB.SaveAttestationForPubKey(ctx, p0, [32]byte{}, createAttestation(99, 100)),
+	)
+	require.NoError(
+		t,
+		validatorDB.SaveAttestationForPubKey(ctx, p1, [32]byte{}, createAttestation(199, 200)),
+	)
+	got, exists, err = validatorDB.HighestSignedTargetEpoch(ctx, p0)
+	require.NoError(t, err)
+	require.Equal(t, true, exists)
+	require.Equal(t, types.Epoch(301), got)
+	got, exists, err = validatorDB.HighestSignedTargetEpoch(ctx, p1)
+	require.NoError(t, err)
+	require.Equal(t, true, exists)
+	require.Equal(t, types.Epoch(200), got)
+}
+
 func TestStore_SaveAttestationsForPubKey(t *testing.T) {
 	ctx := context.Background()
 	numValidators := 1
@@ -369,114 +902,1203 @@ func TestStore_SaveAttestationsForPubKey(t *testing.T) {
 	}
 }
 
-func TestSaveAttestationForPubKey_BatchWrites_FullCapacity(t *testing.T) {
-	hook := logTest.NewGlobal()
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-	numValidators := attestationBatchCapacity
-	pubKeys := make([][48]byte, numValidators)
+func TestStore_SaveAttestationsForPubKey_Idempotent(t *testing.T) {
+	ctx := context.Background()
+	pubKeys := make([][48]byte, 1)
 	validatorDB := setupDB(t, pubKeys)
+	atts := make([]*ethpb.IndexedAttestation, 0)
+	signingRoots := make([][32]byte, 0)
+	for i := types.Epoch(1); i < 10; i++ {
+		atts = append(atts, createAttestation(i-1, i))
+		var sr [32]byte
+		copy(sr[:], fmt.Sprintf("%d", i))
+		signingRoots = append(signingRoots, sr)
+	}
 
-	// For each public key, we attempt to save an attestation with signing root.
-	var wg sync.WaitGroup
-	for i, pubKey := range pubKeys {
-		wg.Add(1)
-		go func(j types.Epoch, pk [48]byte, w *sync.WaitGroup) {
-			defer w.Done()
-			var signingRoot [32]byte
-			copy(signingRoot[:], fmt.Sprintf("%d", j))
-			att := createAttestation(j, j+1)
-			err := validatorDB.SaveAttestationForPubKey(ctx, pk, signingRoot, att)
-			require.NoError(t, err)
-		}(types.Epoch(i), pubKey, &wg)
+	// Saving the same history twice, as happens when re-importing
+	// the same slashing protection file, should not duplicate any entries.
+	for i := 0; i < 2; i++ {
+		require.NoError(t, validatorDB.SaveAttestationsForPubKey(ctx, pubKeys[0], signingRoots, atts))
 	}
-	wg.Wait()
+	history, err := validatorDB.AttestationHistoryForPubKey(ctx, pubKeys[0])
+	require.NoError(t, err)
+	require.Equal(t, len(atts), len(history))
 
-	// We verify that we reached the max capacity of batched attestations
-	// before we are required to force flush them to the DB.
-	require.LogsContain(t, hook, "Reached max capacity of batched attestation records")
-	require.LogsDoNotContain(t, hook, "Batched attestation records write interval reached")
-	require.LogsContain(t, hook, "Successfully flushed batched attestations to DB")
-	require.Equal(t, 0, validatorDB.batchedAttestations.Len())
+	err = validatorDB.view(func(tx *bolt.Tx) error {
+		pkBucket := tx.Bucket(pubKeysBucket).Bucket(pubKeys[0][:])
+		sourceEpochsBucket := pkBucket.Bucket(attestationSourceEpochsBucket)
+		targetEpochsBucket := pkBucket.Bucket(attestationTargetEpochsBucket)
+		for _, att := range atts {
+			sourceBytes := bytesutil.EpochToBytesBigEndian(att.Data.Source.Epoch)
+			targetBytes := bytesutil.EpochToBytesBigEndian(att.Data.Target.Epoch)
+			require.DeepEqual(t, targetBytes, sourceEpochsBucket.Get(sourceBytes))
+			require.DeepEqual(t, sourceBytes, targetEpochsBucket.Get(targetBytes))
+		}
+		return nil
+	})
+	require.NoError(t, err)
 
-	// We then verify all the data we wanted to save is indeed saved to disk.
-	err := validatorDB.view(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket(pubKeysBucket)
-		for i, pubKey := range pubKeys {
-			var signingRoot [32]byte
+	lowestSource, exists, err := validatorDB.LowestSignedSourceEpoch(ctx, pubKeys[0])
+	require.NoError(t, err)
+	require.Equal(t, true, exists)
+	require.Equal(t, types.Epoch(0), lowestSource)
+	lowestTarget, exists, err := validatorDB.LowestSignedTargetEpoch(ctx, pubKeys[0])
+	require.NoError(t, err)
+	require.Equal(t, true, exists)
+	require.Equal(t, types.Epoch(1), lowestTarget)
+}
+
+func TestStore_SaveAttestationRecordsForPubKey(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	atts := make([]*ethpb.IndexedAttestation, 0)
+	signingRoots := make([][32]byte, 0)
+	records := make([]*AttestationRecord, 0)
+	for i := types.Epoch(1); i < 10; i++ {
+		atts = append(atts, createAttestation(i-1, i))
+		var sr [32]byte
+		copy(sr[:], fmt.Sprintf("%d", i))
+		signingRoots = append(signingRoots, sr)
+		records = append(records, &AttestationRecord{
+			PubKey:      pubKey,
+			Source:      i - 1,
+			Target:      i,
+			SigningRoot: sr,
+		})
+	}
+
+	// Records are written with the same on-disk layout as SaveAttestationsForPubKey.
+	wantDB, err := NewKVStore(ctx, t.TempDir(), &Config{PubKeys: [][48]byte{pubKey}})
+	require.NoError(t, err, "Failed to instantiate DB")
+	require.NoError(t, wantDB.SaveAttestationsForPubKey(ctx, pubKey, signingRoots, atts))
+	want := dumpDB(t, wantDB)
+	require.NoError(t, wantDB.Close(), "Failed to close database")
+	validatorDB := setupDB(t, [][48]byte{pubKey})
+	require.NoError(t, validatorDB.SaveAttestationRecordsForPubKey(ctx, pubKey, records))
+	require.DeepEqual(t, want, dumpDB(t, validatorDB))
+
+	otherKeyRecord := &AttestationRecord{PubKey: [48]byte{2}, Source: 10, Target: 11}
+	err = validatorDB.SaveAttestationRecordsForPubKey(ctx, pubKey, []*AttestationRecord{otherKeyRecord})
+	require.ErrorContains(t, "does not match", err)
+	history, err := validatorDB.AttestationHistoryForPubKey(ctx, pubKey)
+	require.NoError(t, err)
+	require.Equal(t, len(records), len(history))
+}
+
+// dumpDB returns every key and value in the database, keyed by their full bucket path.
+func dumpDB(t *testing.T, validatorDB *Store) map[string][]byte {
+	contents := make(map[string][]byte)
+	var dumpBucket func(path string, b *bolt.Bucket) error
+	dumpBucket = func(path string, b *bolt.Bucket) error {
+		return b.ForEach(func(k, v []byte) error {
+			key := fmt.Sprintf("%s/%x", path, k)
+			if v == nil {
+				return dumpBucket(key, b.Bucket(k))
+			}
+			contents[key] = append([]byte{}, v...)
+			return nil
+		})
+	}
+	require.NoError(t, validatorDB.view(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			return dumpBucket(string(name), b)
+		})
+	}))
+	return contents
+}
+
+func TestStore_SaveAttestationForPubKey_DecreasingTarget(t *testing.T) {
+	hook := logTest.NewGlobal()
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	validatorDB := setupDB(t, [][48]byte{pubKey})
+	require.NoError(t, validatorDB.SaveAttestationForPubKey(ctx, pubKey, [32]byte{1}, createAttestation(4, 5)))
+
+	// Saving the same target again is not a decreasing target.
+	require.NoError(t, validatorDB.SaveAttestationForPubKey(ctx, pubKey, [32]byte{1}, createAttestation(4, 5)))
+	require.LogsDoNotContain(t, hook, "lower target epoch than the highest signed target epoch")
+
+	// By default, a decreasing target is saved and logged.
+	require.NoError(t, validatorDB.SaveAttestationForPubKey(ctx, pubKey, [32]byte{2}, createAttestation(1, 2)))
+	require.LogsContain(t, hook, "lower target epoch than the highest signed target epoch")
+	history, err := validatorDB.AttestationHistoryForPubKey(ctx, pubKey)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(history))
+}
+
+func TestStore_SaveAttestationForPubKey_Retry(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	validatorDB := setupDB(t, [][48]byte{pubKey})
+	require.NoError(t, validatorDB.SaveAttestationForPubKey(ctx, pubKey, [32]byte{1}, createAttestation(4, 5)))
+
+	// Saving the exact same attestation again does not write to the DB.
+	writes := validatorDB.db.Stats().TxStats.Write
+	require.NoError(t, validatorDB.SaveAttestationForPubKey(ctx, pubKey, [32]byte{1}, createAttestation(4, 5)))
+	assert.Equal(t, writes, validatorDB.db.Stats().TxStats.Write)
+
+	// Attestations which differ in any of their epochs or signing root are written.
+	for _, tt := range []struct {
+		signingRoot [32]byte
+		source      types.Epoch
+		target      types.Epoch
+	}{
+		{signingRoot: [32]byte{2}, source: 4, target: 5},
+		{signingRoot: [32]byte{1}, source: 3, target: 5},
+		{signingRoot: [32]byte{1}, source: 4, target: 6},
+	} {
+		writes := validatorDB.db.Stats().TxStats.Write
+		require.NoError(t, validatorDB.SaveAttestationForPubKey(ctx, pubKey, tt.signingRoot, createAttestation(tt.source, tt.target)))
+		assert.Equal(t, true, validatorDB.db.Stats().TxStats.Write > writes)
+	}
+	history, err := validatorDB.AttestationHistoryForPubKey(ctx, pubKey)
+	require.NoError(t, err)
+	assert.Equal(t, 3, len(history))
+}
+
+func TestStore_SaveAttestationForPubKey_RejectDecreasingTargets(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	validatorDB, err := NewKVStore(ctx, t.TempDir(), &Config{
+		PubKeys:                 [][48]byte{pubKey},
+		RejectDecreasingTargets: true,
+	})
+	require.NoError(t, err, "Failed to instantiate DB")
+	t.Cleanup(func() {
+		require.NoError(t, validatorDB.Close(), "Failed to close database")
+		require.NoError(t, validatorDB.ClearDB(), "Failed to clear database")
+	})
+	require.NoError(t, validatorDB.SaveAttestationForPubKey(ctx, pubKey, [32]byte{1}, createAttestation(4, 5)))
+
+	err = validatorDB.SaveAttestationForPubKey(ctx, pubKey, [32]byte{2}, createAttestation(1, 2))
+	require.ErrorContains(t, "attestation target epoch 2 is lower than highest signed target epoch 5", err)
+	history, err := validatorDB.AttestationHistoryForPubKey(ctx, pubKey)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(history))
+
+	// Batched records which are not yet written are taken into account.
+	validatorDB.attestationBatchFor(pubKey).records.Append(&AttestationRecord{PubKey: pubKey, Source: 8, Target: 9})
+	err = validatorDB.SaveAttestationForPubKey(ctx, pubKey, [32]byte{3}, createAttestation(5, 6))
+	require.ErrorContains(t, "attestation target epoch 6 is lower than highest signed target epoch 9", err)
+}
+
+func TestStore_SaveAttestationForPubKey_InvalidAttestation(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	validatorDB := setupDB(t, [][48]byte{pubKey})
+	tests := []struct {
+		name    string
+		att     *ethpb.IndexedAttestation
+		wantErr string
+	}{
+		{
+			name:    "nil data",
+			att:     &ethpb.IndexedAttestation{},
+			wantErr: "attestation data is nil",
+		},
+		{
+			name: "nil source checkpoint",
+			att: &ethpb.IndexedAttestation{
+				Data: &ethpb.AttestationData{Target: &ethpb.Checkpoint{Epoch: 1}},
+			},
+			wantErr: "attestation source checkpoint is nil",
+		},
+		{
+			name: "nil target checkpoint",
+			att: &ethpb.IndexedAttestation{
+				Data: &ethpb.AttestationData{Source: &ethpb.Checkpoint{Epoch: 1}},
+			},
+			wantErr: "attestation target checkpoint is nil",
+		},
+		{
+			name:    "target epoch lower than source epoch",
+			att:     createAttestation(3, 2),
+			wantErr: "attestation target epoch 2 is lower than its source epoch 3",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validatorDB.SaveAttestationForPubKey(ctx, pubKey, [32]byte{1}, tt.att)
+			require.ErrorContains(t, tt.wantErr, err)
+			err = validatorDB.SaveAttestationsForPubKey(
+				ctx, pubKey, [][32]byte{{1}}, []*ethpb.IndexedAttestation{tt.att},
+			)
+			require.ErrorContains(t, tt.wantErr, err)
+		})
+	}
+	history, err := validatorDB.AttestationHistoryForPubKey(ctx, pubKey)
+	require.NoError(t, err)
+	require.Equal(t, 0, len(history))
+
+	// Equal source and target epochs, as attested at genesis, are valid.
+	require.NoError(t, validatorDB.SaveAttestationForPubKey(ctx, pubKey, [32]byte{1}, createAttestation(0, 0)))
+}
+
+func TestSaveAttestationForPubKey_BatchWrites_FullCapacity(t *testing.T) {
+	hook := logTest.NewGlobal()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	numValidators := attestationBatchCapacity
+	pubKeys := make([][48]byte, numValidators)
+	validatorDB := setupDB(t, pubKeys)
+	capacityFlushes := promtestutil.ToFloat64(batchedAttestationsFlushCount.WithLabelValues(flushReasonCapacity))
+
+	// For each public key, we attempt to save an attestation with signing root.
+	var wg sync.WaitGroup
+	for i, pubKey := range pubKeys {
+		wg.Add(1)
+		go func(j types.Epoch, pk [48]byte, w *sync.WaitGroup) {
+			defer w.Done()
+			var signingRoot [32]byte
+			copy(signingRoot[:], fmt.Sprintf("%d", j))
+			att := createAttestation(j, j+1)
+			err := validatorDB.SaveAttestationForPubKey(ctx, pk, signingRoot, att)
+			require.NoError(t, err)
+		}(types.Epoch(i), pubKey, &wg)
+	}
+	wg.Wait()
+
+	// We verify that we reached the max capacity of batched attestations
+	// before we are required to force flush them to the DB.
+	require.LogsContain(t, hook, "Reached max capacity of batched attestation records")
+	require.LogsDoNotContain(t, hook, "Batched attestation records write interval reached")
+	require.LogsContain(t, hook, "Successfully flushed batched attestations to DB")
+	assertFlushLogFields(t, hook, "Successfully flushed batched attestations to DB", flushReasonCapacity)
+	require.Equal(t, 0, validatorDB.batchedAttestationsLen())
+	require.Equal(
+		t,
+		capacityFlushes+1,
+		promtestutil.ToFloat64(batchedAttestationsFlushCount.WithLabelValues(flushReasonCapacity)),
+	)
+
+	// We then verify all the data we wanted to save is indeed saved to disk.
+	err := validatorDB.view(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(pubKeysBucket)
+		for i, pubKey := range pubKeys {
+			var signingRoot [32]byte
+			copy(signingRoot[:], fmt.Sprintf("%d", i))
+			pkBucket := bucket.Bucket(pubKey[:])
+			signingRootsBucket := pkBucket.Bucket(attestationSigningRootsBucket)
+			sourceEpochsBucket := pkBucket.Bucket(attestationSourceEpochsBucket)
+
+			source := bytesutil.Uint64ToBytesBigEndian(uint64(i))
+			target := bytesutil.Uint64ToBytesBigEndian(uint64(i) + 1)
+			savedSigningRoot := signingRootsBucket.Get(target)
+			require.DeepEqual(t, signingRoot[:], savedSigningRoot)
+			savedTarget := sourceEpochsBucket.Get(source)
+			require.DeepEqual(t, signingRoot[:], savedSigningRoot)
+			require.DeepEqual(t, target, savedTarget)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func TestSaveAttestationForPubKey_BatchWrites_Sharded(t *testing.T) {
+	ctx := context.Background()
+	numValidators := 64
+	pubKeys := make([][48]byte, numValidators)
+	for i := range pubKeys {
+		pubKeys[i] = [48]byte{byte(i), 1}
+	}
+	validatorDB := setupDBWithConfig(t, &Config{PubKeys: pubKeys, AttestationBatchShards: 4})
+	require.Equal(t, 4, len(validatorDB.attestationBatches))
+
+	// Public keys are spread across the shards.
+	usedBatches := make(map[*attestationBatch]bool)
+	for _, pubKey := range pubKeys {
+		usedBatches[validatorDB.attestationBatchFor(pubKey)] = true
+	}
+	assert.Equal(t, true, len(usedBatches) > 1)
+
+	var wg sync.WaitGroup
+	for i, pubKey := range pubKeys {
+		wg.Add(1)
+		go func(j types.Epoch, pk [48]byte) {
+			defer wg.Done()
+			require.NoError(t, validatorDB.SaveAttestationForPubKey(ctx, pk, [32]byte{byte(j)}, createAttestation(j, j+1)))
+		}(types.Epoch(i), pubKey)
+	}
+	wg.Wait()
+	require.Equal(t, 0, validatorDB.batchedAttestationsLen())
+
+	for i, pubKey := range pubKeys {
+		history, err := validatorDB.AttestationHistoryForPubKey(ctx, pubKey)
+		require.NoError(t, err)
+		require.Equal(t, 1, len(history))
+		assert.Equal(t, types.Epoch(i)+1, history[0].Target)
+	}
+
+	// Records queued in the shard of a public key are checked before being written.
+	for i, pubKey := range pubKeys {
+		validatorDB.attestationBatchFor(pubKey).records.Append(&AttestationRecord{
+			PubKey: pubKey, Source: types.Epoch(i) + 1, Target: types.Epoch(i) + 2, SigningRoot: [32]byte{1},
+		})
+		slashingKind, err := validatorDB.CheckSlashableAttestation(
+			ctx, pubKey, [32]byte{2}, createAttestation(types.Epoch(i)+1, types.Epoch(i)+2),
+		)
+		require.NotNil(t, err)
+		assert.Equal(t, DoubleVote, slashingKind)
+	}
+	require.NoError(t, validatorDB.FlushAttestationBatch(ctx))
+	require.Equal(t, 0, validatorDB.batchedAttestationsLen())
+}
+
+func TestSaveAttestationForPubKey_BatchWrites_LowCapacity_TimerReached(t *testing.T) {
+	hook := logTest.NewGlobal()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// Number of validators equal to half the total capacity
+	// of batch attestation processing. This will allow us to
+	// test force flushing to the DB based on a timer instead
+	// of the max capacity being reached.
+	numValidators := attestationBatchCapacity / 2
+	pubKeys := make([][48]byte, numValidators)
+	validatorDB := setupDB(t, pubKeys)
+
+	// For each public key, we attempt to save an attestation with signing root.
+	var wg sync.WaitGroup
+	for i, pubKey := range pubKeys {
+		wg.Add(1)
+		go func(j types.Epoch, pk [48]byte, w *sync.WaitGroup) {
+			defer w.Done()
+			var signingRoot [32]byte
+			copy(signingRoot[:], fmt.Sprintf("%d", j))
+			att := createAttestation(j, j+1)
+			err := validatorDB.SaveAttestationForPubKey(ctx, pk, signingRoot, att)
+			require.NoError(t, err)
+		}(types.Epoch(i), pubKey, &wg)
+	}
+	wg.Wait()
+
+	// We verify that we reached a timer interval for force flushing records
+	// before we are required to force flush them to the DB.
+	require.LogsDoNotContain(t, hook, "Reached max capacity of batched attestation records")
+	require.LogsContain(t, hook, "Batched attestation records write interval reached")
+	require.LogsContain(t, hook, "Successfully flushed batched attestations to DB")
+	require.Equal(t, 0, validatorDB.batchedAttestationsLen())
+
+	// We then verify all the data we wanted to save is indeed saved to disk.
+	err := validatorDB.view(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(pubKeysBucket)
+		for i, pubKey := range pubKeys {
+			var signingRoot [32]byte
 			copy(signingRoot[:], fmt.Sprintf("%d", i))
 			pkBucket := bucket.Bucket(pubKey[:])
 			signingRootsBucket := pkBucket.Bucket(attestationSigningRootsBucket)
 			sourceEpochsBucket := pkBucket.Bucket(attestationSourceEpochsBucket)
 
-			source := bytesutil.Uint64ToBytesBigEndian(uint64(i))
-			target := bytesutil.Uint64ToBytesBigEndian(uint64(i) + 1)
-			savedSigningRoot := signingRootsBucket.Get(target)
-			require.DeepEqual(t, signingRoot[:], savedSigningRoot)
-			savedTarget := sourceEpochsBucket.Get(source)
-			require.DeepEqual(t, signingRoot[:], savedSigningRoot)
-			require.DeepEqual(t, target, savedTarget)
-		}
-		return nil
-	})
+			source := bytesutil.Uint64ToBytesBigEndian(uint64(i))
+			target := bytesutil.Uint64ToBytesBigEndian(uint64(i) + 1)
+			savedSigningRoot := signingRootsBucket.Get(target)
+			require.DeepEqual(t, signingRoot[:], savedSigningRoot)
+			savedTarget := sourceEpochsBucket.Get(source)
+			require.DeepEqual(t, signingRoot[:], savedSigningRoot)
+			require.DeepEqual(t, target, savedTarget)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func TestSaveAttestationForPubKey_BatchWrites_CustomCapacity(t *testing.T) {
+	hook := logTest.NewGlobal()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	numValidators := 8
+	pubKeys := make([][48]byte, numValidators)
+	for i := range pubKeys {
+		pubKeys[i] = [48]byte{byte(i)}
+	}
+	// A long write interval ensures records are only
+	// flushed once the custom capacity is reached.
+	validatorDB, err := NewKVStore(ctx, t.TempDir(), &Config{
+		PubKeys:                       pubKeys,
+		AttestationBatchCapacity:      numValidators,
+		AttestationBatchWriteInterval: time.Hour,
+	})
+	require.NoError(t, err, "Failed to instantiate DB")
+	t.Cleanup(func() {
+		require.NoError(t, validatorDB.Close(), "Failed to close database")
+		require.NoError(t, validatorDB.ClearDB(), "Failed to clear database")
+	})
+
+	var wg sync.WaitGroup
+	for i, pubKey := range pubKeys {
+		wg.Add(1)
+		go func(j types.Epoch, pk [48]byte, w *sync.WaitGroup) {
+			defer w.Done()
+			att := createAttestation(j, j+1)
+			err := validatorDB.SaveAttestationForPubKey(ctx, pk, [32]byte{}, att)
+			require.NoError(t, err)
+		}(types.Epoch(i), pubKey, &wg)
+	}
+	wg.Wait()
+
+	require.LogsContain(t, hook, "Reached max capacity of batched attestation records")
+	require.LogsDoNotContain(t, hook, "Batched attestation records write interval reached")
+	require.Equal(t, 0, validatorDB.batchedAttestationsLen())
+	for _, pubKey := range pubKeys {
+		history, err := validatorDB.AttestationHistoryForPubKey(ctx, pubKey)
+		require.NoError(t, err)
+		require.Equal(t, 1, len(history))
+	}
+}
+
+func TestSaveAttestationForPubKey_BatchWrites_ContextCancelled(t *testing.T) {
+	ctx := context.Background()
+	numValidators := 8
+	pubKeys := make([][48]byte, numValidators+1)
+	for i := range pubKeys {
+		pubKeys[i] = [48]byte{byte(i)}
+	}
+	validatorDB, err := NewKVStore(ctx, t.TempDir(), &Config{
+		PubKeys:                       pubKeys,
+		AttestationBatchCapacity:      numValidators,
+		AttestationBatchWriteInterval: time.Hour,
+	})
+	require.NoError(t, err, "Failed to instantiate DB")
+	t.Cleanup(func() {
+		require.NoError(t, validatorDB.Close(), "Failed to close database")
+		require.NoError(t, validatorDB.ClearDB(), "Failed to clear database")
+	})
+
+	// We fill half of the batch with records whose context gets cancelled
+	// while they are waiting for the batch to be flushed.
+	cancelledCtx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	for i := 0; i < numValidators/2; i++ {
+		wg.Add(1)
+		go func(j types.Epoch, pk [48]byte, w *sync.WaitGroup) {
+			defer w.Done()
+			att := createAttestation(j, j+1)
+			err := validatorDB.SaveAttestationForPubKey(cancelledCtx, pk, [32]byte{byte(j)}, att)
+			assert.ErrorContains(t, context.Canceled.Error(), err)
+		}(types.Epoch(i), pubKeys[i], &wg)
+	}
+	for validatorDB.batchedAttestationsLen() < numValidators/2 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	wg.Wait()
+
+	// A record saved with an already cancelled context should never be queued.
+	droppedPubKey := pubKeys[numValidators]
+	err = validatorDB.SaveAttestationForPubKey(cancelledCtx, droppedPubKey, [32]byte{}, createAttestation(1, 2))
+	require.ErrorContains(t, context.Canceled.Error(), err)
+	require.Equal(t, numValidators/2, validatorDB.batchedAttestationsLen())
+
+	// We fill the rest of the batch, which flushes it to the DB.
+	for i := numValidators / 2; i < numValidators; i++ {
+		wg.Add(1)
+		go func(j types.Epoch, pk [48]byte, w *sync.WaitGroup) {
+			defer w.Done()
+			att := createAttestation(j, j+1)
+			err := validatorDB.SaveAttestationForPubKey(ctx, pk, [32]byte{byte(j)}, att)
+			require.NoError(t, err)
+		}(types.Epoch(i), pubKeys[i], &wg)
+	}
+	wg.Wait()
+	require.Equal(t, 0, validatorDB.batchedAttestationsLen())
+
+	// Records already queued when their context was cancelled are fully
+	// written, and the dropped record is not written at all.
+	err = validatorDB.view(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(pubKeysBucket)
+		for i := 0; i < numValidators; i++ {
+			pkBucket := bucket.Bucket(pubKeys[i][:])
+			require.NotNil(t, pkBucket)
+			source := bytesutil.Uint64ToBytesBigEndian(uint64(i))
+			target := bytesutil.Uint64ToBytesBigEndian(uint64(i) + 1)
+			sourceEpochsBucket := pkBucket.Bucket(attestationSourceEpochsBucket)
+			require.NotNil(t, sourceEpochsBucket)
+			require.DeepEqual(t, target, sourceEpochsBucket.Get(source))
+			signingRootsBucket := pkBucket.Bucket(attestationSigningRootsBucket)
+			require.NotNil(t, signingRootsBucket)
+			signingRoot := [32]byte{byte(i)}
+			require.DeepEqual(t, signingRoot[:], signingRootsBucket.Get(target))
+		}
+		pkBucket := bucket.Bucket(droppedPubKey[:])
+		if pkBucket != nil {
+			sourceEpochsBucket := pkBucket.Bucket(attestationSourceEpochsBucket)
+			if sourceEpochsBucket != nil {
+				require.Equal(t, 0, sourceEpochsBucket.Stats().KeyN)
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func TestStore_CheckSlashableAttestation_BatchedRecords(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	pubKeys := [][48]byte{{1}, {2}}
+	// A long write interval and large capacity ensure the record stays batched.
+	validatorDB, err := NewKVStore(ctx, t.TempDir(), &Config{
+		PubKeys:                       pubKeys,
+		AttestationBatchCapacity:      8,
+		AttestationBatchWriteInterval: time.Hour,
+	})
+	require.NoError(t, err, "Failed to instantiate DB")
+	t.Cleanup(func() {
+		require.NoError(t, validatorDB.Close(), "Failed to close database")
+		require.NoError(t, validatorDB.ClearDB(), "Failed to clear database")
+	})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := validatorDB.SaveAttestationForPubKey(ctx, pubKeys[0], [32]byte{1}, createAttestation(2, 3))
+		assert.ErrorContains(t, context.Canceled.Error(), err)
+	}()
+	for validatorDB.batchedAttestationsLen() < 1 {
+		time.Sleep(time.Millisecond)
+	}
+	history, err := validatorDB.AttestationHistoryForPubKey(ctx, pubKeys[0])
+	require.NoError(t, err)
+	require.Equal(t, 0, len(history))
+
+	slashingKind, err := validatorDB.CheckSlashableAttestation(ctx, pubKeys[0], [32]byte{2}, createAttestation(2, 3))
+	var doubleVoteErr *DoubleVoteError
+	require.Equal(t, true, errors.As(err, &doubleVoteErr))
+	assert.Equal(t, DoubleVote, slashingKind)
+	assert.Equal(t, [32]byte{1}, doubleVoteErr.ExistingSigningRoot)
+
+	slashingKind, err = validatorDB.CheckSlashableAttestation(ctx, pubKeys[0], [32]byte{2}, createAttestation(1, 4))
+	assert.ErrorContains(t, "surrounds", err)
+	assert.Equal(t, SurroundingVote, slashingKind)
+
+	// The same attestation, or one from another public key, is not slashable.
+	slashingKind, err = validatorDB.CheckSlashableAttestation(ctx, pubKeys[0], [32]byte{1}, createAttestation(2, 3))
+	require.NoError(t, err)
+	assert.Equal(t, NotSlashable, slashingKind)
+	slashingKind, err = validatorDB.CheckSlashableAttestation(ctx, pubKeys[1], [32]byte{2}, createAttestation(2, 3))
+	require.NoError(t, err)
+	assert.Equal(t, NotSlashable, slashingKind)
+
+	cancel()
+	wg.Wait()
+}
+
+func TestStore_SelfTestSlashingProtection(t *testing.T) {
+	ctx := context.Background()
+	pubKeys := [][48]byte{{1}, {2}, {3}}
+	validatorDB := setupDB(t, pubKeys)
+
+	atts := []*ethpb.IndexedAttestation{createAttestation(2, 3), createAttestation(3, 4)}
+	require.NoError(t, validatorDB.SaveAttestationsForPubKey(ctx, pubKeys[0], [][32]byte{{1}, {2}}, atts))
+	require.NoError(t, validatorDB.SaveAttestationForPubKey(ctx, pubKeys[1], [32]byte{1}, createAttestation(0, 1)))
+
+	ok, err := validatorDB.SelfTestSlashingProtection(ctx, pubKeys[0])
+	require.NoError(t, err)
+	assert.Equal(t, true, ok)
+
+	// The self-test does not modify the stored history.
+	history, err := validatorDB.AttestationHistoryForPubKey(ctx, pubKeys[0])
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(history))
+
+	// No attestation can surround a history with only a genesis source epoch, so a double vote is used.
+	ok, err = validatorDB.SelfTestSlashingProtection(ctx, pubKeys[1])
+	require.NoError(t, err)
+	assert.Equal(t, true, ok)
+	_, err = validatorDB.SelfTestSlashingProtection(ctx, pubKeys[2])
+	assert.ErrorContains(t, "no attestation history to self-test against", err)
+}
+
+func TestStore_SelfTestSlashingProtection_DoesNotCallHook(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	called := make(chan SlashingKind, 1)
+	validatorDB := setupDBWithConfig(t, &Config{
+		PubKeys: [][48]byte{pubKey},
+		SlashingDetectionHook: func(_ [48]byte, kind SlashingKind, _, _ types.Epoch) {
+			called <- kind
+		},
+	})
+	require.NoError(t, validatorDB.SaveAttestationForPubKey(ctx, pubKey, [32]byte{1}, createAttestation(2, 3)))
+
+	ok, err := validatorDB.SelfTestSlashingProtection(ctx, pubKey)
+	require.NoError(t, err)
+	assert.Equal(t, true, ok)
+	select {
+	case kind := <-called:
+		t.Fatalf("Slashing detection hook was called with %v", kind)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestStore_SelfTestSlashingProtection_MinimalSlashingProtection(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	validatorDB, err := NewKVStore(ctx, t.TempDir(), &Config{
+		PubKeys:                   [][48]byte{pubKey},
+		MinimalSlashingProtection: true,
+	})
+	require.NoError(t, err, "Failed to instantiate DB")
+	t.Cleanup(func() {
+		require.NoError(t, validatorDB.Close(), "Failed to close database")
+		require.NoError(t, validatorDB.ClearDB(), "Failed to clear database")
+	})
+	require.NoError(t, validatorDB.SaveAttestationForPubKey(ctx, pubKey, [32]byte{1}, createAttestation(10, 11)))
+	require.NoError(t, validatorDB.SaveAttestationForPubKey(ctx, [48]byte{2}, [32]byte{1}, createAttestation(0, 1)))
+
+	ok, err := validatorDB.SelfTestSlashingProtection(ctx, pubKey)
+	require.NoError(t, err)
+	assert.Equal(t, true, ok)
+	// A lowest signed source epoch of 0 is handled as well.
+	ok, err = validatorDB.SelfTestSlashingProtection(ctx, [48]byte{2})
+	require.NoError(t, err)
+	assert.Equal(t, true, ok)
+	highestTarget, exists, err := validatorDB.HighestSignedTargetEpoch(ctx, pubKey)
+	require.NoError(t, err)
+	require.Equal(t, true, exists)
+	assert.Equal(t, types.Epoch(11), highestTarget)
+}
+
+func TestStore_KeepAllSigningRoots(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	validatorDB, err := NewKVStore(ctx, t.TempDir(), &Config{
+		PubKeys:             [][48]byte{pubKey},
+		KeepAllSigningRoots: true,
+	})
+	require.NoError(t, err, "Failed to instantiate DB")
+	t.Cleanup(func() {
+		require.NoError(t, validatorDB.Close(), "Failed to close database")
+		require.NoError(t, validatorDB.ClearDB(), "Failed to clear database")
+	})
+
+	first, second, incoming := [32]byte{1}, [32]byte{2}, [32]byte{3}
+	att := createAttestation(1, 2)
+	for _, signingRoot := range [][32]byte{first, second, first} {
+		require.NoError(t, validatorDB.SaveAttestationsForPubKey(
+			ctx, pubKey, [][32]byte{signingRoot}, []*ethpb.IndexedAttestation{att},
+		))
+	}
+
+	signingRoots, err := validatorDB.SigningRootsAtTargetEpoch(ctx, pubKey, 2)
+	require.NoError(t, err)
+	assert.DeepEqual(t, [][32]byte{first, second}, signingRoots)
+	signingRoot, exists, err := validatorDB.SigningRootAtTarget(ctx, pubKey, 2)
+	require.NoError(t, err)
+	assert.Equal(t, true, exists)
+	assert.Equal(t, first, signingRoot)
+	history, err := validatorDB.AttestationHistoryForPubKey(ctx, pubKey)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(history))
+	assert.Equal(t, first, history[0].SigningRoot)
+
+	// A double vote is reported against the first stored signing root that differs.
+	slashingKind, err := validatorDB.CheckSlashableAttestation(ctx, pubKey, incoming, att)
+	var doubleVoteErr *DoubleVoteError
+	require.Equal(t, true, errors.As(err, &doubleVoteErr))
+	assert.Equal(t, DoubleVote, slashingKind)
+	assert.Equal(t, first, doubleVoteErr.ExistingSigningRoot)
+	slashingKind, err = validatorDB.CheckSlashableAttestation(ctx, pubKey, first, att)
+	require.Equal(t, true, errors.As(err, &doubleVoteErr))
+	assert.Equal(t, DoubleVote, slashingKind)
+	assert.Equal(t, second, doubleVoteErr.ExistingSigningRoot)
+}
+
+func TestStore_SigningRootAtTarget(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	validatorDB := setupDB(t, [][48]byte{pubKey})
+
+	signingRoot, exists, err := validatorDB.SigningRootAtTarget(ctx, pubKey, 2)
+	require.NoError(t, err)
+	assert.Equal(t, false, exists)
+	assert.Equal(t, [32]byte{}, signingRoot)
+
+	require.NoError(t, validatorDB.SaveAttestationsForPubKey(
+		ctx, pubKey, [][32]byte{{5}, {}}, []*ethpb.IndexedAttestation{createAttestation(1, 2), createAttestation(2, 3)},
+	))
+	signingRoot, exists, err = validatorDB.SigningRootAtTarget(ctx, pubKey, 2)
+	require.NoError(t, err)
+	assert.Equal(t, true, exists)
+	assert.Equal(t, [32]byte{5}, signingRoot)
+
+	// A stored zero signing root, as imported without a signing root, still exists.
+	signingRoot, exists, err = validatorDB.SigningRootAtTarget(ctx, pubKey, 3)
+	require.NoError(t, err)
+	assert.Equal(t, true, exists)
+	assert.Equal(t, [32]byte{}, signingRoot)
+
+	_, exists, err = validatorDB.SigningRootAtTarget(ctx, pubKey, 4)
+	require.NoError(t, err)
+	assert.Equal(t, false, exists)
+
+	// SigningRootAtTargetEpoch returns the zero root whether or not one is stored.
+	signingRoot, err = validatorDB.SigningRootAtTargetEpoch(ctx, pubKey, 2)
+	require.NoError(t, err)
+	assert.Equal(t, [32]byte{5}, signingRoot)
+	signingRoot, err = validatorDB.SigningRootAtTargetEpoch(ctx, pubKey, 4)
+	require.NoError(t, err)
+	assert.Equal(t, [32]byte{}, signingRoot)
+}
+
+func TestStore_TargetForSource(t *testing.T) {
+	for _, compactEpochKeys := range []bool{false, true} {
+		t.Run(fmt.Sprintf("compact epoch keys %v", compactEpochKeys), func(t *testing.T) {
+			ctx := context.Background()
+			pubKey := [48]byte{1}
+			validatorDB := setupDBWithConfig(t, &Config{PubKeys: [][48]byte{pubKey}, CompactEpochKeys: compactEpochKeys})
+
+			_, exists, err := validatorDB.TargetForSource(ctx, [48]byte{2}, 1)
+			require.NoError(t, err)
+			assert.Equal(t, false, exists, "Expected no target for an unknown public key")
+
+			require.NoError(t, validatorDB.SaveAttestationsForPubKey(
+				ctx,
+				pubKey,
+				[][32]byte{{1}, {2}, {3}},
+				[]*ethpb.IndexedAttestation{createAttestation(1, 5), createAttestation(1, 3), createAttestation(4, 6)},
+			))
+			// The highest of several targets recorded for a source is returned.
+			target, exists, err := validatorDB.TargetForSource(ctx, pubKey, 1)
+			require.NoError(t, err)
+			require.Equal(t, true, exists)
+			assert.Equal(t, types.Epoch(5), target)
+			target, exists, err = validatorDB.TargetForSource(ctx, pubKey, 4)
+			require.NoError(t, err)
+			require.Equal(t, true, exists)
+			assert.Equal(t, types.Epoch(6), target)
+
+			_, exists, err = validatorDB.TargetForSource(ctx, pubKey, 2)
+			require.NoError(t, err)
+			assert.Equal(t, false, exists, "Expected no target for a source without records")
+		})
+	}
+}
+
+func TestStore_SigningRootsAtTargetEpoch_SingleRoot(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	validatorDB := setupDB(t, [][48]byte{pubKey})
+
+	signingRoots, err := validatorDB.SigningRootsAtTargetEpoch(ctx, pubKey, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(signingRoots))
+
+	// Without keeping all signing roots, only the latest one is stored.
+	att := createAttestation(1, 2)
+	for _, signingRoot := range [][32]byte{{1}, {2}} {
+		require.NoError(t, validatorDB.SaveAttestationsForPubKey(
+			ctx, pubKey, [][32]byte{signingRoot}, []*ethpb.IndexedAttestation{att},
+		))
+	}
+	signingRoots, err = validatorDB.SigningRootsAtTargetEpoch(ctx, pubKey, 2)
 	require.NoError(t, err)
+	assert.DeepEqual(t, [][32]byte{{2}}, signingRoots)
 }
 
-func TestSaveAttestationForPubKey_BatchWrites_LowCapacity_TimerReached(t *testing.T) {
-	hook := logTest.NewGlobal()
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-	// Number of validators equal to half the total capacity
-	// of batch attestation processing. This will allow us to
-	// test force flushing to the DB based on a timer instead
-	// of the max capacity being reached.
-	numValidators := attestationBatchCapacity / 2
+func TestStore_Close_FlushesBatchedRecords(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	numValidators := 8
 	pubKeys := make([][48]byte, numValidators)
-	validatorDB := setupDB(t, pubKeys)
+	for i := range pubKeys {
+		pubKeys[i] = [48]byte{byte(i)}
+	}
+	// A long write interval ensures records are only flushed when closing the DB.
+	validatorDB, err := NewKVStore(ctx, dir, &Config{
+		PubKeys:                       pubKeys,
+		AttestationBatchWriteInterval: time.Hour,
+		ProposalBatchWriteInterval:    time.Hour,
+		CloseFlushTimeout:             time.Millisecond * 500,
+	})
+	require.NoError(t, err, "Failed to instantiate DB")
 
-	// For each public key, we attempt to save an attestation with signing root.
 	var wg sync.WaitGroup
 	for i, pubKey := range pubKeys {
 		wg.Add(1)
-		go func(j types.Epoch, pk [48]byte, w *sync.WaitGroup) {
-			defer w.Done()
-			var signingRoot [32]byte
-			copy(signingRoot[:], fmt.Sprintf("%d", j))
-			att := createAttestation(j, j+1)
-			err := validatorDB.SaveAttestationForPubKey(ctx, pk, signingRoot, att)
+		go func(j types.Epoch, pk [48]byte) {
+			defer wg.Done()
+			err := validatorDB.SaveAttestationForPubKey(ctx, pk, [32]byte{1}, createAttestation(j, j+1))
 			require.NoError(t, err)
-		}(types.Epoch(i), pubKey, &wg)
+		}(types.Epoch(i), pubKey)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		require.NoError(t, validatorDB.SaveBlockProposal(ctx, pubKeys[0], [32]byte{1}, 1))
+	}()
+	for validatorDB.batchedAttestationsLen() < numValidators || validatorDB.batchedProposals.Len() < 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Closing the DB either persists every batched record or reports that it could not.
+	if err := validatorDB.Close(); err != nil {
+		require.ErrorContains(t, "before deadline", err)
+		return
 	}
 	wg.Wait()
 
-	// We verify that we reached a timer interval for force flushing records
-	// before we are required to force flush them to the DB.
-	require.LogsDoNotContain(t, hook, "Reached max capacity of batched attestation records")
-	require.LogsContain(t, hook, "Batched attestation records write interval reached")
-	require.LogsContain(t, hook, "Successfully flushed batched attestations to DB")
-	require.Equal(t, 0, validatorDB.batchedAttestations.Len())
+	reopenedDB, err := NewKVStore(ctx, dir, &Config{})
+	require.NoError(t, err, "Failed to instantiate DB")
+	t.Cleanup(func() {
+		require.NoError(t, reopenedDB.Close(), "Failed to close database")
+		require.NoError(t, reopenedDB.ClearDB(), "Failed to clear database")
+	})
+	for _, pubKey := range pubKeys {
+		history, err := reopenedDB.AttestationHistoryForPubKey(ctx, pubKey)
+		require.NoError(t, err)
+		require.Equal(t, 1, len(history))
+	}
+	_, exists, err := reopenedDB.ProposalHistoryForSlot(ctx, pubKeys[0], 1)
+	require.NoError(t, err)
+	assert.Equal(t, true, exists)
+}
 
-	// We then verify all the data we wanted to save is indeed saved to disk.
-	err := validatorDB.view(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket(pubKeysBucket)
-		for i, pubKey := range pubKeys {
-			var signingRoot [32]byte
-			copy(signingRoot[:], fmt.Sprintf("%d", i))
-			pkBucket := bucket.Bucket(pubKey[:])
-			signingRootsBucket := pkBucket.Bucket(attestationSigningRootsBucket)
-			sourceEpochsBucket := pkBucket.Bucket(attestationSourceEpochsBucket)
+func TestStore_FlushAttestationBatch_Deadline(t *testing.T) {
+	validatorDB := setupDB(t, nil)
+	// Holding the flush lock simulates a flush which does not complete in time.
+	validatorDB.attestationBatches[0].flushLock.Lock()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	err := validatorDB.FlushAttestationBatch(ctx)
+	require.ErrorContains(t, "could not flush batched attestation records before deadline", err)
+	validatorDB.attestationBatches[0].flushLock.Unlock()
+	require.NoError(t, validatorDB.FlushAttestationBatch(context.Background()))
+}
 
-			source := bytesutil.Uint64ToBytesBigEndian(uint64(i))
-			target := bytesutil.Uint64ToBytesBigEndian(uint64(i) + 1)
-			savedSigningRoot := signingRootsBucket.Get(target)
-			require.DeepEqual(t, signingRoot[:], savedSigningRoot)
-			savedTarget := sourceEpochsBucket.Get(source)
-			require.DeepEqual(t, signingRoot[:], savedSigningRoot)
-			require.DeepEqual(t, target, savedTarget)
+func TestStore_ForEachAttestation(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	validatorDB := setupDB(t, [][48]byte{pubKey})
+
+	// Records are saved out of order, including two sharing a target epoch.
+	atts := []*ethpb.IndexedAttestation{
+		createAttestation(3, 10),
+		createAttestation(1, 2),
+		createAttestation(5, 7),
+		createAttestation(2, 10),
+	}
+	signingRoots := [][32]byte{{10}, {2}, {7}, {10}}
+	require.NoError(t, validatorDB.SaveAttestationsForPubKey(ctx, pubKey, signingRoots, atts))
+
+	type visited struct {
+		source, target types.Epoch
+		signingRoot    [32]byte
+	}
+	got := make([]visited, 0)
+	require.NoError(t, validatorDB.ForEachAttestation(
+		ctx, pubKey, func(source, target types.Epoch, signingRoot [32]byte) error {
+			got = append(got, visited{source, target, signingRoot})
+			return nil
+		},
+	))
+	want := []visited{
+		{1, 2, [32]byte{2}},
+		{5, 7, [32]byte{7}},
+		{2, 10, [32]byte{10}},
+		{3, 10, [32]byte{10}},
+	}
+	require.DeepEqual(t, want, got)
+
+	// Iteration stops at the first error returned by the callback.
+	stopErr := errors.New("stop")
+	calls := 0
+	err := validatorDB.ForEachAttestation(ctx, pubKey, func(_, _ types.Epoch, _ [32]byte) error {
+		calls++
+		if calls == 2 {
+			return stopErr
 		}
 		return nil
 	})
+	assert.Equal(t, stopErr, err)
+	assert.Equal(t, 2, calls)
+
+	// A public key without history is never passed to the callback.
+	require.NoError(t, validatorDB.ForEachAttestation(ctx, [48]byte{2}, func(_, _ types.Epoch, _ [32]byte) error {
+		t.Error("callback should not be called")
+		return nil
+	}))
+}
+
+func TestStore_AttestedPublicKeys(t *testing.T) {
+	ctx := context.Background()
+	pubKeys := [][48]byte{{4}, {1}, {3}, {2}}
+	validatorDB := setupDB(t, pubKeys)
+
+	attested, err := validatorDB.AttestedPublicKeys(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(attested))
+
+	// Only public keys with saved attestations are returned, sorted
+	// regardless of the order in which they attested.
+	for _, pubKey := range pubKeys[:3] {
+		err := validatorDB.SaveAttestationForPubKey(ctx, pubKey, [32]byte{}, createAttestation(1, 2))
+		require.NoError(t, err)
+	}
+	attested, err = validatorDB.AttestedPublicKeys(ctx)
+	require.NoError(t, err)
+	assert.DeepEqual(t, [][48]byte{{1}, {3}, {4}}, attested)
+}
+
+func TestStore_AttestationRecordCount(t *testing.T) {
+	ctx := context.Background()
+	pubKeys := [][48]byte{{1}, {2}, {3}}
+	validatorDB := setupDB(t, pubKeys)
+
+	total, err := validatorDB.TotalAttestationRecordCount(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), total)
+
+	// Several targets sharing a source epoch are counted as separate records.
+	atts := []*ethpb.IndexedAttestation{
+		createAttestation(1, 2),
+		createAttestation(1, 3),
+		createAttestation(2, 4),
+	}
+	roots := [][32]byte{{1}, {2}, {3}}
+	require.NoError(t, validatorDB.SaveAttestationsForPubKey(ctx, pubKeys[0], roots, atts))
+	// Saving the same record again does not change the count.
+	require.NoError(t, validatorDB.SaveAttestationForPubKey(ctx, pubKeys[0], roots[0], atts[0]))
+	require.NoError(t, validatorDB.SaveAttestationForPubKey(ctx, pubKeys[1], [32]byte{4}, createAttestation(1, 2)))
+
+	count, err := validatorDB.AttestationRecordCount(ctx, pubKeys[0])
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), count)
+	count, err = validatorDB.AttestationRecordCount(ctx, pubKeys[1])
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), count)
+	count, err = validatorDB.AttestationRecordCount(ctx, pubKeys[2])
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), count)
+
+	total, err = validatorDB.TotalAttestationRecordCount(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), total)
+
+	// Records sharing a target epoch are counted separately as well.
+	require.NoError(t, validatorDB.saveAttestationRecords(ctx, []*AttestationRecord{
+		{PubKey: pubKeys[2], Source: 1, Target: 3, SigningRoot: [32]byte{5}},
+		{PubKey: pubKeys[2], Source: 2, Target: 3, SigningRoot: [32]byte{6}},
+	}))
+	history, err := validatorDB.AttestationHistoryForPubKey(ctx, pubKeys[2])
+	require.NoError(t, err)
+	count, err = validatorDB.AttestationRecordCount(ctx, pubKeys[2])
+	require.NoError(t, err)
+	assert.Equal(t, uint64(len(history)), count)
+	assert.Equal(t, uint64(2), count)
+}
+
+func TestStore_AllAttestationBoundaries(t *testing.T) {
+	for _, compactSequential := range []bool{false, true} {
+		t.Run(fmt.Sprintf("compact sequential attestations %v", compactSequential), func(t *testing.T) {
+			ctx := context.Background()
+			pubKeys := [][48]byte{{1}, {2}, {3}}
+			validatorDB := setupDBWithConfig(t, &Config{
+				PubKeys:                       pubKeys,
+				CompactSequentialAttestations: compactSequential,
+			})
+			require.NoError(t, validatorDB.saveAttestationRecords(ctx, []*AttestationRecord{
+				{PubKey: pubKeys[0], Source: 3, Target: 4},
+				{PubKey: pubKeys[0], Source: 4, Target: 5},
+				{PubKey: pubKeys[0], Source: 5, Target: 8},
+				{PubKey: pubKeys[1], Source: 2, Target: 6},
+				{PubKey: pubKeys[1], Source: 6, Target: 7},
+			}))
+
+			// Public keys without an attesting history are left out.
+			boundaries, err := validatorDB.AllAttestationBoundaries(ctx)
+			require.NoError(t, err)
+			require.DeepEqual(t, map[[48]byte]EpochBounds{
+				pubKeys[0]: {LowestSource: 3, HighestTarget: 8},
+				pubKeys[1]: {LowestSource: 2, HighestTarget: 7},
+			}, boundaries)
+		})
+	}
+}
+
+func TestStore_AllAttestationBoundaries_MinimalSlashingProtection(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	validatorDB := setupDBWithConfig(t, &Config{PubKeys: [][48]byte{pubKey}, MinimalSlashingProtection: true})
+	require.NoError(t, validatorDB.SaveAttestationForPubKey(ctx, pubKey, [32]byte{1}, createAttestation(3, 4)))
+	require.NoError(t, validatorDB.SaveAttestationForPubKey(ctx, pubKey, [32]byte{2}, createAttestation(4, 9)))
+
+	boundaries, err := validatorDB.AllAttestationBoundaries(ctx)
+	require.NoError(t, err)
+	require.DeepEqual(t, map[[48]byte]EpochBounds{pubKey: {LowestSource: 3, HighestTarget: 9}}, boundaries)
+}
+
+func TestStore_ClearAttestationHistoryForPubKeys(t *testing.T) {
+	ctx := context.Background()
+	pubKeys := [][48]byte{{1}, {2}, {3}}
+	validatorDB := setupDB(t, pubKeys)
+
+	for _, pubKey := range pubKeys[:2] {
+		err := validatorDB.SaveAttestationForPubKey(ctx, pubKey, [32]byte{1}, createAttestation(1, 2))
+		require.NoError(t, err)
+		require.NoError(t, validatorDB.SaveProposalHistoryForSlot(ctx, pubKey, 1, []byte{1}))
+	}
+
+	// Clearing the history of a public key without any history is a no-op.
+	require.NoError(t, validatorDB.ClearAttestationHistoryForPubKeys(ctx, [][48]byte{pubKeys[0], pubKeys[2]}))
+
+	history, err := validatorDB.AttestationHistoryForPubKey(ctx, pubKeys[0])
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(history))
+	_, exists, err := validatorDB.ProposalHistoryForSlot(ctx, pubKeys[0], 1)
+	require.NoError(t, err)
+	assert.Equal(t, false, exists)
+
+	// The history of other public keys is left untouched.
+	history, err = validatorDB.AttestationHistoryForPubKey(ctx, pubKeys[1])
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(history))
+	_, exists, err = validatorDB.ProposalHistoryForSlot(ctx, pubKeys[1], 1)
+	require.NoError(t, err)
+	assert.Equal(t, true, exists)
+
+	attested, err := validatorDB.AttestedPublicKeys(ctx)
+	require.NoError(t, err)
+	assert.DeepEqual(t, [][48]byte{pubKeys[1]}, attested)
+	proposed, err := validatorDB.ProposedPublicKeys(ctx)
+	require.NoError(t, err)
+	assert.DeepEqual(t, [][48]byte{pubKeys[1]}, proposed)
+	_, exists, err = validatorDB.LowestSignedSourceEpoch(ctx, pubKeys[0])
+	require.NoError(t, err)
+	assert.Equal(t, false, exists)
+	_, exists, err = validatorDB.HighestSignedTargetEpoch(ctx, pubKeys[0])
+	require.NoError(t, err)
+	assert.Equal(t, false, exists)
+	_, exists, err = validatorDB.FirstSignedTimestamp(ctx, pubKeys[0])
+	require.NoError(t, err)
+	assert.Equal(t, false, exists)
+}
+
+func TestStore_ClearAttestationHistoryForPubKeys_Pending(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	validatorDB := setupDBWithConfig(t, &Config{
+		PubKeys:                       [][48]byte{pubKey},
+		WarmSignedEpochsCache:         true,
+		AttestationBatchWriteInterval: time.Hour,
+	})
+	require.NoError(t, validatorDB.saveAttestationRecords(ctx, []*AttestationRecord{
+		{PubKey: pubKey, Source: 5, Target: 6, SigningRoot: [32]byte{1}},
+	}))
+	assert.Equal(t, true, validatorDB.signedEpochs.contains(pubKey))
+
+	// A record still batched when the history is cleared is cleared along with it.
+	saved := make(chan error, 1)
+	go func() {
+		saved <- validatorDB.SaveAttestationForPubKey(ctx, pubKey, [32]byte{2}, createAttestation(6, 7))
+	}()
+	batch := validatorDB.attestationBatchFor(pubKey)
+	for batch.records.Len() == 0 && len(batch.recordsChan) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	require.NoError(t, validatorDB.ClearAttestationHistoryForPubKeys(ctx, [][48]byte{pubKey}))
+	require.NoError(t, <-saved)
+	history, err := validatorDB.AttestationHistoryForPubKey(ctx, pubKey)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(history))
+	assert.Equal(t, false, validatorDB.signedEpochs.contains(pubKey))
+
+	// Attestations lower than the cleared history are no longer rejected.
+	kind, err := validatorDB.CheckSlashableAttestation(ctx, pubKey, [32]byte{3}, createAttestation(1, 2))
+	require.NoError(t, err)
+	assert.Equal(t, NotSlashable, kind)
+}
+
+func TestStore_VerifyAttestationBounds(t *testing.T) {
+	ctx := context.Background()
+	pubKeys := [][48]byte{{1}, {2}}
+	validatorDB := setupDB(t, pubKeys)
+
+	// A public key without any history is consistent.
+	require.NoError(t, validatorDB.VerifyAttestationBounds(ctx, pubKeys[1]))
+
+	atts := []*ethpb.IndexedAttestation{
+		createAttestation(2, 3),
+		createAttestation(3, 4),
+		createAttestation(3, 5),
+	}
+	err := validatorDB.SaveAttestationsForPubKey(ctx, pubKeys[0], make([][32]byte, len(atts)), atts)
+	require.NoError(t, err)
+	require.NoError(t, validatorDB.VerifyAttestationBounds(ctx, pubKeys[0]))
+
+	setBound := func(bucket []byte, epoch types.Epoch) {
+		err := validatorDB.update(func(tx *bolt.Tx) error {
+			return tx.Bucket(bucket).Put(pubKeys[0][:], bytesutil.EpochToBytesBigEndian(epoch))
+		})
+		require.NoError(t, err)
+	}
+
+	// A lowest signed source epoch higher than a stored source epoch is inconsistent.
+	setBound(lowestSignedSourceBucket, 3)
+	err = validatorDB.VerifyAttestationBounds(ctx, pubKeys[0])
+	require.ErrorContains(t, fmt.Sprintf(lowestSourceMessage, pubKeys[0], 3, 2), err)
+	setBound(lowestSignedSourceBucket, 2)
+
+	// A highest signed target epoch lower than a stored target epoch is inconsistent.
+	setBound(highestSignedTargetBucket, 4)
+	err = validatorDB.VerifyAttestationBounds(ctx, pubKeys[0])
+	require.ErrorContains(t, fmt.Sprintf(highestTargetMessage, pubKeys[0], 4, 5), err)
+	setBound(highestSignedTargetBucket, 5)
+	require.NoError(t, validatorDB.VerifyAttestationBounds(ctx, pubKeys[0]))
+
+	// A missing lowest signed source epoch is inconsistent with existing history.
+	err = validatorDB.update(func(tx *bolt.Tx) error {
+		return tx.Bucket(lowestSignedSourceBucket).Delete(pubKeys[0][:])
+	})
+	require.NoError(t, err)
+	err = validatorDB.VerifyAttestationBounds(ctx, pubKeys[0])
+	require.ErrorContains(t, fmt.Sprintf(missingBoundMessage, pubKeys[0], 2), err)
+}
+
+func TestNewKVStore_DefaultAttestationBatchSettings(t *testing.T) {
+	validatorDB := setupDB(t, nil)
+	assert.Equal(t, attestationBatchCapacity, validatorDB.attestationBatchCapacity)
+	assert.Equal(t, attestationBatchWriteInterval, validatorDB.attestationBatchWriteInterval)
+	require.Equal(t, 1, len(validatorDB.attestationBatches))
+	assert.Equal(t, attestationBatchCapacity, cap(validatorDB.attestationBatches[0].recordsChan))
+}
+
+func TestStore_CheckSurroundVotes_ContextCancelled(t *testing.T) {
+	pubKey := [48]byte{1}
+	validatorDB := setupDB(t, [][48]byte{pubKey})
+	numEpochs := types.Epoch(3 * surroundCheckCancellationInterval)
+	atts := make([]*ethpb.IndexedAttestation, 0, numEpochs)
+	signingRoots := make([][32]byte, 0, numEpochs)
+	for epoch := types.Epoch(1); epoch <= numEpochs; epoch++ {
+		atts = append(atts, createAttestation(epoch-1, epoch))
+		signingRoots = append(signingRoots, [32]byte{})
+	}
+	require.NoError(t, validatorDB.SaveAttestationsForPubKey(context.Background(), pubKey, signingRoots, atts))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// This vote is not slashable and is older than the whole history, so both scans
+	// would otherwise walk through every saved attestation.
+	oldestVote := createAttestation(0, 0)
+	err := validatorDB.view(func(tx *bolt.Tx) error {
+		pkBucket := tx.Bucket(pubKeysBucket).Bucket(pubKey[:])
+		slashingKind, err := validatorDB.checkSurroundingVote(
+			ctx, pkBucket.Bucket(attestationSourceEpochsBucket), oldestVote,
+		)
+		assert.ErrorContains(t, context.Canceled.Error(), err)
+		assert.Equal(t, NotSlashable, slashingKind)
+		slashingKind, err = validatorDB.checkSurroundedVote(
+			ctx, pkBucket.Bucket(attestationTargetEpochsBucket), oldestVote,
+		)
+		assert.ErrorContains(t, context.Canceled.Error(), err)
+		assert.Equal(t, NotSlashable, slashingKind)
+		return nil
+	})
+	require.NoError(t, err)
+
+	// With a live context, the scans complete.
+	nextVote := createAttestation(numEpochs, numEpochs+1)
+	slashingKind, err := validatorDB.CheckSlashableAttestation(context.Background(), pubKey, [32]byte{}, nextVote)
 	require.NoError(t, err)
+	assert.Equal(t, NotSlashable, slashingKind)
 }
 
 func BenchmarkStore_CheckSlashableAttestation_Surround_SafeAttestation_54kEpochs(b *testing.B) {
@@ -570,9 +2192,172 @@ func createAttestation(source, target types.Epoch) *ethpb.IndexedAttestation {
 
 func TestStore_flushAttestationRecords_InProgress(t *testing.T) {
 	s := &Store{}
-	s.batchedAttestationsFlushInProgress.Set()
+	batch := &attestationBatch{}
+	batch.flushInProgress.Set()
 
 	hook := logTest.NewGlobal()
-	s.flushAttestationRecords(context.Background(), nil)
+	s.flushAttestationRecords(context.Background(), batch, nil, flushReasonExplicit)
 	assert.LogsContain(t, hook, "Attempted to flush attestation records when already in progress")
 }
+
+func BenchmarkStore_FlushAttestationRecords_Sync(b *testing.B) {
+	benchFlushAttestationRecords(b, false /* noSync */)
+}
+
+func BenchmarkStore_FlushAttestationRecords_NoSync(b *testing.B) {
+	benchFlushAttestationRecords(b, true /* noSync */)
+}
+
+func benchFlushAttestationRecords(b *testing.B, noSync bool) {
+	ctx := context.Background()
+	numValidators := 16
+	pubKeys := make([][48]byte, numValidators)
+	for i := range pubKeys {
+		pubKeys[i] = [48]byte{byte(i)}
+	}
+	validatorDB, err := NewKVStore(ctx, b.TempDir(), &Config{
+		PubKeys: pubKeys,
+		NoSync:  noSync,
+	})
+	require.NoError(b, err, "Failed to instantiate DB")
+	defer func() {
+		require.NoError(b, validatorDB.Close(), "Failed to close database")
+		require.NoError(b, validatorDB.ClearDB(), "Failed to clear database")
+	}()
+
+	// Each iteration writes one batch of records, as a batch flush does, attesting
+	// to the next epoch for every validator.
+	records := make([]*AttestationRecord, numValidators)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j, pubKey := range pubKeys {
+			records[j] = &AttestationRecord{
+				PubKey:      pubKey,
+				Source:      types.Epoch(i),
+				Target:      types.Epoch(i + 1),
+				SigningRoot: [32]byte{byte(i)},
+			}
+		}
+		require.NoError(b, validatorDB.saveAttestationRecords(ctx, records))
+	}
+}
+
+func BenchmarkStore_SaveAttestationForPubKey_Concurrent_SingleBatch(b *testing.B) {
+	benchSaveAttestationsConcurrently(b, 1 /* numShards */)
+}
+
+func BenchmarkStore_SaveAttestationForPubKey_Concurrent_ShardedBatches(b *testing.B) {
+	benchSaveAttestationsConcurrently(b, 16 /* numShards */)
+}
+
+func benchSaveAttestationsConcurrently(b *testing.B, numShards int) {
+	ctx := context.Background()
+	numValidators := 1024
+	pubKeys := make([][48]byte, numValidators)
+	for i := range pubKeys {
+		pubKeys[i] = [48]byte{byte(i), byte(i >> 8)}
+	}
+	validatorDB, err := NewKVStore(ctx, b.TempDir(), &Config{
+		PubKeys:                pubKeys,
+		AttestationBatchShards: numShards,
+	})
+	require.NoError(b, err, "Failed to instantiate DB")
+	defer func() {
+		require.NoError(b, validatorDB.Close(), "Failed to close database")
+		require.NoError(b, validatorDB.ClearDB(), "Failed to clear database")
+	}()
+
+	// Each iteration saves an attestation for the next epoch for every validator at once.
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var wg sync.WaitGroup
+		for _, pubKey := range pubKeys {
+			wg.Add(1)
+			go func(pk [48]byte) {
+				defer wg.Done()
+				att := createAttestation(types.Epoch(i), types.Epoch(i+1))
+				require.NoError(b, validatorDB.SaveAttestationForPubKey(ctx, pk, [32]byte{byte(i)}, att))
+			}(pubKey)
+		}
+		wg.Wait()
+	}
+}
+
+func TestStore_AttestationBucketFillPercent(t *testing.T) {
+	pubKey := [48]byte{1}
+	numEpochs := types.Epoch(5000)
+	defaultDB, err := NewKVStore(context.Background(), t.TempDir(), &Config{PubKeys: [][48]byte{pubKey}, NoSync: true})
+	require.NoError(t, err, "Failed to instantiate DB")
+	assert.Equal(t, bolt.DefaultFillPercent, defaultDB.attestationFillPercent)
+	saveSequentialAttestingHistory(t, defaultDB, pubKey, numEpochs)
+	defaultSize, err := defaultDB.Size()
+	require.NoError(t, err)
+	defaultHistory, err := defaultDB.AttestationHistoryForPubKey(context.Background(), pubKey)
+	require.NoError(t, err)
+	require.NoError(t, defaultDB.Close(), "Failed to close database")
+
+	// Attesting history written in ascending order takes less space with full pages.
+	tunedDB := setupDBWithConfig(t, &Config{PubKeys: [][48]byte{pubKey}, NoSync: true, AttestationBucketFillPercent: 1.0})
+	saveSequentialAttestingHistory(t, tunedDB, pubKey, numEpochs)
+	tunedSize, err := tunedDB.Size()
+	require.NoError(t, err)
+	assert.Equal(t, true, tunedSize < defaultSize, "Expected size %d to be lower than %d", tunedSize, defaultSize)
+
+	// The fill percent does not change the records which are saved.
+	tunedHistory, err := tunedDB.AttestationHistoryForPubKey(context.Background(), pubKey)
+	require.NoError(t, err)
+	assert.DeepEqual(t, defaultHistory, tunedHistory)
+}
+
+func BenchmarkStore_AttestationBucketFillPercent_Default_54kEpochs(b *testing.B) {
+	benchAttestationBucketFillPercent(b, 0 /* default */)
+}
+
+func BenchmarkStore_AttestationBucketFillPercent_Full_54kEpochs(b *testing.B) {
+	benchAttestationBucketFillPercent(b, 1.0)
+}
+
+// Writes the attesting history of a validator since genesis up to and including the weak
+// subjectivity period epoch (54,000) with the given fill percent, and reports the size of
+// the resulting database.
+func benchAttestationBucketFillPercent(b *testing.B, fillPercent float64) {
+	pubKey := [48]byte{1}
+	var size int64
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		validatorDB, err := NewKVStore(context.Background(), b.TempDir(), &Config{
+			PubKeys:                      [][48]byte{pubKey},
+			NoSync:                       true,
+			AttestationBucketFillPercent: fillPercent,
+		})
+		require.NoError(b, err, "Failed to instantiate DB")
+		b.StartTimer()
+		saveSequentialAttestingHistory(b, validatorDB, pubKey, 54000)
+		b.StopTimer()
+		size, err = validatorDB.Size()
+		require.NoError(b, err)
+		require.NoError(b, validatorDB.Close(), "Failed to close database")
+		require.NoError(b, validatorDB.ClearDB(), "Failed to clear database")
+		b.StartTimer()
+	}
+	b.ReportMetric(float64(size), "db-bytes")
+}
+
+// Saves an attestation for every (source = epoch, target = epoch + 1) sequential pair
+// up to the given epoch, writing 32 records per transaction as a batch flush does.
+func saveSequentialAttestingHistory(tb testing.TB, validatorDB *Store, pubKey [48]byte, numEpochs types.Epoch) {
+	ctx := context.Background()
+	batchSize := types.Epoch(32)
+	for start := types.Epoch(1); start < numEpochs; start += batchSize {
+		records := make([]*AttestationRecord, 0, batchSize)
+		for epoch := start; epoch < start+batchSize && epoch < numEpochs; epoch++ {
+			records = append(records, &AttestationRecord{
+				PubKey:      pubKey,
+				Source:      epoch - 1,
+				Target:      epoch,
+				SigningRoot: [32]byte{byte(epoch)},
+			})
+		}
+		require.NoError(tb, validatorDB.saveAttestationRecords(ctx, records))
+	}
+}
@@ -0,0 +1,206 @@
+package kv
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prysmaticlabs/prysm/shared/abool"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// batchSaveAttempts is the number of times a batch of records is written to the DB
+	// before giving up, so that a transient failure does not fail the whole batch.
+	batchSaveAttempts = 3
+	// batchSaveBackoff is the delay before a batch is written again after a failed
+	// attempt, which doubles after every attempt.
+	batchSaveBackoff = 50 * time.Millisecond
+)
+
+// A wrapper over an error received from a background routine
+// saving batched records for slashing protection.
+type saveRecordsResponse struct {
+	err error
+}
+
+// recordAcks holds, for each batched record which a caller waits on, the channel which
+// receives the result of the flush writing that record to the DB. A flush only acknowledges
+// the records it wrote, so a caller is never notified by a flush which started before its
+// record was queued.
+type recordAcks struct {
+	lock  sync.Mutex
+	chans map[interface{}]chan saveRecordsResponse
+}
+
+func newRecordAcks() *recordAcks {
+	return &recordAcks{chans: make(map[interface{}]chan saveRecordsResponse)}
+}
+
+// register returns the channel receiving the result of the flush of a record, which must be
+// called before the record is queued. The channel is buffered so acknowledging never blocks.
+func (a *recordAcks) register(record interface{}) <-chan saveRecordsResponse {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	ch := make(chan saveRecordsResponse, 1)
+	a.chans[record] = ch
+	return ch
+}
+
+// cancel should be called once the caller no longer waits on the flush of a record.
+func (a *recordAcks) cancel(record interface{}) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	delete(a.chans, record)
+}
+
+// ack sends the result of a flush to the caller waiting on a record, if any. A record which
+// failed to be written is queued again, and its next flush has no one waiting on it.
+func (a *recordAcks) ack(record interface{}, err error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if ch, ok := a.chans[record]; ok {
+		ch <- saveRecordsResponse{err: err}
+		delete(a.chans, record)
+	}
+}
+
+// batchMetrics groups the metrics tracked for a type of batched records.
+type batchMetrics struct {
+	flushCount   *prometheus.CounterVec
+	flushSize    prometheus.Histogram
+	flushLatency prometheus.Histogram
+	queueLength  prometheus.Gauge
+}
+
+// recordBatch defines a type of slashing protection records, such as attestations
+// or block proposals, which are batched in memory before being flushed to the DB.
+type recordBatch struct {
+	recordType      string
+	capacity        int
+	numRecords      func() int
+	queueLength     func() int
+	flush           func(ctx context.Context, reason string)
+	flushInProgress *abool.AtomicBool
+	metrics         *batchMetrics
+}
+
+// recordQueued is called every time a record is added to the batch, and flushes
+// the batch to the DB once we have reached its max capacity.
+func (b *recordBatch) recordQueued(ctx context.Context) {
+	if numRecords := b.numRecords(); numRecords >= b.capacity {
+		log.WithField("numRecords", numRecords).Debugf(
+			"Reached max capacity of batched %s records, flushing to DB", b.recordType,
+		)
+		if b.flushInProgress.IsNotSet() {
+			b.metrics.flushCount.WithLabelValues(flushReasonCapacity).Inc()
+			b.flush(ctx, flushReasonCapacity)
+		}
+	}
+	b.metrics.queueLength.Set(float64(b.queueLength()))
+}
+
+// writeIntervalReached is called every time the batch write interval passes,
+// and flushes any batched records to the DB.
+func (b *recordBatch) writeIntervalReached(ctx context.Context) {
+	if numRecords := b.numRecords(); numRecords > 0 {
+		log.WithField("numRecords", numRecords).Debugf(
+			"Batched %s records write interval reached, flushing to DB", b.recordType,
+		)
+		if b.flushInProgress.IsNotSet() {
+			b.metrics.flushCount.WithLabelValues(flushReasonInterval).Inc()
+			b.flush(ctx, flushReasonInterval)
+		}
+	}
+	b.metrics.queueLength.Set(float64(b.queueLength()))
+}
+
+// flushBatchedRecords saves a list of batched records to the database using the
+// provided save function, which is expected to queue the records again if
+// saving them fails. This function acknowledges the result of the save operation
+// to the callers waiting on the flushed records, and returns that result. The flush
+// is logged with the number of records and distinct public keys, the reason for
+// the flush and its duration.
+func flushBatchedRecords(
+	recordType string,
+	reason string,
+	numRecords int,
+	numPubKeys int,
+	flushInProgress *abool.AtomicBool,
+	metrics *batchMetrics,
+	save func() error,
+	acknowledge func(err error),
+) error {
+	if flushInProgress.IsSet() {
+		// This should never happen. This method should not be called when a flush is already in
+		// progress. If you are seeing this log, check the atomic bool before calling this method.
+		log.Errorf("Attempted to flush %s records when already in progress", recordType)
+		return nil
+	}
+	flushInProgress.Set()
+	defer flushInProgress.UnSet()
+
+	start := time.Now()
+	err := save()
+	metrics.flushSize.Observe(float64(numRecords))
+	metrics.flushLatency.Observe(float64(time.Since(start).Milliseconds()))
+	entry := log.WithFields(logrus.Fields{
+		"numRecords":    numRecords,
+		"numPublicKeys": numPubKeys,
+		"reason":        reason,
+		"duration":      time.Since(start),
+	})
+	if err == nil {
+		entry.Debugf("Successfully flushed batched %ss to DB", recordType)
+	} else {
+		// This should never happen.
+		entry.WithError(err).Errorf("Failed to batch save %s records, retrying in queue", recordType)
+	}
+	// Forward the error, if any, to the callers waiting on the flushed records.
+	acknowledge(err)
+	return err
+}
+
+// flushBatchBeforeDeadline runs a flush of batched records, returning an error if the
+// context is done before the flush completes. The flush keeps running in the background
+// in that case, so the records may still be saved.
+func flushBatchBeforeDeadline(ctx context.Context, recordType string, flush func() error) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- flush()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return errors.Wrapf(ctx.Err(), "could not flush batched %s records before deadline", recordType)
+	}
+}
+
+// saveWithRetries calls save until it succeeds, up to batchSaveAttempts times, waiting with an
+// exponential backoff between attempts. Batched records are written in a single transaction,
+// which is rolled back if it fails, so a failed attempt can safely be retried. Once all
+// attempts failed, or if the context is done while waiting, the last error is returned.
+func saveWithRetries(ctx context.Context, recordType string, save func() error) error {
+	backoff := batchSaveBackoff
+	for attempt := 1; ; attempt++ {
+		err := save()
+		if err == nil {
+			return nil
+		}
+		if attempt == batchSaveAttempts {
+			return errors.Wrapf(err, "could not save batched %s records after %d attempts", recordType, attempt)
+		}
+		log.WithError(err).WithField("attempt", attempt).Debugf(
+			"Could not save batched %s records, retrying in %v", recordType, backoff,
+		)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return errors.Wrapf(err, "could not save batched %s records before context was done", recordType)
+		}
+		backoff *= 2
+	}
+}
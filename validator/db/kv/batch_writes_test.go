@@ -0,0 +1,186 @@
+package kv
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	types "github.com/prysmaticlabs/eth2-types"
+	"github.com/prysmaticlabs/prysm/shared/testutil/assert"
+	"github.com/prysmaticlabs/prysm/shared/testutil/require"
+	logTest "github.com/sirupsen/logrus/hooks/test"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestSaveWithRetries(t *testing.T) {
+	ctx := context.Background()
+	transientErr := errors.New("transient")
+
+	// Transient failures are retried until the save succeeds.
+	calls := 0
+	require.NoError(t, saveWithRetries(ctx, "attestation", func() error {
+		calls++
+		if calls < batchSaveAttempts {
+			return transientErr
+		}
+		return nil
+	}))
+	assert.Equal(t, batchSaveAttempts, calls)
+
+	// A clear error is returned once all attempts failed.
+	calls = 0
+	err := saveWithRetries(ctx, "attestation", func() error {
+		calls++
+		return transientErr
+	})
+	require.ErrorContains(t, "could not save batched attestation records after 3 attempts: transient", err)
+	assert.Equal(t, batchSaveAttempts, calls)
+
+	// No further attempt is made once the context is done.
+	cancelledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	calls = 0
+	err = saveWithRetries(cancelledCtx, "proposal", func() error {
+		calls++
+		return transientErr
+	})
+	require.ErrorContains(t, "could not save batched proposal records before context was done", err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestStore_SaveAttestationForPubKey_SlowTransaction(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	validatorDB := setupDBWithConfig(t, &Config{
+		PubKeys:                       [][48]byte{pubKey},
+		AttestationBatchWriteInterval: 10 * time.Millisecond,
+	})
+
+	// Hold the write lock of the database while the attestation is batched, so that
+	// the flush transaction has to wait for the slow transaction to complete.
+	txStarted := make(chan struct{})
+	slowTxDone := make(chan error, 1)
+	go func() {
+		slowTxDone <- validatorDB.db.Update(func(tx *bolt.Tx) error {
+			close(txStarted)
+			time.Sleep(200 * time.Millisecond)
+			return nil
+		})
+	}()
+	<-txStarted
+
+	require.NoError(t, validatorDB.SaveAttestationForPubKey(ctx, pubKey, [32]byte{1}, createAttestation(1, 2)))
+	require.NoError(t, <-slowTxDone)
+	signingRoot, exists, err := validatorDB.SigningRootAtTarget(ctx, pubKey, 2)
+	require.NoError(t, err)
+	require.Equal(t, true, exists)
+	assert.Equal(t, [32]byte{1}, signingRoot)
+}
+
+func TestRecordAcks(t *testing.T) {
+	acks := newRecordAcks()
+	first, second := &AttestationRecord{Target: 1}, &AttestationRecord{Target: 1}
+	firstAck := acks.register(first)
+	secondAck := acks.register(second)
+
+	// A flush only acknowledges the records it wrote, even if they are equal to others.
+	acks.ack(first, nil)
+	select {
+	case res := <-firstAck:
+		require.NoError(t, res.err)
+	default:
+		t.Fatal("Expected the flushed record to be acknowledged")
+	}
+	select {
+	case <-secondAck:
+		t.Fatal("Record was acknowledged by the flush of another record")
+	default:
+	}
+
+	// Records nobody waits on anymore are not acknowledged.
+	acks.cancel(second)
+	acks.ack(second, errors.New("failed"))
+	assert.Equal(t, 0, len(secondAck))
+}
+
+func TestStore_SaveAttestationForPubKey_StoredOnReturn(t *testing.T) {
+	ctx := context.Background()
+	numValidators := 32
+	pubKeys := make([][48]byte, numValidators)
+	for i := range pubKeys {
+		pubKeys[i] = [48]byte{byte(i)}
+	}
+	// Flushing after every record makes flushes overlap with records being queued.
+	validatorDB := setupDBWithConfig(t, &Config{
+		PubKeys:                       pubKeys,
+		AttestationBatchCapacity:      1,
+		AttestationBatchWriteInterval: time.Millisecond,
+	})
+	var wg sync.WaitGroup
+	for _, pubKey := range pubKeys {
+		wg.Add(1)
+		go func(pubKey [48]byte) {
+			defer wg.Done()
+			for target := types.Epoch(1); target <= 10; target++ {
+				record := &AttestationRecord{PubKey: pubKey, Source: target - 1, Target: target, SigningRoot: [32]byte{1}}
+				att := createAttestation(record.Source, record.Target)
+				require.NoError(t, validatorDB.SaveAttestationForPubKey(ctx, pubKey, record.SigningRoot, att))
+				require.NoError(t, validatorDB.view(func(tx *bolt.Tx) error {
+					assert.Equal(t, true, validatorDB.attestationSaved(tx, record), "Record not in the DB after save returned")
+					return nil
+				}))
+			}
+		}(pubKey)
+	}
+	wg.Wait()
+}
+
+func TestStore_SaveBlockProposal_StoredOnReturn(t *testing.T) {
+	ctx := context.Background()
+	numValidators := 32
+	pubKeys := make([][48]byte, numValidators)
+	for i := range pubKeys {
+		pubKeys[i] = [48]byte{byte(i)}
+	}
+	validatorDB := setupDBWithConfig(t, &Config{
+		PubKeys:                    pubKeys,
+		ProposalBatchCapacity:      1,
+		ProposalBatchWriteInterval: time.Millisecond,
+	})
+	var wg sync.WaitGroup
+	for _, pubKey := range pubKeys {
+		wg.Add(1)
+		go func(pubKey [48]byte) {
+			defer wg.Done()
+			for slot := types.Slot(1); slot <= 10; slot++ {
+				require.NoError(t, validatorDB.SaveBlockProposal(ctx, pubKey, [32]byte{1}, slot))
+				_, exists, err := validatorDB.ProposalHistoryForSlot(ctx, pubKey, slot)
+				require.NoError(t, err)
+				assert.Equal(t, true, exists, "Proposal not in the DB after save returned")
+			}
+		}(pubKey)
+	}
+	wg.Wait()
+}
+
+// Checks that the first log entry with the given message holds the structured fields
+// of a batch flush with the given reason.
+func assertFlushLogFields(t *testing.T, hook *logTest.Hook, msg, reason string) {
+	for _, entry := range hook.AllEntries() {
+		if entry.Message != msg {
+			continue
+		}
+		assert.Equal(t, reason, entry.Data["reason"])
+		numRecords, ok := entry.Data["numRecords"].(int)
+		require.Equal(t, true, ok, "Missing number of records")
+		numPubKeys, ok := entry.Data["numPublicKeys"].(int)
+		require.Equal(t, true, ok, "Missing number of public keys")
+		assert.Equal(t, true, numRecords > 0 && numPubKeys > 0 && numPubKeys <= numRecords)
+		_, ok = entry.Data["duration"].(time.Duration)
+		assert.Equal(t, true, ok, "Missing duration")
+		return
+	}
+	t.Fatalf("No log entry with message %q", msg)
+}
@@ -0,0 +1,150 @@
+package kv
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/prysmaticlabs/prysm/shared/params"
+	"github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+	"go.opencensus.io/trace"
+)
+
+const compactedDbFileSuffix = ".compact"
+
+// Compact rewrites the database into a new file, reclaiming the disk space left behind
+// by deleted keys, and then atomically replaces the current database file with it.
+// Batched slashing protection records are written first, and every read and write of the
+// store then waits until the compacted database is reopened, so that no write is lost.
+// Compaction is meant to be run while the validator client is not performing duties.
+func (s *Store) Compact(ctx context.Context) error {
+	ctx, span := trace.StartSpan(ctx, "ValidatorDB.Compact")
+	defer span.End()
+
+	if s.readOnly {
+		return ErrReadOnly
+	}
+	if err := s.FlushAttestationBatch(ctx); err != nil {
+		return errors.Wrap(err, "could not flush batched attestations before compacting")
+	}
+	if err := s.FlushProposalBatch(ctx); err != nil {
+		return errors.Wrap(err, "could not flush batched proposals before compacting")
+	}
+	// Records batched from now on are written once the lock is released.
+	s.dbLock.Lock()
+	defer s.dbLock.Unlock()
+
+	datafile := filepath.Join(s.databasePath, ProtectionDbFileName)
+	compactedFile := datafile + compactedDbFileSuffix
+	sizeBefore, err := fileSize(datafile)
+	if err != nil {
+		return err
+	}
+
+	// Remove any leftover file from a previously interrupted compaction.
+	if err := os.Remove(compactedFile); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	compactedDB, err := bolt.Open(
+		compactedFile,
+		params.BeaconIoConfig().ReadWritePermissions,
+		&bolt.Options{Timeout: params.BeaconIoConfig().BoltTimeout},
+	)
+	if err != nil {
+		return errors.Wrap(err, "could not create compacted database")
+	}
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		return copyBuckets(ctx, tx, compactedDB)
+	}); err != nil {
+		if closeErr := compactedDB.Close(); closeErr != nil {
+			log.WithError(closeErr).Error("Failed to close compacted database")
+		}
+		if removeErr := os.Remove(compactedFile); removeErr != nil {
+			log.WithError(removeErr).Error("Failed to remove compacted database")
+		}
+		return errors.Wrap(err, "could not copy database contents")
+	}
+	if err := compactedDB.Close(); err != nil {
+		return errors.Wrap(err, "could not close compacted database")
+	}
+
+	// Swap the compacted file in place of the current database file and reopen it.
+	noSync := s.db.NoSync
+	s.unregisterMetrics()
+	if err := s.db.Close(); err != nil {
+		return errors.Wrap(err, "could not close database")
+	}
+	// If the file cannot be replaced, we still reopen the uncompacted database.
+	renameErr := os.Rename(compactedFile, datafile)
+	boltDB, err := bolt.Open(datafile, params.BeaconIoConfig().ReadWritePermissions, &bolt.Options{
+		Timeout:         params.BeaconIoConfig().BoltTimeout,
+		InitialMmapSize: s.initialMMapSize,
+		NoSync:          noSync,
+	})
+	if err != nil {
+		return errors.Wrap(err, "could not reopen database")
+	}
+	s.db = boltDB
+	if renameErr != nil {
+		if err := s.registerMetrics(); err != nil {
+			log.WithError(err).Error("Failed to register database metrics")
+		}
+		return errors.Wrap(renameErr, "could not replace database file with compacted database")
+	}
+
+	sizeAfter, err := fileSize(datafile)
+	if err != nil {
+		return err
+	}
+	log.WithFields(logrus.Fields{
+		"sizeBefore": sizeBefore,
+		"sizeAfter":  sizeAfter,
+	}).Info("Compacted validator database")
+	return s.registerMetrics()
+}
+
+// Copies every bucket, including nested buckets, from a read transaction into the
+// destination database, using one write transaction per top level bucket.
+func copyBuckets(ctx context.Context, srcTx *bolt.Tx, dst *bolt.DB) error {
+	return srcTx.ForEach(func(name []byte, src *bolt.Bucket) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return dst.Update(func(dstTx *bolt.Tx) error {
+			b, err := dstTx.CreateBucket(name)
+			if err != nil {
+				return err
+			}
+			return copyBucket(src, b)
+		})
+	})
+}
+
+func copyBucket(src, dst *bolt.Bucket) error {
+	// Keys are inserted in order, so pages can be filled completely.
+	dst.FillPercent = 1.0
+	if err := dst.SetSequence(src.Sequence()); err != nil {
+		return err
+	}
+	return src.ForEach(func(k, v []byte) error {
+		// A nil value denotes a nested bucket.
+		if v == nil {
+			child, err := dst.CreateBucket(k)
+			if err != nil {
+				return err
+			}
+			return copyBucket(src.Bucket(k), child)
+		}
+		return dst.Put(k, v)
+	})
+}
+
+func fileSize(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
@@ -0,0 +1,121 @@
+package kv
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	types "github.com/prysmaticlabs/eth2-types"
+	ethpb "github.com/prysmaticlabs/prysm/proto/eth/v1alpha1"
+	"github.com/prysmaticlabs/prysm/shared/testutil/assert"
+	"github.com/prysmaticlabs/prysm/shared/testutil/require"
+	logTest "github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestStore_Compact(t *testing.T) {
+	hook := logTest.NewGlobal()
+	ctx := context.Background()
+	numValidators := 32
+	numEpochs := 128
+	pubKeys := make([][48]byte, numValidators)
+	for i := range pubKeys {
+		pubKeys[i] = [48]byte{byte(i)}
+	}
+	validatorDB := setupDB(t, pubKeys)
+	root := [32]byte{1}
+	require.NoError(t, validatorDB.SaveGenesisValidatorsRoot(ctx, root[:]))
+
+	for _, pubKey := range pubKeys {
+		atts := make([]*ethpb.IndexedAttestation, numEpochs)
+		signingRoots := make([][32]byte, numEpochs)
+		for i := 0; i < numEpochs; i++ {
+			atts[i] = createAttestation(types.Epoch(i), types.Epoch(i+1))
+			signingRoots[i] = [32]byte{byte(i)}
+		}
+		require.NoError(t, validatorDB.SaveAttestationsForPubKey(ctx, pubKey, signingRoots, atts))
+	}
+	// Deleting most of the history leaves free pages behind in the database file.
+	require.NoError(t, validatorDB.ClearAttestationHistoryForPubKeys(ctx, pubKeys[1:]))
+
+	datafile := filepath.Join(validatorDB.databasePath, ProtectionDbFileName)
+	before, err := os.Stat(datafile)
+	require.NoError(t, err)
+	require.NoError(t, validatorDB.Compact(ctx))
+	after, err := os.Stat(datafile)
+	require.NoError(t, err)
+	assert.Equal(t, true, after.Size() < before.Size())
+	require.LogsContain(t, hook, "Compacted validator database")
+	_, err = os.Stat(datafile + compactedDbFileSuffix)
+	assert.Equal(t, true, os.IsNotExist(err))
+
+	// The remaining data is preserved and the database is still writable.
+	genesisRoot, err := validatorDB.GenesisValidatorsRoot(ctx)
+	require.NoError(t, err)
+	require.DeepEqual(t, root[:], genesisRoot)
+	history, err := validatorDB.AttestationHistoryForPubKey(ctx, pubKeys[0])
+	require.NoError(t, err)
+	assert.Equal(t, numEpochs, len(history))
+	history, err = validatorDB.AttestationHistoryForPubKey(ctx, pubKeys[1])
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(history))
+	require.NoError(t, validatorDB.SaveAttestationForPubKey(ctx, pubKeys[1], [32]byte{1}, createAttestation(1, 2)))
+	history, err = validatorDB.AttestationHistoryForPubKey(ctx, pubKeys[1])
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(history))
+}
+
+func TestStore_Compact_PendingBatchedRecords(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	// A long write interval ensures the batched record is not flushed before compacting.
+	validatorDB := setupDBWithConfig(t, &Config{
+		PubKeys:                       [][48]byte{pubKey},
+		AttestationBatchWriteInterval: time.Hour,
+	})
+	validatorDB.attestationBatches[0].records.Append(&AttestationRecord{PubKey: pubKey, Source: 1, Target: 2})
+	require.NoError(t, validatorDB.Compact(ctx))
+	assert.Equal(t, 0, validatorDB.batchedAttestationsLen())
+	history, err := validatorDB.AttestationHistoryForPubKey(ctx, pubKey)
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(history))
+}
+
+func TestStore_Compact_ConcurrentWrites(t *testing.T) {
+	ctx := context.Background()
+	numValidators := 16
+	pubKeys := make([][48]byte, numValidators)
+	for i := range pubKeys {
+		pubKeys[i] = [48]byte{byte(i)}
+	}
+	validatorDB := setupDBWithConfig(t, &Config{
+		PubKeys:                       pubKeys,
+		InitialMMapSize:               1 << 20,
+		AttestationBatchWriteInterval: time.Millisecond,
+	})
+
+	// Attestations saved while the database is compacted are all kept.
+	numEpochs := types.Epoch(20)
+	var wg sync.WaitGroup
+	for _, pubKey := range pubKeys {
+		wg.Add(1)
+		go func(pubKey [48]byte) {
+			defer wg.Done()
+			for target := types.Epoch(1); target <= numEpochs; target++ {
+				err := validatorDB.SaveAttestationForPubKey(ctx, pubKey, [32]byte{1}, createAttestation(target-1, target))
+				assert.NoError(t, err)
+			}
+		}(pubKey)
+	}
+	for i := 0; i < 3; i++ {
+		require.NoError(t, validatorDB.Compact(ctx))
+	}
+	wg.Wait()
+	for _, pubKey := range pubKeys {
+		history, err := validatorDB.AttestationHistoryForPubKey(ctx, pubKey)
+		require.NoError(t, err)
+		assert.Equal(t, int(numEpochs), len(history))
+	}
+}
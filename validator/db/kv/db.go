@@ -3,15 +3,18 @@ package kv
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	types "github.com/prysmaticlabs/eth2-types"
 	prombolt "github.com/prysmaticlabs/prombbolt"
 	"github.com/prysmaticlabs/prysm/shared/abool"
-	"github.com/prysmaticlabs/prysm/shared/event"
+	"github.com/prysmaticlabs/prysm/shared/bytesutil"
 	"github.com/prysmaticlabs/prysm/shared/featureconfig"
 	"github.com/prysmaticlabs/prysm/shared/fileutil"
 	"github.com/prysmaticlabs/prysm/shared/params"
@@ -28,6 +31,15 @@ const (
 	// Time interval after which we flush attestation records to the database
 	// from a batch kept in memory for slashing protection.
 	attestationBatchWriteInterval = time.Millisecond * 100
+	// Number of block proposal records we can hold in memory before
+	// we flush them to the database. Proposals are far rarer than
+	// attestations, so a much smaller batch is sufficient.
+	proposalBatchCapacity = 64
+	// Time interval after which we flush block proposal records to the database
+	// from a batch kept in memory for slashing protection.
+	proposalBatchWriteInterval = time.Millisecond * 100
+	// Maximum time spent writing batched records to the database when closing it.
+	closeFlushTimeout = time.Second * 5
 )
 
 // ProtectionDbFileName Validator slashing protection db file name.
@@ -35,6 +47,9 @@ var (
 	ProtectionDbFileName = "validator.db"
 )
 
+// ErrReadOnly is returned when attempting to write to a database opened in read-only mode.
+var ErrReadOnly = errors.New("database opened read-only")
+
 // blockedBuckets represents the buckets that we want to restrict
 // from our metrics fetching for performance reasons. For a detailed
 // summary, it can be read in https://github.com/prysmaticlabs/prysm/issues/8274.
@@ -42,42 +57,313 @@ var blockedBuckets = [][]byte{
 	deprecatedAttestationHistoryBucket,
 	lowestSignedSourceBucket,
 	lowestSignedTargetBucket,
+	highestSignedTargetBucket,
 	lowestSignedProposalsBucket,
 	highestSignedProposalsBucket,
 	pubKeysBucket,
 	attestationSigningRootsBucket,
 	attestationSourceEpochsBucket,
 	attestationTargetEpochsBucket,
+	attestationSequentialRunsBucket,
+	compactAttestationSigningRootsBucket,
+	compactAttestationSourceEpochsBucket,
+	compactAttestationTargetEpochsBucket,
+	compactAttestationSequentialRunsBucket,
 }
 
 // Config represents store's config object.
 type Config struct {
-	PubKeys         [][48]byte
+	PubKeys [][48]byte
+	// InitialMMapSize is the initial size in bytes of the memory map of the database
+	// file. A value large enough to hold the database avoids remapping it as it grows,
+	// which blocks writes while the file is remapped.
 	InitialMMapSize int
+	// NoSync skips the fsync call after every write transaction, which improves write
+	// throughput on fast storage. It is not crash safe: after a power loss or operating
+	// system crash, the most recently written slashing protection records may be lost,
+	// so the validator could sign a slashable message once restarted. The database file
+	// may also be left corrupted. It defaults to false, keeping every write durable.
+	NoSync bool
+	// AttestationBatchCapacity is the number of attestation records held in memory
+	// before they are flushed to the database. Defaults to attestationBatchCapacity.
+	AttestationBatchCapacity int
+	// AttestationBatchWriteInterval is the time interval after which batched attestation
+	// records are flushed to the database. Defaults to attestationBatchWriteInterval.
+	AttestationBatchWriteInterval time.Duration
+	// AttestationBatchShards is the number of independent batches attestation records are
+	// queued in, each with its own lock and write interval timer. Public keys are spread
+	// across the shards by hash, so that validators in different shards do not contend on
+	// the same batch, which helps when running many keys. The batch capacity and write
+	// interval apply to each shard. Defaults to a single batch.
+	AttestationBatchShards int
+	// ProposalBatchCapacity is the number of block proposal records held in memory
+	// before they are flushed to the database. Defaults to proposalBatchCapacity.
+	ProposalBatchCapacity int
+	// ProposalBatchWriteInterval is the time interval after which batched block proposal
+	// records are flushed to the database. Defaults to proposalBatchWriteInterval.
+	ProposalBatchWriteInterval time.Duration
+	// MinimalSlashingProtection only keeps track of the lowest signed source epoch
+	// and the highest signed target epoch per validator instead of the full
+	// attesting history.
+	MinimalSlashingProtection bool
+	// CloseFlushTimeout is the maximum time spent writing batched records to the
+	// database when it is closed. Defaults to closeFlushTimeout.
+	CloseFlushTimeout time.Duration
+	// KeepAllSigningRoots stores every distinct signing root saved for an attestation
+	// target epoch rather than only the latest one, so that conflicting votes can be
+	// enumerated for forensic analysis. This increases the size of the database.
+	KeepAllSigningRoots bool
+	// RejectDecreasingTargets makes SaveAttestationForPubKey reject an attestation with a
+	// lower target epoch than the highest target epoch already signed by the validator,
+	// instead of only logging a warning. A correctly functioning validator never votes
+	// backwards, so such an attestation points to a clock or logic bug upstream.
+	RejectDecreasingTargets bool
+	// CompactEpochKeys stores the source and target epochs of the attesting history as
+	// 4 instead of 8 byte big-endian values, in separate buckets, which noticeably reduces
+	// the size of the database for large numbers of validators. Attestations with epochs
+	// above math.MaxUint32 cannot be saved. The option must be set consistently whenever
+	// the database is opened: a database holding attesting history in the other layout
+	// fails to open.
+	CompactEpochKeys bool
+	// AttestationBucketFillPercent is the fill percent of the source epochs and signing roots
+	// buckets of each public key when attestation records are written. Bolt splits a page once
+	// it is filled to that ratio. As attestation epochs are mostly written in ascending order,
+	// pages left half full are rarely filled up later, so a value of 1.0 reduces page splits and
+	// the size of the database. Out of order writes split full pages more often, though.
+	// Defaults to bolt.DefaultFillPercent, and values above 1.0 are treated as 1.0.
+	AttestationBucketFillPercent float64
+	// CompactSequentialAttestations stores runs of sequential attestations, whose target epoch is
+	// right after their source epoch as for a validator attesting every epoch, as a single entry
+	// holding the first source and last target epochs of the run, instead of one source and one
+	// target epoch entry per attestation. This shrinks the attesting history of such validators
+	// considerably. Signing roots are still stored per target epoch, and all readers of the
+	// attesting history handle both forms, so the option can be changed between openings.
+	CompactSequentialAttestations bool
+	// WarmSignedEpochsCache loads the highest source and target epochs signed by every public
+	// key into memory when the database is opened, and keeps them up to date as attestations
+	// are saved. CheckSlashableAttestation then allows attestations newer than the whole
+	// attesting history of a public key without reading the database, which avoids cold reads
+	// for the first attestations after a restart. Every other attestation is still checked
+	// against the database. It has no effect with minimal slashing protection or in read-only mode.
+	WarmSignedEpochsCache bool
+	// DetectSuspiciousFutureTargets makes CheckSlashableAttestation reject an attestation whose
+	// target epoch exceeds the highest target epoch signed by the validator by more than the
+	// weak subjectivity period, with a SuspiciousFutureTargetError. Such an attestation is not
+	// slashable, but a jump that large points to a clock or fork bug, so callers may choose to
+	// ignore the error. Public keys without attesting history are never flagged.
+	DetectSuspiciousFutureTargets bool
+	// SlashingDetectionHook, if set, is called every time CheckSlashableAttestation finds
+	// an attestation slashable, with the public key, the kind of slashing and the source
+	// and target epochs of the rejected attestation. It is called in its own goroutine
+	// once the check is done, so a slow hook never delays signing, but calls may arrive
+	// out of order.
+	SlashingDetectionHook func(pubKey [48]byte, kind SlashingKind, source, target types.Epoch)
+	// PruningInterval, if set along with HeadEpoch, starts a background routine which
+	// prunes the attestation and proposal history of every public key once per interval,
+	// so that long running databases stay bounded in size. The routine is stopped on Close.
+	PruningInterval time.Duration
+	// HeadEpoch returns the current head epoch, which proposals are pruned relative to
+	// by the background pruning routine.
+	HeadEpoch func() types.Epoch
+	// SkipIntegrityCheck opens the database without verifying that the attesting history
+	// of every public key is well-formed. It is only meant for recovery, such as exporting
+	// the slashing protection history of a corrupt database, as a corrupt history may let
+	// slashable attestations through.
+	SkipIntegrityCheck bool
+	// ReadOnly opens an existing database without write access, for example to
+	// export slashing protection data. No buckets are created, no migrations,
+	// pruning or integrity checks are run and records are not batched. Note that
+	// bolt still acquires a shared file lock, which waits for any process holding
+	// the database open for writing to release it.
+	ReadOnly bool
+	// MirrorPath, if set, is the directory of a second database file, ideally on a different
+	// disk, kept as a hot standby for a corrupt primary database. Every write is replayed on the
+	// mirror once it succeeds on the primary database, and both count their writes alike. When
+	// the database is opened, the mirror is kept as is if it counts as many writes as the primary
+	// database and passes the same checks. If it counts fewer, the mirror is replaced with a copy
+	// of the primary database, which has been checked by then. If it counts more, for example
+	// when the primary database was restored from an older backup, the mirror may hold records
+	// the primary database misses, so it is left untouched and not used.
+	// Writes only have to succeed on the primary database: if a mirror write fails, a warning is
+	// logged and the mirror is no longer used, as it may then miss records. A read failing
+	// because of the primary database itself, rather than the records read, is retried against
+	// the mirror. If the mirror cannot be opened, a warning is logged and the database is used
+	// without it. It is ignored in read-only mode, where the mirror cannot be brought up to date.
+	MirrorPath string
 }
 
 // Store defines an implementation of the Prysm Database interface
 // using BoltDB as the underlying persistent kv-store for eth2.
 type Store struct {
-	db                                 *bolt.DB
-	databasePath                       string
-	batchedAttestations                *QueuedAttestationRecords
-	batchedAttestationsChan            chan *AttestationRecord
-	batchAttestationsFlushedFeed       *event.Feed
-	batchedAttestationsFlushInProgress abool.AtomicBool
+	db                              *bolt.DB
+	dbLock                          sync.RWMutex
+	initialMMapSize                 int
+	mirror                          *bolt.DB
+	mirrorLock                      sync.Mutex
+	mirrorFailed                    abool.AtomicBool
+	metricsRegistered               bool
+	databasePath                    string
+	attestationBatches              []*attestationBatch
+	attestationBatchCapacity        int
+	attestationBatchWriteInterval   time.Duration
+	batchedProposals                *QueuedProposalRecords
+	batchedProposalsChan            chan *ProposalRecord
+	batchedProposalAcks             *recordAcks
+	batchedProposalsFlushInProgress abool.AtomicBool
+	proposalFlushLock               sync.Mutex
+	proposalBatchCapacity           int
+	proposalBatchWriteInterval      time.Duration
+	minimalSlashingProtection       bool
+	readOnly                        bool
+	keepAllSigningRoots             bool
+	rejectDecreasingTargets         bool
+	detectSuspiciousFutureTargets   bool
+	epochKeys                       epochKeyLayout
+	attestationFillPercent          float64
+	compactSequentialAttestations   bool
+	signedEpochs                    *signedEpochsCache
+	closeFlushTimeout               time.Duration
+	slashingDetectionHook           func(pubKey [48]byte, kind SlashingKind, source, target types.Epoch)
+	stopPruning                     chan struct{}
+	stopPruningOnce                 sync.Once
+	pruningDone                     chan struct{}
 }
 
-// Close closes the underlying boltdb database.
+// Close stops the background pruning routine, if any, flushes any batched slashing
+// protection records and closes the underlying boltdb database. If the records cannot be flushed before the close flush timeout,
+// the database is still closed and an error is returned, as the records may be lost.
 func (s *Store) Close() error {
-	prometheus.Unregister(createBoltCollector(s.db))
-	return s.db.Close()
+	s.stopPeriodicPruning()
+	var flushErr error
+	if !s.readOnly {
+		ctx, cancel := context.WithTimeout(context.Background(), s.closeFlushTimeout)
+		defer cancel()
+		if err := s.FlushAttestationBatch(ctx); err != nil {
+			flushErr = errors.Wrap(err, "could not flush batched attestations on close")
+		}
+		if err := s.FlushProposalBatch(ctx); err != nil && flushErr == nil {
+			flushErr = errors.Wrap(err, "could not flush batched proposals on close")
+		}
+	}
+	s.dbLock.Lock()
+	defer s.dbLock.Unlock()
+	s.unregisterMetrics()
+	if s.mirror != nil {
+		if err := s.mirror.Close(); err != nil {
+			log.WithError(err).Warn("Could not close mirror database")
+		}
+	}
+	if err := s.db.Close(); err != nil {
+		return err
+	}
+	return flushErr
 }
 
+// Writes to the database, then replays the same write on the mirror database, if any. Only the
+// write to the primary database has to succeed: if the mirror write fails, a warning is logged
+// and the mirror is no longer used. As the write function is run once per database, side effects
+// outside of its transaction, such as logs or caches, must be skipped for the mirror, as told by
+// isMirrorTx.
 func (s *Store) update(fn func(*bolt.Tx) error) error {
-	return s.db.Update(fn)
+	if s.readOnly {
+		return ErrReadOnly
+	}
+	// Compaction replaces the database, so it holds this lock exclusively while it runs.
+	s.dbLock.RLock()
+	defer s.dbLock.RUnlock()
+	var sequence uint64
+	countedFn := func(tx *bolt.Tx) error {
+		if err := fn(tx); err != nil {
+			return err
+		}
+		sequence, _ = writeSequence(tx)
+		sequence++
+		return putWriteSequence(tx, sequence)
+	}
+	if s.mirror == nil {
+		return s.db.Update(countedFn)
+	}
+	// Writes are replayed on the mirror in the order in which they were made on the primary database.
+	s.mirrorLock.Lock()
+	defer s.mirrorLock.Unlock()
+	if err := s.db.Update(countedFn); err != nil {
+		return err
+	}
+	if s.mirrorFailed.IsSet() {
+		return nil
+	}
+	// The mirror counts the write with the same sequence number as the primary database.
+	if err := s.mirror.Update(func(tx *bolt.Tx) error {
+		if err := fn(tx); err != nil {
+			return err
+		}
+		return putWriteSequence(tx, sequence)
+	}); err != nil {
+		s.mirrorFailed.Set()
+		log.WithError(err).Warn("Could not write to mirror database, it is no longer used")
+	}
+	return nil
+}
+
+// Returns the number of writes made to the database, and false if none was counted yet.
+func writeSequence(tx *bolt.Tx) (uint64, bool) {
+	bkt := tx.Bucket(migrationsBucket)
+	if bkt == nil {
+		return 0, false
+	}
+	enc := bkt.Get(writeSequenceKey)
+	if len(enc) != 8 {
+		return 0, false
+	}
+	return bytesutil.BytesToUint64BigEndian(enc), true
 }
+
+func putWriteSequence(tx *bolt.Tx, sequence uint64) error {
+	bkt, err := tx.CreateBucketIfNotExists(migrationsBucket)
+	if err != nil {
+		return err
+	}
+	return bkt.Put(writeSequenceKey, bytesutil.Uint64ToBytesBigEndian(sequence))
+}
+
+// Returns true if the transaction is a write replayed on the mirror database.
+func (s *Store) isMirrorTx(tx *bolt.Tx) bool {
+	return s.mirror != nil && tx.DB() == s.mirror
+}
+
+// Reads from the database, falling back to the mirror database, if any, when the read fails
+// because of the primary database itself, such as when it is closed or a corrupt page makes
+// bolt panic. Errors returned by the read function are returned as is, and a mirror which
+// missed a write is never read from.
 func (s *Store) view(fn func(*bolt.Tx) error) error {
-	return s.db.View(fn)
+	s.dbLock.RLock()
+	defer s.dbLock.RUnlock()
+	if s.mirror == nil || s.mirrorFailed.IsSet() {
+		return s.db.View(fn)
+	}
+	failed, err := viewRecovered(s.db, fn)
+	if !failed || s.mirrorFailed.IsSet() {
+		return err
+	}
+	log.WithError(err).Warn("Could not read from database, reading from mirror database instead")
+	_, err = viewRecovered(s.mirror, fn)
+	return err
+}
+
+// Runs a read transaction, recovering from any panic, and returns true along with the error
+// if the transaction failed for any other reason than an error returned by the read function.
+func viewRecovered(db *bolt.DB, fn func(*bolt.Tx) error) (failed bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			failed, err = true, fmt.Errorf("could not read from database %s: %v", db.Path(), r)
+		}
+	}()
+	var fnErr error
+	err = db.View(func(tx *bolt.Tx) error {
+		fnErr = fn(tx)
+		return fnErr
+	})
+	return err != nil && err != fnErr, err
 }
 
 // ClearDB removes any previously stored data at the configured data directory.
@@ -85,7 +371,7 @@ func (s *Store) ClearDB() error {
 	if _, err := os.Stat(s.databasePath); os.IsNotExist(err) {
 		return nil
 	}
-	prometheus.Unregister(createBoltCollector(s.db))
+	s.unregisterMetrics()
 	return os.Remove(filepath.Join(s.databasePath, ProtectionDbFileName))
 }
 
@@ -94,6 +380,140 @@ func (s *Store) DatabasePath() string {
 	return s.databasePath
 }
 
+// MinimalSlashingProtection returns true if the database only keeps track of the signed
+// epoch bounds of each validator instead of the full attesting history.
+func (s *Store) MinimalSlashingProtection() bool {
+	return s.minimalSlashingProtection
+}
+
+// Closes the database after it failed to be set up, so the file lock is released
+// and the database can be opened again with a different configuration.
+func closeOnError(db *bolt.DB, err error) error {
+	if closeErr := db.Close(); closeErr != nil {
+		log.WithError(closeErr).Error("Could not close database")
+	}
+	return err
+}
+
+func createTopLevelBuckets(tx *bolt.Tx) error {
+	return createBuckets(
+		tx,
+		genesisInfoBucket,
+		deprecatedAttestationHistoryBucket,
+		historicProposalsBucket,
+		lowestSignedSourceBucket,
+		lowestSignedTargetBucket,
+		highestSignedTargetBucket,
+		lowestSignedProposalsBucket,
+		highestSignedProposalsBucket,
+		slashablePublicKeysBucket,
+		pubKeysBucket,
+		migrationsBucket,
+		graffitiBucket,
+		syncCommitteeHistoryBucket,
+		firstSignedTimestampsBucket,
+	)
+}
+
+// Opens the mirror database in the given directory, once the database has been checked and
+// before it is written to. A mirror counting as many writes as the database is kept as is if it
+// passes the same checks. Otherwise, a mirror counting fewer writes is replaced with a copy of
+// the database. As the mirror is only a standby, nil is returned after logging a warning if it
+// cannot be opened, copied or checked, or if it counts more writes than the database.
+func (s *Store) openMirror(ctx context.Context, dirPath string, config *Config) *bolt.DB {
+	logMirrorError := func(err error) {
+		log.WithError(err).WithField("path", dirPath).Warn("Could not open mirror database, continuing without it")
+	}
+	hasDir, err := fileutil.HasDir(dirPath)
+	if err == nil && !hasDir {
+		err = fileutil.MkdirAll(dirPath)
+	}
+	if err != nil {
+		logMirrorError(err)
+		return nil
+	}
+	mirror, err := bolt.Open(filepath.Join(dirPath, ProtectionDbFileName), params.BeaconIoConfig().ReadWritePermissions, &bolt.Options{
+		Timeout:         params.BeaconIoConfig().BoltTimeout,
+		InitialMmapSize: config.InitialMMapSize,
+		NoSync:          config.NoSync,
+	})
+	if err != nil {
+		logMirrorError(err)
+		return nil
+	}
+	var sequence, mirrorSequence uint64
+	var mirrorCounted bool
+	err = s.db.View(func(tx *bolt.Tx) error {
+		sequence, _ = writeSequence(tx)
+		return mirror.View(func(mirrorTx *bolt.Tx) error {
+			mirrorSequence, mirrorCounted = writeSequence(mirrorTx)
+			return nil
+		})
+	})
+	if err == nil && mirrorSequence > sequence {
+		err = fmt.Errorf(
+			"mirror database counts %d writes, more than the %d of the database, and may hold records it misses",
+			mirrorSequence,
+			sequence,
+		)
+	}
+	if err == nil && (!mirrorCounted || mirrorSequence < sequence || s.checkMirror(mirror, config) != nil) {
+		log.WithField("path", dirPath).Info("Copying database to mirror database")
+		err = s.copyToMirror(ctx, mirror)
+		if err == nil {
+			err = s.checkMirror(mirror, config)
+		}
+	}
+	if err != nil {
+		logMirrorError(closeOnError(mirror, err))
+		return nil
+	}
+	return mirror
+}
+
+// Checks the mirror database like the database is checked when opened.
+func (s *Store) checkMirror(mirror *bolt.DB, config *Config) error {
+	if err := mirror.View(s.checkEpochKeyLayout); err != nil {
+		return err
+	}
+	if config.SkipIntegrityCheck {
+		return nil
+	}
+	return mirror.View(s.checkIntegrity)
+}
+
+// Replaces the contents of the mirror database with a copy of the database, which must not be
+// written to meanwhile. The copy is made in a single transaction, so that an interrupted copy
+// never leaves a mirror counting as many writes as the database without all of its records.
+func (s *Store) copyToMirror(ctx context.Context, mirror *bolt.DB) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		return mirror.Update(func(mirrorTx *bolt.Tx) error {
+			var names [][]byte
+			if err := mirrorTx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+				names = append(names, append([]byte{}, name...))
+				return nil
+			}); err != nil {
+				return err
+			}
+			for _, name := range names {
+				if err := mirrorTx.DeleteBucket(name); err != nil {
+					return err
+				}
+			}
+			return tx.ForEach(func(name []byte, src *bolt.Bucket) error {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				dst, err := mirrorTx.CreateBucket(name)
+				if err != nil {
+					return err
+				}
+				return copyBucket(src, dst)
+			})
+		})
+	})
+}
+
 func createBuckets(tx *bolt.Tx, buckets ...[]byte) error {
 	for _, bucket := range buckets {
 		if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
@@ -120,6 +540,8 @@ func NewKVStore(ctx context.Context, dirPath string, config *Config) (*Store, er
 	boltDB, err := bolt.Open(datafile, params.BeaconIoConfig().ReadWritePermissions, &bolt.Options{
 		Timeout:         params.BeaconIoConfig().BoltTimeout,
 		InitialMmapSize: config.InitialMMapSize,
+		NoSync:          config.NoSync,
+		ReadOnly:        config.ReadOnly,
 	})
 	if err != nil {
 		if errors.Is(err, bolt.ErrTimeout) {
@@ -128,30 +550,71 @@ func NewKVStore(ctx context.Context, dirPath string, config *Config) (*Store, er
 		return nil, err
 	}
 
+	batchCapacity := attestationBatchCapacity
+	if config.AttestationBatchCapacity > 0 {
+		batchCapacity = config.AttestationBatchCapacity
+	}
+	batchWriteInterval := attestationBatchWriteInterval
+	if config.AttestationBatchWriteInterval > 0 {
+		batchWriteInterval = config.AttestationBatchWriteInterval
+	}
+	batchShards := 1
+	if config.AttestationBatchShards > 0 {
+		batchShards = config.AttestationBatchShards
+	}
+	proposalCapacity := proposalBatchCapacity
+	if config.ProposalBatchCapacity > 0 {
+		proposalCapacity = config.ProposalBatchCapacity
+	}
+	proposalWriteInterval := proposalBatchWriteInterval
+	if config.ProposalBatchWriteInterval > 0 {
+		proposalWriteInterval = config.ProposalBatchWriteInterval
+	}
+	flushTimeout := closeFlushTimeout
+	if config.CloseFlushTimeout > 0 {
+		flushTimeout = config.CloseFlushTimeout
+	}
+	epochKeys := defaultEpochKeyLayout
+	if config.CompactEpochKeys {
+		epochKeys = compactEpochKeyLayout
+	}
+	attestationFillPercent := bolt.DefaultFillPercent
+	if config.AttestationBucketFillPercent > 0 {
+		attestationFillPercent = config.AttestationBucketFillPercent
+	}
+
 	kv := &Store{
-		db:                           boltDB,
-		databasePath:                 dirPath,
-		batchedAttestations:          NewQueuedAttestationRecords(),
-		batchedAttestationsChan:      make(chan *AttestationRecord, attestationBatchCapacity),
-		batchAttestationsFlushedFeed: new(event.Feed),
-	}
-
-	if err := kv.db.Update(func(tx *bolt.Tx) error {
-		return createBuckets(
-			tx,
-			genesisInfoBucket,
-			deprecatedAttestationHistoryBucket,
-			historicProposalsBucket,
-			lowestSignedSourceBucket,
-			lowestSignedTargetBucket,
-			lowestSignedProposalsBucket,
-			highestSignedProposalsBucket,
-			slashablePublicKeysBucket,
-			pubKeysBucket,
-			migrationsBucket,
-			graffitiBucket,
-		)
-	}); err != nil {
+		db:                            boltDB,
+		initialMMapSize:               config.InitialMMapSize,
+		databasePath:                  dirPath,
+		attestationBatches:            newAttestationBatches(batchShards, batchCapacity),
+		attestationBatchCapacity:      batchCapacity,
+		attestationBatchWriteInterval: batchWriteInterval,
+		batchedProposals:              NewQueuedProposalRecords(),
+		batchedProposalsChan:          make(chan *ProposalRecord, proposalCapacity),
+		batchedProposalAcks:           newRecordAcks(),
+		proposalBatchCapacity:         proposalCapacity,
+		proposalBatchWriteInterval:    proposalWriteInterval,
+		minimalSlashingProtection:     config.MinimalSlashingProtection,
+		readOnly:                      config.ReadOnly,
+		keepAllSigningRoots:           config.KeepAllSigningRoots,
+		rejectDecreasingTargets:       config.RejectDecreasingTargets,
+		detectSuspiciousFutureTargets: config.DetectSuspiciousFutureTargets,
+		epochKeys:                     epochKeys,
+		attestationFillPercent:        attestationFillPercent,
+		compactSequentialAttestations: config.CompactSequentialAttestations,
+		closeFlushTimeout:             flushTimeout,
+		slashingDetectionHook:         config.SlashingDetectionHook,
+	}
+
+	if kv.readOnly {
+		if err := kv.db.View(kv.checkEpochKeyLayout); err != nil {
+			return nil, closeOnError(boltDB, err)
+		}
+		return kv, kv.registerMetrics()
+	}
+
+	if err := kv.db.Update(createTopLevelBuckets); err != nil {
 		return nil, err
 	}
 
@@ -162,6 +625,35 @@ func NewKVStore(ctx context.Context, dirPath string, config *Config) (*Store, er
 		}
 	}
 
+	// Bring the bucket layout up to date before anything else reads or writes records.
+	if err := kv.RunMigrations(ctx); err != nil {
+		return nil, errors.Wrap(err, "could not run database schema migrations")
+	}
+
+	if err := kv.db.View(kv.checkEpochKeyLayout); err != nil {
+		return nil, closeOnError(boltDB, err)
+	}
+
+	// Refuse to sign with an attesting history which may be corrupt, for example after an unclean shutdown.
+	if !config.SkipIntegrityCheck {
+		if err := kv.db.View(kv.checkIntegrity); err != nil {
+			return nil, closeOnError(boltDB, err)
+		}
+	}
+
+	if config.WarmSignedEpochsCache && !kv.minimalSlashingProtection {
+		kv.signedEpochs = newSignedEpochsCache()
+		if err := kv.db.View(kv.warmSignedEpochsCache); err != nil {
+			return nil, closeOnError(boltDB, errors.Wrap(err, "could not warm up signed epochs cache"))
+		}
+	}
+
+	// The mirror is brought up to date with the database once it is known to be sound, and
+	// before the batching routines start writing to it.
+	if config.MirrorPath != "" {
+		kv.mirror = kv.openMirror(ctx, config.MirrorPath, config)
+	}
+
 	if featureconfig.Get().EnableSlashingProtectionPruning {
 		// Prune attesting records older than the current weak subjectivity period.
 		if err := kv.PruneAttestations(ctx); err != nil {
@@ -171,16 +663,47 @@ func NewKVStore(ctx context.Context, dirPath string, config *Config) (*Store, er
 
 	// Batch save attestation records for slashing protection at timed
 	// intervals to our database.
-	go kv.batchAttestationWrites(ctx)
+	for _, batch := range kv.attestationBatches {
+		go kv.batchAttestationWrites(ctx, batch)
+	}
+	// Batch save block proposal records for slashing protection at timed
+	// intervals to our database.
+	go kv.batchProposalWrites(ctx)
+	// Prune the slashing protection history at timed intervals, if configured.
+	if config.PruningInterval > 0 && config.HeadEpoch != nil {
+		kv.stopPruning = make(chan struct{})
+		kv.pruningDone = make(chan struct{})
+		go kv.pruneHistoryPeriodically(ctx, config.PruningInterval, config.HeadEpoch)
+	}
 
-	return kv, prometheus.Register(createBoltCollector(kv.db))
+	return kv, kv.registerMetrics()
 }
 
 // UpdatePublicKeysBuckets for a specified list of keys.
 func (s *Store) UpdatePublicKeysBuckets(pubKeys [][48]byte) error {
-	return s.update(func(tx *bolt.Tx) error {
+	if s.readOnly {
+		return ErrReadOnly
+	}
+	// Nothing is written if every bucket exists, so that opening the database does not count as
+	// a write which its mirror database misses.
+	var missing [][48]byte
+	if err := s.view(func(tx *bolt.Tx) error {
 		bucket := tx.Bucket(historicProposalsBucket)
 		for _, pubKey := range pubKeys {
+			if bucket.Bucket(pubKey[:]) == nil {
+				missing = append(missing, pubKey)
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return s.update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(historicProposalsBucket)
+		for _, pubKey := range missing {
 			if _, err := bucket.CreateBucketIfNotExists(pubKey[:]); err != nil {
 				return errors.Wrap(err, "failed to create proposal history bucket")
 			}
@@ -192,13 +715,49 @@ func (s *Store) UpdatePublicKeysBuckets(pubKeys [][48]byte) error {
 // Size returns the db size in bytes.
 func (s *Store) Size() (int64, error) {
 	var size int64
-	err := s.db.View(func(tx *bolt.Tx) error {
+	err := s.view(func(tx *bolt.Tx) error {
 		size = tx.Size()
 		return nil
 	})
 	return size, err
 }
 
+// DatabaseSizeBytes returns the size in bytes of the database file on disk. As bolt never
+// shrinks its file, it only goes down after the database is compacted. Bolt does not expose
+// the size of its memory map, which it grows ahead of the data, so Size, the size of the data
+// seen by a read transaction, is the closest measure of the database held in memory.
+func (s *Store) DatabaseSizeBytes() (int64, error) {
+	return fileSize(filepath.Join(s.databasePath, ProtectionDbFileName))
+}
+
+// Registers the prometheus collector of the database. A single bolt collector can be
+// registered at a time, so a store opened while another one exports its metrics, such as
+// the source database of a merge, is run without metrics instead of failing to open.
+func (s *Store) registerMetrics() error {
+	err := prometheus.Register(createBoltCollector(s.db))
+	var alreadyRegistered prometheus.AlreadyRegisteredError
+	if errors.As(err, &alreadyRegistered) {
+		log.WithField("path", s.databasePath).Info(
+			"Database metrics are already exported by another store, running without them",
+		)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	s.metricsRegistered = true
+	return nil
+}
+
+// Unregisters the prometheus collector of the database, if it was registered by this store.
+func (s *Store) unregisterMetrics() {
+	if !s.metricsRegistered {
+		return
+	}
+	prometheus.Unregister(createBoltCollector(s.db))
+	s.metricsRegistered = false
+}
+
 // createBoltCollector returns a prometheus collector specifically configured for boltdb.
 func createBoltCollector(db *bolt.DB) prometheus.Collector {
 	return prombolt.New("boltDB", db, blockedBuckets...)
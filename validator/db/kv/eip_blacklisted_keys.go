@@ -14,7 +14,7 @@ func (s *Store) EIPImportBlacklistedPublicKeys(ctx context.Context) ([][48]byte,
 	defer span.End()
 	var err error
 	publicKeys := make([][48]byte, 0)
-	err = s.db.View(func(tx *bolt.Tx) error {
+	err = s.view(func(tx *bolt.Tx) error {
 		bucket := tx.Bucket(slashablePublicKeysBucket)
 		return bucket.ForEach(func(key []byte, _ []byte) error {
 			if key != nil {
@@ -33,15 +33,20 @@ func (s *Store) EIPImportBlacklistedPublicKeys(ctx context.Context) ([][48]byte,
 func (s *Store) SaveEIPImportBlacklistedPublicKeys(ctx context.Context, publicKeys [][48]byte) error {
 	ctx, span := trace.StartSpan(ctx, "Validator.SaveEIPImportBlacklistedPublicKeys")
 	defer span.End()
-	return s.db.Update(func(tx *bolt.Tx) error {
-		bkt := tx.Bucket(slashablePublicKeysBucket)
-		for _, pubKey := range publicKeys {
-			// We write the public key to disk in the bucket. The value written for the key does not
-			// matter as we'll only be looking at the keys in the bucket when fetching from disk.
-			if err := bkt.Put(pubKey[:], []byte{1}); err != nil {
-				return err
-			}
-		}
-		return nil
+	return s.update(func(tx *bolt.Tx) error {
+		return saveBlacklistedPublicKeys(tx, publicKeys)
 	})
 }
+
+// Writes blacklisted public keys within a transaction.
+func saveBlacklistedPublicKeys(tx *bolt.Tx, publicKeys [][48]byte) error {
+	bkt := tx.Bucket(slashablePublicKeysBucket)
+	for _, pubKey := range publicKeys {
+		// We write the public key to disk in the bucket. The value written for the key does not
+		// matter as we'll only be looking at the keys in the bucket when fetching from disk.
+		if err := bkt.Put(pubKey[:], []byte{1}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
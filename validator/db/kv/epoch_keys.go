@@ -0,0 +1,155 @@
+package kv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	types "github.com/prysmaticlabs/eth2-types"
+	bolt "go.etcd.io/bbolt"
+)
+
+// epochKeyLayout describes how the attesting history of a validator public key is stored.
+// Source and target epochs are encoded big-endian with a fixed length, both as keys and in
+// the concatenated epoch lists stored as values, so that keys sort in the same order as the
+// epochs they encode. The surround vote checks and pruning rely on this ordering when
+// walking the buckets with a cursor. Each layout uses its own bucket names, so that records
+// stored with one epoch length are never decoded with the other.
+type epochKeyLayout struct {
+	size                 int
+	signingRootsBucket   []byte
+	sourceEpochsBucket   []byte
+	targetEpochsBucket   []byte
+	sequentialRunsBucket []byte
+}
+
+var (
+	// Epochs are stored as 8 bytes, the layout used by every database created so far.
+	defaultEpochKeyLayout = epochKeyLayout{
+		size:                 8,
+		signingRootsBucket:   attestationSigningRootsBucket,
+		sourceEpochsBucket:   attestationSourceEpochsBucket,
+		targetEpochsBucket:   attestationTargetEpochsBucket,
+		sequentialRunsBucket: attestationSequentialRunsBucket,
+	}
+	// Epochs are stored as 4 bytes, which halves the size of the epoch keys and lists at
+	// the cost of only supporting epochs up to math.MaxUint32.
+	compactEpochKeyLayout = epochKeyLayout{
+		size:                 4,
+		signingRootsBucket:   compactAttestationSigningRootsBucket,
+		sourceEpochsBucket:   compactAttestationSourceEpochsBucket,
+		targetEpochsBucket:   compactAttestationTargetEpochsBucket,
+		sequentialRunsBucket: compactAttestationSequentialRunsBucket,
+	}
+)
+
+// Returns whether the epoch can be encoded with the layout.
+func (l epochKeyLayout) fits(epoch types.Epoch) bool {
+	return l.size == 8 || uint64(epoch) <= math.MaxUint32
+}
+
+// Encodes an epoch, which must fit the layout.
+func (l epochKeyLayout) encode(epoch types.Epoch) []byte {
+	enc := make([]byte, l.size)
+	if l.size == 4 {
+		binary.BigEndian.PutUint32(enc, uint32(epoch))
+	} else {
+		binary.BigEndian.PutUint64(enc, uint64(epoch))
+	}
+	return enc
+}
+
+// Decodes an epoch, returning 0 if the input is too short as bytesutil.BytesToEpochBigEndian does.
+func (l epochKeyLayout) decode(enc []byte) types.Epoch {
+	if len(enc) < l.size {
+		return 0
+	}
+	if l.size == 4 {
+		return types.Epoch(binary.BigEndian.Uint32(enc))
+	}
+	return types.Epoch(binary.BigEndian.Uint64(enc))
+}
+
+// Decodes a list of concatenated epochs.
+func (l epochKeyLayout) decodeList(enc []byte) []types.Epoch {
+	epochs := make([]types.Epoch, 0, len(enc)/l.size)
+	for i := 0; i+l.size <= len(enc); i += l.size {
+		epochs = append(epochs, l.decode(enc[i:i+l.size]))
+	}
+	return epochs
+}
+
+// Checks whether a list of concatenated epochs contains the given encoded epoch.
+func (l epochKeyLayout) listContains(epochsList, epochBytes []byte) bool {
+	for i := 0; i+l.size <= len(epochsList); i += l.size {
+		if bytes.Equal(epochsList[i:i+l.size], epochBytes) {
+			return true
+		}
+	}
+	return false
+}
+
+// Gets the value stored under an epoch key. Nothing can be stored under an
+// epoch which does not fit the layout, so nil is returned for it.
+func (l epochKeyLayout) get(bkt *bolt.Bucket, epoch types.Epoch) []byte {
+	if bkt == nil || !l.fits(epoch) {
+		return nil
+	}
+	return bkt.Get(l.encode(epoch))
+}
+
+func (l epochKeyLayout) String() string {
+	if l.size == 4 {
+		return "compact"
+	}
+	return "default"
+}
+
+// Returns an error if an attestation record cannot be stored with the epoch key layout of the store.
+func (s *Store) checkEpochKeysFit(source, target types.Epoch) error {
+	if !s.epochKeys.fits(source) || !s.epochKeys.fits(target) {
+		return fmt.Errorf(
+			"attestation with source epoch %d and target epoch %d cannot be stored with %d byte epoch keys",
+			source,
+			target,
+			s.epochKeys.size,
+		)
+	}
+	return nil
+}
+
+// Verifies that no attesting history is stored in the buckets of another epoch key layout than
+// the one the store was opened with, as it would otherwise be silently ignored by slashing protection.
+func (s *Store) checkEpochKeyLayout(tx *bolt.Tx) error {
+	other := compactEpochKeyLayout
+	if s.epochKeys.size == compactEpochKeyLayout.size {
+		other = defaultEpochKeyLayout
+	}
+	bucket := tx.Bucket(pubKeysBucket)
+	if bucket == nil {
+		return nil
+	}
+	return bucket.ForEach(func(pubKey, _ []byte) error {
+		pkBucket := bucket.Bucket(pubKey)
+		if pkBucket == nil {
+			return nil
+		}
+		for _, name := range [][]byte{
+			other.signingRootsBucket, other.sourceEpochsBucket, other.targetEpochsBucket, other.sequentialRunsBucket,
+		} {
+			if b := pkBucket.Bucket(name); b != nil {
+				if k, _ := b.Cursor().First(); k != nil {
+					return fmt.Errorf(
+						"database holds attesting history for public key %#x with the %s epoch key layout, "+
+							"which cannot be read with the %s epoch key layout",
+						pubKey,
+						other,
+						s.epochKeys,
+					)
+				}
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,127 @@
+package kv
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"testing"
+
+	types "github.com/prysmaticlabs/eth2-types"
+	ethpb "github.com/prysmaticlabs/prysm/proto/eth/v1alpha1"
+	"github.com/prysmaticlabs/prysm/shared/testutil/assert"
+	"github.com/prysmaticlabs/prysm/shared/testutil/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestEpochKeyLayout_EncodingPreservesOrder(t *testing.T) {
+	epochs := []types.Epoch{0, 1, 255, 256, 65535, 65536, math.MaxUint32 - 1, math.MaxUint32}
+	for _, layout := range []epochKeyLayout{defaultEpochKeyLayout, compactEpochKeyLayout} {
+		for i, epoch := range epochs {
+			enc := layout.encode(epoch)
+			require.Equal(t, layout.size, len(enc))
+			assert.Equal(t, epoch, layout.decode(enc))
+			if i > 0 {
+				assert.Equal(t, -1, bytes.Compare(layout.encode(epochs[i-1]), enc), "Encoding of epoch %d is out of order", epoch)
+			}
+		}
+	}
+	assert.Equal(t, false, compactEpochKeyLayout.fits(math.MaxUint32+1))
+	assert.Equal(t, true, defaultEpochKeyLayout.fits(math.MaxUint32+1))
+}
+
+func TestStore_CompactEpochKeys_SaveAndRead(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	validatorDB := setupDBWithConfig(t, &Config{PubKeys: [][48]byte{pubKey}, CompactEpochKeys: true})
+	require.NoError(t, validatorDB.SaveAttestationForPubKey(ctx, pubKey, [32]byte{1}, createAttestation(1, 2)))
+	require.NoError(t, validatorDB.SaveAttestationForPubKey(ctx, pubKey, [32]byte{2}, createAttestation(2, 3)))
+
+	history, err := validatorDB.AttestationHistoryForPubKey(ctx, pubKey)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(history))
+	assert.Equal(t, types.Epoch(3), history[1].Target)
+	assert.Equal(t, [32]byte{2}, history[1].SigningRoot)
+
+	signingRoot, exists, err := validatorDB.SigningRootAtTarget(ctx, pubKey, 2)
+	require.NoError(t, err)
+	assert.Equal(t, true, exists)
+	assert.Equal(t, [32]byte{1}, signingRoot)
+	highestTarget, exists, err := validatorDB.HighestSignedTargetEpoch(ctx, pubKey)
+	require.NoError(t, err)
+	assert.Equal(t, true, exists)
+	assert.Equal(t, types.Epoch(3), highestTarget)
+
+	// Records are only stored in the compact buckets.
+	require.NoError(t, validatorDB.view(func(tx *bolt.Tx) error {
+		pkBucket := tx.Bucket(pubKeysBucket).Bucket(pubKey[:])
+		assert.Equal(t, true, pkBucket.Bucket(compactAttestationSigningRootsBucket) != nil)
+		assert.Equal(t, true, pkBucket.Bucket(attestationSigningRootsBucket) == nil)
+		return nil
+	}))
+
+	_, err = validatorDB.CheckSlashableAttestation(ctx, pubKey, [32]byte{3}, createAttestation(2, 3))
+	require.ErrorContains(t, "double vote found", err)
+}
+
+func TestStore_CompactEpochKeys_RejectsEpochsOutOfRange(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	validatorDB := setupDBWithConfig(t, &Config{PubKeys: [][48]byte{pubKey}, CompactEpochKeys: true})
+
+	att := createAttestation(1, math.MaxUint32+1)
+	err := validatorDB.SaveAttestationForPubKey(ctx, pubKey, [32]byte{1}, att)
+	require.ErrorContains(t, "cannot be stored with 4 byte epoch keys", err)
+	err = validatorDB.SaveAttestationsForPubKey(ctx, pubKey, [][32]byte{{1}}, []*ethpb.IndexedAttestation{att})
+	require.ErrorContains(t, "cannot be stored with 4 byte epoch keys", err)
+
+	// Nothing can be stored at such an epoch, so it is never a double vote.
+	slashingKind, err := validatorDB.CheckSlashableAttestation(ctx, pubKey, [32]byte{2}, att)
+	require.NoError(t, err)
+	assert.Equal(t, NotSlashable, slashingKind)
+}
+
+func TestNewKVStore_EpochKeyLayoutMismatch(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	for _, compactEpochKeys := range []bool{false, true} {
+		dir := t.TempDir()
+		db, err := NewKVStore(ctx, dir, &Config{PubKeys: [][48]byte{pubKey}, CompactEpochKeys: compactEpochKeys})
+		require.NoError(t, err, "Failed to instantiate DB")
+		require.NoError(t, db.SaveAttestationForPubKey(ctx, pubKey, [32]byte{1}, createAttestation(1, 2)))
+		require.NoError(t, db.Close(), "Failed to close database")
+
+		_, err = NewKVStore(ctx, dir, &Config{PubKeys: [][48]byte{pubKey}, CompactEpochKeys: !compactEpochKeys})
+		require.ErrorContains(t, "epoch key layout", err)
+		_, err = NewKVStore(ctx, dir, &Config{CompactEpochKeys: !compactEpochKeys, ReadOnly: true})
+		require.ErrorContains(t, "epoch key layout", err)
+
+		// The database can still be opened with the layout it was created with.
+		db, err = NewKVStore(ctx, dir, &Config{PubKeys: [][48]byte{pubKey}, CompactEpochKeys: compactEpochKeys})
+		require.NoError(t, err, "Failed to instantiate DB")
+		history, err := db.AttestationHistoryForPubKey(ctx, pubKey)
+		require.NoError(t, err)
+		assert.Equal(t, 1, len(history))
+		require.NoError(t, db.Close(), "Failed to close database")
+	}
+}
+
+func TestStore_CompactEpochKeys_Prune(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	validatorDB := setupDBWithConfig(t, &Config{PubKeys: [][48]byte{pubKey}, CompactEpochKeys: true})
+	atts := make([]*ethpb.IndexedAttestation, 0)
+	signingRoots := make([][32]byte, 0)
+	for epoch := types.Epoch(1); epoch <= 20; epoch++ {
+		atts = append(atts, createAttestation(epoch-1, epoch))
+		signingRoots = append(signingRoots, [32]byte{})
+	}
+	require.NoError(t, validatorDB.SaveAttestationsForPubKey(ctx, pubKey, signingRoots, atts))
+	require.NoError(t, validatorDB.PruneAttestationsWithPeriod(ctx, 10))
+
+	history, err := validatorDB.AttestationHistoryForPubKey(ctx, pubKey)
+	require.NoError(t, err)
+	for _, record := range history {
+		assert.Equal(t, true, record.Target >= 10, "Target epoch %d was not pruned", record.Target)
+	}
+	assert.Equal(t, 11, len(history))
+}
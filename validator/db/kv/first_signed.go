@@ -0,0 +1,63 @@
+package kv
+
+import (
+	"context"
+	"time"
+
+	"github.com/prysmaticlabs/prysm/shared/bytesutil"
+	bolt "go.etcd.io/bbolt"
+	"go.opencensus.io/trace"
+)
+
+// FirstSignedTimestamp returns the time at which the first attestation of a validator public
+// key was saved through SaveAttestationForPubKey in this database. The boolean is false for
+// keys which have not signed anything yet, and for keys whose history predates the recording
+// of these timestamps, such as keys which signed with an older version or were imported.
+func (s *Store) FirstSignedTimestamp(ctx context.Context, pubKey [48]byte) (time.Time, bool, error) {
+	ctx, span := trace.StartSpan(ctx, "Validator.FirstSignedTimestamp")
+	defer span.End()
+	var timestamp time.Time
+	var exists bool
+	err := s.view(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(firstSignedTimestampsBucket)
+		// The bucket does not exist in databases created by older versions and opened read-only.
+		if bucket == nil {
+			return nil
+		}
+		enc := bucket.Get(pubKey[:])
+		if len(enc) != 8 {
+			return nil
+		}
+		timestamp = time.Unix(0, int64(bytesutil.BytesToUint64BigEndian(enc)))
+		exists = true
+		return nil
+	})
+	return timestamp, exists, err
+}
+
+// Records the given time as the first signed timestamp of the public keys of attestation
+// records which have none stored yet.
+func saveFirstSignedTimestamps(tx *bolt.Tx, records []*AttestationRecord, timestamp time.Time) error {
+	timestamps := make(map[[48]byte]time.Time, len(records))
+	for _, record := range records {
+		timestamps[record.PubKey] = timestamp
+	}
+	return saveFirstSignedTimestampsByPubKey(tx, timestamps)
+}
+
+// Records the first signed timestamps of the public keys which have none stored yet.
+func saveFirstSignedTimestampsByPubKey(tx *bolt.Tx, timestamps map[[48]byte]time.Time) error {
+	bucket, err := tx.CreateBucketIfNotExists(firstSignedTimestampsBucket)
+	if err != nil {
+		return err
+	}
+	for pubKey, timestamp := range timestamps {
+		if len(bucket.Get(pubKey[:])) != 0 {
+			continue
+		}
+		if err := bucket.Put(pubKey[:], bytesutil.Uint64ToBytesBigEndian(uint64(timestamp.UnixNano()))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package kv
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prysmaticlabs/prysm/shared/testutil/assert"
+	"github.com/prysmaticlabs/prysm/shared/testutil/require"
+)
+
+func TestStore_FirstSignedTimestamp(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	validatorDB := setupDB(t, [][48]byte{pubKey})
+
+	// Keys which never signed have no timestamp.
+	_, exists, err := validatorDB.FirstSignedTimestamp(ctx, pubKey)
+	require.NoError(t, err)
+	assert.Equal(t, false, exists)
+
+	before := time.Now()
+	require.NoError(t, validatorDB.SaveAttestationForPubKey(ctx, pubKey, [32]byte{1}, createAttestation(1, 2)))
+	after := time.Now()
+	first, exists, err := validatorDB.FirstSignedTimestamp(ctx, pubKey)
+	require.NoError(t, err)
+	require.Equal(t, true, exists)
+	assert.Equal(t, false, first.Before(before) || first.After(after))
+
+	// Later attestations leave the timestamp of the first one.
+	require.NoError(t, validatorDB.SaveAttestationForPubKey(ctx, pubKey, [32]byte{2}, createAttestation(2, 3)))
+	timestamp, exists, err := validatorDB.FirstSignedTimestamp(ctx, pubKey)
+	require.NoError(t, err)
+	require.Equal(t, true, exists)
+	assert.Equal(t, true, first.Equal(timestamp))
+}
+
+func TestStore_FirstSignedTimestamp_NotRecordedForRejectedAttestation(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	validatorDB := setupDB(t, [][48]byte{pubKey})
+	err := validatorDB.SaveAttestationForPubKey(ctx, pubKey, [32]byte{1}, createAttestation(2, 1))
+	require.ErrorContains(t, "lower than its source epoch", err)
+	_, exists, err := validatorDB.FirstSignedTimestamp(ctx, pubKey)
+	require.NoError(t, err)
+	assert.Equal(t, false, exists)
+}
+
+func TestInMemoryStore_FirstSignedTimestamp(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	store := setupInMemoryDB(t, [][48]byte{pubKey})
+	_, exists, err := store.FirstSignedTimestamp(ctx, pubKey)
+	require.NoError(t, err)
+	assert.Equal(t, false, exists)
+
+	require.NoError(t, store.SaveAttestationForPubKey(ctx, pubKey, [32]byte{1}, createAttestation(1, 2)))
+	require.NoError(t, store.FlushAttestationBatch(ctx))
+	first, exists, err := store.FirstSignedTimestamp(ctx, pubKey)
+	require.NoError(t, err)
+	require.Equal(t, true, exists)
+	require.NoError(t, store.SaveAttestationForPubKey(ctx, pubKey, [32]byte{2}, createAttestation(2, 3)))
+	require.NoError(t, store.FlushAttestationBatch(ctx))
+	timestamp, _, err := store.FirstSignedTimestamp(ctx, pubKey)
+	require.NoError(t, err)
+	assert.Equal(t, true, first.Equal(timestamp))
+}
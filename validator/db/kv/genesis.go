@@ -1,19 +1,25 @@
 package kv
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 
 	bolt "go.etcd.io/bbolt"
 )
 
-// SaveGenesisValidatorsRoot saves the genesis validator root to db.
+// SaveGenesisValidatorsRoot saves the genesis validator root to db. Once saved, the
+// genesis validators root is immutable: saving the same root again is a no-op, while
+// saving a different root returns an error to prevent mixing data from different networks.
 func (s *Store) SaveGenesisValidatorsRoot(ctx context.Context, genValRoot []byte) error {
-	err := s.db.Update(func(tx *bolt.Tx) error {
+	err := s.update(func(tx *bolt.Tx) error {
 		bkt := tx.Bucket(genesisInfoBucket)
 		enc := bkt.Get(genesisValidatorsRootKey)
 		if len(enc) != 0 {
-			return fmt.Errorf("cannot overwite existing genesis validators root: %#x", enc)
+			if bytes.Equal(enc, genValRoot) {
+				return nil
+			}
+			return fmt.Errorf("cannot overwrite existing genesis validators root: %#x", enc)
 		}
 		return bkt.Put(genesisValidatorsRootKey, genValRoot)
 	})
@@ -23,7 +29,7 @@ func (s *Store) SaveGenesisValidatorsRoot(ctx context.Context, genValRoot []byte
 // GenesisValidatorsRoot retrieves the genesis validator root from db.
 func (s *Store) GenesisValidatorsRoot(ctx context.Context) ([]byte, error) {
 	var genValRoot []byte
-	err := s.db.View(func(tx *bolt.Tx) error {
+	err := s.view(func(tx *bolt.Tx) error {
 		bkt := tx.Bucket(genesisInfoBucket)
 		enc := bkt.Get(genesisValidatorsRootKey)
 		if len(enc) == 0 {
@@ -22,6 +22,11 @@ func TestStore_GenesisValidatorsRoot_ReadAndWrite(t *testing.T) {
 			want:  nil,
 			write: params.BeaconConfig().ZeroHash[:],
 		},
+		{
+			name:  "zero then same root accepted",
+			want:  params.BeaconConfig().ZeroHash[:],
+			write: params.BeaconConfig().ZeroHash[:],
+		},
 		{
 			name:    "zero then overwrite rejected",
 			want:    params.BeaconConfig().ZeroHash[:],
@@ -10,7 +10,7 @@ import (
 
 // SaveGraffitiOrderedIndex writes the current graffiti index to the db
 func (s *Store) SaveGraffitiOrderedIndex(ctx context.Context, index uint64) error {
-	return s.db.Update(func(tx *bolt.Tx) error {
+	return s.update(func(tx *bolt.Tx) error {
 		bkt := tx.Bucket(graffitiBucket)
 		indexBytes := bytesutil.Uint64ToBytesBigEndian(index)
 		return bkt.Put(graffitiOrderedIndexKey, indexBytes)
@@ -20,12 +20,14 @@ func (s *Store) SaveGraffitiOrderedIndex(ctx context.Context, index uint64) erro
 // GraffitiOrderedIndex fetches the ordered index, resetting if the file hash changed
 func (s *Store) GraffitiOrderedIndex(ctx context.Context, fileHash [32]byte) (uint64, error) {
 	orderedIndex := uint64(0)
-	err := s.db.Update(func(tx *bolt.Tx) error {
+	err := s.update(func(tx *bolt.Tx) error {
 		bkt := tx.Bucket(graffitiBucket)
 		dbFileHash := bkt.Get(graffitiFileHashKey)
 		if bytes.Equal(dbFileHash, fileHash[:]) {
-			indexBytes := bkt.Get(graffitiOrderedIndexKey)
-			orderedIndex = bytesutil.BytesToUint64BigEndian(indexBytes)
+			if !s.isMirrorTx(tx) {
+				indexBytes := bkt.Get(graffitiOrderedIndexKey)
+				orderedIndex = bytesutil.BytesToUint64BigEndian(indexBytes)
+			}
 		} else {
 			indexBytes := bytesutil.Uint64ToBytesBigEndian(0)
 			if err := bkt.Put(graffitiOrderedIndexKey, indexBytes); err != nil {
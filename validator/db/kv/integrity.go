@@ -0,0 +1,112 @@
+package kv
+
+import (
+	"github.com/pkg/errors"
+	types "github.com/prysmaticlabs/eth2-types"
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrIntegrityCheckFailed is returned when opening a database whose attesting history is corrupt.
+var ErrIntegrityCheckFailed = errors.New("slashing protection database failed its integrity check")
+
+// Verifies that the source epochs bucket of every public key is well-formed: each key is an
+// epoch of the size of the epoch key layout, each value a non-empty list of such epochs, and
+// the highest target epoch recorded for each source epoch never decreases as source epochs
+// increase. A decrease would mean that a surrounded vote is recorded, which slashing
+// protection never allows, so the bucket can no longer be trusted to reject slashable votes.
+// Sequential runs are verified to be well-formed as well.
+func (s *Store) checkIntegrity(tx *bolt.Tx) error {
+	bucket := tx.Bucket(pubKeysBucket)
+	if bucket == nil {
+		return nil
+	}
+	return bucket.ForEach(func(pubKey, _ []byte) error {
+		pkBucket := bucket.Bucket(pubKey)
+		if pkBucket == nil {
+			return nil
+		}
+		if err := s.checkSequentialRunsIntegrity(pubKey, pkBucket); err != nil {
+			return err
+		}
+		sourceEpochsBucket := pkBucket.Bucket(s.epochKeys.sourceEpochsBucket)
+		if sourceEpochsBucket == nil {
+			return nil
+		}
+		var previousSource, previousMaxTarget types.Epoch
+		first := true
+		// Source epochs are encoded big-endian, so the cursor walks them in ascending order.
+		c := sourceEpochsBucket.Cursor()
+		for sourceBytes, targetEpochsList := c.First(); sourceBytes != nil; sourceBytes, targetEpochsList = c.Next() {
+			if len(sourceBytes) != s.epochKeys.size {
+				return errors.Wrapf(
+					ErrIntegrityCheckFailed,
+					"source epoch key %#x of public key %#x is %d bytes long, wanted %d",
+					sourceBytes, pubKey, len(sourceBytes), s.epochKeys.size,
+				)
+			}
+			source := s.epochKeys.decode(sourceBytes)
+			if len(targetEpochsList) == 0 || len(targetEpochsList)%s.epochKeys.size != 0 {
+				return errors.Wrapf(
+					ErrIntegrityCheckFailed,
+					"target epochs of source epoch %d of public key %#x are %d bytes long, "+
+						"which is not a multiple of %d",
+					source, pubKey, len(targetEpochsList), s.epochKeys.size,
+				)
+			}
+			var maxTarget types.Epoch
+			for _, target := range s.epochKeys.decodeList(targetEpochsList) {
+				if target > maxTarget {
+					maxTarget = target
+				}
+			}
+			if !first && maxTarget < previousMaxTarget {
+				return errors.Wrapf(
+					ErrIntegrityCheckFailed,
+					"highest target epoch %d of source epoch %d of public key %#x is lower than "+
+						"highest target epoch %d of source epoch %d",
+					maxTarget, source, pubKey, previousMaxTarget, previousSource,
+				)
+			}
+			previousSource, previousMaxTarget, first = source, maxTarget, false
+		}
+		return nil
+	})
+}
+
+// Verifies that every sequential run of a public key has a start and end epoch of the size of
+// the epoch key layout, ends after it starts, and starts after the previous run ends.
+func (s *Store) checkSequentialRunsIntegrity(pubKey []byte, pkBucket *bolt.Bucket) error {
+	runsBucket := pkBucket.Bucket(s.epochKeys.sequentialRunsBucket)
+	if runsBucket == nil {
+		return nil
+	}
+	var previousEnd types.Epoch
+	first := true
+	c := runsBucket.Cursor()
+	for startBytes, endBytes := c.First(); startBytes != nil; startBytes, endBytes = c.Next() {
+		if len(startBytes) != s.epochKeys.size || len(endBytes) != s.epochKeys.size {
+			return errors.Wrapf(
+				ErrIntegrityCheckFailed,
+				"sequential run %#x of public key %#x has an end epoch %#x, wanted both %d bytes long",
+				startBytes, pubKey, endBytes, s.epochKeys.size,
+			)
+		}
+		start, end := s.epochKeys.decode(startBytes), s.epochKeys.decode(endBytes)
+		if end <= start {
+			return errors.Wrapf(
+				ErrIntegrityCheckFailed,
+				"sequential run of public key %#x starting at epoch %d ends at epoch %d",
+				pubKey, start, end,
+			)
+		}
+		if !first && start < previousEnd {
+			return errors.Wrapf(
+				ErrIntegrityCheckFailed,
+				"sequential run of public key %#x starting at epoch %d overlaps the previous run ending at epoch %d",
+				pubKey, start, previousEnd,
+			)
+		}
+		previousEnd, first = end, false
+	}
+	return nil
+}
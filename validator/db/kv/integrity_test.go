@@ -0,0 +1,88 @@
+package kv
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prysmaticlabs/prysm/shared/bytesutil"
+	"github.com/prysmaticlabs/prysm/shared/testutil/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestNewKVStore_IntegrityCheck(t *testing.T) {
+	pubKey := [48]byte{1}
+	epoch := func(e uint64) []byte {
+		return bytesutil.Uint64ToBytesBigEndian(e)
+	}
+	tests := []struct {
+		name    string
+		records map[string][]byte
+		wantErr string
+	}{
+		{
+			name: "valid history",
+			records: map[string][]byte{
+				string(epoch(1)): append(epoch(3), epoch(2)...),
+				string(epoch(4)): epoch(5),
+			},
+		},
+		{
+			name: "malformed source epoch key",
+			records: map[string][]byte{
+				string([]byte{1, 2, 3}): epoch(2),
+			},
+			wantErr: "source epoch key 0x010203 of public key",
+		},
+		{
+			name: "malformed target epochs",
+			records: map[string][]byte{
+				string(epoch(1)): {1, 2, 3},
+			},
+			wantErr: "target epochs of source epoch 1 of public key",
+		},
+		{
+			name: "decreasing highest target epoch",
+			records: map[string][]byte{
+				string(epoch(1)): epoch(5),
+				string(epoch(2)): epoch(3),
+			},
+			wantErr: "highest target epoch 3 of source epoch 2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			dir := t.TempDir()
+			validatorDB, err := NewKVStore(ctx, dir, &Config{PubKeys: [][48]byte{pubKey}})
+			require.NoError(t, err, "Failed to instantiate DB")
+			require.NoError(t, validatorDB.db.Update(func(tx *bolt.Tx) error {
+				pkBucket, err := tx.Bucket(pubKeysBucket).CreateBucketIfNotExists(pubKey[:])
+				if err != nil {
+					return err
+				}
+				sourceEpochsBucket, err := pkBucket.CreateBucketIfNotExists(attestationSourceEpochsBucket)
+				if err != nil {
+					return err
+				}
+				for source, targets := range tt.records {
+					if err := sourceEpochsBucket.Put([]byte(source), targets); err != nil {
+						return err
+					}
+				}
+				return nil
+			}))
+			require.NoError(t, validatorDB.Close(), "Failed to close database")
+
+			validatorDB, err = NewKVStore(ctx, dir, &Config{})
+			if tt.wantErr != "" {
+				require.ErrorContains(t, tt.wantErr, err)
+				require.ErrorContains(t, ErrIntegrityCheckFailed.Error(), err)
+
+				// The check can be skipped to recover the database.
+				validatorDB, err = NewKVStore(ctx, dir, &Config{SkipIntegrityCheck: true})
+			}
+			require.NoError(t, err)
+			require.NoError(t, validatorDB.Close(), "Failed to close database")
+		})
+	}
+}
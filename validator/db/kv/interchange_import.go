@@ -0,0 +1,124 @@
+package kv
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	types "github.com/prysmaticlabs/eth2-types"
+	bolt "go.etcd.io/bbolt"
+	"go.opencensus.io/trace"
+)
+
+// InterchangeData is the slashing protection history of an EIP-3076 interchange file,
+// already parsed into the records stored in the database. Parsing the JSON file itself is
+// left to the standard protection format package, which depends on this package.
+type InterchangeData struct {
+	// GenesisValidatorsRoot is empty if the data does not tell it, in which
+	// case the stored genesis validators root is left as is.
+	GenesisValidatorsRoot []byte
+	// Attestations may hold several records with distinct signing roots for the same
+	// source and target epochs, which are all kept by a database which keeps every
+	// signing root. Otherwise, only the first of them is imported.
+	Attestations map[[48]byte][]*AttestationRecord
+	Proposals    map[[48]byte][]Proposal
+	// FirstSignedTimestamps are saved for the public keys which have none stored yet.
+	FirstSignedTimestamps map[[48]byte]time.Time
+	// SlashablePublicKeys are keys left out of the import because their histories are
+	// slashable. They are saved as EIP-3076 import blacklisted public keys.
+	SlashablePublicKeys [][48]byte
+	// AllowGenesisRootMismatch keeps the stored genesis validators root, and imports the
+	// data anyway, when it differs from the one of the data.
+	AllowGenesisRootMismatch bool
+}
+
+// ImportInterchangeData writes the attestations, block proposals, first signed timestamps and
+// slashable public keys of EIP-3076 interchange data, or of a Prysm backup, into the database in
+// a single transaction, so that a failed import leaves the database unchanged. Unless data.AllowGenesisRootMismatch is set, the genesis
+// validators root of the data must match the stored one. It is saved if none is stored yet.
+// Importing the same data again leaves the database, including the signed epoch bounds of
+// every public key, unchanged.
+func (s *Store) ImportInterchangeData(ctx context.Context, data *InterchangeData) error {
+	ctx, span := trace.StartSpan(ctx, "Validator.ImportInterchangeData")
+	defer span.End()
+	if data == nil {
+		return errors.New("no interchange data to import")
+	}
+	for pubKey, records := range data.Attestations {
+		for _, record := range records {
+			if record.PubKey != pubKey {
+				return fmt.Errorf("attestation record public key %#x does not match %#x", record.PubKey, pubKey)
+			}
+			if record.Source > record.Target {
+				return fmt.Errorf(
+					"attestation for public key %#x has source epoch %d greater than its target epoch %d",
+					pubKey,
+					record.Source,
+					record.Target,
+				)
+			}
+		}
+	}
+	return s.update(func(tx *bolt.Tx) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// The stored genesis validators root, if any, is left as is when the data does not tell it.
+		if len(data.GenesisValidatorsRoot) != 0 {
+			bkt := tx.Bucket(genesisInfoBucket)
+			enc := bkt.Get(genesisValidatorsRootKey)
+			if len(enc) == 0 {
+				if err := bkt.Put(genesisValidatorsRootKey, data.GenesisValidatorsRoot); err != nil {
+					return errors.Wrap(err, "could not save genesis validators root")
+				}
+			} else if !bytes.Equal(enc, data.GenesisValidatorsRoot) && !data.AllowGenesisRootMismatch {
+				return fmt.Errorf(
+					"genesis validators root %#x of the interchange data does not match the stored root %#x",
+					data.GenesisValidatorsRoot,
+					enc,
+				)
+			}
+		}
+		if err := saveBlacklistedPublicKeys(tx, data.SlashablePublicKeys); err != nil {
+			return errors.Wrap(err, "could not save slashable public keys")
+		}
+		for pubKey, proposals := range data.Proposals {
+			for _, proposal := range proposals {
+				if err := saveProposalRecord(tx, pubKey, proposal.Slot, proposal.SigningRoot); err != nil {
+					return errors.Wrapf(err, "could not import block proposals for public key %#x", pubKey)
+				}
+			}
+		}
+		for pubKey, records := range data.Attestations {
+			if !s.keepAllSigningRoots {
+				records = firstRecordsByEpochs(records)
+			}
+			if err := s.putAttestationRecords(tx, records); err != nil {
+				return errors.Wrapf(err, "could not import attestations for public key %#x", pubKey)
+			}
+		}
+		if err := saveFirstSignedTimestampsByPubKey(tx, data.FirstSignedTimestamps); err != nil {
+			return errors.Wrap(err, "could not import first signed timestamps")
+		}
+		return nil
+	})
+}
+
+// Returns the records without those with the same source and target epochs as an earlier one,
+// so that a database which only keeps one signing root per target epoch keeps the first one, as
+// a database which keeps all of them reads it.
+func firstRecordsByEpochs(records []*AttestationRecord) []*AttestationRecord {
+	seen := make(map[[2]types.Epoch]bool, len(records))
+	firstRecords := make([]*AttestationRecord, 0, len(records))
+	for _, record := range records {
+		epochs := [2]types.Epoch{record.Source, record.Target}
+		if seen[epochs] {
+			continue
+		}
+		seen[epochs] = true
+		firstRecords = append(firstRecords, record)
+	}
+	return firstRecords
+}
@@ -0,0 +1,141 @@
+package kv
+
+import (
+	"context"
+	"testing"
+
+	types "github.com/prysmaticlabs/eth2-types"
+	"github.com/prysmaticlabs/prysm/shared/testutil/assert"
+	"github.com/prysmaticlabs/prysm/shared/testutil/require"
+)
+
+func TestStore_ImportInterchangeData(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	validatorDB := setupDB(t, [][48]byte{pubKey})
+	data := &InterchangeData{
+		GenesisValidatorsRoot: []byte{1},
+		Attestations: map[[48]byte][]*AttestationRecord{
+			pubKey: {
+				{PubKey: pubKey, Source: 1, Target: 2, SigningRoot: [32]byte{2}},
+				{PubKey: pubKey, Source: 2, Target: 4, SigningRoot: [32]byte{4}},
+			},
+		},
+		Proposals: map[[48]byte][]Proposal{
+			pubKey: {{Slot: 5, SigningRoot: []byte{5}}, {Slot: 9, SigningRoot: []byte{9}}},
+		},
+	}
+	require.NoError(t, validatorDB.ImportInterchangeData(ctx, data))
+	// Importing the same data again must leave the database unchanged.
+	require.NoError(t, validatorDB.ImportInterchangeData(ctx, data))
+
+	genesisValidatorsRoot, err := validatorDB.GenesisValidatorsRoot(ctx)
+	require.NoError(t, err)
+	assert.DeepEqual(t, data.GenesisValidatorsRoot, genesisValidatorsRoot)
+	count, err := validatorDB.AttestationRecordCount(ctx, pubKey)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), count)
+	lowestSource, exists, err := validatorDB.LowestSignedSourceEpoch(ctx, pubKey)
+	require.NoError(t, err)
+	require.Equal(t, true, exists)
+	assert.Equal(t, types.Epoch(1), lowestSource)
+	highestTarget, exists, err := validatorDB.HighestSignedTargetEpoch(ctx, pubKey)
+	require.NoError(t, err)
+	require.Equal(t, true, exists)
+	assert.Equal(t, types.Epoch(4), highestTarget)
+	proposals, err := validatorDB.ProposalHistoryForPubKey(ctx, pubKey)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(proposals))
+	lowestSlot, exists, err := validatorDB.LowestSignedProposal(ctx, pubKey)
+	require.NoError(t, err)
+	require.Equal(t, true, exists)
+	assert.Equal(t, types.Slot(5), lowestSlot)
+
+	slashingKind, err := validatorDB.CheckSlashableAttestation(ctx, pubKey, [32]byte{3}, createAttestation(2, 4))
+	require.NotNil(t, err)
+	assert.Equal(t, DoubleVote, slashingKind)
+}
+
+func TestStore_ImportInterchangeData_GenesisValidatorsRootMismatch(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	validatorDB := setupDB(t, [][48]byte{pubKey})
+	require.NoError(t, validatorDB.SaveGenesisValidatorsRoot(ctx, []byte{2}))
+	data := &InterchangeData{
+		GenesisValidatorsRoot: []byte{1},
+		Attestations: map[[48]byte][]*AttestationRecord{
+			pubKey: {{PubKey: pubKey, Source: 1, Target: 2}},
+		},
+		SlashablePublicKeys: [][48]byte{{2}},
+	}
+	err := validatorDB.ImportInterchangeData(ctx, data)
+	require.ErrorContains(t, "does not match the stored root", err)
+
+	// Nothing is written when the import is rejected.
+	count, err := validatorDB.AttestationRecordCount(ctx, pubKey)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), count)
+	blacklisted, err := validatorDB.EIPImportBlacklistedPublicKeys(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(blacklisted))
+}
+
+func TestStore_ImportInterchangeData_AllowGenesisRootMismatch(t *testing.T) {
+	ctx := context.Background()
+	pubKeys := [][48]byte{{1}, {2}}
+	validatorDB := setupDB(t, pubKeys)
+	require.NoError(t, validatorDB.SaveGenesisValidatorsRoot(ctx, []byte{2}))
+	data := &InterchangeData{
+		GenesisValidatorsRoot: []byte{1},
+		Attestations: map[[48]byte][]*AttestationRecord{
+			pubKeys[0]: {{PubKey: pubKeys[0], Source: 1, Target: 2}},
+		},
+		SlashablePublicKeys:      [][48]byte{pubKeys[1]},
+		AllowGenesisRootMismatch: true,
+	}
+	require.NoError(t, validatorDB.ImportInterchangeData(ctx, data))
+
+	// The stored genesis validators root is kept.
+	genesisValidatorsRoot, err := validatorDB.GenesisValidatorsRoot(ctx)
+	require.NoError(t, err)
+	assert.DeepEqual(t, []byte{2}, genesisValidatorsRoot)
+	count, err := validatorDB.AttestationRecordCount(ctx, pubKeys[0])
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), count)
+	blacklisted, err := validatorDB.EIPImportBlacklistedPublicKeys(ctx)
+	require.NoError(t, err)
+	assert.DeepEqual(t, [][48]byte{pubKeys[1]}, blacklisted)
+}
+
+func TestStore_ImportInterchangeData_InvalidRecords(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	validatorDB := setupDB(t, [][48]byte{pubKey})
+	tests := []struct {
+		name    string
+		records []*AttestationRecord
+		wantErr string
+	}{
+		{
+			name:    "source epoch greater than target epoch",
+			records: []*AttestationRecord{{PubKey: pubKey, Source: 3, Target: 2}},
+			wantErr: "attestation for public key 0x01",
+		},
+		{
+			name:    "record for another public key",
+			records: []*AttestationRecord{{PubKey: [48]byte{2}, Source: 1, Target: 2}},
+			wantErr: "does not match",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validatorDB.ImportInterchangeData(ctx, &InterchangeData{
+				Attestations: map[[48]byte][]*AttestationRecord{pubKey: tt.records},
+			})
+			require.ErrorContains(t, tt.wantErr, err)
+		})
+	}
+	genesisValidatorsRoot, err := validatorDB.GenesisValidatorsRoot(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(genesisValidatorsRoot))
+}
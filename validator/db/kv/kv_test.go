@@ -2,11 +2,17 @@ package kv
 
 import (
 	"context"
+	"errors"
 	"io/ioutil"
+	"path/filepath"
 	"testing"
 
+	"github.com/prysmaticlabs/prysm/shared/params"
+	"github.com/prysmaticlabs/prysm/shared/testutil/assert"
 	"github.com/prysmaticlabs/prysm/shared/testutil/require"
 	"github.com/sirupsen/logrus"
+	logTest "github.com/sirupsen/logrus/hooks/test"
+	bolt "go.etcd.io/bbolt"
 )
 
 func TestMain(m *testing.M) {
@@ -18,11 +24,17 @@ func TestMain(m *testing.M) {
 
 // setupDB instantiates and returns a DB instance for the validator client.
 func setupDB(t testing.TB, pubkeys [][48]byte) *Store {
-	db, err := NewKVStore(context.Background(), t.TempDir(), &Config{
+	return setupDBWithConfig(t, &Config{
 		PubKeys: pubkeys,
 	})
+}
+
+// setupDBWithConfig instantiates and returns a DB instance for the validator client
+// opened with the given config.
+func setupDBWithConfig(t testing.TB, config *Config) *Store {
+	db, err := NewKVStore(context.Background(), t.TempDir(), config)
 	require.NoError(t, err, "Failed to instantiate DB")
-	err = db.UpdatePublicKeysBuckets(pubkeys)
+	err = db.UpdatePublicKeysBuckets(config.PubKeys)
 	require.NoError(t, err, "Failed to create old buckets for public keys")
 	t.Cleanup(func() {
 		require.NoError(t, db.Close(), "Failed to close database")
@@ -30,3 +42,268 @@ func setupDB(t testing.TB, pubkeys [][48]byte) *Store {
 	})
 	return db
 }
+
+func TestNewKVStore_ReadOnly(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	pubKey := [48]byte{1}
+	db, err := NewKVStore(ctx, dir, &Config{PubKeys: [][48]byte{pubKey}})
+	require.NoError(t, err, "Failed to instantiate DB")
+	require.NoError(t, db.SaveAttestationForPubKey(ctx, pubKey, [32]byte{1}, createAttestation(1, 2)))
+	require.NoError(t, db.Close(), "Failed to close database")
+
+	readOnlyDB, err := NewKVStore(ctx, dir, &Config{ReadOnly: true})
+	require.NoError(t, err, "Failed to instantiate read-only DB")
+	t.Cleanup(func() {
+		require.NoError(t, readOnlyDB.Close(), "Failed to close database")
+	})
+
+	history, err := readOnlyDB.AttestationHistoryForPubKey(ctx, pubKey)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(history))
+
+	err = readOnlyDB.SaveAttestationForPubKey(ctx, pubKey, [32]byte{2}, createAttestation(2, 3))
+	require.ErrorContains(t, ErrReadOnly.Error(), err)
+	err = readOnlyDB.SaveBlockProposal(ctx, pubKey, [32]byte{1}, 1)
+	require.ErrorContains(t, ErrReadOnly.Error(), err)
+	err = readOnlyDB.SaveProposalHistoryForSlot(ctx, pubKey, 1, []byte{1})
+	require.ErrorContains(t, ErrReadOnly.Error(), err)
+}
+
+func TestStore_DatabaseSize(t *testing.T) {
+	pubKey := [48]byte{1}
+	validatorDB := setupDB(t, [][48]byte{pubKey})
+
+	sizeOnDisk, err := validatorDB.DatabaseSizeBytes()
+	require.NoError(t, err)
+	assert.Equal(t, true, sizeOnDisk > 0)
+	size, err := validatorDB.Size()
+	require.NoError(t, err)
+
+	// Both sizes grow along with the attesting history.
+	saveSequentialAttestingHistory(t, validatorDB, pubKey, 2000)
+	grownSizeOnDisk, err := validatorDB.DatabaseSizeBytes()
+	require.NoError(t, err)
+	grownSize, err := validatorDB.Size()
+	require.NoError(t, err)
+	assert.Equal(t, true, grownSizeOnDisk > sizeOnDisk)
+	assert.Equal(t, true, grownSize > size)
+}
+
+func TestStore_DatabaseSize_Closed(t *testing.T) {
+	validatorDB, err := NewKVStore(context.Background(), t.TempDir(), &Config{})
+	require.NoError(t, err)
+	require.NoError(t, validatorDB.Close())
+
+	// The file remains on disk once the database is closed.
+	sizeOnDisk, err := validatorDB.DatabaseSizeBytes()
+	require.NoError(t, err)
+	assert.Equal(t, true, sizeOnDisk > 0)
+}
+
+func TestNewKVStore_MirrorPath(t *testing.T) {
+	ctx := context.Background()
+	dir, mirrorDir := t.TempDir(), filepath.Join(t.TempDir(), "mirror")
+	pubKey := [48]byte{1}
+	db, err := NewKVStore(ctx, dir, &Config{PubKeys: [][48]byte{pubKey}})
+	require.NoError(t, err, "Failed to instantiate DB")
+	require.NoError(t, db.saveAttestationRecords(ctx, []*AttestationRecord{
+		{PubKey: pubKey, Source: 1, Target: 2, SigningRoot: [32]byte{2}},
+	}))
+	require.NoError(t, db.Close(), "Failed to close database")
+
+	// The history saved before the mirror was configured is copied to it when opened.
+	db, err = NewKVStore(ctx, dir, &Config{PubKeys: [][48]byte{pubKey}, MirrorPath: mirrorDir})
+	require.NoError(t, err, "Failed to instantiate DB")
+	require.NotNil(t, db.mirror)
+	require.NoError(t, db.SaveAttestationForPubKey(ctx, pubKey, [32]byte{3}, createAttestation(2, 3)))
+	require.NoError(t, db.SaveProposalHistoryForSlot(ctx, pubKey, 3, []byte{3}))
+	require.NoError(t, db.SaveGenesisValidatorsRoot(ctx, []byte{4}))
+	require.NoError(t, db.Close(), "Failed to close database")
+
+	// The mirror holds the same records, and can be opened as a database of its own.
+	mirrorDB, err := NewKVStore(ctx, mirrorDir, &Config{ReadOnly: true})
+	require.NoError(t, err, "Failed to instantiate mirror DB")
+	t.Cleanup(func() {
+		require.NoError(t, mirrorDB.Close(), "Failed to close database")
+	})
+	history, err := mirrorDB.AttestationHistoryForPubKey(ctx, pubKey)
+	require.NoError(t, err)
+	require.DeepEqual(t, []*AttestationRecord{
+		{Source: 1, Target: 2, SigningRoot: [32]byte{2}},
+		{Source: 2, Target: 3, SigningRoot: [32]byte{3}},
+	}, history)
+	_, exists, err := mirrorDB.FirstSignedTimestamp(ctx, pubKey)
+	require.NoError(t, err)
+	assert.Equal(t, true, exists)
+	signingRoot, exists, err := mirrorDB.ProposalHistoryForSlot(ctx, pubKey, 3)
+	require.NoError(t, err)
+	assert.Equal(t, true, exists)
+	assert.Equal(t, [32]byte{3}, signingRoot)
+	genesisValidatorsRoot, err := mirrorDB.GenesisValidatorsRoot(ctx)
+	require.NoError(t, err)
+	assert.DeepEqual(t, []byte{4}, genesisValidatorsRoot)
+}
+
+func TestNewKVStore_MirrorPath_KeepsUpToDateMirror(t *testing.T) {
+	ctx := context.Background()
+	dir, mirrorDir := t.TempDir(), t.TempDir()
+	pubKey := [48]byte{1}
+	config := &Config{PubKeys: [][48]byte{pubKey}, MirrorPath: mirrorDir}
+	db, err := NewKVStore(ctx, dir, config)
+	require.NoError(t, err, "Failed to instantiate DB")
+	require.NoError(t, db.SaveGenesisValidatorsRoot(ctx, []byte{1}))
+	require.NoError(t, db.Close(), "Failed to close database")
+	// Mark the mirror without counting a write, to tell whether it is copied again.
+	markMirror(t, mirrorDir)
+
+	db, err = NewKVStore(ctx, dir, config)
+	require.NoError(t, err, "Failed to instantiate DB")
+	t.Cleanup(func() {
+		require.NoError(t, db.Close(), "Failed to close database")
+	})
+	require.NotNil(t, db.mirror)
+	require.NoError(t, db.mirror.View(func(tx *bolt.Tx) error {
+		assert.DeepEqual(t, []byte{1}, tx.Bucket(genesisInfoBucket).Get(mirrorMarkKey))
+		return nil
+	}))
+	// Writes are still replayed on the kept mirror.
+	require.NoError(t, db.SaveGenesisValidatorsRoot(ctx, []byte{1}))
+	require.NoError(t, db.mirror.View(func(tx *bolt.Tx) error {
+		assert.DeepEqual(t, []byte{1}, tx.Bucket(genesisInfoBucket).Get(genesisValidatorsRootKey))
+		return nil
+	}))
+}
+
+func TestNewKVStore_MirrorPath_ReplacesStaleMirror(t *testing.T) {
+	ctx := context.Background()
+	dir, mirrorDir := t.TempDir(), t.TempDir()
+	pubKey := [48]byte{1}
+	db, err := NewKVStore(ctx, dir, &Config{PubKeys: [][48]byte{pubKey}, MirrorPath: mirrorDir})
+	require.NoError(t, err, "Failed to instantiate DB")
+	require.NoError(t, db.Close(), "Failed to close database")
+	markMirror(t, mirrorDir)
+	// The mirror misses the writes made while it is not configured.
+	db, err = NewKVStore(ctx, dir, &Config{PubKeys: [][48]byte{pubKey}})
+	require.NoError(t, err, "Failed to instantiate DB")
+	require.NoError(t, db.SaveGenesisValidatorsRoot(ctx, []byte{1}))
+	require.NoError(t, db.Close(), "Failed to close database")
+
+	db, err = NewKVStore(ctx, dir, &Config{PubKeys: [][48]byte{pubKey}, MirrorPath: mirrorDir})
+	require.NoError(t, err, "Failed to instantiate DB")
+	t.Cleanup(func() {
+		require.NoError(t, db.Close(), "Failed to close database")
+	})
+	require.NotNil(t, db.mirror)
+	require.NoError(t, db.mirror.View(func(tx *bolt.Tx) error {
+		assert.Equal(t, 0, len(tx.Bucket(genesisInfoBucket).Get(mirrorMarkKey)))
+		assert.DeepEqual(t, []byte{1}, tx.Bucket(genesisInfoBucket).Get(genesisValidatorsRootKey))
+		return nil
+	}))
+}
+
+func TestNewKVStore_MirrorPath_MirrorAhead(t *testing.T) {
+	hook := logTest.NewGlobal()
+	ctx := context.Background()
+	mirrorDir := t.TempDir()
+	pubKey := [48]byte{1}
+	// The mirror counts more writes than the new database, which it must not be replaced with.
+	ahead, err := NewKVStore(ctx, mirrorDir, &Config{PubKeys: [][48]byte{pubKey}})
+	require.NoError(t, err, "Failed to instantiate DB")
+	require.NoError(t, ahead.SaveGenesisValidatorsRoot(ctx, []byte{1}))
+	require.NoError(t, ahead.Close(), "Failed to close database")
+
+	db := setupDBWithConfig(t, &Config{PubKeys: [][48]byte{pubKey}, MirrorPath: mirrorDir})
+	assert.Equal(t, true, db.mirror == nil)
+	require.LogsContain(t, hook, "may hold records it misses")
+	require.NoError(t, db.SaveGenesisValidatorsRoot(ctx, []byte{2}))
+
+	mirrorDB, err := NewKVStore(ctx, mirrorDir, &Config{ReadOnly: true})
+	require.NoError(t, err, "Failed to instantiate mirror DB")
+	t.Cleanup(func() {
+		require.NoError(t, mirrorDB.Close(), "Failed to close database")
+	})
+	genesisValidatorsRoot, err := mirrorDB.GenesisValidatorsRoot(ctx)
+	require.NoError(t, err)
+	assert.DeepEqual(t, []byte{1}, genesisValidatorsRoot)
+}
+
+var mirrorMarkKey = []byte("mirror-mark")
+
+// Writes a key into the closed mirror database in the given directory, without counting it as a write.
+func markMirror(t *testing.T, mirrorDir string) {
+	mirror, err := bolt.Open(filepath.Join(mirrorDir, ProtectionDbFileName), params.BeaconIoConfig().ReadWritePermissions, nil)
+	require.NoError(t, err)
+	require.NoError(t, mirror.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(genesisInfoBucket).Put(mirrorMarkKey, []byte{1})
+	}))
+	require.NoError(t, mirror.Close())
+}
+
+func TestStore_MirrorWriteFailure(t *testing.T) {
+	hook := logTest.NewGlobal()
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	db := setupDBWithConfig(t, &Config{PubKeys: [][48]byte{pubKey}, MirrorPath: t.TempDir()})
+	require.NoError(t, db.mirror.Close())
+
+	// Writes still succeed as long as they succeed on the primary database.
+	require.NoError(t, db.saveAttestationRecords(ctx, []*AttestationRecord{
+		{PubKey: pubKey, Source: 1, Target: 2, SigningRoot: [32]byte{2}},
+	}))
+	require.LogsContain(t, hook, "Could not write to mirror database, it is no longer used")
+	history, err := db.AttestationHistoryForPubKey(ctx, pubKey)
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(history))
+
+	// A mirror which missed a write is never read from.
+	require.NoError(t, db.db.Close())
+	_, err = db.AttestationHistoryForPubKey(ctx, pubKey)
+	require.ErrorContains(t, bolt.ErrDatabaseNotOpen.Error(), err)
+	require.LogsDoNotContain(t, hook, "reading from mirror database instead")
+}
+
+func TestStore_ViewFallsBackToMirror(t *testing.T) {
+	hook := logTest.NewGlobal()
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	db := setupDBWithConfig(t, &Config{PubKeys: [][48]byte{pubKey}, MirrorPath: t.TempDir()})
+	require.NoError(t, db.saveAttestationRecords(ctx, []*AttestationRecord{
+		{PubKey: pubKey, Source: 1, Target: 2, SigningRoot: [32]byte{2}},
+	}))
+
+	// Errors returned by the read itself are not retried against the mirror.
+	reads := 0
+	err := db.view(func(tx *bolt.Tx) error {
+		reads++
+		return errors.New("read failed")
+	})
+	require.ErrorContains(t, "read failed", err)
+	assert.Equal(t, 1, reads)
+	require.LogsDoNotContain(t, hook, "reading from mirror database instead")
+
+	// Reads fall back to the mirror once the primary database fails.
+	require.NoError(t, db.db.Close())
+	history, err := db.AttestationHistoryForPubKey(ctx, pubKey)
+	require.NoError(t, err)
+	require.DeepEqual(t, []*AttestationRecord{
+		{Source: 1, Target: 2, SigningRoot: [32]byte{2}},
+	}, history)
+	require.LogsContain(t, hook, "reading from mirror database instead")
+	kind, err := db.CheckSlashableAttestation(ctx, pubKey, [32]byte{3}, createAttestation(1, 2))
+	assert.NotNil(t, err)
+	assert.Equal(t, DoubleVote, kind)
+}
+
+func TestNewKVStore_MirrorPathUnavailable(t *testing.T) {
+	hook := logTest.NewGlobal()
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	// The mirror directory cannot be created below a file, so the database is opened without it.
+	file := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, ioutil.WriteFile(file, []byte{}, 0600))
+	db := setupDBWithConfig(t, &Config{PubKeys: [][48]byte{pubKey}, MirrorPath: filepath.Join(file, "mirror")})
+	assert.Equal(t, true, db.mirror == nil)
+	require.LogsContain(t, hook, "Could not open mirror database")
+	require.NoError(t, db.SaveAttestationForPubKey(ctx, pubKey, [32]byte{1}, createAttestation(1, 2)))
+}
@@ -0,0 +1,58 @@
+package kv
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// Directory of the tmpfs mount in which in-memory stores are created, if it exists.
+const sharedMemoryDir = "/dev/shm"
+
+// InMemoryStore is a slashing protection store meant for simulations and tests. It is the
+// bolt backed Store, with the same slashing checks and batching semantics, opened without
+// fsync in a temporary directory of the /dev/shm tmpfs, so that its database never touches
+// disk where that mount exists. The directory is removed once the store is closed, so it must
+// never be used to protect real validator keys.
+type InMemoryStore struct {
+	*Store
+}
+
+// NewInMemoryStore initializes an empty in-memory slashing protection store for the
+// given validator public keys.
+func NewInMemoryStore(pubKeys [][48]byte) (*InMemoryStore, error) {
+	parentDir := os.TempDir()
+	if info, err := os.Stat(sharedMemoryDir); err == nil && info.IsDir() {
+		parentDir = sharedMemoryDir
+	}
+	dirPath, err := ioutil.TempDir(parentDir, "validator-db-")
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create in-memory database directory")
+	}
+	store, err := NewKVStore(context.Background(), dirPath, &Config{PubKeys: pubKeys, NoSync: true})
+	if err != nil {
+		if rmErr := os.RemoveAll(dirPath); rmErr != nil {
+			log.WithError(rmErr).Warn("Could not remove in-memory database directory")
+		}
+		return nil, err
+	}
+	s := &InMemoryStore{Store: store}
+	if err := s.UpdatePublicKeysBuckets(pubKeys); err != nil {
+		if closeErr := s.Close(); closeErr != nil {
+			log.WithError(closeErr).Warn("Could not close in-memory database")
+		}
+		return nil, err
+	}
+	return s, nil
+}
+
+// Close closes the underlying database and removes its temporary directory.
+func (s *InMemoryStore) Close() error {
+	closeErr := s.Store.Close()
+	if err := os.RemoveAll(s.databasePath); err != nil && closeErr == nil {
+		return errors.Wrap(err, "could not remove in-memory database directory")
+	}
+	return closeErr
+}
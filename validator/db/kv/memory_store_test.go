@@ -0,0 +1,198 @@
+package kv
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	types "github.com/prysmaticlabs/eth2-types"
+	"github.com/prysmaticlabs/prysm/shared/testutil/assert"
+	"github.com/prysmaticlabs/prysm/shared/testutil/require"
+)
+
+// setupInMemoryDB instantiates and returns an in-memory slashing protection store
+// for the given public keys, closed once the test is done.
+func setupInMemoryDB(t testing.TB, pubKeys [][48]byte) *InMemoryStore {
+	validatorDB, err := NewInMemoryStore(pubKeys)
+	require.NoError(t, err, "Failed to instantiate in-memory store")
+	t.Cleanup(func() {
+		require.NoError(t, validatorDB.Close(), "Failed to close in-memory store")
+	})
+	return validatorDB
+}
+
+func TestInMemoryStore_SaveAttestationForPubKey_Batched(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	validatorDB := setupInMemoryDB(t, [][48]byte{pubKey})
+	require.NoError(t, validatorDB.SaveAttestationForPubKey(ctx, pubKey, [32]byte{1}, createAttestation(1, 50)))
+
+	// As with the bolt store, the batched record is written by the time the save returns.
+	slashingKind, err := validatorDB.CheckSlashableAttestation(ctx, pubKey, [32]byte{2}, createAttestation(1, 50))
+	require.NotNil(t, err)
+	assert.Equal(t, DoubleVote, slashingKind)
+	slashingKind, err = validatorDB.CheckSlashableAttestation(ctx, pubKey, [32]byte{2}, createAttestation(2, 49))
+	require.NotNil(t, err)
+	assert.Equal(t, SurroundedVote, slashingKind)
+
+	history, err := validatorDB.AttestationHistoryForPubKey(ctx, pubKey)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(history))
+	assert.Equal(t, types.Epoch(50), history[0].Target)
+	_, exists, err := validatorDB.FirstSignedTimestamp(ctx, pubKey)
+	require.NoError(t, err)
+	assert.Equal(t, true, exists)
+}
+
+func TestInMemoryStore_SaveAttestationForPubKey_FullCapacity(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	validatorDB := setupInMemoryDB(t, [][48]byte{pubKey})
+	for i := 0; i < attestationBatchCapacity; i++ {
+		att := createAttestation(types.Epoch(i), types.Epoch(i+1))
+		require.NoError(t, validatorDB.SaveAttestationForPubKey(ctx, pubKey, [32]byte{byte(i)}, att))
+	}
+	// Reaching the capacity of the batch writes it without an explicit flush.
+	count, err := validatorDB.AttestationRecordCount(ctx, pubKey)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(attestationBatchCapacity), count)
+}
+
+func TestInMemoryStore_ClearAttestationHistoryForPubKeys_Pending(t *testing.T) {
+	ctx := context.Background()
+	pubKeys := [][48]byte{{1}, {2}}
+	validatorDB := setupInMemoryDB(t, pubKeys)
+	require.NoError(t, validatorDB.SaveAttestationForPubKey(ctx, pubKeys[0], [32]byte{1}, createAttestation(1, 2)))
+	require.NoError(t, validatorDB.SaveAttestationForPubKey(ctx, pubKeys[1], [32]byte{1}, createAttestation(1, 2)))
+	require.NoError(t, validatorDB.ClearAttestationHistoryForPubKeys(ctx, pubKeys[:1]))
+	require.NoError(t, validatorDB.FlushAttestationBatch(ctx))
+
+	// The batched record of the cleared key is dropped instead of being written after the clear.
+	count, err := validatorDB.AttestationRecordCount(ctx, pubKeys[0])
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), count)
+	_, exists, err := validatorDB.HighestSignedTargetEpoch(ctx, pubKeys[0])
+	require.NoError(t, err)
+	assert.Equal(t, false, exists)
+	count, err = validatorDB.AttestationRecordCount(ctx, pubKeys[1])
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), count)
+}
+
+func TestInMemoryStore_AttestationHistory(t *testing.T) {
+	ctx := context.Background()
+	pubKeys := [][48]byte{{1}}
+	validatorDB := setupInMemoryDB(t, pubKeys)
+	records := []*AttestationRecord{
+		{PubKey: pubKeys[0], Source: 3, Target: 4, SigningRoot: [32]byte{4}},
+		{PubKey: pubKeys[0], Source: 1, Target: 3, SigningRoot: [32]byte{3}},
+		{PubKey: pubKeys[0], Source: 1, Target: 2, SigningRoot: [32]byte{2}},
+	}
+	require.NoError(t, validatorDB.SaveAttestationRecordsForPubKey(ctx, pubKeys[0], records))
+	// Saving the same records again must not duplicate them.
+	require.NoError(t, validatorDB.SaveAttestationRecordsForPubKey(ctx, pubKeys[0], records))
+
+	count, err := validatorDB.AttestationRecordCount(ctx, pubKeys[0])
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), count)
+
+	var targets []types.Epoch
+	require.NoError(t, validatorDB.ForEachAttestation(
+		ctx, pubKeys[0], func(source, target types.Epoch, signingRoot [32]byte) error {
+			assert.Equal(t, [32]byte{byte(target)}, signingRoot)
+			targets = append(targets, target)
+			return nil
+		},
+	))
+	assert.DeepEqual(t, []types.Epoch{2, 3, 4}, targets)
+
+	lowestSource, exists, err := validatorDB.LowestSignedSourceEpoch(ctx, pubKeys[0])
+	require.NoError(t, err)
+	require.Equal(t, true, exists)
+	assert.Equal(t, types.Epoch(1), lowestSource)
+	highestTarget, exists, err := validatorDB.HighestSignedTargetEpoch(ctx, pubKeys[0])
+	require.NoError(t, err)
+	require.Equal(t, true, exists)
+	assert.Equal(t, types.Epoch(4), highestTarget)
+	require.NoError(t, validatorDB.VerifyAttestationBounds(ctx, pubKeys[0]))
+
+	ok, err := validatorDB.SelfTestSlashingProtection(ctx, pubKeys[0])
+	require.NoError(t, err)
+	assert.Equal(t, true, ok)
+}
+
+func TestInMemoryStore_AllAttestationBoundaries(t *testing.T) {
+	ctx := context.Background()
+	pubKeys := [][48]byte{{1}, {2}}
+	validatorDB := setupInMemoryDB(t, pubKeys)
+	require.NoError(t, validatorDB.SaveAttestationForPubKey(ctx, pubKeys[0], [32]byte{1}, createAttestation(3, 4)))
+	require.NoError(t, validatorDB.SaveAttestationForPubKey(ctx, pubKeys[0], [32]byte{2}, createAttestation(4, 8)))
+	require.NoError(t, validatorDB.FlushAttestationBatch(ctx))
+
+	boundaries, err := validatorDB.AllAttestationBoundaries(ctx)
+	require.NoError(t, err)
+	require.DeepEqual(t, map[[48]byte]EpochBounds{pubKeys[0]: {LowestSource: 3, HighestTarget: 8}}, boundaries)
+}
+
+func TestInMemoryStore_CheckSlashableBlockProposal(t *testing.T) {
+	ctx := context.Background()
+	pubKeys := [][48]byte{{1}}
+	validatorDB := setupInMemoryDB(t, pubKeys)
+	require.NoError(t, validatorDB.SaveBlockProposal(ctx, pubKeys[0], [32]byte{1}, 10))
+
+	slashingKind, err := validatorDB.CheckSlashableBlockProposal(ctx, pubKeys[0], [32]byte{2}, 10)
+	require.NotNil(t, err)
+	assert.Equal(t, DoubleProposal, slashingKind)
+	slashingKind, err = validatorDB.CheckSlashableBlockProposal(ctx, pubKeys[0], [32]byte{1}, 10)
+	require.NoError(t, err)
+	assert.Equal(t, NotSlashable, slashingKind)
+
+	highest, exists, err := validatorDB.HighestSignedProposal(ctx, pubKeys[0])
+	require.NoError(t, err)
+	require.Equal(t, true, exists)
+	assert.Equal(t, types.Slot(10), highest)
+}
+
+func TestInMemoryStore_ProposalSlotIsSafe(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	validatorDB := setupInMemoryDB(t, [][48]byte{pubKey})
+	require.NoError(t, validatorDB.SaveBlockProposal(ctx, pubKey, [32]byte{1}, 10))
+
+	safe, slashingKind, err := validatorDB.ProposalSlotIsSafe(ctx, pubKey, 10, [32]byte{1})
+	require.NoError(t, err)
+	assert.Equal(t, true, safe)
+	assert.Equal(t, NotSlashable, slashingKind)
+	safe, slashingKind, err = validatorDB.ProposalSlotIsSafe(ctx, pubKey, 10, [32]byte{2})
+	require.NoError(t, err)
+	assert.Equal(t, false, safe)
+	assert.Equal(t, DoubleProposal, slashingKind)
+	safe, slashingKind, err = validatorDB.ProposalSlotIsSafe(ctx, pubKey, 9, [32]byte{2})
+	require.NoError(t, err)
+	assert.Equal(t, false, safe)
+	assert.Equal(t, MinimalProtectionViolation, slashingKind)
+}
+
+func TestInMemoryStore_SaveAttestationForPubKey_InvalidAttestation(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	validatorDB := setupInMemoryDB(t, [][48]byte{pubKey})
+	err := validatorDB.SaveAttestationForPubKey(ctx, pubKey, [32]byte{1}, createAttestation(3, 2))
+	require.ErrorContains(t, "attestation target epoch 2 is lower than its source epoch 3", err)
+	count, err := validatorDB.AttestationRecordCount(ctx, pubKey)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), count)
+}
+
+func TestInMemoryStore_Close_RemovesDirectory(t *testing.T) {
+	validatorDB, err := NewInMemoryStore([][48]byte{{1}})
+	require.NoError(t, err)
+	dirPath := validatorDB.DatabasePath()
+	_, err = os.Stat(filepath.Join(dirPath, ProtectionDbFileName))
+	require.NoError(t, err)
+
+	require.NoError(t, validatorDB.Close())
+	_, err = os.Stat(dirPath)
+	assert.Equal(t, true, os.IsNotExist(err))
+}
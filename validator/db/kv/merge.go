@@ -0,0 +1,287 @@
+package kv
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	types "github.com/prysmaticlabs/eth2-types"
+	"github.com/prysmaticlabs/prysm/shared/bytesutil"
+	"github.com/prysmaticlabs/prysm/shared/params"
+	bolt "go.etcd.io/bbolt"
+	"go.opencensus.io/trace"
+)
+
+// ErrMergeConflict is returned when two databases being merged hold distinct signing roots
+// for the same public key at the same attestation target epoch or block proposal slot, or
+// attestations of the same public key which surround each other.
+var ErrMergeConflict = errors.New("slashing protection databases hold conflicting signing roots")
+
+// MergeFrom merges the slashing protection history of another database into this one, such as
+// when consolidating validators from two machines onto one. The attestations and block proposals
+// of both databases are united, so that the merged history protects against everything either
+// database protected against. For public keys present in both, the lowest signed source and
+// target epochs are the minimum of both, and the highest signed target epoch the maximum.
+//
+// A public key which signed distinct signing roots at the same target epoch or slot in both
+// databases, or an attestation in one database surrounding or surrounded by one in the other,
+// has already signed slashable messages, which cannot be resolved automatically, so all such
+// conflicts are reported in an error wrapping ErrMergeConflict and nothing is merged.
+// A missing signing root does not conflict with a known one, which is kept. The genesis
+// validators roots of both databases must match, if set.
+func (s *Store) MergeFrom(ctx context.Context, other *Store) error {
+	ctx, span := trace.StartSpan(ctx, "Validator.MergeFrom")
+	defer span.End()
+	if s.readOnly {
+		return ErrReadOnly
+	}
+	if other == s {
+		return errors.New("cannot merge a database into itself")
+	}
+
+	// Batched records which are not yet flushed are part of the histories being merged.
+	for _, store := range []*Store{s, other} {
+		if store.readOnly {
+			continue
+		}
+		if err := store.FlushAttestationBatch(ctx); err != nil {
+			return errors.Wrap(err, "could not flush batched attestations")
+		}
+		if err := store.FlushProposalBatch(ctx); err != nil {
+			return errors.Wrap(err, "could not flush batched proposals")
+		}
+	}
+
+	genesisValidatorsRoot, err := s.GenesisValidatorsRoot(ctx)
+	if err != nil {
+		return err
+	}
+	otherGenesisValidatorsRoot, err := other.GenesisValidatorsRoot(ctx)
+	if err != nil {
+		return err
+	}
+	if len(genesisValidatorsRoot) != 0 && len(otherGenesisValidatorsRoot) != 0 &&
+		!bytes.Equal(genesisValidatorsRoot, otherGenesisValidatorsRoot) {
+		return fmt.Errorf(
+			"cannot merge slashing protection data of genesis validators root %#x into %#x",
+			otherGenesisValidatorsRoot, genesisValidatorsRoot,
+		)
+	}
+
+	attestations, conflicts, err := s.mergeableAttestations(ctx, other)
+	if err != nil {
+		return err
+	}
+	proposals, proposalConflicts, err := s.mergeableProposals(ctx, other)
+	if err != nil {
+		return err
+	}
+	conflicts = append(conflicts, proposalConflicts...)
+	if len(conflicts) > 0 {
+		return errors.Wrapf(ErrMergeConflict, "%d conflicts: %s", len(conflicts), strings.Join(conflicts, "; "))
+	}
+	bounds, err := other.signedEpochBounds(ctx)
+	if err != nil {
+		return err
+	}
+	blacklistedPublicKeys, err := other.EIPImportBlacklistedPublicKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Everything is written in a single transaction, so that a failed merge leaves this
+	// database unchanged.
+	return s.update(func(tx *bolt.Tx) error {
+		if len(genesisValidatorsRoot) == 0 && len(otherGenesisValidatorsRoot) != 0 {
+			if err := tx.Bucket(genesisInfoBucket).Put(genesisValidatorsRootKey, otherGenesisValidatorsRoot); err != nil {
+				return errors.Wrap(err, "could not save merged genesis validators root")
+			}
+		}
+		if err := saveBlacklistedPublicKeys(tx, blacklistedPublicKeys); err != nil {
+			return errors.Wrap(err, "could not save merged blacklisted public keys")
+		}
+		if err := s.putAttestationRecords(tx, attestations); err != nil {
+			return errors.Wrap(err, "could not save merged attestations")
+		}
+		for pubKey, history := range proposals {
+			for _, proposal := range history {
+				if err := saveProposalRecord(tx, pubKey, proposal.Slot, proposal.SigningRoot); err != nil {
+					return errors.Wrap(err, "could not save merged proposals")
+				}
+			}
+		}
+		for _, b := range bounds {
+			if err := mergeEpochBound(tx.Bucket(lowestSignedSourceBucket), b.pubKey, b.lowestSource, true); err != nil {
+				return err
+			}
+			if err := mergeEpochBound(tx.Bucket(lowestSignedTargetBucket), b.pubKey, b.lowestTarget, true); err != nil {
+				return err
+			}
+			if err := mergeEpochBound(tx.Bucket(highestSignedTargetBucket), b.pubKey, b.highestTarget, false); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Returns the attestations of another database to save in this one, along with the target
+// epochs at which both databases hold distinct signing roots and the attestations of either
+// database surrounding one of the other. Attestations without signing root take the signing
+// root known in this database, if any, so that it is not overwritten.
+func (s *Store) mergeableAttestations(ctx context.Context, other *Store) ([]*AttestationRecord, []string, error) {
+	publicKeys, err := other.AttestedPublicKeys(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	records := make([]*AttestationRecord, 0)
+	conflicts := make([]string, 0)
+	for _, pubKey := range publicKeys {
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		otherHistory, err := other.AttestationHistoryForPubKey(ctx, pubKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		history, err := s.AttestationHistoryForPubKey(ctx, pubKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		stored := NewStoredAttestations(history)
+		signingRoots := make(map[types.Epoch][32]byte, len(history))
+		for _, record := range history {
+			if record.SigningRoot != params.BeaconConfig().ZeroHash {
+				signingRoots[record.Target] = record.SigningRoot
+			}
+		}
+		for _, record := range otherHistory {
+			// Records read from the attesting history do not carry their public key.
+			record.PubKey = pubKey
+			// Double votes are told apart below, as a missing signing root does not conflict.
+			if kind := stored.surroundKind(record); kind != NotSlashable {
+				conflicts = append(conflicts, fmt.Sprintf(
+					"public key %#x attestation with source epoch %d and target epoch %d is a %s",
+					bytesutil.Trunc(pubKey[:]), record.Source, record.Target, kind,
+				))
+				continue
+			}
+			if existing, ok := signingRoots[record.Target]; ok {
+				if record.SigningRoot == params.BeaconConfig().ZeroHash {
+					record.SigningRoot = existing
+				} else if record.SigningRoot != existing {
+					conflicts = append(conflicts, fmt.Sprintf(
+						"public key %#x signed target epoch %d with signing roots %#x and %#x",
+						bytesutil.Trunc(pubKey[:]), record.Target, existing, record.SigningRoot,
+					))
+				}
+			}
+			records = append(records, record)
+		}
+	}
+	return records, conflicts, nil
+}
+
+// Returns the block proposals of another database which are missing from this one, along
+// with the slots at which both databases hold distinct signing roots.
+func (s *Store) mergeableProposals(ctx context.Context, other *Store) (map[[48]byte][]*Proposal, []string, error) {
+	publicKeys, err := other.ProposedPublicKeys(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	proposals := make(map[[48]byte][]*Proposal)
+	conflicts := make([]string, 0)
+	for _, pubKey := range publicKeys {
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		otherHistory, err := other.ProposalHistoryForPubKey(ctx, pubKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		history, err := s.ProposalHistoryForPubKey(ctx, pubKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		signingRoots := make(map[types.Slot][]byte, len(history))
+		for _, proposal := range history {
+			signingRoots[proposal.Slot] = proposal.SigningRoot
+		}
+		for _, proposal := range otherHistory {
+			if existing, ok := signingRoots[proposal.Slot]; ok {
+				if isMissingSigningRoot(proposal.SigningRoot) || bytes.Equal(existing, proposal.SigningRoot) {
+					continue
+				}
+				if !isMissingSigningRoot(existing) {
+					conflicts = append(conflicts, fmt.Sprintf(
+						"public key %#x proposed slot %d with signing roots %#x and %#x",
+						bytesutil.Trunc(pubKey[:]), proposal.Slot, existing, proposal.SigningRoot,
+					))
+					continue
+				}
+				// The known signing root replaces the missing one.
+			}
+			proposals[pubKey] = append(proposals[pubKey], proposal)
+		}
+	}
+	return proposals, conflicts, nil
+}
+
+// Bounds of the epochs signed by a public key, as stored in the lowest signed source and
+// target epochs and highest signed target epoch buckets.
+type signedEpochBound struct {
+	pubKey        [48]byte
+	lowestSource  types.Epoch
+	lowestTarget  types.Epoch
+	highestTarget types.Epoch
+}
+
+// Returns the bounds of the epochs signed by every public key with an attesting history.
+// The bounds are kept when attestations are pruned, so they may be wider than the history.
+func (s *Store) signedEpochBounds(ctx context.Context) ([]*signedEpochBound, error) {
+	publicKeys, err := s.AttestedPublicKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	bounds := make([]*signedEpochBound, 0, len(publicKeys))
+	err = s.view(func(tx *bolt.Tx) error {
+		lowestSourceBucket := tx.Bucket(lowestSignedSourceBucket)
+		lowestTargetBucket := tx.Bucket(lowestSignedTargetBucket)
+		highestTargetBucket := tx.Bucket(highestSignedTargetBucket)
+		for _, pubKey := range publicKeys {
+			lowestSource := lowestSourceBucket.Get(pubKey[:])
+			lowestTarget := lowestTargetBucket.Get(pubKey[:])
+			highestTarget := highestTargetBucket.Get(pubKey[:])
+			if len(lowestSource) < 8 || len(lowestTarget) < 8 || len(highestTarget) < 8 {
+				continue
+			}
+			bounds = append(bounds, &signedEpochBound{
+				pubKey:        pubKey,
+				lowestSource:  bytesutil.BytesToEpochBigEndian(lowestSource),
+				lowestTarget:  bytesutil.BytesToEpochBigEndian(lowestTarget),
+				highestTarget: bytesutil.BytesToEpochBigEndian(highestTarget),
+			})
+		}
+		return nil
+	})
+	return bounds, err
+}
+
+// Stores an epoch bound of a public key in a bucket, unless the stored bound is
+// already lower, or higher if lower is false.
+func mergeEpochBound(bucket *bolt.Bucket, pubKey [48]byte, epoch types.Epoch, lower bool) error {
+	if enc := bucket.Get(pubKey[:]); len(enc) >= 8 {
+		existing := bytesutil.BytesToEpochBigEndian(enc)
+		if (lower && existing <= epoch) || (!lower && existing >= epoch) {
+			return nil
+		}
+	}
+	return bucket.Put(pubKey[:], bytesutil.EpochToBytesBigEndian(epoch))
+}
+
+// Returns true for the empty or zero signing root of a record whose signing root is unknown.
+func isMissingSigningRoot(signingRoot []byte) bool {
+	return len(signingRoot) == 0 || bytes.Equal(signingRoot, params.BeaconConfig().ZeroHash[:])
+}
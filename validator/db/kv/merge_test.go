@@ -0,0 +1,136 @@
+package kv
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	types "github.com/prysmaticlabs/eth2-types"
+	"github.com/prysmaticlabs/prysm/shared/testutil/assert"
+	"github.com/prysmaticlabs/prysm/shared/testutil/require"
+)
+
+func TestStore_MergeFrom(t *testing.T) {
+	ctx := context.Background()
+	shared, onlyOther := [48]byte{1}, [48]byte{2}
+	validatorDB := setupDB(t, [][48]byte{shared})
+	other := setupDB(t, [][48]byte{shared, onlyOther})
+	require.NoError(t, other.SaveGenesisValidatorsRoot(ctx, make([]byte, 32)))
+
+	require.NoError(t, validatorDB.SaveAttestationForPubKey(ctx, shared, [32]byte{3}, createAttestation(3, 4)))
+	require.NoError(t, validatorDB.SaveAttestationForPubKey(ctx, shared, [32]byte{4}, createAttestation(4, 5)))
+	require.NoError(t, other.SaveAttestationForPubKey(ctx, shared, [32]byte{1}, createAttestation(1, 2)))
+	require.NoError(t, other.SaveAttestationForPubKey(ctx, shared, [32]byte{4}, createAttestation(4, 5)))
+	require.NoError(t, other.SaveAttestationForPubKey(ctx, shared, [32]byte{6}, createAttestation(5, 6)))
+	require.NoError(t, other.SaveAttestationForPubKey(ctx, onlyOther, [32]byte{9}, createAttestation(8, 9)))
+	require.NoError(t, validatorDB.SaveProposalHistoryForSlot(ctx, shared, 10, []byte{10}))
+	require.NoError(t, other.SaveProposalHistoryForSlot(ctx, shared, 10, []byte{10}))
+	require.NoError(t, other.SaveProposalHistoryForSlot(ctx, shared, 20, []byte{20}))
+
+	require.NoError(t, validatorDB.MergeFrom(ctx, other))
+
+	genesisValidatorsRoot, err := validatorDB.GenesisValidatorsRoot(ctx)
+	require.NoError(t, err)
+	assert.DeepEqual(t, make([]byte, 32), genesisValidatorsRoot)
+
+	// Histories are united, and the signed epoch bounds span both databases.
+	history, err := validatorDB.AttestationHistoryForPubKey(ctx, shared)
+	require.NoError(t, err)
+	targets := make(map[types.Epoch][32]byte)
+	for _, record := range history {
+		targets[record.Target] = record.SigningRoot
+	}
+	assert.DeepEqual(t, map[types.Epoch][32]byte{2: {1}, 4: {3}, 5: {4}, 6: {6}}, targets)
+	lowestSource, _, err := validatorDB.LowestSignedSourceEpoch(ctx, shared)
+	require.NoError(t, err)
+	assert.Equal(t, types.Epoch(1), lowestSource)
+	highestTarget, _, err := validatorDB.HighestSignedTargetEpoch(ctx, shared)
+	require.NoError(t, err)
+	assert.Equal(t, types.Epoch(6), highestTarget)
+	history, err = validatorDB.AttestationHistoryForPubKey(ctx, onlyOther)
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(history))
+
+	proposals, err := validatorDB.ProposalHistoryForPubKey(ctx, shared)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(proposals))
+	assert.Equal(t, types.Slot(20), proposals[1].Slot)
+
+	// The merged history protects against attestations slashable in the other database.
+	kind, err := validatorDB.CheckSlashableAttestation(ctx, shared, [32]byte{}, createAttestation(0, 7))
+	assert.NotNil(t, err)
+	assert.Equal(t, SurroundingVote, kind)
+}
+
+func TestStore_MergeFrom_Conflicts(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	validatorDB := setupDB(t, [][48]byte{pubKey})
+	other := setupDB(t, [][48]byte{pubKey})
+	require.NoError(t, validatorDB.SaveAttestationForPubKey(ctx, pubKey, [32]byte{1}, createAttestation(1, 2)))
+	require.NoError(t, other.SaveAttestationForPubKey(ctx, pubKey, [32]byte{2}, createAttestation(1, 2)))
+	require.NoError(t, other.SaveAttestationForPubKey(ctx, pubKey, [32]byte{3}, createAttestation(2, 3)))
+	require.NoError(t, validatorDB.SaveProposalHistoryForSlot(ctx, pubKey, 10, []byte{1}))
+	require.NoError(t, other.SaveProposalHistoryForSlot(ctx, pubKey, 10, []byte{2}))
+
+	err := validatorDB.MergeFrom(ctx, other)
+	require.ErrorContains(t, "2 conflicts", err)
+	assert.Equal(t, true, errors.Is(err, ErrMergeConflict))
+	assert.ErrorContains(t, "signed target epoch 2", err)
+	assert.ErrorContains(t, "proposed slot 10", err)
+
+	// Nothing is merged when there are conflicts.
+	history, err := validatorDB.AttestationHistoryForPubKey(ctx, pubKey)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(history))
+	assert.Equal(t, [32]byte{1}, history[0].SigningRoot)
+}
+
+func TestStore_MergeFrom_SurroundConflicts(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	validatorDB := setupDB(t, [][48]byte{pubKey})
+	other := setupDB(t, [][48]byte{pubKey})
+	require.NoError(t, other.SaveGenesisValidatorsRoot(ctx, make([]byte, 32)))
+	require.NoError(t, other.SaveEIPImportBlacklistedPublicKeys(ctx, [][48]byte{{2}}))
+	require.NoError(t, validatorDB.SaveAttestationForPubKey(ctx, pubKey, [32]byte{1}, createAttestation(2, 3)))
+	require.NoError(t, validatorDB.SaveAttestationForPubKey(ctx, pubKey, [32]byte{2}, createAttestation(5, 10)))
+	// Surrounds the attestation with source epoch 2 and target epoch 3.
+	require.NoError(t, other.SaveAttestationForPubKey(ctx, pubKey, [32]byte{3}, createAttestation(1, 4)))
+	// Surrounded by the attestation with source epoch 5 and target epoch 10.
+	require.NoError(t, other.SaveAttestationForPubKey(ctx, pubKey, [32]byte{4}, createAttestation(6, 8)))
+	require.NoError(t, other.SaveProposalHistoryForSlot(ctx, pubKey, 10, []byte{1}))
+
+	err := validatorDB.MergeFrom(ctx, other)
+	require.ErrorContains(t, "2 conflicts", err)
+	assert.Equal(t, true, errors.Is(err, ErrMergeConflict))
+	assert.ErrorContains(t, "source epoch 1 and target epoch 4 is a SurroundingVote", err)
+	assert.ErrorContains(t, "source epoch 6 and target epoch 8 is a SurroundedVote", err)
+
+	// Nothing is merged when conflicts are found.
+	count, err := validatorDB.AttestationRecordCount(ctx, pubKey)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), count)
+	lowestSource, _, err := validatorDB.LowestSignedSourceEpoch(ctx, pubKey)
+	require.NoError(t, err)
+	assert.Equal(t, types.Epoch(2), lowestSource)
+	proposals, err := validatorDB.ProposalHistoryForPubKey(ctx, pubKey)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(proposals))
+	genesisValidatorsRoot, err := validatorDB.GenesisValidatorsRoot(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(genesisValidatorsRoot))
+	blacklisted, err := validatorDB.EIPImportBlacklistedPublicKeys(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(blacklisted))
+}
+
+func TestStore_MergeFrom_GenesisValidatorsRootMismatch(t *testing.T) {
+	ctx := context.Background()
+	validatorDB := setupDB(t, nil)
+	other := setupDB(t, nil)
+	require.NoError(t, validatorDB.SaveGenesisValidatorsRoot(ctx, []byte{1}))
+	require.NoError(t, other.SaveGenesisValidatorsRoot(ctx, []byte{2}))
+	assert.ErrorContains(t, "cannot merge slashing protection data of genesis validators root", validatorDB.MergeFrom(ctx, other))
+	assert.ErrorContains(t, "cannot merge a database into itself", validatorDB.MergeFrom(ctx, validatorDB))
+}
@@ -0,0 +1,96 @@
+package kv
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	// Flush reasons used as labels for the forced flushes counter.
+	flushReasonCapacity = "capacity"
+	flushReasonInterval = "interval"
+	// Flush reason logged for explicit flushes, such as when closing the DB.
+	flushReasonExplicit = "explicit"
+)
+
+var (
+	batchedAttestationsFlushCount = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "validator",
+			Name:      "batched_attestations_flush_total",
+			Help:      "The number of forced flushes of batched attestation records to the DB by reason",
+		},
+		[]string{
+			"reason",
+		},
+	)
+	batchedAttestationsFlushSize = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: "validator",
+			Name:      "batched_attestations_flush_size",
+			Help:      "The number of attestation records in a batch at the time it is flushed to the DB",
+			Buckets:   []float64{1, 8, 32, 128, 512, 1024, 2048, 4096},
+		},
+	)
+	batchedAttestationsFlushLatency = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: "validator",
+			Name:      "batched_attestations_flush_latency_milliseconds",
+			Help:      "Captures the time taken to flush a batch of attestation records to the DB in milliseconds",
+			Buckets:   []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000},
+		},
+	)
+	batchedAttestationsQueueLength = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "validator",
+			Name:      "batched_attestations_queue_length",
+			Help:      "The number of attestation records currently waiting to be flushed to the DB",
+		},
+	)
+	batchedProposalsFlushCount = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "validator",
+			Name:      "batched_proposals_flush_total",
+			Help:      "The number of forced flushes of batched block proposal records to the DB by reason",
+		},
+		[]string{
+			"reason",
+		},
+	)
+	batchedProposalsFlushSize = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: "validator",
+			Name:      "batched_proposals_flush_size",
+			Help:      "The number of block proposal records in a batch at the time it is flushed to the DB",
+			Buckets:   []float64{1, 2, 4, 8, 16, 32, 64, 128},
+		},
+	)
+	batchedProposalsFlushLatency = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: "validator",
+			Name:      "batched_proposals_flush_latency_milliseconds",
+			Help:      "Captures the time taken to flush a batch of block proposal records to the DB in milliseconds",
+			Buckets:   []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000},
+		},
+	)
+	batchedProposalsQueueLength = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "validator",
+			Name:      "batched_proposals_queue_length",
+			Help:      "The number of block proposal records currently waiting to be flushed to the DB",
+		},
+	)
+
+	attestationBatchMetrics = &batchMetrics{
+		flushCount:   batchedAttestationsFlushCount,
+		flushSize:    batchedAttestationsFlushSize,
+		flushLatency: batchedAttestationsFlushLatency,
+		queueLength:  batchedAttestationsQueueLength,
+	}
+	proposalBatchMetrics = &batchMetrics{
+		flushCount:   batchedProposalsFlushCount,
+		flushSize:    batchedProposalsFlushSize,
+		flushLatency: batchedProposalsFlushLatency,
+		queueLength:  batchedProposalsQueueLength,
+	}
+)
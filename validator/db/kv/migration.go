@@ -2,7 +2,10 @@ package kv
 
 import (
 	"context"
+	"fmt"
 
+	"github.com/pkg/errors"
+	"github.com/prysmaticlabs/prysm/shared/bytesutil"
 	bolt "go.etcd.io/bbolt"
 )
 
@@ -10,8 +13,17 @@ type migration func(*bolt.Tx) error
 
 var (
 	migrationCompleted = []byte("done")
-	upMigrations       []migration
-	downMigrations     []migration
+	// upMigrations are versioned schema migrations, applied in order. Applying the
+	// migration at index i brings the database to schema version i+1, so migrations
+	// must only ever be appended to this list. downMigrations holds the matching
+	// rollback for each migration, at the same index.
+	upMigrations = []migration{
+		// Version 1 records the schema in use when versioning was introduced.
+		func(*bolt.Tx) error { return nil },
+	}
+	downMigrations = []migration{
+		func(*bolt.Tx) error { return nil },
+	}
 )
 
 // RunUpMigrations defined in the upMigrations list.
@@ -23,14 +35,42 @@ func (s *Store) RunUpMigrations(ctx context.Context) error {
 	if err := s.migrateSourceTargetEpochsBucketUp(ctx); err != nil {
 		return err
 	}
+	return s.RunMigrations(ctx)
+}
 
-	for _, m := range upMigrations {
+// RunMigrations applies the schema migrations in the upMigrations list which have not
+// yet been applied to the database, recording the new schema version together with
+// each migration. It refuses to operate on a database with a newer schema version than
+// this version of the validator client supports.
+func (s *Store) RunMigrations(ctx context.Context) error {
+	var version uint64
+	if err := s.view(func(tx *bolt.Tx) error {
+		version = schemaVersion(tx)
+		return nil
+	}); err != nil {
+		return err
+	}
+	if version > uint64(len(upMigrations)) {
+		return fmt.Errorf(
+			"database schema version %d is newer than the supported version %d, "+
+				"please upgrade your validator client",
+			version,
+			len(upMigrations),
+		)
+	}
+	for ; version < uint64(len(upMigrations)); version++ {
 		if ctx.Err() != nil {
 			return ctx.Err()
 		}
-
-		if err := s.db.Update(m); err != nil {
-			return err
+		m := upMigrations[version]
+		next := version + 1
+		if err := s.update(func(tx *bolt.Tx) error {
+			if err := m(tx); err != nil {
+				return err
+			}
+			return tx.Bucket(migrationsBucket).Put(schemaVersionKey, bytesutil.Uint64ToBytesBigEndian(next))
+		}); err != nil {
+			return errors.Wrapf(err, "could not migrate database to schema version %d", next)
 		}
 	}
 	return nil
@@ -46,14 +86,45 @@ func (s *Store) RunDownMigrations(ctx context.Context) error {
 		return err
 	}
 
-	for _, m := range downMigrations {
+	var version uint64
+	if err := s.view(func(tx *bolt.Tx) error {
+		version = schemaVersion(tx)
+		return nil
+	}); err != nil {
+		return err
+	}
+	if version > uint64(len(downMigrations)) {
+		return fmt.Errorf(
+			"database schema version %d is newer than the supported version %d",
+			version,
+			len(downMigrations),
+		)
+	}
+	// Schema migrations are rolled back in reverse order.
+	for ; version > 0; version-- {
 		if ctx.Err() != nil {
 			return ctx.Err()
 		}
-
-		if err := s.db.Update(m); err != nil {
-			return err
+		m := downMigrations[version-1]
+		previous := version - 1
+		if err := s.update(func(tx *bolt.Tx) error {
+			if err := m(tx); err != nil {
+				return err
+			}
+			return tx.Bucket(migrationsBucket).Put(schemaVersionKey, bytesutil.Uint64ToBytesBigEndian(previous))
+		}); err != nil {
+			return errors.Wrapf(err, "could not roll back database to schema version %d", previous)
 		}
 	}
 	return nil
 }
+
+// Returns the schema version stored in the migrations bucket. Databases created
+// before schema versioning was introduced have no version stored, which is version 0.
+func schemaVersion(tx *bolt.Tx) uint64 {
+	enc := tx.Bucket(migrationsBucket).Get(schemaVersionKey)
+	if len(enc) != 8 {
+		return 0
+	}
+	return bytesutil.BytesToUint64BigEndian(enc)
+}
@@ -158,6 +158,9 @@ func (s *Store) migrateOptimalAttesterProtectionDown(ctx context.Context) error
 			}
 			sourceEpochsBucket := pubKeyBkt.Bucket(attestationSourceEpochsBucket)
 			signingRootsBucket := pubKeyBkt.Bucket(attestationSigningRootsBucket)
+			if sourceEpochsBucket == nil || signingRootsBucket == nil {
+				continue
+			}
 			// Extract signing roots.
 			if err := signingRootsBucket.ForEach(func(targetBytes, signingRoot []byte) error {
 				var sr [32]byte
@@ -0,0 +1,79 @@
+package kv
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prysmaticlabs/prysm/shared/bytesutil"
+	"github.com/prysmaticlabs/prysm/shared/testutil/assert"
+	"github.com/prysmaticlabs/prysm/shared/testutil/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func storedSchemaVersion(t *testing.T, validatorDB *Store) uint64 {
+	var version uint64
+	require.NoError(t, validatorDB.view(func(tx *bolt.Tx) error {
+		version = schemaVersion(tx)
+		return nil
+	}))
+	return version
+}
+
+func setSchemaVersion(t *testing.T, validatorDB *Store, version uint64) {
+	require.NoError(t, validatorDB.update(func(tx *bolt.Tx) error {
+		return tx.Bucket(migrationsBucket).Put(schemaVersionKey, bytesutil.Uint64ToBytesBigEndian(version))
+	}))
+}
+
+func TestStore_RunMigrations_NewDatabase(t *testing.T) {
+	validatorDB := setupDB(t, nil)
+	assert.Equal(t, uint64(len(upMigrations)), storedSchemaVersion(t, validatorDB))
+}
+
+func TestStore_RunMigrations_AppliesPendingInOrder(t *testing.T) {
+	ctx := context.Background()
+	validatorDB := setupDB(t, nil)
+
+	applied := make([]int, 0)
+	originalUp := upMigrations
+	t.Cleanup(func() {
+		upMigrations = originalUp
+	})
+	upMigrations = append(append(make([]migration, 0), originalUp...),
+		func(*bolt.Tx) error {
+			applied = append(applied, 1)
+			return nil
+		},
+		func(*bolt.Tx) error {
+			applied = append(applied, 2)
+			return nil
+		},
+	)
+
+	require.NoError(t, validatorDB.RunMigrations(ctx))
+	assert.DeepEqual(t, []int{1, 2}, applied)
+	assert.Equal(t, uint64(len(upMigrations)), storedSchemaVersion(t, validatorDB))
+
+	// Migrations which were already applied are not run again.
+	require.NoError(t, validatorDB.RunMigrations(ctx))
+	assert.DeepEqual(t, []int{1, 2}, applied)
+}
+
+func TestStore_RunMigrations_NewerSchemaVersion(t *testing.T) {
+	ctx := context.Background()
+	validatorDB := setupDB(t, nil)
+	setSchemaVersion(t, validatorDB, uint64(len(upMigrations)+1))
+
+	err := validatorDB.RunMigrations(ctx)
+	require.ErrorContains(t, "is newer than the supported version", err)
+}
+
+func TestStore_RunDownMigrations_ResetsSchemaVersion(t *testing.T) {
+	ctx := context.Background()
+	validatorDB := setupDB(t, nil)
+	require.NoError(t, validatorDB.RunDownMigrations(ctx))
+	assert.Equal(t, uint64(0), storedSchemaVersion(t, validatorDB))
+
+	require.NoError(t, validatorDB.RunUpMigrations(ctx))
+	assert.Equal(t, uint64(len(upMigrations)), storedSchemaVersion(t, validatorDB))
+}
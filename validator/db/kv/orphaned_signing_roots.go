@@ -0,0 +1,110 @@
+package kv
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	types "github.com/prysmaticlabs/eth2-types"
+	"github.com/prysmaticlabs/prysm/shared/bytesutil"
+	"github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+	"go.opencensus.io/trace"
+)
+
+// FindOrphanedSigningRoots returns, in ascending order, the target epochs at which a signing
+// root is stored for a public key while no source epoch of its attesting history maps to that
+// target epoch. A crash in the middle of a write which bypassed bolt transactions, or a
+// corrupt file, can leave such orphaned signing roots behind. Nothing is modified, so that the
+// orphans can be reviewed before calling RemoveOrphanedSigningRoots.
+func (s *Store) FindOrphanedSigningRoots(ctx context.Context, pubKey [48]byte) ([]types.Epoch, error) {
+	ctx, span := trace.StartSpan(ctx, "Validator.FindOrphanedSigningRoots")
+	defer span.End()
+	var orphans []types.Epoch
+	err := s.view(func(tx *bolt.Tx) error {
+		var err error
+		orphans, err = s.orphanedSigningRoots(ctx, tx, pubKey)
+		return err
+	})
+	return orphans, err
+}
+
+// RemoveOrphanedSigningRoots deletes the orphaned signing roots of a public key, as found by
+// FindOrphanedSigningRoots, in a single transaction, and returns their target epochs. Each
+// orphan is logged before it is removed. The target epochs bucket is left untouched, so that
+// any source epoch still recorded for an orphaned target epoch keeps protecting against
+// surround votes.
+func (s *Store) RemoveOrphanedSigningRoots(ctx context.Context, pubKey [48]byte) ([]types.Epoch, error) {
+	ctx, span := trace.StartSpan(ctx, "Validator.RemoveOrphanedSigningRoots")
+	defer span.End()
+	var orphans []types.Epoch
+	err := s.update(func(tx *bolt.Tx) error {
+		// The mirror removes its own orphans, which are those of the database unless it missed a write.
+		found, err := s.orphanedSigningRoots(ctx, tx, pubKey)
+		if err != nil {
+			return err
+		}
+		mirrorTx := s.isMirrorTx(tx)
+		if !mirrorTx {
+			orphans = found
+		}
+		signingRootsBucket := tx.Bucket(pubKeysBucket).Bucket(pubKey[:]).Bucket(s.epochKeys.signingRootsBucket)
+		for _, target := range found {
+			if !mirrorTx {
+				log.WithFields(logrus.Fields{
+					"publicKey":    fmt.Sprintf("%#x", bytesutil.Trunc(pubKey[:])),
+					"targetEpoch":  target,
+					"signingRoots": fmt.Sprintf("%#x", decodeSigningRoots(s.epochKeys.get(signingRootsBucket, target))),
+				}).Warn("Removing orphaned signing root")
+			}
+			if err := signingRootsBucket.Delete(s.epochKeys.encode(target)); err != nil {
+				return errors.Wrapf(err, "could not remove orphaned signing root for target epoch %d", target)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return orphans, nil
+}
+
+// Returns the target epochs of the signing roots of a public key which no source epoch maps to.
+func (s *Store) orphanedSigningRoots(ctx context.Context, tx *bolt.Tx, pubKey [48]byte) ([]types.Epoch, error) {
+	orphans := make([]types.Epoch, 0)
+	pkBucket := tx.Bucket(pubKeysBucket).Bucket(pubKey[:])
+	if pkBucket == nil {
+		return orphans, nil
+	}
+	signingRootsBucket := pkBucket.Bucket(s.epochKeys.signingRootsBucket)
+	if signingRootsBucket == nil {
+		return orphans, nil
+	}
+	mappedTargets := make(map[types.Epoch]bool)
+	if sourceEpochsBucket := pkBucket.Bucket(s.epochKeys.sourceEpochsBucket); sourceEpochsBucket != nil {
+		if err := sourceEpochsBucket.ForEach(func(_, targetEpochsList []byte) error {
+			for _, target := range s.epochKeys.decodeList(targetEpochsList) {
+				mappedTargets[target] = true
+			}
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+	for _, run := range s.sequentialRuns(pkBucket) {
+		for target := run.start + 1; target <= run.end; target++ {
+			mappedTargets[target] = true
+		}
+	}
+	// Signing roots are keyed by big-endian target epochs, so they are iterated in ascending order.
+	err := signingRootsBucket.ForEach(func(targetBytes, _ []byte) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if target := s.epochKeys.decode(targetBytes); !mappedTargets[target] {
+			orphans = append(orphans, target)
+		}
+		return nil
+	})
+	return orphans, err
+}
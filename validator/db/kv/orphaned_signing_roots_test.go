@@ -0,0 +1,87 @@
+package kv
+
+import (
+	"context"
+	"testing"
+
+	types "github.com/prysmaticlabs/eth2-types"
+	"github.com/prysmaticlabs/prysm/shared/testutil/assert"
+	"github.com/prysmaticlabs/prysm/shared/testutil/require"
+	logTest "github.com/sirupsen/logrus/hooks/test"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestStore_OrphanedSigningRoots(t *testing.T) {
+	hook := logTest.NewGlobal()
+	ctx := context.Background()
+	pubKeys := [][48]byte{{1}, {2}}
+	validatorDB := setupDB(t, pubKeys)
+	for _, pubKey := range pubKeys {
+		require.NoError(t, validatorDB.saveAttestationRecords(ctx, []*AttestationRecord{
+			{PubKey: pubKey, Source: 1, Target: 2, SigningRoot: [32]byte{2}},
+			{PubKey: pubKey, Source: 2, Target: 3, SigningRoot: [32]byte{3}},
+			{PubKey: pubKey, Source: 2, Target: 4, SigningRoot: [32]byte{4}},
+		}))
+	}
+
+	// A history without orphans has none to find or remove.
+	orphans, err := validatorDB.FindOrphanedSigningRoots(ctx, pubKeys[0])
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(orphans))
+	orphans, err = validatorDB.RemoveOrphanedSigningRoots(ctx, pubKeys[0])
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(orphans))
+	require.LogsDoNotContain(t, hook, "Removing orphaned signing root")
+
+	// Simulate partial writes leaving signing roots without source epoch mappings.
+	require.NoError(t, validatorDB.update(func(tx *bolt.Tx) error {
+		pkBucket := tx.Bucket(pubKeysBucket).Bucket(pubKeys[0][:])
+		if err := pkBucket.Bucket(validatorDB.epochKeys.signingRootsBucket).Put(
+			validatorDB.epochKeys.encode(7), []byte{7},
+		); err != nil {
+			return err
+		}
+		// Source epoch 2 no longer maps to target epoch 4.
+		return pkBucket.Bucket(validatorDB.epochKeys.sourceEpochsBucket).Put(
+			validatorDB.epochKeys.encode(2), validatorDB.epochKeys.encode(3),
+		)
+	}))
+
+	orphans, err = validatorDB.FindOrphanedSigningRoots(ctx, pubKeys[0])
+	require.NoError(t, err)
+	assert.DeepEqual(t, []types.Epoch{4, 7}, orphans)
+	// Finding orphans does not modify the database.
+	_, exists, err := validatorDB.SigningRootAtTarget(ctx, pubKeys[0], 4)
+	require.NoError(t, err)
+	assert.Equal(t, true, exists)
+
+	orphans, err = validatorDB.RemoveOrphanedSigningRoots(ctx, pubKeys[0])
+	require.NoError(t, err)
+	assert.DeepEqual(t, []types.Epoch{4, 7}, orphans)
+	require.LogsContain(t, hook, "Removing orphaned signing root")
+	for _, target := range []types.Epoch{4, 7} {
+		_, exists, err := validatorDB.SigningRootAtTarget(ctx, pubKeys[0], target)
+		require.NoError(t, err)
+		assert.Equal(t, false, exists, "Orphaned signing root at target epoch %d was not removed", target)
+	}
+	orphans, err = validatorDB.FindOrphanedSigningRoots(ctx, pubKeys[0])
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(orphans))
+
+	// Signing roots with source epoch mappings, and those of other public keys, are kept.
+	for _, target := range []types.Epoch{2, 3} {
+		_, exists, err := validatorDB.SigningRootAtTarget(ctx, pubKeys[0], target)
+		require.NoError(t, err)
+		assert.Equal(t, true, exists)
+	}
+	history, err := validatorDB.AttestationHistoryForPubKey(ctx, pubKeys[1])
+	require.NoError(t, err)
+	assert.Equal(t, 3, len(history))
+}
+
+func TestStore_FindOrphanedSigningRoots_UnknownPubKey(t *testing.T) {
+	validatorDB := setupDB(t, nil)
+	orphans, err := validatorDB.FindOrphanedSigningRoots(context.Background(), [48]byte{1})
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(orphans))
+}
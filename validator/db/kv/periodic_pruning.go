@@ -0,0 +1,106 @@
+package kv
+
+import (
+	"context"
+	"time"
+
+	types "github.com/prysmaticlabs/eth2-types"
+	"github.com/prysmaticlabs/prysm/beacon-chain/core/helpers"
+	"github.com/prysmaticlabs/prysm/shared/params"
+	"github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+// pruneHistoryPeriodically prunes the attestation and proposal history of every public key
+// once per interval, until the store is closed or the context is done.
+func (s *Store) pruneHistoryPeriodically(ctx context.Context, interval time.Duration, headEpoch func() types.Epoch) {
+	defer close(s.pruningDone)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.pruneHistory(ctx, headEpoch()); err != nil {
+				log.WithError(err).Error("Could not prune slashing protection history")
+			}
+		case <-s.stopPruning:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// pruneHistory runs a single pruning pass and logs the number of records removed.
+// Attestations are pruned relative to the head epoch, as done by pruneAttestationsAtHead,
+// and proposals relative to the start slot of the head epoch.
+func (s *Store) pruneHistory(ctx context.Context, headEpoch types.Epoch) error {
+	attestationsBefore, err := s.TotalAttestationRecordCount(ctx)
+	if err != nil {
+		return err
+	}
+	proposalsBefore, err := s.totalProposalCount()
+	if err != nil {
+		return err
+	}
+	if err := s.pruneAttestationsAtHead(ctx, headEpoch, params.BeaconConfig().SlashingProtectionPruningEpochs); err != nil {
+		return err
+	}
+	headSlot, err := helpers.StartSlot(headEpoch)
+	if err != nil {
+		return err
+	}
+	if err := s.PruneProposals(ctx, headSlot); err != nil {
+		return err
+	}
+	attestationsAfter, err := s.TotalAttestationRecordCount(ctx)
+	if err != nil {
+		return err
+	}
+	proposalsAfter, err := s.totalProposalCount()
+	if err != nil {
+		return err
+	}
+	log.WithFields(logrus.Fields{
+		"headEpoch":          headEpoch,
+		"attestationsPruned": prunedCount(attestationsBefore, attestationsAfter),
+		"proposalsPruned":    prunedCount(proposalsBefore, proposalsAfter),
+	}).Info("Pruned slashing protection history")
+	return nil
+}
+
+// Returns the number of records removed by a pruning pass. Records may be saved while the
+// pass runs, in which case fewer records than were saved are reported as pruned.
+func prunedCount(before, after uint64) uint64 {
+	if after > before {
+		return 0
+	}
+	return before - after
+}
+
+// Stops the periodic pruning routine, if running, and waits for any pruning pass in
+// progress to complete. This is safe to call more than once.
+func (s *Store) stopPeriodicPruning() {
+	if s.stopPruning == nil {
+		return
+	}
+	s.stopPruningOnce.Do(func() {
+		close(s.stopPruning)
+	})
+	<-s.pruningDone
+}
+
+// Returns the number of block proposals stored across all public keys.
+func (s *Store) totalProposalCount() (uint64, error) {
+	var total uint64
+	err := s.view(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(historicProposalsBucket)
+		return bucket.ForEach(func(pubKey []byte, _ []byte) error {
+			if valBucket := bucket.Bucket(pubKey); valBucket != nil {
+				total += uint64(valBucket.Stats().KeyN)
+			}
+			return nil
+		})
+	})
+	return total, err
+}
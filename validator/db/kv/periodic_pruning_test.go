@@ -0,0 +1,99 @@
+package kv
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	types "github.com/prysmaticlabs/eth2-types"
+	"github.com/prysmaticlabs/prysm/shared/params"
+	"github.com/prysmaticlabs/prysm/shared/testutil/assert"
+	"github.com/prysmaticlabs/prysm/shared/testutil/require"
+	logTest "github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestStore_PruneHistoryPeriodically(t *testing.T) {
+	hook := logTest.NewGlobal()
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	headEpoch := params.BeaconConfig().WeakSubjectivityPeriod + 10
+	validatorDB, err := NewKVStore(ctx, t.TempDir(), &Config{
+		PubKeys:         [][48]byte{pubKey},
+		PruningInterval: 10 * time.Millisecond,
+		HeadEpoch: func() types.Epoch {
+			return headEpoch
+		},
+	})
+	require.NoError(t, err, "Failed to instantiate DB")
+	t.Cleanup(func() {
+		require.NoError(t, validatorDB.ClearDB(), "Failed to clear database")
+	})
+	for _, slot := range []types.Slot{5, 10} {
+		require.NoError(t, validatorDB.SaveProposalHistoryForSlot(ctx, pubKey, slot, []byte{1}))
+	}
+
+	// Only the highest signed proposal is kept once a pruning pass ran.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		proposals, err := validatorDB.ProposalHistoryForPubKey(ctx, pubKey)
+		require.NoError(t, err)
+		if len(proposals) == 1 {
+			assert.Equal(t, types.Slot(10), proposals[0].Slot)
+			break
+		}
+		require.Equal(t, true, time.Now().Before(deadline), "Proposals were not pruned in time")
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.LogsContain(t, hook, "Pruned slashing protection history")
+
+	// Closing the store stops the pruning routine.
+	require.NoError(t, validatorDB.Close())
+	select {
+	case <-validatorDB.pruningDone:
+	default:
+		t.Fatal("Pruning routine was not stopped on close")
+	}
+}
+
+func TestStore_PruneHistory_LogsPrunedCounts(t *testing.T) {
+	hook := logTest.NewGlobal()
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	validatorDB := setupDB(t, [][48]byte{pubKey})
+	for _, slot := range []types.Slot{5, 10, 15} {
+		require.NoError(t, validatorDB.SaveProposalHistoryForSlot(ctx, pubKey, slot, []byte{1}))
+	}
+	require.NoError(t, validatorDB.pruneHistory(ctx, params.BeaconConfig().WeakSubjectivityPeriod+10))
+	require.LogsContain(t, hook, "proposalsPruned=2")
+	require.LogsContain(t, hook, "attestationsPruned=0")
+}
+
+func TestStore_PruneHistory_RelativeToHeadEpoch(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	validatorDB := setupDB(t, [][48]byte{pubKey})
+	pruningEpochs := params.BeaconConfig().SlashingProtectionPruningEpochs
+	headEpoch := pruningEpochs + 100
+	// A record signed ahead of the head epoch does not cause records within the pruning period
+	// of the head epoch to be pruned, while older records are.
+	records := []*AttestationRecord{
+		{PubKey: pubKey, Source: 49, Target: 50},
+		{PubKey: pubKey, Source: 149, Target: 150},
+		{PubKey: pubKey, Source: headEpoch + 199, Target: headEpoch + 200},
+	}
+	require.NoError(t, validatorDB.saveAttestationRecords(ctx, records))
+	require.NoError(t, validatorDB.pruneHistory(ctx, headEpoch))
+
+	history, err := validatorDB.AttestationHistoryForPubKey(ctx, pubKey)
+	require.NoError(t, err)
+	require.DeepEqual(t, []*AttestationRecord{
+		{Source: 149, Target: 150},
+		{Source: headEpoch + 199, Target: headEpoch + 200},
+	}, history)
+}
+
+func TestPrunedCount(t *testing.T) {
+	assert.Equal(t, uint64(2), prunedCount(5, 3))
+	// Records saved during the pruning pass never make the count underflow.
+	assert.Equal(t, uint64(0), prunedCount(3, 5))
+}
@@ -1,18 +1,25 @@
 package kv
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	types "github.com/prysmaticlabs/eth2-types"
 	"github.com/prysmaticlabs/prysm/beacon-chain/core/helpers"
 	"github.com/prysmaticlabs/prysm/shared/bytesutil"
 	"github.com/prysmaticlabs/prysm/shared/params"
+	"github.com/prysmaticlabs/prysm/shared/slashutil"
+	"github.com/prysmaticlabs/prysm/shared/traceutil"
 	bolt "go.etcd.io/bbolt"
 	"go.opencensus.io/trace"
 )
 
+var doubleProposalMessage = "double proposal found, existing proposal at slot %d with conflicting signing root %#x"
+
 // ProposalHistoryForPubkey for a validator public key.
 type ProposalHistoryForPubkey struct {
 	Proposals []Proposal
@@ -24,6 +31,107 @@ type Proposal struct {
 	SigningRoot []byte     `json:"signing_root"`
 }
 
+// ProposalRecord which can be represented by these simple values
+// for manipulation by database methods.
+type ProposalRecord struct {
+	PubKey      [48]byte
+	Slot        types.Slot
+	SigningRoot [32]byte
+}
+
+// NewQueuedProposalRecords constructor allocates the underlying slice and
+// required attributes for managing pending block proposal records.
+func NewQueuedProposalRecords() *QueuedProposalRecords {
+	return &QueuedProposalRecords{
+		records: make([]*ProposalRecord, 0, proposalBatchCapacity),
+	}
+}
+
+// QueuedProposalRecords is a thread-safe struct for managing a queue of
+// block proposal records to save to validator database.
+type QueuedProposalRecords struct {
+	sending  []*ProposalRecord
+	records  []*ProposalRecord
+	flushing []*ProposalRecord
+	lock     sync.RWMutex
+}
+
+// Send marks a record as being sent to the batching routine, which appends it to the
+// queue once received. The record is visible to PendingForPubKey from then on.
+func (p *QueuedProposalRecords) Send(pr *ProposalRecord) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.sending = append(p.sending, pr)
+}
+
+// CancelSend should be called if a record marked by Send is not sent after all.
+func (p *QueuedProposalRecords) CancelSend(pr *ProposalRecord) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.removeSending(pr)
+}
+
+// Append a new block proposal record to the queue.
+func (p *QueuedProposalRecords) Append(pr *ProposalRecord) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.removeSending(pr)
+	p.records = append(p.records, pr)
+}
+
+// Records are received in the order they are sent, so they are usually found first.
+func (p *QueuedProposalRecords) removeSending(pr *ProposalRecord) {
+	for i, sending := range p.sending {
+		if sending == pr {
+			p.sending = append(p.sending[:i], p.sending[i+1:]...)
+			return
+		}
+	}
+}
+
+// Flush all records. This method returns the current pending records and resets
+// the pending records slice. The returned records remain visible to PendingForPubKey
+// until FlushCompleted is called, so they can be checked while being written to the DB.
+func (p *QueuedProposalRecords) Flush() []*ProposalRecord {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	recs := p.records
+	p.flushing = recs
+	p.records = make([]*ProposalRecord, 0, proposalBatchCapacity)
+	return recs
+}
+
+// FlushCompleted should be called once the records returned by Flush have been
+// written to the DB, or queued again after a failed write.
+func (p *QueuedProposalRecords) FlushCompleted() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.flushing = nil
+}
+
+// PendingForPubKey returns the records for a public key which are being sent to the
+// batching routine, queued or currently being flushed, and thus may not be in the DB yet.
+func (p *QueuedProposalRecords) PendingForPubKey(pubKey [48]byte) []*ProposalRecord {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	pending := make([]*ProposalRecord, 0)
+	for _, recs := range [][]*ProposalRecord{p.flushing, p.records, p.sending} {
+		for _, pr := range recs {
+			if pr.PubKey == pubKey {
+				pending = append(pending, pr)
+			}
+		}
+	}
+	return pending
+}
+
+// Len returns the current length of records.
+func (p *QueuedProposalRecords) Len() int {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return len(p.records)
+}
+
 // ProposedPublicKeys retrieves all public keys in our proposals history bucket.
 func (s *Store) ProposedPublicKeys(ctx context.Context) ([][48]byte, error) {
 	ctx, span := trace.StartSpan(ctx, "Validator.ProposedPublicKeys")
@@ -69,7 +177,10 @@ func (s *Store) ProposalHistoryForSlot(ctx context.Context, publicKey [48]byte,
 	return signingRoot, proposalExists, err
 }
 
-// ProposalHistoryForPubKey returns the entire proposal history for a given public key.
+// ProposalHistoryForPubKey returns the entire proposal history for a given public key,
+// in ascending slot order. Slots are stored as big-endian keys, so a cursor scan over
+// the public key's bucket already yields them sorted. A validator which never proposed
+// has an empty history.
 func (s *Store) ProposalHistoryForPubKey(ctx context.Context, publicKey [48]byte) ([]*Proposal, error) {
 	ctx, span := trace.StartSpan(ctx, "Validator.ProposalHistoryForPubKey")
 	defer span.End()
@@ -102,47 +213,309 @@ func (s *Store) SaveProposalHistoryForSlot(ctx context.Context, pubKey [48]byte,
 	ctx, span := trace.StartSpan(ctx, "Validator.SaveProposalHistoryForEpoch")
 	defer span.End()
 
-	err := s.update(func(tx *bolt.Tx) error {
+	return s.update(func(tx *bolt.Tx) error {
+		return saveProposalRecord(tx, pubKey, slot, signingRoot)
+	})
+}
+
+// Saves a list of block proposal records to the database in a single boltDB
+// transaction to minimize write lock contention compared to doing them
+// all in individual, isolated boltDB transactions.
+func (s *Store) saveProposalRecords(ctx context.Context, records []*ProposalRecord) error {
+	ctx, span := trace.StartSpan(ctx, "Validator.saveProposalRecords")
+	defer span.End()
+	return s.update(func(tx *bolt.Tx) error {
+		for _, record := range records {
+			if err := saveProposalRecord(tx, record.PubKey, record.Slot, record.SigningRoot[:]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Saves the signing root of a block proposal at a slot for a validator public key,
+// updating its lowest and highest signed proposal slots.
+func saveProposalRecord(tx *bolt.Tx, pubKey [48]byte, slot types.Slot, signingRoot []byte) error {
+	bucket := tx.Bucket(historicProposalsBucket)
+	valBucket, err := bucket.CreateBucketIfNotExists(pubKey[:])
+	if err != nil {
+		return fmt.Errorf("could not create bucket for public key %#x", pubKey)
+	}
+
+	// If the incoming slot is lower than the lowest signed proposal slot, override.
+	lowestSignedBkt := tx.Bucket(lowestSignedProposalsBucket)
+	lowestSignedProposalBytes := lowestSignedBkt.Get(pubKey[:])
+	var lowestSignedProposalSlot types.Slot
+	if len(lowestSignedProposalBytes) >= 8 {
+		lowestSignedProposalSlot = bytesutil.BytesToSlotBigEndian(lowestSignedProposalBytes)
+	}
+	if len(lowestSignedProposalBytes) == 0 || slot < lowestSignedProposalSlot {
+		if err := lowestSignedBkt.Put(pubKey[:], bytesutil.SlotToBytesBigEndian(slot)); err != nil {
+			return err
+		}
+	}
+
+	// If the incoming slot is higher than the highest signed proposal slot, override.
+	highestSignedBkt := tx.Bucket(highestSignedProposalsBucket)
+	highestSignedProposalBytes := highestSignedBkt.Get(pubKey[:])
+	var highestSignedProposalSlot types.Slot
+	if len(highestSignedProposalBytes) >= 8 {
+		highestSignedProposalSlot = bytesutil.BytesToSlotBigEndian(highestSignedProposalBytes)
+	}
+	if len(highestSignedProposalBytes) == 0 || slot > highestSignedProposalSlot {
+		if err := highestSignedBkt.Put(pubKey[:], bytesutil.SlotToBytesBigEndian(slot)); err != nil {
+			return err
+		}
+	}
+
+	if err := valBucket.Put(bytesutil.SlotToBytesBigEndian(slot), signingRoot); err != nil {
+		return err
+	}
+	return pruneProposalHistoryBySlot(valBucket, slot, false /* keepHighest */)
+}
+
+// CheckSlashableBlockProposal verifies an incoming block proposal is not
+// a double proposal for a validator public key at the given slot. Batched
+// proposals which are not yet written are checked as well.
+func (s *Store) CheckSlashableBlockProposal(
+	ctx context.Context, pubKey [48]byte, signingRoot [32]byte, slot types.Slot,
+) (SlashingKind, error) {
+	ctx, span := trace.StartSpan(ctx, "Validator.CheckSlashableBlockProposal")
+	defer span.End()
+	// A record is only removed from the batch once it has been written, so it is
+	// always visible either here or in the DB view opened below.
+	for _, pr := range s.batchedProposals.PendingForPubKey(pubKey) {
+		if pr.Slot == slot && slashutil.SigningRootsDiffer(pr.SigningRoot, signingRoot) {
+			err := fmt.Errorf(doubleProposalMessage, slot, pr.SigningRoot[:])
+			traceutil.AnnotateError(span, err)
+			return DoubleProposal, err
+		}
+	}
+	var slashKind SlashingKind
+	err := s.view(func(tx *bolt.Tx) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		bucket := tx.Bucket(historicProposalsBucket)
-		valBucket, err := bucket.CreateBucketIfNotExists(pubKey[:])
-		if err != nil {
-			return fmt.Errorf("could not create bucket for public key %#x", pubKey)
+		valBucket := bucket.Bucket(pubKey[:])
+		if valBucket == nil {
+			return nil
+		}
+		existingSigningRoot := valBucket.Get(bytesutil.SlotToBytesBigEndian(slot))
+		if existingSigningRoot == nil {
+			return nil
+		}
+		var existing [32]byte
+		copy(existing[:], existingSigningRoot)
+		if slashutil.SigningRootsDiffer(existing, signingRoot) {
+			slashKind = DoubleProposal
+			return fmt.Errorf(doubleProposalMessage, slot, existingSigningRoot)
 		}
+		return nil
+	})
 
-		// If the incoming slot is lower than the lowest signed proposal slot, override.
-		lowestSignedBkt := tx.Bucket(lowestSignedProposalsBucket)
-		lowestSignedProposalBytes := lowestSignedBkt.Get(pubKey[:])
-		var lowestSignedProposalSlot types.Slot
-		if len(lowestSignedProposalBytes) >= 8 {
-			lowestSignedProposalSlot = bytesutil.BytesToSlotBigEndian(lowestSignedProposalBytes)
+	traceutil.AnnotateError(span, err)
+	return slashKind, err
+}
+
+// ProposalSlotIsSafe returns whether signing a block proposal at a slot with the given
+// signing root is safe for a validator public key and, if not, the kind of slashing it
+// would allow, without saving anything. Signing is unsafe if a proposal with a differing
+// signing root exists at the slot, or, as required by EIP-3076, if the slot is below the
+// lowest signed proposal slot. Batched proposals which are not yet written are taken into
+// account. An error is only returned if the proposal history could not be read.
+func (s *Store) ProposalSlotIsSafe(
+	ctx context.Context, pubKey [48]byte, slot types.Slot, signingRoot [32]byte,
+) (bool, SlashingKind, error) {
+	ctx, span := trace.StartSpan(ctx, "Validator.ProposalSlotIsSafe")
+	defer span.End()
+	existingSigningRoots := make([][32]byte, 0, 1)
+	var lowestSlot types.Slot
+	var lowestExists bool
+	err := s.view(func(tx *bolt.Tx) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
 		}
-		if len(lowestSignedProposalBytes) == 0 || slot < lowestSignedProposalSlot {
-			if err := lowestSignedBkt.Put(pubKey[:], bytesutil.SlotToBytesBigEndian(slot)); err != nil {
-				return err
+		if valBucket := tx.Bucket(historicProposalsBucket).Bucket(pubKey[:]); valBucket != nil {
+			if existing := valBucket.Get(bytesutil.SlotToBytesBigEndian(slot)); existing != nil {
+				existingSigningRoots = append(existingSigningRoots, bytesutil.ToBytes32(existing))
 			}
 		}
+		// 8 because bytesutil.BytesToSlotBigEndian will return 0 if input is less than 8 bytes.
+		if enc := tx.Bucket(lowestSignedProposalsBucket).Get(pubKey[:]); len(enc) >= 8 {
+			lowestSlot, lowestExists = bytesutil.BytesToSlotBigEndian(enc), true
+		}
+		return nil
+	})
+	if err != nil {
+		traceutil.AnnotateError(span, err)
+		return false, NotSlashable, err
+	}
+	for _, pr := range s.batchedProposals.PendingForPubKey(pubKey) {
+		if pr.Slot == slot {
+			existingSigningRoots = append(existingSigningRoots, pr.SigningRoot)
+		}
+		if !lowestExists || pr.Slot < lowestSlot {
+			lowestSlot, lowestExists = pr.Slot, true
+		}
+	}
+	safe, kind := proposalSlotIsSafe(existingSigningRoots, lowestSlot, lowestExists, slot, signingRoot)
+	return safe, kind, nil
+}
 
-		// If the incoming slot is higher than the highest signed proposal slot, override.
-		highestSignedBkt := tx.Bucket(highestSignedProposalsBucket)
-		highestSignedProposalBytes := highestSignedBkt.Get(pubKey[:])
-		var highestSignedProposalSlot types.Slot
-		if len(highestSignedProposalBytes) >= 8 {
-			highestSignedProposalSlot = bytesutil.BytesToSlotBigEndian(highestSignedProposalBytes)
+// Returns whether signing a block proposal at a slot is safe given the signing roots of the
+// proposals already signed at that slot and the lowest signed proposal slot, if any.
+func proposalSlotIsSafe(
+	existingSigningRoots [][32]byte, lowestSlot types.Slot, lowestExists bool, slot types.Slot, signingRoot [32]byte,
+) (bool, SlashingKind) {
+	for _, existing := range existingSigningRoots {
+		if slashutil.SigningRootsDiffer(existing, signingRoot) {
+			return false, DoubleProposal
 		}
-		if len(highestSignedProposalBytes) == 0 || slot > highestSignedProposalSlot {
-			if err := highestSignedBkt.Put(pubKey[:], bytesutil.SlotToBytesBigEndian(slot)); err != nil {
-				return err
-			}
+	}
+	// A proposal at the lowest signed slot itself is either repeated or a double proposal.
+	if lowestExists && slot < lowestSlot {
+		return false, MinimalProtectionViolation
+	}
+	return true, NotSlashable
+}
+
+// SaveBlockProposal saves a block proposal for a validator public key
+// for local validator slashing protection. Block proposals are batched
+// in memory and flushed to the database at regular intervals.
+func (s *Store) SaveBlockProposal(ctx context.Context, pubKey [48]byte, signingRoot [32]byte, slot types.Slot) error {
+	ctx, span := trace.StartSpan(ctx, "Validator.SaveBlockProposal")
+	defer span.End()
+	if s.readOnly {
+		return ErrReadOnly
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	record := &ProposalRecord{
+		PubKey:      pubKey,
+		Slot:        slot,
+		SigningRoot: signingRoot,
+	}
+	// Register to be notified when the flush which writes this very record
+	// to the DB completes, with the result of the save operation.
+	responseChan := s.batchedProposalAcks.register(record)
+	defer s.batchedProposalAcks.cancel(record)
+	// The record is checked by CheckSlashableBlockProposal while waiting in the channel.
+	s.batchedProposals.Send(record)
+	select {
+	case s.batchedProposalsChan <- record:
+	case <-ctx.Done():
+		s.batchedProposals.CancelSend(record)
+		return ctx.Err()
+	}
+	select {
+	case res := <-responseChan:
+		return res.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Meant to run as a background routine, this function flushes batched
+// block proposals to the DB all at once in a single boltDB transaction,
+// either once we have reached the max capacity of batched proposals or
+// once the configured proposal batch write interval has passed.
+func (s *Store) batchProposalWrites(ctx context.Context) {
+	ticker := time.NewTicker(s.proposalBatchWriteInterval)
+	defer ticker.Stop()
+	batch := &recordBatch{
+		recordType: "proposal",
+		capacity:   s.proposalBatchCapacity,
+		numRecords: s.batchedProposals.Len,
+		// Proposals are batched in a single queue.
+		queueLength: s.batchedProposals.Len,
+		flush: func(ctx context.Context, reason string) {
+			s.proposalFlushLock.Lock()
+			defer s.proposalFlushLock.Unlock()
+			s.flushProposalRecords(ctx, s.batchedProposals.Flush(), reason)
+			s.batchedProposals.FlushCompleted()
+		},
+		flushInProgress: &s.batchedProposalsFlushInProgress,
+		metrics:         proposalBatchMetrics,
+	}
+	for {
+		select {
+		case v := <-s.batchedProposalsChan:
+			s.batchedProposals.Append(v)
+			batch.recordQueued(ctx)
+		case <-ticker.C:
+			batch.writeIntervalReached(ctx)
+		case <-ctx.Done():
+			return
 		}
+	}
+}
 
-		if err := valBucket.Put(bytesutil.SlotToBytesBigEndian(slot), signingRoot); err != nil {
-			return err
+// FlushProposalBatch immediately writes all batched block proposal records to the
+// database, waiting for any flush already in progress. If the context is done before
+// the records are written, an error is returned as they may not have been saved.
+func (s *Store) FlushProposalBatch(ctx context.Context) error {
+	ctx, span := trace.StartSpan(ctx, "Validator.FlushProposalBatch")
+	defer span.End()
+	err := flushBatchBeforeDeadline(ctx, "proposal", func() error {
+		s.proposalFlushLock.Lock()
+		defer s.proposalFlushLock.Unlock()
+		// Records may still be waiting in the channel if the batching routine has stopped.
+		for drained := false; !drained; {
+			select {
+			case v := <-s.batchedProposalsChan:
+				s.batchedProposals.Append(v)
+			default:
+				drained = true
+			}
 		}
-		return pruneProposalHistoryBySlot(valBucket, slot)
+		if s.batchedProposals.Len() == 0 {
+			return nil
+		}
+		err := s.flushProposalRecords(ctx, s.batchedProposals.Flush(), flushReasonExplicit)
+		s.batchedProposals.FlushCompleted()
+		return err
 	})
+	traceutil.AnnotateError(span, err)
 	return err
 }
 
+// Flushes a list of batched block proposals to the database and notifies
+// the callers waiting on each of the records of the result of the save operation.
+func (s *Store) flushProposalRecords(ctx context.Context, records []*ProposalRecord, reason string) error {
+	pubKeys := make(map[[48]byte]bool)
+	for _, pr := range records {
+		pubKeys[pr.PubKey] = true
+	}
+	return flushBatchedRecords(
+		"proposal",
+		reason,
+		len(records),
+		len(pubKeys),
+		&s.batchedProposalsFlushInProgress,
+		proposalBatchMetrics,
+		func() error {
+			err := saveWithRetries(ctx, "proposal", func() error {
+				return s.saveProposalRecords(ctx, records)
+			})
+			// If there was any error, retry the records since the TX would have been reverted.
+			if err != nil {
+				for _, pr := range records {
+					s.batchedProposals.Append(pr)
+				}
+			}
+			return err
+		},
+		func(err error) {
+			for _, pr := range records {
+				s.batchedProposalAcks.ack(pr, err)
+			}
+		},
+	)
+}
+
 // LowestSignedProposal returns the lowest signed proposal slot for a validator public key.
 // If no data exists, a boolean of value false is returned.
 func (s *Store) LowestSignedProposal(ctx context.Context, publicKey [48]byte) (types.Slot, bool, error) {
@@ -189,14 +562,21 @@ func (s *Store) HighestSignedProposal(ctx context.Context, publicKey [48]byte) (
 	return highestSignedProposalSlot, exists, err
 }
 
-func pruneProposalHistoryBySlot(valBucket *bolt.Bucket, newestSlot types.Slot) error {
+// Deletes the proposals of a public key which are at least the weak subjectivity period older
+// than the given slot. If keepHighest is set, the highest signed proposal is never deleted, so
+// that a re-proposal at that slot is still detected as a double proposal.
+func pruneProposalHistoryBySlot(valBucket *bolt.Bucket, newestSlot types.Slot, keepHighest bool) error {
+	var highestSlot []byte
+	if keepHighest {
+		highestSlot, _ = valBucket.Cursor().Last()
+	}
 	c := valBucket.Cursor()
 	for k, _ := c.First(); k != nil; k, _ = c.First() {
 		slot := bytesutil.BytesToSlotBigEndian(k)
 		epoch := helpers.SlotToEpoch(slot)
 		newestEpoch := helpers.SlotToEpoch(newestSlot)
 		// Only delete epochs that are older than the weak subjectivity period.
-		if epoch+params.BeaconConfig().WeakSubjectivityPeriod <= newestEpoch {
+		if epoch+params.BeaconConfig().WeakSubjectivityPeriod <= newestEpoch && !bytes.Equal(k, highestSlot) {
 			if err := c.Delete(); err != nil {
 				return errors.Wrapf(err, "could not prune epoch %d in proposal history", epoch)
 			}
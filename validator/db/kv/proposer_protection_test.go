@@ -2,6 +2,7 @@ package kv
 
 import (
 	"context"
+	"sync"
 	"testing"
 
 	types "github.com/prysmaticlabs/eth2-types"
@@ -9,6 +10,7 @@ import (
 	"github.com/prysmaticlabs/prysm/shared/params"
 	"github.com/prysmaticlabs/prysm/shared/testutil/assert"
 	"github.com/prysmaticlabs/prysm/shared/testutil/require"
+	logTest "github.com/sirupsen/logrus/hooks/test"
 )
 
 func TestProposalHistoryForSlot_InitializesNewPubKeys(t *testing.T) {
@@ -78,6 +80,28 @@ func TestSaveProposalHistoryForPubKey_OK(t *testing.T) {
 	require.DeepEqual(t, want[0], proposalHistory[0])
 }
 
+func TestProposalHistoryForPubKey_AscendingSlotOrder(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{3}
+	db := setupDB(t, [][48]byte{pubKey})
+
+	// Slots saved out of order, including slots which differ in their higher bytes.
+	slots := []types.Slot{300, 2, 1 << 16, 255, 256, 0}
+	for _, slot := range slots {
+		root := bytesutil.PadTo(bytesutil.SlotToBytesBigEndian(slot), 32)
+		require.NoError(t, db.SaveProposalHistoryForSlot(ctx, pubKey, slot, root))
+	}
+
+	proposalHistory, err := db.ProposalHistoryForPubKey(ctx, pubKey)
+	require.NoError(t, err)
+	wantSlots := []types.Slot{0, 2, 255, 256, 300, 1 << 16}
+	require.Equal(t, len(wantSlots), len(proposalHistory))
+	for i, proposal := range proposalHistory {
+		assert.Equal(t, wantSlots[i], proposal.Slot)
+		assert.DeepEqual(t, bytesutil.PadTo(bytesutil.SlotToBytesBigEndian(wantSlots[i]), 32), proposal.SigningRoot)
+	}
+}
+
 func TestSaveProposalHistoryForSlot_Overwrites(t *testing.T) {
 	pubkey := [48]byte{0}
 	tests := []struct {
@@ -177,6 +201,228 @@ func TestPruneProposalHistoryBySlot_OK(t *testing.T) {
 	}
 }
 
+func TestStore_CheckSlashableBlockProposal_DoubleProposal(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	tests := []struct {
+		name                string
+		existingSlot        types.Slot
+		existingSigningRoot [32]byte
+		incomingSlot        types.Slot
+		incomingSigningRoot [32]byte
+		want                SlashingKind
+	}{
+		{
+			name:                "different signing root at same slot equals a double proposal",
+			existingSlot:        1,
+			existingSigningRoot: [32]byte{1},
+			incomingSlot:        1,
+			incomingSigningRoot: [32]byte{2},
+			want:                DoubleProposal,
+		},
+		{
+			name:                "same signing root at same slot is safe",
+			existingSlot:        1,
+			existingSigningRoot: [32]byte{1},
+			incomingSlot:        1,
+			incomingSigningRoot: [32]byte{1},
+			want:                NotSlashable,
+		},
+		{
+			name:                "different signing root at different slot is safe",
+			existingSlot:        1,
+			existingSigningRoot: [32]byte{1},
+			incomingSlot:        2,
+			incomingSigningRoot: [32]byte{2},
+			want:                NotSlashable,
+		},
+		{
+			name:                "empty existing signing root at same slot equals a double proposal",
+			existingSlot:        1,
+			existingSigningRoot: [32]byte{},
+			incomingSlot:        1,
+			incomingSigningRoot: [32]byte{},
+			want:                DoubleProposal,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validatorDB := setupDB(t, [][48]byte{pubKey})
+			err := validatorDB.SaveBlockProposal(ctx, pubKey, tt.existingSigningRoot, tt.existingSlot)
+			require.NoError(t, err)
+			slashingKind, err := validatorDB.CheckSlashableBlockProposal(
+				ctx, pubKey, tt.incomingSigningRoot, tt.incomingSlot,
+			)
+			if tt.want != NotSlashable {
+				require.ErrorContains(t, "double proposal found", err)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tt.want, slashingKind)
+		})
+	}
+}
+
+func TestStore_CheckSlashableBlockProposal_NoHistory(t *testing.T) {
+	ctx := context.Background()
+	validatorDB := setupDB(t, [][48]byte{})
+	slashingKind, err := validatorDB.CheckSlashableBlockProposal(ctx, [48]byte{1}, [32]byte{1}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, NotSlashable, slashingKind)
+}
+
+func TestQueuedProposalRecords_PendingForPubKey(t *testing.T) {
+	queue := NewQueuedProposalRecords()
+	queue.Append(&ProposalRecord{PubKey: [48]byte{1}, Slot: 1})
+	queue.Append(&ProposalRecord{PubKey: [48]byte{2}, Slot: 2})
+	assert.Equal(t, 1, len(queue.PendingForPubKey([48]byte{1})))
+
+	// Records being flushed are still pending until the flush completes.
+	queue.Flush()
+	queue.Append(&ProposalRecord{PubKey: [48]byte{1}, Slot: 3})
+	assert.Equal(t, 2, len(queue.PendingForPubKey([48]byte{1})))
+	queue.FlushCompleted()
+	pending := queue.PendingForPubKey([48]byte{1})
+	require.Equal(t, 1, len(pending))
+	assert.Equal(t, types.Slot(3), pending[0].Slot)
+	assert.Equal(t, 0, len(queue.PendingForPubKey([48]byte{3})))
+
+	// Records being sent to the batching routine are pending until appended or cancelled.
+	sent := &ProposalRecord{PubKey: [48]byte{3}, Slot: 4}
+	queue.Send(sent)
+	assert.Equal(t, 1, len(queue.PendingForPubKey([48]byte{3})))
+	queue.Append(sent)
+	assert.Equal(t, 1, len(queue.PendingForPubKey([48]byte{3})))
+	cancelled := &ProposalRecord{PubKey: [48]byte{4}, Slot: 5}
+	queue.Send(cancelled)
+	assert.Equal(t, 1, len(queue.PendingForPubKey([48]byte{4})))
+	queue.CancelSend(cancelled)
+	assert.Equal(t, 0, len(queue.PendingForPubKey([48]byte{4})))
+}
+
+func TestStore_ProposalSlotIsSafe(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	validatorDB := setupDB(t, [][48]byte{pubKey})
+	require.NoError(t, validatorDB.SaveProposalHistoryForSlot(ctx, pubKey, 10, []byte{1}))
+	require.NoError(t, validatorDB.SaveProposalHistoryForSlot(ctx, pubKey, 12, make([]byte, 32)))
+	// A batched proposal which is not written yet.
+	validatorDB.batchedProposals.Append(&ProposalRecord{PubKey: pubKey, Slot: 20, SigningRoot: [32]byte{2}})
+
+	tests := []struct {
+		name        string
+		pubKey      [48]byte
+		slot        types.Slot
+		signingRoot [32]byte
+		want        SlashingKind
+	}{
+		{
+			name:        "same signing root at a signed slot",
+			pubKey:      pubKey,
+			slot:        10,
+			signingRoot: [32]byte{1},
+			want:        NotSlashable,
+		},
+		{
+			name:        "different signing root at a signed slot",
+			pubKey:      pubKey,
+			slot:        10,
+			signingRoot: [32]byte{2},
+			want:        DoubleProposal,
+		},
+		{
+			name:        "empty signing root stored at the slot",
+			pubKey:      pubKey,
+			slot:        12,
+			signingRoot: [32]byte{},
+			want:        DoubleProposal,
+		},
+		{
+			name:        "different signing root at a batched slot",
+			pubKey:      pubKey,
+			slot:        20,
+			signingRoot: [32]byte{3},
+			want:        DoubleProposal,
+		},
+		{
+			name:        "same signing root at a batched slot",
+			pubKey:      pubKey,
+			slot:        20,
+			signingRoot: [32]byte{2},
+			want:        NotSlashable,
+		},
+		{
+			name:        "slot below the lowest signed proposal slot",
+			pubKey:      pubKey,
+			slot:        9,
+			signingRoot: [32]byte{1},
+			want:        MinimalProtectionViolation,
+		},
+		{
+			name:        "unsigned slot between signed slots",
+			pubKey:      pubKey,
+			slot:        11,
+			signingRoot: [32]byte{1},
+			want:        NotSlashable,
+		},
+		{
+			name:        "public key without proposal history",
+			pubKey:      [48]byte{2},
+			slot:        1,
+			signingRoot: [32]byte{1},
+			want:        NotSlashable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			safe, slashingKind, err := validatorDB.ProposalSlotIsSafe(ctx, tt.pubKey, tt.slot, tt.signingRoot)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want == NotSlashable, safe)
+			assert.Equal(t, tt.want, slashingKind)
+		})
+	}
+
+	// Nothing is saved.
+	_, exists, err := validatorDB.ProposalHistoryForSlot(ctx, pubKey, 11)
+	require.NoError(t, err)
+	assert.Equal(t, false, exists)
+}
+
+func TestStore_ProposalSlotIsSafe_BatchedLowestSlot(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	validatorDB := setupDB(t, [][48]byte{pubKey})
+	require.NoError(t, validatorDB.SaveProposalHistoryForSlot(ctx, pubKey, 10, []byte{1}))
+	validatorDB.batchedProposals.Append(&ProposalRecord{PubKey: pubKey, Slot: 5, SigningRoot: [32]byte{5}})
+
+	safe, slashingKind, err := validatorDB.ProposalSlotIsSafe(ctx, pubKey, 7, [32]byte{7})
+	require.NoError(t, err)
+	assert.Equal(t, true, safe)
+	assert.Equal(t, NotSlashable, slashingKind)
+	safe, slashingKind, err = validatorDB.ProposalSlotIsSafe(ctx, pubKey, 4, [32]byte{4})
+	require.NoError(t, err)
+	assert.Equal(t, false, safe)
+	assert.Equal(t, MinimalProtectionViolation, slashingKind)
+}
+
+func TestStore_CheckSlashableBlockProposal_Batched(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	validatorDB := setupDB(t, [][48]byte{pubKey})
+	validatorDB.batchedProposals.Append(&ProposalRecord{PubKey: pubKey, Slot: 5, SigningRoot: [32]byte{5}})
+
+	// A batched proposal which is not yet written is a double proposal for a differing root.
+	slashingKind, err := validatorDB.CheckSlashableBlockProposal(ctx, pubKey, [32]byte{6}, 5)
+	require.ErrorContains(t, "double proposal found", err)
+	assert.Equal(t, DoubleProposal, slashingKind)
+	slashingKind, err = validatorDB.CheckSlashableBlockProposal(ctx, pubKey, [32]byte{5}, 5)
+	require.NoError(t, err)
+	assert.Equal(t, NotSlashable, slashingKind)
+	slashingKind, err = validatorDB.CheckSlashableBlockProposal(ctx, [48]byte{2}, [32]byte{6}, 5)
+	require.NoError(t, err)
+	assert.Equal(t, NotSlashable, slashingKind)
+}
+
 func TestStore_ProposedPublicKeys(t *testing.T) {
 	ctx := context.Background()
 	validatorDB, err := NewKVStore(ctx, t.TempDir(), &Config{})
@@ -281,3 +527,122 @@ func TestStore_HighestSignedProposal(t *testing.T) {
 	require.Equal(t, true, exists)
 	assert.Equal(t, types.Slot(3), slot)
 }
+
+func TestStore_SignedProposalBoundaries_SlotZero(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{3}
+	validatorDB := setupDB(t, [][48]byte{pubKey})
+
+	// A validator which never proposed has no boundaries.
+	_, exists, err := validatorDB.LowestSignedProposal(ctx, pubKey)
+	require.NoError(t, err)
+	require.Equal(t, false, exists)
+	_, exists, err = validatorDB.HighestSignedProposal(ctx, pubKey)
+	require.NoError(t, err)
+	require.Equal(t, false, exists)
+
+	// A proposal at slot zero is reported as existing.
+	require.NoError(t, validatorDB.SaveProposalHistoryForSlot(ctx, pubKey, 0, make([]byte, 32)))
+	slot, exists, err := validatorDB.LowestSignedProposal(ctx, pubKey)
+	require.NoError(t, err)
+	require.Equal(t, true, exists)
+	assert.Equal(t, types.Slot(0), slot)
+	slot, exists, err = validatorDB.HighestSignedProposal(ctx, pubKey)
+	require.NoError(t, err)
+	require.Equal(t, true, exists)
+	assert.Equal(t, types.Slot(0), slot)
+}
+
+func TestSaveBlockProposal_BatchWrites_FullCapacity(t *testing.T) {
+	hook := logTest.NewGlobal()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	numValidators := proposalBatchCapacity
+	pubKeys := make([][48]byte, numValidators)
+	for i := range pubKeys {
+		pubKeys[i] = [48]byte{byte(i)}
+	}
+	validatorDB := setupDB(t, pubKeys)
+
+	// For each public key, we attempt to save a block proposal with signing root.
+	var wg sync.WaitGroup
+	for i, pubKey := range pubKeys {
+		wg.Add(1)
+		go func(slot types.Slot, pk [48]byte, w *sync.WaitGroup) {
+			defer w.Done()
+			err := validatorDB.SaveBlockProposal(ctx, pk, [32]byte{byte(slot)}, slot)
+			require.NoError(t, err)
+		}(types.Slot(i), pubKey, &wg)
+	}
+	wg.Wait()
+
+	// We verify that we reached the max capacity of batched proposals
+	// before we are required to force flush them to the DB.
+	require.LogsContain(t, hook, "Reached max capacity of batched proposal records")
+	require.LogsDoNotContain(t, hook, "Batched proposal records write interval reached")
+	require.LogsContain(t, hook, "Successfully flushed batched proposals to DB")
+	assertFlushLogFields(t, hook, "Successfully flushed batched proposals to DB", flushReasonCapacity)
+	require.Equal(t, 0, validatorDB.batchedProposals.Len())
+
+	// We then verify all the data we wanted to save is indeed saved to disk.
+	for i, pubKey := range pubKeys {
+		signingRoot, exists, err := validatorDB.ProposalHistoryForSlot(ctx, pubKey, types.Slot(i))
+		require.NoError(t, err)
+		require.Equal(t, true, exists)
+		require.Equal(t, [32]byte{byte(i)}, signingRoot)
+	}
+}
+
+func TestSaveBlockProposal_BatchWrites_LowCapacity_TimerReached(t *testing.T) {
+	hook := logTest.NewGlobal()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// Number of validators equal to half the total capacity
+	// of batch proposal processing. This will allow us to
+	// test force flushing to the DB based on a timer instead
+	// of the max capacity being reached.
+	numValidators := proposalBatchCapacity / 2
+	pubKeys := make([][48]byte, numValidators)
+	for i := range pubKeys {
+		pubKeys[i] = [48]byte{byte(i)}
+	}
+	validatorDB := setupDB(t, pubKeys)
+
+	var wg sync.WaitGroup
+	for i, pubKey := range pubKeys {
+		wg.Add(1)
+		go func(slot types.Slot, pk [48]byte, w *sync.WaitGroup) {
+			defer w.Done()
+			err := validatorDB.SaveBlockProposal(ctx, pk, [32]byte{byte(slot)}, slot)
+			require.NoError(t, err)
+		}(types.Slot(i), pubKey, &wg)
+	}
+	wg.Wait()
+
+	// We verify that we reached a timer interval for force flushing records
+	// before we are required to force flush them to the DB.
+	require.LogsDoNotContain(t, hook, "Reached max capacity of batched proposal records")
+	require.LogsContain(t, hook, "Batched proposal records write interval reached")
+	require.LogsContain(t, hook, "Successfully flushed batched proposals to DB")
+	require.Equal(t, 0, validatorDB.batchedProposals.Len())
+
+	for i, pubKey := range pubKeys {
+		signingRoot, exists, err := validatorDB.ProposalHistoryForSlot(ctx, pubKey, types.Slot(i))
+		require.NoError(t, err)
+		require.Equal(t, true, exists)
+		require.Equal(t, [32]byte{byte(i)}, signingRoot)
+		lowest, exists, err := validatorDB.LowestSignedProposal(ctx, pubKey)
+		require.NoError(t, err)
+		require.Equal(t, true, exists)
+		require.Equal(t, types.Slot(i), lowest)
+	}
+}
+
+func TestStore_flushProposalRecords_InProgress(t *testing.T) {
+	s := &Store{}
+	s.batchedProposalsFlushInProgress.Set()
+
+	hook := logTest.NewGlobal()
+	s.flushProposalRecords(context.Background(), nil, flushReasonExplicit)
+	assert.LogsContain(t, hook, "Attempted to flush proposal records when already in progress")
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 
 	types "github.com/prysmaticlabs/eth2-types"
-	"github.com/prysmaticlabs/prysm/shared/bytesutil"
 	"github.com/prysmaticlabs/prysm/shared/params"
 	bolt "go.etcd.io/bbolt"
 	"go.opencensus.io/trace"
@@ -15,15 +14,48 @@ import (
 // target epoch minus some constant of how many epochs we keep track of for slashing
 // protection. This routine is meant to run on startup.
 func (s *Store) PruneAttestations(ctx context.Context) error {
-	ctx, span := trace.StartSpan(ctx, "Validator.PruneAttestations")
+	return s.PruneAttestationsWithPeriod(ctx, params.BeaconConfig().SlashingProtectionPruningEpochs)
+}
+
+// PruneAttestationsWithPeriod prunes, for every public key, all attestation data with
+// epochs more than pruningEpochs behind the highest epoch stored for that key. The
+// lowest signed source and target epochs live in their own buckets and are never
+// pruned, so minimal slashing protection still rejects any surrounding or double vote
+// that would have relied on the removed records.
+func (s *Store) PruneAttestationsWithPeriod(ctx context.Context, pruningEpochs types.Epoch) error {
+	ctx, span := trace.StartSpan(ctx, "Validator.PruneAttestationsWithPeriod")
 	defer span.End()
+	return s.pruneAttestations(ctx, func(highestEpoch types.Epoch) types.Epoch {
+		return pruningEpochCutoff(highestEpoch, pruningEpochs)
+	})
+}
+
+// Prunes, for every public key, all attestation data with epochs more than pruningEpochs
+// behind both the head epoch and the highest epoch stored for that key. Records signed
+// ahead of the head epoch, for example with a wrong clock, thus do not cause records
+// still within the pruning period of the head epoch to be removed.
+func (s *Store) pruneAttestationsAtHead(ctx context.Context, headEpoch, pruningEpochs types.Epoch) error {
+	headCutoff := pruningEpochCutoff(headEpoch, pruningEpochs)
+	return s.pruneAttestations(ctx, func(highestEpoch types.Epoch) types.Epoch {
+		if cutoff := pruningEpochCutoff(highestEpoch, pruningEpochs); cutoff < headCutoff {
+			return cutoff
+		}
+		return headCutoff
+	})
+}
+
+// Returns the epoch before which attestation data is pruned, given the highest epoch of a bucket.
+type pruningCutoffFunc func(highestEpoch types.Epoch) types.Epoch
+
+// Prunes the attestation data of every public key, each in its own transaction.
+func (s *Store) pruneAttestations(ctx context.Context, cutoff pruningCutoffFunc) error {
 	var pubkeys [][]byte
 	err := s.view(func(tx *bolt.Tx) error {
 		bucket := tx.Bucket(pubKeysBucket)
 		return bucket.ForEach(func(pubKey []byte, _ []byte) error {
 			key := make([]byte, len(pubKey))
 			copy(key, pubKey)
-			pubkeys = append(pubkeys, pubKey)
+			pubkeys = append(pubkeys, key)
 			return nil
 		})
 	})
@@ -31,19 +63,25 @@ func (s *Store) PruneAttestations(ctx context.Context) error {
 		return err
 	}
 	for _, k := range pubkeys {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		err = s.update(func(tx *bolt.Tx) error {
 			bucket := tx.Bucket(pubKeysBucket)
 			pkBucket := bucket.Bucket(k)
 			if pkBucket == nil {
 				return nil
 			}
-			if err := pruneSourceEpochsBucket(pkBucket); err != nil {
+			if err := s.pruneSourceEpochsBucket(pkBucket, cutoff); err != nil {
+				return err
+			}
+			if err := s.pruneTargetEpochsBucket(pkBucket, cutoff); err != nil {
 				return err
 			}
-			if err := pruneTargetEpochsBucket(pkBucket); err != nil {
+			if err := s.pruneSequentialRunsBucket(pkBucket, cutoff); err != nil {
 				return err
 			}
-			return pruneSigningRootsBucket(pkBucket)
+			return s.pruneSigningRootsBucket(pkBucket, cutoff)
 		})
 		if err != nil {
 			return err
@@ -52,48 +90,63 @@ func (s *Store) PruneAttestations(ctx context.Context) error {
 	return nil
 }
 
-func pruneSourceEpochsBucket(bucket *bolt.Bucket) error {
-	sourceEpochsBucket := bucket.Bucket(attestationSourceEpochsBucket)
+// Source and target epochs held by sequential runs count towards the highest epochs of the
+// source and target epochs buckets, so that histories are pruned alike whether compacted or not.
+func (s *Store) pruneSourceEpochsBucket(bucket *bolt.Bucket, cutoff pruningCutoffFunc) error {
+	sourceEpochsBucket := bucket.Bucket(s.epochKeys.sourceEpochsBucket)
 	if sourceEpochsBucket == nil {
 		return nil
 	}
 
-	return pruneBucket(sourceEpochsBucket)
+	highestSourceBytes, _ := sourceEpochsBucket.Cursor().Last()
+	highestSource := s.epochKeys.decode(highestSourceBytes)
+	if run, ok := s.lastSequentialRun(bucket); ok && run.end-1 > highestSource {
+		highestSource = run.end - 1
+	}
+	return s.pruneBucketBefore(sourceEpochsBucket, cutoff(highestSource))
 }
 
-func pruneTargetEpochsBucket(bucket *bolt.Bucket) error {
-	targetEpochsBucket := bucket.Bucket(attestationTargetEpochsBucket)
+func (s *Store) pruneTargetEpochsBucket(bucket *bolt.Bucket, cutoff pruningCutoffFunc) error {
+	targetEpochsBucket := bucket.Bucket(s.epochKeys.targetEpochsBucket)
 	if targetEpochsBucket == nil {
 		return nil
 	}
 
-	return pruneBucket(targetEpochsBucket)
+	highestTargetBytes, _ := targetEpochsBucket.Cursor().Last()
+	highestTarget := s.epochKeys.decode(highestTargetBytes)
+	if run, ok := s.lastSequentialRun(bucket); ok && run.end > highestTarget {
+		highestTarget = run.end
+	}
+	return s.pruneBucketBefore(targetEpochsBucket, cutoff(highestTarget))
 }
 
-func pruneSigningRootsBucket(bucket *bolt.Bucket) error {
-	signingRootsBucket := bucket.Bucket(attestationSigningRootsBucket)
+func (s *Store) pruneSigningRootsBucket(bucket *bolt.Bucket, cutoff pruningCutoffFunc) error {
+	signingRootsBucket := bucket.Bucket(s.epochKeys.signingRootsBucket)
 	if signingRootsBucket == nil {
 		return nil
 	}
 
-	return pruneBucket(signingRootsBucket)
+	return s.pruneBucket(signingRootsBucket, cutoff)
 }
 
 // pruneBucket iterates through epoch keys and deletes any key/value lower than
 // the pruning cut off epoch as determined by the highest key in the bucket.
-func pruneBucket(bkt *bolt.Bucket) error {
+func (s *Store) pruneBucket(bkt *bolt.Bucket, cutoff pruningCutoffFunc) error {
 	if bkt == nil {
 		return nil
 	}
 
 	// We obtain the highest target epoch from the signing roots bucket.
 	highestEpochBytes, _ := bkt.Cursor().Last()
-	highestEpoch := bytesutil.BytesToEpochBigEndian(highestEpochBytes)
-	upperBounds := pruningEpochCutoff(highestEpoch)
+	highestEpoch := s.epochKeys.decode(highestEpochBytes)
+	return s.pruneBucketBefore(bkt, cutoff(highestEpoch))
+}
 
+// Deletes any key/value of a bucket with an epoch key lower than the given upper bound.
+func (s *Store) pruneBucketBefore(bkt *bolt.Bucket, upperBounds types.Epoch) error {
 	c := bkt.Cursor()
 	for k, _ := c.First(); k != nil; k, _ = c.Next() {
-		targetEpoch := bytesutil.BytesToEpochBigEndian(k)
+		targetEpoch := s.epochKeys.decode(k)
 		if targetEpoch >= upperBounds {
 			return nil
 		}
@@ -107,12 +160,12 @@ func pruneBucket(bkt *bolt.Bucket) error {
 
 // This helper function determines the cutoff epoch where, for all epochs before it, we should prune
 // the slashing protection database. This is computed by taking in an epoch and subtracting
-// SLASHING_PROTECTION_PRUNING_EPOCHS from the value. For example, if we are keeping track of 512 epochs
+// the number of pruning epochs from the value. For example, if we are keeping track of 512 epochs
 // in the database, if we pass in epoch 612, then we want to prune all epochs before epoch 100.
-func pruningEpochCutoff(epoch types.Epoch) types.Epoch {
+func pruningEpochCutoff(epoch, pruningEpochs types.Epoch) types.Epoch {
 	minEpoch := types.Epoch(0)
-	if epoch > params.BeaconConfig().SlashingProtectionPruningEpochs {
-		minEpoch = epoch - params.BeaconConfig().SlashingProtectionPruningEpochs
+	if epoch > pruningEpochs {
+		minEpoch = epoch - pruningEpochs
 	}
 	return minEpoch
 }
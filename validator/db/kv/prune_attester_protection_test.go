@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	types "github.com/prysmaticlabs/eth2-types"
+	ethpb "github.com/prysmaticlabs/prysm/proto/eth/v1alpha1"
 	"github.com/prysmaticlabs/prysm/shared/bytesutil"
 	"github.com/prysmaticlabs/prysm/shared/params"
 	"github.com/prysmaticlabs/prysm/shared/testutil/require"
@@ -87,6 +88,45 @@ func TestPruneAttestations_OK(t *testing.T) {
 	}
 }
 
+func TestPruneAttestationsWithPeriod_PreservesSlashingProtection(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	validatorDB := setupDB(t, [][48]byte{pubKey})
+
+	pruningEpochs := types.Epoch(16)
+	numEpochs := pruningEpochs * 4
+	atts := make([]*ethpb.IndexedAttestation, 0, numEpochs)
+	signingRoots := make([][32]byte, 0, numEpochs)
+	for sourceEpoch := types.Epoch(0); sourceEpoch < numEpochs; sourceEpoch++ {
+		atts = append(atts, createAttestation(sourceEpoch, sourceEpoch+1))
+		var signingRoot [32]byte
+		copy(signingRoot[:], fmt.Sprintf("%d", bytesutil.EpochToBytesBigEndian(sourceEpoch+1)))
+		signingRoots = append(signingRoots, signingRoot)
+	}
+	require.NoError(t, validatorDB.SaveAttestationsForPubKey(ctx, pubKey, signingRoots, atts))
+	require.NoError(t, validatorDB.PruneAttestationsWithPeriod(ctx, pruningEpochs))
+
+	// Old history is gone while the most recent pruning window is kept.
+	require.NoError(t, checkAttestingHistoryAfterPruning(t, validatorDB, pubKey, 0, numEpochs-pruningEpochs-1, true))
+	require.NoError(t, checkAttestingHistoryAfterPruning(t, validatorDB, pubKey, numEpochs-pruningEpochs, numEpochs, false))
+
+	// The lowest signed epochs are never pruned.
+	lowestSource, exists, err := validatorDB.LowestSignedSourceEpoch(ctx, pubKey)
+	require.NoError(t, err)
+	require.Equal(t, true, exists)
+	require.Equal(t, types.Epoch(0), lowestSource)
+	lowestTarget, exists, err := validatorDB.LowestSignedTargetEpoch(ctx, pubKey)
+	require.NoError(t, err)
+	require.Equal(t, true, exists)
+	require.Equal(t, types.Epoch(1), lowestTarget)
+
+	// A vote surrounding the retained history must still be caught.
+	surrounding := createAttestation(numEpochs-pruningEpochs, numEpochs+1)
+	slashingKind, err := validatorDB.CheckSlashableAttestation(ctx, pubKey, [32]byte{}, surrounding)
+	require.NotNil(t, err)
+	require.Equal(t, SurroundingVote, slashingKind)
+}
+
 func BenchmarkPruneAttestations(b *testing.B) {
 	numKeys := uint64(8)
 	pks := make([][48]byte, 0, numKeys)
@@ -111,6 +151,38 @@ func BenchmarkPruneAttestations(b *testing.B) {
 	}
 }
 
+func BenchmarkPruneAttestationsWithPeriod_BoundedSize(b *testing.B) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	validatorDB := setupDB(b, [][48]byte{pubKey})
+
+	// Simulate a long running validator which attests once per epoch and
+	// periodically prunes its history. The database should not grow past
+	// the size needed for a single pruning window.
+	pruningEpochs := params.BeaconConfig().SlashingProtectionPruningEpochs
+	epochsPerRun := pruningEpochs * 2
+	var signingRoot [32]byte
+	var maxSize int64
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		start := types.Epoch(i) * epochsPerRun
+		atts := make([]*ethpb.IndexedAttestation, 0, epochsPerRun)
+		signingRoots := make([][32]byte, 0, epochsPerRun)
+		for sourceEpoch := start; sourceEpoch < start+epochsPerRun; sourceEpoch++ {
+			atts = append(atts, createAttestation(sourceEpoch, sourceEpoch+1))
+			signingRoots = append(signingRoots, signingRoot)
+		}
+		require.NoError(b, validatorDB.SaveAttestationsForPubKey(ctx, pubKey, signingRoots, atts))
+		require.NoError(b, validatorDB.PruneAttestationsWithPeriod(ctx, pruningEpochs))
+		size, err := validatorDB.Size()
+		require.NoError(b, err)
+		if size > maxSize {
+			maxSize = size
+		}
+	}
+	b.ReportMetric(float64(maxSize), "max-db-bytes")
+}
+
 // Saves attesting history for every (source, target = source + 1) pairs since genesis
 // up to a given number of epochs for a validator public key.
 func setupAttestationsForEveryEpoch(t testing.TB, validatorDB *Store, pubKey [48]byte, numEpochs types.Epoch) error {
@@ -0,0 +1,48 @@
+package kv
+
+import (
+	"context"
+
+	types "github.com/prysmaticlabs/eth2-types"
+	bolt "go.etcd.io/bbolt"
+	"go.opencensus.io/trace"
+)
+
+// PruneProposals loops through every public key in the proposal history bucket and
+// deletes all proposals with slots older than the weak subjectivity period behind the
+// current slot. The highest signed proposal of each public key is always retained, so
+// a re-proposal at that slot is still detected as a double proposal. Each public key
+// is pruned in its own transaction.
+func (s *Store) PruneProposals(ctx context.Context, currentSlot types.Slot) error {
+	ctx, span := trace.StartSpan(ctx, "Validator.PruneProposals")
+	defer span.End()
+	var pubKeys [][]byte
+	err := s.view(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(historicProposalsBucket)
+		return bucket.ForEach(func(pubKey []byte, _ []byte) error {
+			key := make([]byte, len(pubKey))
+			copy(key, pubKey)
+			pubKeys = append(pubKeys, key)
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	for _, pubKey := range pubKeys {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		err = s.update(func(tx *bolt.Tx) error {
+			valBucket := tx.Bucket(historicProposalsBucket).Bucket(pubKey)
+			if valBucket == nil {
+				return nil
+			}
+			return pruneProposalHistoryBySlot(valBucket, currentSlot, true /* keepHighest */)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package kv
+
+import (
+	"context"
+	"testing"
+
+	types "github.com/prysmaticlabs/eth2-types"
+	"github.com/prysmaticlabs/prysm/shared/params"
+	"github.com/prysmaticlabs/prysm/shared/testutil/assert"
+	"github.com/prysmaticlabs/prysm/shared/testutil/require"
+)
+
+func TestPruneProposals_KeepsHighestSignedSlot(t *testing.T) {
+	ctx := context.Background()
+	slotsPerEpoch := params.BeaconConfig().SlotsPerEpoch
+	wsPeriod := params.BeaconConfig().WeakSubjectivityPeriod
+	oldKey, recentKey := [48]byte{1}, [48]byte{2}
+	validatorDB := setupDB(t, [][48]byte{oldKey, recentKey})
+
+	signingRoot := [32]byte{1}
+	currentSlot := types.Slot(wsPeriod+10) * slotsPerEpoch
+	recentSlot := currentSlot - slotsPerEpoch
+	for _, slot := range []types.Slot{5, 10} {
+		require.NoError(t, validatorDB.SaveProposalHistoryForSlot(ctx, oldKey, slot, signingRoot[:]))
+	}
+	for _, slot := range []types.Slot{5, recentSlot} {
+		require.NoError(t, validatorDB.SaveProposalHistoryForSlot(ctx, recentKey, slot, signingRoot[:]))
+	}
+
+	require.NoError(t, validatorDB.PruneProposals(ctx, currentSlot))
+
+	// Only the highest signed slot survives for a validator whose proposals are all old.
+	proposals, err := validatorDB.ProposalHistoryForPubKey(ctx, oldKey)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(proposals))
+	assert.Equal(t, types.Slot(10), proposals[0].Slot)
+
+	// Proposals within the weak subjectivity period are kept.
+	proposals, err = validatorDB.ProposalHistoryForPubKey(ctx, recentKey)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(proposals))
+	assert.Equal(t, recentSlot, proposals[0].Slot)
+
+	// The retained highest slot still blocks a re-proposal with a different signing root.
+	slashingKind, err := validatorDB.CheckSlashableBlockProposal(ctx, oldKey, [32]byte{2}, 10)
+	require.ErrorContains(t, "double proposal found", err)
+	assert.Equal(t, DoubleProposal, slashingKind)
+	slashingKind, err = validatorDB.CheckSlashableBlockProposal(ctx, oldKey, [32]byte{2}, 5)
+	require.NoError(t, err)
+	assert.Equal(t, NotSlashable, slashingKind)
+}
+
+func TestPruneProposals_NoPruning(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	validatorDB := setupDB(t, [][48]byte{pubKey})
+
+	signingRoot := [32]byte{1}
+	slots := []types.Slot{1, 2, 3}
+	for _, slot := range slots {
+		require.NoError(t, validatorDB.SaveProposalHistoryForSlot(ctx, pubKey, slot, signingRoot[:]))
+	}
+	require.NoError(t, validatorDB.PruneProposals(ctx, 100))
+
+	proposals, err := validatorDB.ProposalHistoryForPubKey(ctx, pubKey)
+	require.NoError(t, err)
+	require.Equal(t, len(slots), len(proposals))
+}
@@ -0,0 +1,280 @@
+package kv
+
+import (
+	"context"
+	"sort"
+
+	types "github.com/prysmaticlabs/eth2-types"
+	"github.com/prysmaticlabs/prysm/shared/bytesutil"
+	"github.com/prysmaticlabs/prysm/shared/params"
+	bolt "go.etcd.io/bbolt"
+	"go.opencensus.io/trace"
+)
+
+// DiscrepancyKind is the way in which the attesting history of a public key differs
+// from the history reported by an external signer.
+type DiscrepancyKind int
+
+// Kinds of discrepancies between the local and an external attesting history.
+const (
+	// TargetMissingLocally is an attestation of the external history at a target
+	// epoch for which no attestation is stored locally.
+	TargetMissingLocally DiscrepancyKind = iota
+	// TargetMissingExternally is an attestation stored locally at a target epoch
+	// for which the external history holds no attestation.
+	TargetMissingExternally
+	// SourceEpochMismatch is an attestation of the external history whose source epoch
+	// differs from that of every attestation stored locally at the same target epoch.
+	SourceEpochMismatch
+	// SigningRootMismatch is an attestation of the external history whose signing root
+	// differs from every signing root stored locally at the same target epoch.
+	SigningRootMismatch
+	// LowestSignedSourceMismatch is a lowest signed source epoch which differs.
+	LowestSignedSourceMismatch
+	// LowestSignedTargetMismatch is a lowest signed target epoch which differs.
+	LowestSignedTargetMismatch
+	// HighestSignedTargetMismatch is a highest signed target epoch which differs.
+	HighestSignedTargetMismatch
+)
+
+// Discrepancy between the local attesting history of a public key and an external one.
+type Discrepancy struct {
+	Kind DiscrepancyKind
+	// TargetEpoch of the attestations compared. It is not set for the signed epoch bounds.
+	TargetEpoch types.Epoch
+	// LocalEpoch and ExternalEpoch are the differing source epochs or signed epoch bounds.
+	LocalEpoch    types.Epoch
+	ExternalEpoch types.Epoch
+	// LocalSigningRoots and ExternalSigningRoot are the signing roots of the attestations at
+	// the target epoch, if any. Several signing roots are stored if all of them are kept.
+	LocalSigningRoots   [][32]byte
+	ExternalSigningRoot [32]byte
+}
+
+// Attestations stored locally at a target epoch.
+type localTargetRecords struct {
+	sources      []types.Epoch
+	signingRoots [][32]byte
+}
+
+// ReconcileWithExternalHistory compares the attesting history of a public key with the one
+// reported by an external signer which also tracks slashing protection, such as a remote
+// signer, and returns every discrepancy between them, so that operators can audit both before
+// trusting either. The external records are taken as the history of the given public key.
+//
+// The signed epoch bounds are compared when both histories have some, followed by the
+// attestations at every target epoch in ascending order. A missing signing root on either
+// side does not differ from a known one. History pruned on one side only shows up as missing
+// targets. With minimal slashing protection, only the signed epoch bounds are compared. Batched
+// records which are not yet written are part of the local history. Nothing is modified.
+func (s *Store) ReconcileWithExternalHistory(
+	ctx context.Context, pubKey [48]byte, external []*AttestationRecord,
+) ([]*Discrepancy, error) {
+	ctx, span := trace.StartSpan(ctx, "Validator.ReconcileWithExternalHistory")
+	defer span.End()
+
+	var lowestSource, lowestTarget, highestTarget types.Epoch
+	var hasLowestSource, hasLowestTarget, hasHighestTarget bool
+	local := make(map[types.Epoch]*localTargetRecords)
+	err := s.view(func(tx *bolt.Tx) error {
+		// 8 because bytesutil.BytesToEpochBigEndian will return 0 if input is less than 8 bytes.
+		if enc := tx.Bucket(lowestSignedSourceBucket).Get(pubKey[:]); len(enc) >= 8 {
+			lowestSource, hasLowestSource = bytesutil.BytesToEpochBigEndian(enc), true
+		}
+		if enc := tx.Bucket(lowestSignedTargetBucket).Get(pubKey[:]); len(enc) >= 8 {
+			lowestTarget, hasLowestTarget = bytesutil.BytesToEpochBigEndian(enc), true
+		}
+		highestTarget, hasHighestTarget = s.highestSignedTargetEpoch(tx, pubKey)
+		if s.minimalSlashingProtection {
+			return nil
+		}
+		pkBucket := tx.Bucket(pubKeysBucket).Bucket(pubKey[:])
+		if pkBucket == nil {
+			return nil
+		}
+		signingRootsBucket := pkBucket.Bucket(s.epochKeys.signingRootsBucket)
+		addLocalRecord := func(source, target types.Epoch) {
+			records := localRecordsAt(local, target)
+			records.sources = append(records.sources, source)
+			if records.signingRoots == nil && signingRootsBucket != nil {
+				records.signingRoots = decodeSigningRoots(s.epochKeys.get(signingRootsBucket, target))
+			}
+		}
+		if sourceEpochsBucket := pkBucket.Bucket(s.epochKeys.sourceEpochsBucket); sourceEpochsBucket != nil {
+			if err := sourceEpochsBucket.ForEach(func(sourceBytes, targetEpochsList []byte) error {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				source := s.epochKeys.decode(sourceBytes)
+				for _, target := range s.epochKeys.decodeList(targetEpochsList) {
+					addLocalRecord(source, target)
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+		}
+		for _, run := range s.sequentialRuns(pkBucket) {
+			for source := run.start; source < run.end; source++ {
+				addLocalRecord(source, source+1)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, ar := range s.attestationBatchFor(pubKey).records.PendingForPubKey(pubKey) {
+		if !hasLowestSource || ar.Source < lowestSource {
+			lowestSource, hasLowestSource = ar.Source, true
+		}
+		if !hasLowestTarget || ar.Target < lowestTarget {
+			lowestTarget, hasLowestTarget = ar.Target, true
+		}
+		if !hasHighestTarget || ar.Target > highestTarget {
+			highestTarget, hasHighestTarget = ar.Target, true
+		}
+		if s.minimalSlashingProtection {
+			continue
+		}
+		records := localRecordsAt(local, ar.Target)
+		records.sources = append(records.sources, ar.Source)
+		records.signingRoots = append(records.signingRoots, ar.SigningRoot)
+	}
+
+	discrepancies := make([]*Discrepancy, 0)
+	if len(external) > 0 {
+		externalLowestSource, externalLowestTarget := external[0].Source, external[0].Target
+		externalHighestTarget := external[0].Target
+		for _, ar := range external[1:] {
+			if ar.Source < externalLowestSource {
+				externalLowestSource = ar.Source
+			}
+			if ar.Target < externalLowestTarget {
+				externalLowestTarget = ar.Target
+			}
+			if ar.Target > externalHighestTarget {
+				externalHighestTarget = ar.Target
+			}
+		}
+		bounds := []struct {
+			kind     DiscrepancyKind
+			exists   bool
+			local    types.Epoch
+			external types.Epoch
+		}{
+			{LowestSignedSourceMismatch, hasLowestSource, lowestSource, externalLowestSource},
+			{LowestSignedTargetMismatch, hasLowestTarget, lowestTarget, externalLowestTarget},
+			{HighestSignedTargetMismatch, hasHighestTarget, highestTarget, externalHighestTarget},
+		}
+		for _, b := range bounds {
+			if b.exists && b.local != b.external {
+				discrepancies = append(discrepancies, &Discrepancy{
+					Kind:          b.kind,
+					LocalEpoch:    b.local,
+					ExternalEpoch: b.external,
+				})
+			}
+		}
+	}
+	if s.minimalSlashingProtection {
+		return discrepancies, nil
+	}
+
+	externalTargets := make(map[types.Epoch]bool, len(external))
+	sortedExternal := make([]*AttestationRecord, len(external))
+	copy(sortedExternal, external)
+	sort.SliceStable(sortedExternal, func(i, j int) bool {
+		return sortedExternal[i].Target < sortedExternal[j].Target
+	})
+	for _, ar := range sortedExternal {
+		externalTargets[ar.Target] = true
+		records, ok := local[ar.Target]
+		if !ok {
+			discrepancies = append(discrepancies, &Discrepancy{
+				Kind:                TargetMissingLocally,
+				TargetEpoch:         ar.Target,
+				ExternalEpoch:       ar.Source,
+				ExternalSigningRoot: ar.SigningRoot,
+			})
+			continue
+		}
+		if !containsEpoch(records.sources, ar.Source) {
+			discrepancies = append(discrepancies, &Discrepancy{
+				Kind:                SourceEpochMismatch,
+				TargetEpoch:         ar.Target,
+				LocalEpoch:          records.sources[0],
+				ExternalEpoch:       ar.Source,
+				LocalSigningRoots:   records.signingRoots,
+				ExternalSigningRoot: ar.SigningRoot,
+			})
+		}
+		if signingRootDiffersFromAll(records.signingRoots, ar.SigningRoot) {
+			discrepancies = append(discrepancies, &Discrepancy{
+				Kind:                SigningRootMismatch,
+				TargetEpoch:         ar.Target,
+				LocalEpoch:          records.sources[0],
+				ExternalEpoch:       ar.Source,
+				LocalSigningRoots:   records.signingRoots,
+				ExternalSigningRoot: ar.SigningRoot,
+			})
+		}
+	}
+	localTargets := make([]types.Epoch, 0, len(local))
+	for target := range local {
+		if !externalTargets[target] {
+			localTargets = append(localTargets, target)
+		}
+	}
+	sort.Slice(localTargets, func(i, j int) bool {
+		return localTargets[i] < localTargets[j]
+	})
+	for _, target := range localTargets {
+		discrepancies = append(discrepancies, &Discrepancy{
+			Kind:              TargetMissingExternally,
+			TargetEpoch:       target,
+			LocalEpoch:        local[target].sources[0],
+			LocalSigningRoots: local[target].signingRoots,
+		})
+	}
+	return discrepancies, nil
+}
+
+// Returns the attestations stored locally at a target epoch, adding them if missing.
+func localRecordsAt(local map[types.Epoch]*localTargetRecords, target types.Epoch) *localTargetRecords {
+	records, ok := local[target]
+	if !ok {
+		records = &localTargetRecords{}
+		local[target] = records
+	}
+	return records
+}
+
+func containsEpoch(epochs []types.Epoch, epoch types.Epoch) bool {
+	for _, e := range epochs {
+		if e == epoch {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if a signing root is known and differs from every known signing root of a list.
+// Missing signing roots, stored as the zero hash, do not differ from any signing root.
+func signingRootDiffersFromAll(signingRoots [][32]byte, signingRoot [32]byte) bool {
+	zeroHash := params.BeaconConfig().ZeroHash
+	if signingRoot == zeroHash {
+		return false
+	}
+	known := false
+	for _, sr := range signingRoots {
+		if sr == zeroHash {
+			continue
+		}
+		if sr == signingRoot {
+			return false
+		}
+		known = true
+	}
+	return known
+}
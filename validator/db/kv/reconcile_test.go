@@ -0,0 +1,111 @@
+package kv
+
+import (
+	"context"
+	"testing"
+
+	types "github.com/prysmaticlabs/eth2-types"
+	"github.com/prysmaticlabs/prysm/shared/testutil/assert"
+	"github.com/prysmaticlabs/prysm/shared/testutil/require"
+)
+
+func TestStore_ReconcileWithExternalHistory(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	validatorDB := setupDB(t, [][48]byte{pubKey})
+	require.NoError(t, validatorDB.saveAttestationRecords(ctx, []*AttestationRecord{
+		{PubKey: pubKey, Source: 1, Target: 2, SigningRoot: [32]byte{2}},
+		{PubKey: pubKey, Source: 2, Target: 3, SigningRoot: [32]byte{3}},
+		{PubKey: pubKey, Source: 3, Target: 4, SigningRoot: [32]byte{4}},
+		{PubKey: pubKey, Source: 4, Target: 5},
+	}))
+
+	// Identical histories, in any order, have no discrepancies.
+	discrepancies, err := validatorDB.ReconcileWithExternalHistory(ctx, pubKey, []*AttestationRecord{
+		{Source: 4, Target: 5, SigningRoot: [32]byte{5}},
+		{Source: 1, Target: 2, SigningRoot: [32]byte{2}},
+		{Source: 3, Target: 4},
+		{Source: 2, Target: 3, SigningRoot: [32]byte{3}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(discrepancies))
+
+	external := []*AttestationRecord{
+		{Source: 0, Target: 1, SigningRoot: [32]byte{1}},
+		{Source: 1, Target: 3, SigningRoot: [32]byte{3}},
+		{Source: 3, Target: 4, SigningRoot: [32]byte{5}},
+	}
+	discrepancies, err = validatorDB.ReconcileWithExternalHistory(ctx, pubKey, external)
+	require.NoError(t, err)
+	want := []*Discrepancy{
+		{Kind: LowestSignedSourceMismatch, LocalEpoch: 1, ExternalEpoch: 0},
+		{Kind: LowestSignedTargetMismatch, LocalEpoch: 2, ExternalEpoch: 1},
+		{Kind: HighestSignedTargetMismatch, LocalEpoch: 5, ExternalEpoch: 4},
+		{Kind: TargetMissingLocally, TargetEpoch: 1, ExternalEpoch: 0, ExternalSigningRoot: [32]byte{1}},
+		{
+			Kind:                SourceEpochMismatch,
+			TargetEpoch:         3,
+			LocalEpoch:          2,
+			ExternalEpoch:       1,
+			LocalSigningRoots:   [][32]byte{{3}},
+			ExternalSigningRoot: [32]byte{3},
+		},
+		{
+			Kind:                SigningRootMismatch,
+			TargetEpoch:         4,
+			LocalEpoch:          3,
+			ExternalEpoch:       3,
+			LocalSigningRoots:   [][32]byte{{4}},
+			ExternalSigningRoot: [32]byte{5},
+		},
+		{Kind: TargetMissingExternally, TargetEpoch: 2, LocalEpoch: 1, LocalSigningRoots: [][32]byte{{2}}},
+		{Kind: TargetMissingExternally, TargetEpoch: 5, LocalEpoch: 4, LocalSigningRoots: [][32]byte{{}}},
+	}
+	require.DeepEqual(t, want, discrepancies)
+
+	// Nothing is modified.
+	history, err := validatorDB.AttestationHistoryForPubKey(ctx, pubKey)
+	require.NoError(t, err)
+	assert.Equal(t, 4, len(history))
+	lowestSource, _, err := validatorDB.LowestSignedSourceEpoch(ctx, pubKey)
+	require.NoError(t, err)
+	assert.Equal(t, types.Epoch(1), lowestSource)
+}
+
+func TestStore_ReconcileWithExternalHistory_BatchedRecords(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	validatorDB := setupDB(t, [][48]byte{pubKey})
+	require.NoError(t, validatorDB.saveAttestationRecords(ctx, []*AttestationRecord{
+		{PubKey: pubKey, Source: 1, Target: 2, SigningRoot: [32]byte{2}},
+	}))
+	validatorDB.attestationBatchFor(pubKey).records.Append(&AttestationRecord{
+		PubKey: pubKey, Source: 2, Target: 3, SigningRoot: [32]byte{3},
+	})
+
+	discrepancies, err := validatorDB.ReconcileWithExternalHistory(ctx, pubKey, []*AttestationRecord{
+		{Source: 1, Target: 2, SigningRoot: [32]byte{2}},
+		{Source: 2, Target: 3, SigningRoot: [32]byte{3}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(discrepancies))
+}
+
+func TestStore_ReconcileWithExternalHistory_MinimalSlashingProtection(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	validatorDB := setupDBWithConfig(t, &Config{PubKeys: [][48]byte{pubKey}, MinimalSlashingProtection: true})
+	require.NoError(t, validatorDB.SaveAttestationForPubKey(ctx, pubKey, [32]byte{1}, createAttestation(3, 4)))
+
+	// Only the signed epoch bounds are compared.
+	discrepancies, err := validatorDB.ReconcileWithExternalHistory(ctx, pubKey, []*AttestationRecord{
+		{Source: 1, Target: 2, SigningRoot: [32]byte{2}},
+		{Source: 3, Target: 4, SigningRoot: [32]byte{1}},
+	})
+	require.NoError(t, err)
+	want := []*Discrepancy{
+		{Kind: LowestSignedSourceMismatch, LocalEpoch: 3, ExternalEpoch: 1},
+		{Kind: LowestSignedTargetMismatch, LocalEpoch: 4, ExternalEpoch: 2},
+	}
+	require.DeepEqual(t, want, discrepancies)
+}
@@ -12,6 +12,9 @@ var (
 	lowestSignedSourceBucket = []byte("lowest-signed-source-bucket")
 	lowestSignedTargetBucket = []byte("lowest-signed-target-bucket")
 
+	// Highest signed target epoch for individual validator, used by minimal slashing protection.
+	highestSignedTargetBucket = []byte("highest-signed-target-bucket")
+
 	// Lowest and highest signed proposals.
 	lowestSignedProposalsBucket  = []byte("lowest-signed-proposals-bucket")
 	highestSignedProposalsBucket = []byte("highest-signed-proposals-bucket")
@@ -27,9 +30,20 @@ var (
 	attestationSigningRootsBucket = []byte("att-signing-roots-bucket")
 	attestationSourceEpochsBucket = []byte("att-source-epochs-bucket")
 	attestationTargetEpochsBucket = []byte("att-target-epochs-bucket")
+	// Runs of sequential attestations, stored as their first source and last target epochs.
+	attestationSequentialRunsBucket = []byte("att-sequential-runs-bucket")
+
+	// Slashing protection buckets used with compact, 4 byte epoch keys.
+	compactAttestationSigningRootsBucket   = []byte("att-signing-roots-bucket-compact")
+	compactAttestationSourceEpochsBucket   = []byte("att-source-epochs-bucket-compact")
+	compactAttestationTargetEpochsBucket   = []byte("att-target-epochs-bucket-compact")
+	compactAttestationSequentialRunsBucket = []byte("att-sequential-runs-bucket-compact")
 
 	// Migrations
 	migrationsBucket = []byte("migrations")
+	schemaVersionKey = []byte("schema-version")
+	// Number of writes made to the database, stored alike in its mirror database.
+	writeSequenceKey = []byte("write-sequence")
 
 	// Graffiti
 	graffitiBucket = []byte("graffiti")
@@ -37,4 +51,10 @@ var (
 	// Graffiti ordered index and hash keys
 	graffitiOrderedIndexKey = []byte("graffiti-ordered-index")
 	graffitiFileHashKey     = []byte("graffiti-file-hash")
+
+	// Sync committee protection
+	syncCommitteeHistoryBucket = []byte("sync-committee-history-bucket")
+
+	// Time at which each validator public key first signed an attestation.
+	firstSignedTimestampsBucket = []byte("first-signed-timestamps-bucket")
 )
@@ -0,0 +1,240 @@
+package kv
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	types "github.com/prysmaticlabs/eth2-types"
+	ethpb "github.com/prysmaticlabs/prysm/proto/eth/v1alpha1"
+	bolt "go.etcd.io/bbolt"
+)
+
+// A run of sequential attestations, whose target epoch is right after their source epoch,
+// covering every attestation from source epoch start to target epoch end. Runs are stored
+// in the sequential runs bucket of a public key, keyed by their start epoch with their end
+// epoch as value, when sequential attestations are compacted. Runs of a public key never
+// overlap, and no attestation held by a run is also held by the source and target epochs buckets.
+type sequentialRun struct {
+	start types.Epoch
+	end   types.Epoch
+}
+
+// Returns true if the run holds the attestation with the given source and target epochs.
+func (r sequentialRun) contains(source, target types.Epoch) bool {
+	return target == source+1 && source >= r.start && target <= r.end
+}
+
+// Returns the sequential runs of a public key in ascending order.
+func (s *Store) sequentialRuns(pkBucket *bolt.Bucket) []sequentialRun {
+	runsBucket := pkBucket.Bucket(s.epochKeys.sequentialRunsBucket)
+	if runsBucket == nil {
+		return nil
+	}
+	var runs []sequentialRun
+	c := runsBucket.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		runs = append(runs, sequentialRun{start: s.epochKeys.decode(k), end: s.epochKeys.decode(v)})
+	}
+	return runs
+}
+
+// Returns the last sequential run of a public key, which holds its highest sequential attestation.
+func (s *Store) lastSequentialRun(pkBucket *bolt.Bucket) (sequentialRun, bool) {
+	runsBucket := pkBucket.Bucket(s.epochKeys.sequentialRunsBucket)
+	if runsBucket == nil {
+		return sequentialRun{}, false
+	}
+	start, end := runsBucket.Cursor().Last()
+	if start == nil {
+		return sequentialRun{}, false
+	}
+	return sequentialRun{start: s.epochKeys.decode(start), end: s.epochKeys.decode(end)}, true
+}
+
+// Returns true if a sequential run of a public key holds the attestation with the given
+// source and target epochs.
+func (s *Store) inSequentialRun(pkBucket *bolt.Bucket, source, target types.Epoch) bool {
+	if target != source+1 {
+		return false
+	}
+	runsBucket := pkBucket.Bucket(s.epochKeys.sequentialRunsBucket)
+	if runsBucket == nil {
+		return false
+	}
+	// The run holding the attestation, if any, is the last one starting at or before its source epoch.
+	c := runsBucket.Cursor()
+	k, v := c.Seek(s.epochKeys.encode(source))
+	if k == nil || s.epochKeys.decode(k) > source {
+		k, v = c.Prev()
+	}
+	if k == nil {
+		return false
+	}
+	return sequentialRun{start: s.epochKeys.decode(k), end: s.epochKeys.decode(v)}.contains(source, target)
+}
+
+// Saves a sequential attestation with the given source epoch to the sequential runs of a
+// public key if it is not held by the source and target epochs buckets, and returns true if
+// a run holds the attestation, in which case it must not be written to those buckets. A
+// sequential attestation already held by a run is never written again, even when sequential
+// attestations are no longer compacted.
+func (s *Store) saveSequentialAttestation(pkBucket *bolt.Bucket, source types.Epoch) (bool, error) {
+	target := source + 1
+	if s.inSequentialRun(pkBucket, source, target) {
+		return true, nil
+	}
+	if !s.compactSequentialAttestations {
+		return false, nil
+	}
+	if s.epochKeys.listContains(
+		s.epochKeys.get(pkBucket.Bucket(s.epochKeys.sourceEpochsBucket), source), s.epochKeys.encode(target),
+	) {
+		return false, nil
+	}
+	runsBucket, err := pkBucket.CreateBucketIfNotExists(s.epochKeys.sequentialRunsBucket)
+	if err != nil {
+		return false, errors.Wrap(err, "could not create sequential runs bucket")
+	}
+	runsBucket.FillPercent = s.attestationFillPercent
+
+	// The attestation extends the run ending at its source epoch, and is followed by the
+	// run starting at its target epoch, if any, which are then merged into a single run.
+	run := sequentialRun{start: source, end: target}
+	var nextKey []byte
+	c := runsBucket.Cursor()
+	k, v := c.Seek(s.epochKeys.encode(source))
+	if k != nil && s.epochKeys.decode(k) == target {
+		nextKey = append([]byte{}, k...)
+		run.end = s.epochKeys.decode(v)
+	}
+	if k == nil {
+		k, v = c.Last()
+	} else {
+		k, v = c.Prev()
+	}
+	if k != nil && s.epochKeys.decode(v) == source {
+		run.start = s.epochKeys.decode(k)
+	}
+	if nextKey != nil {
+		if err := runsBucket.Delete(nextKey); err != nil {
+			return false, errors.Wrapf(err, "could not merge sequential run starting at epoch %d", target)
+		}
+	}
+	if err := runsBucket.Put(s.epochKeys.encode(run.start), s.epochKeys.encode(run.end)); err != nil {
+		return false, errors.Wrapf(err, "could not save sequential run from epoch %d to %d", run.start, run.end)
+	}
+	return true, nil
+}
+
+// Checks whether an incoming attestation surrounds an attestation held by a sequential run.
+// A sequential attestation can never surround another attestation, so only surrounding votes
+// are checked. The attestation surrounded with the highest source epoch is reported, as when
+// walking the source epochs bucket from the back.
+func (s *Store) checkSurroundingSequentialRuns(
+	ctx context.Context, runsBucket *bolt.Bucket, att *ethpb.IndexedAttestation,
+) (SlashingKind, error) {
+	source, target := att.Data.Source.Epoch, att.Data.Target.Epoch
+	// A sequential attestation (e, e+1) is surrounded if source < e and e+1 < target.
+	if target < source+3 {
+		return NotSlashable, nil
+	}
+	c := runsBucket.Cursor()
+	iterations := 0
+	for k, v := c.Last(); k != nil; k, v = c.Prev() {
+		iterations++
+		if iterations%surroundCheckCancellationInterval == 0 && ctx.Err() != nil {
+			return NotSlashable, ctx.Err()
+		}
+		run := sequentialRun{start: s.epochKeys.decode(k), end: s.epochKeys.decode(v)}
+		if run.end <= source+1 {
+			break
+		}
+		lowest, highest := run.start, run.end-1
+		if lowest < source+1 {
+			lowest = source + 1
+		}
+		if highest > target-2 {
+			highest = target - 2
+		}
+		if lowest <= highest {
+			return SurroundingVote, fmt.Errorf(surroundingVoteMessage, source, target, highest, highest+1)
+		}
+	}
+	return NotSlashable, nil
+}
+
+// Prunes the sequential runs of a public key as the source epochs bucket is pruned, keeping
+// attestations whose source epoch is not below the cutoff epoch for the highest one of the
+// attesting history. The run straddling the cutoff epoch is trimmed to start at it.
+func (s *Store) pruneSequentialRunsBucket(bucket *bolt.Bucket, cutoff pruningCutoffFunc) error {
+	lastRun, ok := s.lastSequentialRun(bucket)
+	if !ok {
+		return nil
+	}
+	highestSource := lastRun.end - 1
+	if sourceEpochsBucket := bucket.Bucket(s.epochKeys.sourceEpochsBucket); sourceEpochsBucket != nil {
+		if k, _ := sourceEpochsBucket.Cursor().Last(); k != nil && s.epochKeys.decode(k) > highestSource {
+			highestSource = s.epochKeys.decode(k)
+		}
+	}
+	cutoffEpoch := cutoff(highestSource)
+	runsBucket := bucket.Bucket(s.epochKeys.sequentialRunsBucket)
+
+	var prunedKeys [][]byte
+	var trimmed *sequentialRun
+	c := runsBucket.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		run := sequentialRun{start: s.epochKeys.decode(k), end: s.epochKeys.decode(v)}
+		if run.start >= cutoffEpoch {
+			break
+		}
+		if run.end > cutoffEpoch {
+			trimmed = &sequentialRun{start: cutoffEpoch, end: run.end}
+		}
+		prunedKeys = append(prunedKeys, append([]byte{}, k...))
+	}
+	for _, k := range prunedKeys {
+		if err := runsBucket.Delete(k); err != nil {
+			return err
+		}
+	}
+	if trimmed == nil {
+		return nil
+	}
+	return runsBucket.Put(s.epochKeys.encode(trimmed.start), s.epochKeys.encode(trimmed.end))
+}
+
+// Walks the attestations held by sequential runs in ascending target epoch order.
+type sequentialRunPairs struct {
+	runs   []sequentialRun
+	i      int
+	target types.Epoch
+}
+
+func newSequentialRunPairs(runs []sequentialRun) *sequentialRunPairs {
+	p := &sequentialRunPairs{runs: runs}
+	if len(runs) > 0 {
+		p.target = runs[0].start + 1
+	}
+	return p
+}
+
+// Returns the target epoch of the next attestation, whose source epoch is right before it,
+// and false once every attestation has been walked.
+func (p *sequentialRunPairs) peek() (types.Epoch, bool) {
+	if p.i >= len(p.runs) {
+		return 0, false
+	}
+	return p.target, true
+}
+
+func (p *sequentialRunPairs) advance() {
+	p.target++
+	if p.target > p.runs[p.i].end {
+		p.i++
+		if p.i < len(p.runs) {
+			p.target = p.runs[p.i].start + 1
+		}
+	}
+}
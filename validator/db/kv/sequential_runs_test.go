@@ -0,0 +1,287 @@
+package kv
+
+import (
+	"context"
+	"testing"
+
+	fuzz "github.com/google/gofuzz"
+	types "github.com/prysmaticlabs/eth2-types"
+	"github.com/prysmaticlabs/prysm/shared/testutil/assert"
+	"github.com/prysmaticlabs/prysm/shared/testutil/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestStore_CompactSequentialAttestations(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	records := []*AttestationRecord{
+		{PubKey: pubKey, Source: 0, Target: 1, SigningRoot: [32]byte{1}},
+		{PubKey: pubKey, Source: 1, Target: 2, SigningRoot: [32]byte{2}},
+		{PubKey: pubKey, Source: 3, Target: 4, SigningRoot: [32]byte{4}},
+		{PubKey: pubKey, Source: 4, Target: 6, SigningRoot: [32]byte{6}},
+		{PubKey: pubKey, Source: 5, Target: 7, SigningRoot: [32]byte{7}},
+		{PubKey: pubKey, Source: 6, Target: 7, SigningRoot: [32]byte{7}},
+		// Fills the gap between the first two runs, which are merged.
+		{PubKey: pubKey, Source: 2, Target: 3, SigningRoot: [32]byte{3}},
+	}
+	validatorDB := setupDBWithConfig(t, &Config{PubKeys: [][48]byte{pubKey}, CompactSequentialAttestations: true})
+	uncompactedDB := setupDB(t, [][48]byte{pubKey})
+	for _, record := range records {
+		require.NoError(t, validatorDB.saveAttestationRecords(ctx, []*AttestationRecord{record}))
+		require.NoError(t, uncompactedDB.saveAttestationRecords(ctx, []*AttestationRecord{record}))
+	}
+
+	// Only the attestations which are not sequential are stored per source and target epoch.
+	var runs []sequentialRun
+	var sources []types.Epoch
+	require.NoError(t, validatorDB.view(func(tx *bolt.Tx) error {
+		pkBucket := tx.Bucket(pubKeysBucket).Bucket(pubKey[:])
+		runs = validatorDB.sequentialRuns(pkBucket)
+		return pkBucket.Bucket(validatorDB.epochKeys.sourceEpochsBucket).ForEach(func(k, _ []byte) error {
+			sources = append(sources, validatorDB.epochKeys.decode(k))
+			return nil
+		})
+	}))
+	assert.DeepEqual(t, []sequentialRun{{start: 0, end: 4}, {start: 6, end: 7}}, runs)
+	assert.DeepEqual(t, []types.Epoch{4, 5}, sources)
+
+	// Readers of the attesting history do not tell both forms apart.
+	want := []*AttestationRecord{
+		{Source: 0, Target: 1, SigningRoot: [32]byte{1}},
+		{Source: 1, Target: 2, SigningRoot: [32]byte{2}},
+		{Source: 2, Target: 3, SigningRoot: [32]byte{3}},
+		{Source: 3, Target: 4, SigningRoot: [32]byte{4}},
+		{Source: 4, Target: 6, SigningRoot: [32]byte{6}},
+		{Source: 5, Target: 7, SigningRoot: [32]byte{7}},
+		{Source: 6, Target: 7, SigningRoot: [32]byte{7}},
+	}
+	for _, db := range []*Store{validatorDB, uncompactedDB} {
+		history, err := db.AttestationHistoryForPubKey(ctx, pubKey)
+		require.NoError(t, err)
+		assert.DeepEqual(t, want, history)
+		visited := make([]*AttestationRecord, 0)
+		require.NoError(t, db.ForEachAttestation(ctx, pubKey, func(source, target types.Epoch, signingRoot [32]byte) error {
+			visited = append(visited, &AttestationRecord{Source: source, Target: target, SigningRoot: signingRoot})
+			return nil
+		}))
+		assert.DeepEqual(t, want, visited)
+		target, exists, err := db.TargetForSource(ctx, pubKey, 2)
+		require.NoError(t, err)
+		assert.Equal(t, true, exists)
+		assert.Equal(t, types.Epoch(3), target)
+		require.NoError(t, db.VerifyAttestationBounds(ctx, pubKey))
+		orphans, err := db.FindOrphanedSigningRoots(ctx, pubKey)
+		require.NoError(t, err)
+		assert.Equal(t, 0, len(orphans))
+		discrepancies, err := db.ReconcileWithExternalHistory(ctx, pubKey, want)
+		require.NoError(t, err)
+		assert.Equal(t, 0, len(discrepancies))
+		passed, err := db.SelfTestSlashingProtection(ctx, pubKey)
+		require.NoError(t, err)
+		assert.Equal(t, true, passed)
+	}
+
+	// An attestation held by a run is already saved, and saving it again is a no-op.
+	require.NoError(t, validatorDB.view(func(tx *bolt.Tx) error {
+		assert.Equal(t, true, validatorDB.attestationSaved(tx, &AttestationRecord{
+			PubKey: pubKey, Source: 1, Target: 2, SigningRoot: [32]byte{2},
+		}))
+		return nil
+	}))
+	require.NoError(t, validatorDB.SaveAttestationForPubKey(ctx, pubKey, [32]byte{2}, createAttestation(1, 2)))
+	slashingKind, err := validatorDB.CheckSlashableAttestation(ctx, pubKey, [32]byte{3}, createAttestation(0, 3))
+	require.ErrorContains(t, "attestation with (source 0, target 3) surrounds another with (source 1, target 2)", err)
+	assert.Equal(t, SurroundingVote, slashingKind)
+}
+
+func TestStore_CompactSequentialAttestations_54kEpochs(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	numEpochs := types.Epoch(54000)
+	validatorDB := setupDBWithConfig(t, &Config{
+		PubKeys:                       [][48]byte{pubKey},
+		NoSync:                        true,
+		CompactSequentialAttestations: true,
+	})
+	saveSequentialAttestingHistory(t, validatorDB, pubKey, numEpochs)
+
+	// The whole attesting history is held by a single run, while signing roots are kept per target epoch.
+	require.NoError(t, validatorDB.view(func(tx *bolt.Tx) error {
+		pkBucket := tx.Bucket(pubKeysBucket).Bucket(pubKey[:])
+		assert.DeepEqual(t, []sequentialRun{{start: 0, end: numEpochs - 1}}, validatorDB.sequentialRuns(pkBucket))
+		assert.Equal(t, true, pkBucket.Bucket(validatorDB.epochKeys.sourceEpochsBucket) == nil)
+		assert.Equal(t, true, pkBucket.Bucket(validatorDB.epochKeys.targetEpochsBucket) == nil)
+		return nil
+	}))
+	count, err := validatorDB.AttestationRecordCount(ctx, pubKey)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(numEpochs-1), count)
+
+	tests := []struct {
+		source types.Epoch
+		target types.Epoch
+		want   SlashingKind
+	}{
+		{source: numEpochs / 2, target: numEpochs, want: SurroundingVote},
+		{source: 0, target: numEpochs, want: SurroundingVote},
+		{source: numEpochs - 3, target: numEpochs, want: SurroundingVote},
+		{source: numEpochs - 2, target: numEpochs, want: NotSlashable},
+		{source: numEpochs - 1, target: numEpochs, want: NotSlashable},
+		{source: numEpochs, target: numEpochs + 1, want: NotSlashable},
+	}
+	for _, tt := range tests {
+		slashingKind, err := validatorDB.CheckSlashableAttestation(ctx, pubKey, [32]byte{}, createAttestation(tt.source, tt.target))
+		assert.Equal(t, tt.want, slashingKind, "Wrong slashing kind for source %d and target %d", tt.source, tt.target)
+		assert.Equal(t, tt.want != NotSlashable, err != nil)
+	}
+}
+
+func TestStore_CompactSequentialAttestations_Fuzz(t *testing.T) {
+	ctx := context.Background()
+	fuzzer := fuzz.NewWithSeed(0)
+	validatorDB := setupDBWithConfig(t, &Config{NoSync: true, CompactSequentialAttestations: true})
+	uncompactedDB := setupDBWithConfig(t, &Config{NoSync: true})
+
+	for i := 0; i < 500; i++ {
+		pubKey := [48]byte{byte(i), byte(i >> 8)}
+		var numRecords uint8
+		fuzzer.Fuzz(&numRecords)
+		attestedTargets := make(map[types.Epoch]bool)
+		for j := 0; j < int(numRecords%16)+1; j++ {
+			record := fuzzAttestationRecord(fuzzer, pubKey)
+			if attestedTargets[record.Target] {
+				continue
+			}
+			attestedTargets[record.Target] = true
+			require.NoError(t, validatorDB.saveAttestationRecords(ctx, []*AttestationRecord{record}))
+			require.NoError(t, uncompactedDB.saveAttestationRecords(ctx, []*AttestationRecord{record}))
+		}
+
+		visit := func(db *Store) []*AttestationRecord {
+			visited := make([]*AttestationRecord, 0)
+			require.NoError(t, db.ForEachAttestation(ctx, pubKey, func(source, target types.Epoch, signingRoot [32]byte) error {
+				visited = append(visited, &AttestationRecord{Source: source, Target: target, SigningRoot: signingRoot})
+				return nil
+			}))
+			return visited
+		}
+		require.DeepEqual(t, visit(uncompactedDB), visit(validatorDB))
+
+		incoming := fuzzAttestationRecord(fuzzer, pubKey)
+		att := createAttestation(incoming.Source, incoming.Target)
+		want, _ := uncompactedDB.CheckSlashableAttestation(ctx, pubKey, incoming.SigningRoot, att)
+		slashingKind, _ := validatorDB.CheckSlashableAttestation(ctx, pubKey, incoming.SigningRoot, att)
+		require.Equal(t, want, slashingKind, "Wrong slashing kind for source %d and target %d", incoming.Source, incoming.Target)
+	}
+}
+
+func TestStore_CompactSequentialAttestations_Disabled(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	validatorDB := setupDBWithConfig(t, &Config{PubKeys: [][48]byte{pubKey}, CompactSequentialAttestations: true})
+	saveSequentialAttestingHistory(t, validatorDB, pubKey, 4)
+
+	// Runs saved before compaction was disabled are kept, and never duplicated.
+	validatorDB.compactSequentialAttestations = false
+	require.NoError(t, validatorDB.saveAttestationRecords(ctx, []*AttestationRecord{
+		{PubKey: pubKey, Source: 1, Target: 2, SigningRoot: [32]byte{2}},
+		{PubKey: pubKey, Source: 3, Target: 4, SigningRoot: [32]byte{4}},
+	}))
+	var runs []sequentialRun
+	var sourcesList []byte
+	require.NoError(t, validatorDB.view(func(tx *bolt.Tx) error {
+		pkBucket := tx.Bucket(pubKeysBucket).Bucket(pubKey[:])
+		runs = validatorDB.sequentialRuns(pkBucket)
+		sourcesList = validatorDB.epochKeys.get(pkBucket.Bucket(validatorDB.epochKeys.sourceEpochsBucket), 1)
+		return nil
+	}))
+	assert.DeepEqual(t, []sequentialRun{{start: 0, end: 3}}, runs)
+	assert.Equal(t, 0, len(sourcesList))
+	history, err := validatorDB.AttestationHistoryForPubKey(ctx, pubKey)
+	require.NoError(t, err)
+	assert.Equal(t, 4, len(history))
+}
+
+func TestStore_PruneAttestations_SequentialRuns(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	validatorDB := setupDBWithConfig(t, &Config{PubKeys: [][48]byte{pubKey}, CompactSequentialAttestations: true})
+	uncompactedDB := setupDB(t, [][48]byte{pubKey})
+	for _, db := range []*Store{validatorDB, uncompactedDB} {
+		// Two runs, with a gap at source epoch 50.
+		saveSequentialAttestingHistory(t, db, pubKey, 50)
+		require.NoError(t, db.saveAttestationRecords(ctx, []*AttestationRecord{
+			{PubKey: pubKey, Source: 49, Target: 51},
+		}))
+		for epoch := types.Epoch(52); epoch <= 100; epoch++ {
+			require.NoError(t, db.saveAttestationRecords(ctx, []*AttestationRecord{
+				{PubKey: pubKey, Source: epoch - 1, Target: epoch},
+			}))
+		}
+		require.NoError(t, db.PruneAttestationsWithPeriod(ctx, 10))
+	}
+
+	require.NoError(t, validatorDB.view(func(tx *bolt.Tx) error {
+		pkBucket := tx.Bucket(pubKeysBucket).Bucket(pubKey[:])
+		assert.DeepEqual(t, []sequentialRun{{start: 89, end: 100}}, validatorDB.sequentialRuns(pkBucket))
+		return nil
+	}))
+	want, err := uncompactedDB.AttestationHistoryForPubKey(ctx, pubKey)
+	require.NoError(t, err)
+	history, err := validatorDB.AttestationHistoryForPubKey(ctx, pubKey)
+	require.NoError(t, err)
+	assert.DeepEqual(t, want, history)
+	assert.Equal(t, 11, len(history))
+}
+
+func TestStore_CheckIntegrity_SequentialRuns(t *testing.T) {
+	tests := []struct {
+		name    string
+		runs    map[types.Epoch]types.Epoch
+		wantErr string
+	}{
+		{
+			name: "valid runs",
+			runs: map[types.Epoch]types.Epoch{1: 3, 3: 5},
+		},
+		{
+			name:    "empty run",
+			runs:    map[types.Epoch]types.Epoch{2: 2},
+			wantErr: "starting at epoch 2 ends at epoch 2",
+		},
+		{
+			name:    "overlapping runs",
+			runs:    map[types.Epoch]types.Epoch{1: 4, 3: 5},
+			wantErr: "overlaps the previous run ending at epoch 4",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pubKey := [48]byte{1}
+			validatorDB := setupDB(t, [][48]byte{pubKey})
+			require.NoError(t, validatorDB.update(func(tx *bolt.Tx) error {
+				pkBucket, err := tx.Bucket(pubKeysBucket).CreateBucketIfNotExists(pubKey[:])
+				if err != nil {
+					return err
+				}
+				runsBucket, err := pkBucket.CreateBucketIfNotExists(validatorDB.epochKeys.sequentialRunsBucket)
+				if err != nil {
+					return err
+				}
+				for start, end := range tt.runs {
+					if err := runsBucket.Put(validatorDB.epochKeys.encode(start), validatorDB.epochKeys.encode(end)); err != nil {
+						return err
+					}
+				}
+				return nil
+			}))
+			err := validatorDB.view(validatorDB.checkIntegrity)
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, tt.wantErr, err)
+			require.ErrorContains(t, ErrIntegrityCheckFailed.Error(), err)
+		})
+	}
+}
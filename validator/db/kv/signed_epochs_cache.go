@@ -0,0 +1,156 @@
+package kv
+
+import (
+	"sync"
+
+	types "github.com/prysmaticlabs/eth2-types"
+	"github.com/prysmaticlabs/prysm/shared/bytesutil"
+	bolt "go.etcd.io/bbolt"
+)
+
+// signedEpochsCache holds the highest source and target epochs signed by each validator
+// public key, so that CheckSlashableAttestation can allow an attestation which is newer
+// than the whole attesting history without reading the database. An attestation whose
+// target epoch is higher than every signed target epoch cannot be a double vote nor be
+// surrounded, and one whose source epoch is not lower than every signed source epoch
+// cannot surround a signed attestation.
+//
+// The cache only ever proves that an attestation is safe. Any other attestation, including
+// every attestation of a public key missing from the cache, is checked against the database,
+// which remains the only source of truth for slashable attestations. Epochs are recorded
+// before the records holding them are written, and are never lowered, so the cache may be
+// stricter than the database but never more lenient.
+type signedEpochsCache struct {
+	lock   sync.RWMutex
+	epochs map[[48]byte]*signedEpochs
+}
+
+type signedEpochs struct {
+	highestSource types.Epoch
+	highestTarget types.Epoch
+}
+
+func newSignedEpochsCache() *signedEpochsCache {
+	return &signedEpochsCache{
+		epochs: make(map[[48]byte]*signedEpochs),
+	}
+}
+
+// Returns true if the cache holds the signed epochs of a public key.
+func (c *signedEpochsCache) contains(pubKey [48]byte) bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	_, ok := c.epochs[pubKey]
+	return ok
+}
+
+// Removes the signed epochs of a public key, whose attesting history has been deleted.
+func (c *signedEpochsCache) remove(pubKey [48]byte) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.epochs, pubKey)
+}
+
+// Records the source and target epochs of an attestation signed by a public key.
+// The public key must either be in the cache already or have no other attesting history.
+func (c *signedEpochsCache) update(pubKey [48]byte, source, target types.Epoch) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	epochs, ok := c.epochs[pubKey]
+	if !ok {
+		c.epochs[pubKey] = &signedEpochs{highestSource: source, highestTarget: target}
+		return
+	}
+	if source > epochs.highestSource {
+		epochs.highestSource = source
+	}
+	if target > epochs.highestTarget {
+		epochs.highestTarget = target
+	}
+}
+
+// Returns true if an attestation of a public key is known not to be slashable with respect
+// to the attestations recorded in the cache.
+func (c *signedEpochsCache) isSafe(pubKey [48]byte, source, target types.Epoch) bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	epochs, ok := c.epochs[pubKey]
+	if !ok {
+		return false
+	}
+	return target > epochs.highestTarget && source >= epochs.highestSource
+}
+
+// Loads the highest source and target epochs of every public key with an attesting
+// history into the signed epochs cache.
+func (s *Store) warmSignedEpochsCache(tx *bolt.Tx) error {
+	bucket := tx.Bucket(pubKeysBucket)
+	if bucket == nil {
+		return nil
+	}
+	return bucket.ForEach(func(pubKey, _ []byte) error {
+		pkBucket := bucket.Bucket(pubKey)
+		if pkBucket == nil {
+			return nil
+		}
+		if epochs, ok := s.highestSignedEpochs(pkBucket); ok && epochs != nil {
+			s.signedEpochs.update(bytesutil.ToBytes48(pubKey), epochs.highestSource, epochs.highestTarget)
+		}
+		return nil
+	})
+}
+
+// Records the epochs of an attestation about to be saved in the signed epochs cache, if
+// enabled. A public key missing from the cache is first loaded from its attesting history
+// within the write transaction, so that an entry always covers the whole attesting history.
+func (s *Store) cacheSignedEpochs(pkBucket *bolt.Bucket, pubKey [48]byte, source, target types.Epoch) {
+	if s.signedEpochs == nil {
+		return
+	}
+	if !s.signedEpochs.contains(pubKey) {
+		epochs, ok := s.highestSignedEpochs(pkBucket)
+		if !ok {
+			return
+		}
+		if epochs != nil {
+			s.signedEpochs.update(pubKey, epochs.highestSource, epochs.highestTarget)
+		}
+	}
+	s.signedEpochs.update(pubKey, source, target)
+}
+
+// Reads the highest source and target epochs in the attesting history of a public key. As
+// epochs are encoded big-endian, they are the last keys of the source and target epochs
+// buckets, or held by the last sequential run. It returns nil for a public key without attesting history, and false if only one
+// of the buckets holds records, in which case the public key is left out of the cache.
+func (s *Store) highestSignedEpochs(pkBucket *bolt.Bucket) (*signedEpochs, bool) {
+	var highestSource, highestTarget []byte
+	if sourceEpochsBucket := pkBucket.Bucket(s.epochKeys.sourceEpochsBucket); sourceEpochsBucket != nil {
+		highestSource, _ = sourceEpochsBucket.Cursor().Last()
+	}
+	if targetEpochsBucket := pkBucket.Bucket(s.epochKeys.targetEpochsBucket); targetEpochsBucket != nil {
+		highestTarget, _ = targetEpochsBucket.Cursor().Last()
+	}
+	lastRun, hasRuns := s.lastSequentialRun(pkBucket)
+	if highestSource == nil && highestTarget == nil && !hasRuns {
+		return nil, true
+	}
+	if (highestSource == nil) != (highestTarget == nil) {
+		return nil, false
+	}
+	epochs := &signedEpochs{}
+	if highestSource != nil {
+		epochs.highestSource = s.epochKeys.decode(highestSource)
+		epochs.highestTarget = s.epochKeys.decode(highestTarget)
+	}
+	// The last attestation of the last sequential run has its highest source and target epochs.
+	if hasRuns {
+		if lastRun.end-1 > epochs.highestSource {
+			epochs.highestSource = lastRun.end - 1
+		}
+		if lastRun.end > epochs.highestTarget {
+			epochs.highestTarget = lastRun.end
+		}
+	}
+	return epochs, true
+}
@@ -0,0 +1,87 @@
+package kv
+
+import (
+	"context"
+	"testing"
+
+	types "github.com/prysmaticlabs/eth2-types"
+	"github.com/prysmaticlabs/prysm/shared/testutil/assert"
+	"github.com/prysmaticlabs/prysm/shared/testutil/require"
+)
+
+func TestStore_WarmSignedEpochsCache(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	dirPath := t.TempDir()
+	validatorDB, err := NewKVStore(ctx, dirPath, &Config{PubKeys: [][48]byte{pubKey}})
+	require.NoError(t, err)
+	require.NoError(t, validatorDB.SaveAttestationForPubKey(ctx, pubKey, [32]byte{1}, createAttestation(2, 3)))
+	require.NoError(t, validatorDB.SaveAttestationForPubKey(ctx, pubKey, [32]byte{2}, createAttestation(5, 6)))
+	assert.Equal(t, (*signedEpochsCache)(nil), validatorDB.signedEpochs)
+	require.NoError(t, validatorDB.Close())
+
+	// The highest signed epochs are loaded when the database is opened.
+	validatorDB, err = NewKVStore(ctx, dirPath, &Config{PubKeys: [][48]byte{pubKey}, WarmSignedEpochsCache: true})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, validatorDB.Close())
+	})
+	require.Equal(t, true, validatorDB.signedEpochs.contains(pubKey))
+	assert.Equal(t, true, validatorDB.signedEpochs.isSafe(pubKey, 5, 7))
+	assert.Equal(t, false, validatorDB.signedEpochs.isSafe(pubKey, 4, 7))
+	assert.Equal(t, false, validatorDB.signedEpochs.isSafe(pubKey, 5, 6))
+	assert.Equal(t, false, validatorDB.signedEpochs.isSafe([48]byte{2}, 5, 7))
+
+	// Saving an attestation keeps the cache in sync.
+	require.NoError(t, validatorDB.SaveAttestationForPubKey(ctx, pubKey, [32]byte{3}, createAttestation(6, 8)))
+	assert.Equal(t, false, validatorDB.signedEpochs.isSafe(pubKey, 6, 8))
+	assert.Equal(t, true, validatorDB.signedEpochs.isSafe(pubKey, 6, 9))
+}
+
+func TestStore_CheckSlashableAttestation_WarmSignedEpochsCache(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	validatorDB := setupDBWithConfig(t, &Config{PubKeys: [][48]byte{pubKey}, WarmSignedEpochsCache: true})
+	require.NoError(t, validatorDB.SaveAttestationForPubKey(ctx, pubKey, [32]byte{1}, createAttestation(2, 3)))
+	require.NoError(t, validatorDB.SaveAttestationForPubKey(ctx, pubKey, [32]byte{2}, createAttestation(5, 10)))
+
+	tests := []struct {
+		name        string
+		source      types.Epoch
+		target      types.Epoch
+		signingRoot [32]byte
+		want        SlashingKind
+	}{
+		{name: "newer than the history", source: 5, target: 11, want: NotSlashable},
+		{name: "same attestation", source: 5, target: 10, signingRoot: [32]byte{2}, want: NotSlashable},
+		{name: "double vote", source: 5, target: 10, signingRoot: [32]byte{3}, want: DoubleVote},
+		{name: "surrounding vote", source: 1, target: 11, want: SurroundingVote},
+		{name: "surrounded vote", source: 6, target: 9, want: SurroundedVote},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kind, err := validatorDB.CheckSlashableAttestation(ctx, pubKey, tt.signingRoot, createAttestation(tt.source, tt.target))
+			assert.Equal(t, tt.want, kind)
+			assert.Equal(t, tt.want != NotSlashable, err != nil)
+		})
+	}
+}
+
+func TestStore_SignedEpochsCache_LoadsHistoryOfUncachedKey(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	validatorDB := setupDBWithConfig(t, &Config{WarmSignedEpochsCache: true})
+
+	// A history written while the public key is not cached, such as by a migration,
+	// is loaded before the first attestation saved for that key is recorded.
+	require.NoError(t, validatorDB.saveAttestationRecords(ctx, []*AttestationRecord{
+		{PubKey: pubKey, Source: 5, Target: 20},
+	}))
+	validatorDB.signedEpochs = newSignedEpochsCache()
+	require.NoError(t, validatorDB.saveAttestationRecords(ctx, []*AttestationRecord{
+		{PubKey: pubKey, Source: 1, Target: 2},
+	}))
+	assert.Equal(t, false, validatorDB.signedEpochs.isSafe(pubKey, 5, 3))
+	assert.Equal(t, false, validatorDB.signedEpochs.isSafe(pubKey, 1, 21))
+	assert.Equal(t, true, validatorDB.signedEpochs.isSafe(pubKey, 5, 21))
+}
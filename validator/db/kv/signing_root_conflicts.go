@@ -0,0 +1,102 @@
+package kv
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	types "github.com/prysmaticlabs/eth2-types"
+	"github.com/prysmaticlabs/prysm/shared/bytesutil"
+	"github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+	"go.opencensus.io/trace"
+)
+
+// SigningRootConflict is a target epoch for which several distinct signing roots are
+// stored for a validator public key. This happens when signing roots are kept for forensic
+// analysis, or when an import wrote a different signing root for an already signed target.
+type SigningRootConflict struct {
+	PubKey      [48]byte
+	TargetEpoch types.Epoch
+	// SigningRoots are the distinct signing roots stored at the target epoch, in the order
+	// they were first saved, so the first one is that of the earliest signed record.
+	SigningRoots [][32]byte
+}
+
+// FindDuplicateSigningRootConflicts returns, for every public key, each target epoch at
+// which more than a single distinct signing root is stored. Nothing is modified, so that
+// the conflicts can be reviewed before calling RepairSigningRootConflicts.
+func (s *Store) FindDuplicateSigningRootConflicts(ctx context.Context) ([]*SigningRootConflict, error) {
+	ctx, span := trace.StartSpan(ctx, "Validator.FindDuplicateSigningRootConflicts")
+	defer span.End()
+	conflicts := make([]*SigningRootConflict, 0)
+	err := s.view(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(pubKeysBucket)
+		return bucket.ForEach(func(pubKey, _ []byte) error {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			pkBucket := bucket.Bucket(pubKey)
+			if pkBucket == nil {
+				return nil
+			}
+			signingRootsBucket := pkBucket.Bucket(s.epochKeys.signingRootsBucket)
+			if signingRootsBucket == nil {
+				return nil
+			}
+			return signingRootsBucket.ForEach(func(targetBytes, enc []byte) error {
+				signingRoots := decodeSigningRoots(enc)
+				if len(signingRoots) < 2 {
+					return nil
+				}
+				conflicts = append(conflicts, &SigningRootConflict{
+					PubKey:       bytesutil.ToBytes48(pubKey),
+					TargetEpoch:  s.epochKeys.decode(targetBytes),
+					SigningRoots: signingRoots,
+				})
+				return nil
+			})
+		})
+	})
+	return conflicts, err
+}
+
+// RepairSigningRootConflicts keeps only the signing root of the earliest signed record at
+// the target epoch of each of the given conflicts, as found by FindDuplicateSigningRootConflicts,
+// in a single transaction. Each repaired target epoch is logged. Target epochs which no longer
+// hold several signing roots are left untouched.
+func (s *Store) RepairSigningRootConflicts(ctx context.Context, conflicts []*SigningRootConflict) error {
+	ctx, span := trace.StartSpan(ctx, "Validator.RepairSigningRootConflicts")
+	defer span.End()
+	return s.update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(pubKeysBucket)
+		for _, conflict := range conflicts {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			pkBucket := bucket.Bucket(conflict.PubKey[:])
+			if pkBucket == nil {
+				continue
+			}
+			signingRootsBucket := pkBucket.Bucket(s.epochKeys.signingRootsBucket)
+			signingRoots := decodeSigningRoots(s.epochKeys.get(signingRootsBucket, conflict.TargetEpoch))
+			if len(signingRoots) < 2 {
+				continue
+			}
+			kept := signingRoots[0]
+			if err := signingRootsBucket.Put(s.epochKeys.encode(conflict.TargetEpoch), kept[:]); err != nil {
+				return errors.Wrapf(err, "could not repair signing roots for target epoch %d", conflict.TargetEpoch)
+			}
+			if s.isMirrorTx(tx) {
+				continue
+			}
+			log.WithFields(logrus.Fields{
+				"publicKey":   fmt.Sprintf("%#x", bytesutil.Trunc(conflict.PubKey[:])),
+				"targetEpoch": conflict.TargetEpoch,
+				"kept":        fmt.Sprintf("%#x", kept),
+				"dropped":     len(signingRoots) - 1,
+			}).Warn("Repaired conflicting signing roots")
+		}
+		return nil
+	})
+}
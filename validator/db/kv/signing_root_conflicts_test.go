@@ -0,0 +1,69 @@
+package kv
+
+import (
+	"context"
+	"testing"
+
+	types "github.com/prysmaticlabs/eth2-types"
+	ethpb "github.com/prysmaticlabs/prysm/proto/eth/v1alpha1"
+	"github.com/prysmaticlabs/prysm/shared/testutil/assert"
+	"github.com/prysmaticlabs/prysm/shared/testutil/require"
+	logTest "github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestStore_RepairSigningRootConflicts(t *testing.T) {
+	hook := logTest.NewGlobal()
+	ctx := context.Background()
+	pubKeys := [][48]byte{{1}, {2}}
+	validatorDB, err := NewKVStore(ctx, t.TempDir(), &Config{
+		PubKeys:             pubKeys,
+		KeepAllSigningRoots: true,
+	})
+	require.NoError(t, err, "Failed to instantiate DB")
+	t.Cleanup(func() {
+		require.NoError(t, validatorDB.Close(), "Failed to close database")
+		require.NoError(t, validatorDB.ClearDB(), "Failed to clear database")
+	})
+
+	save := func(pubKey [48]byte, signingRoot [32]byte, att *ethpb.IndexedAttestation) {
+		require.NoError(t, validatorDB.SaveAttestationsForPubKey(
+			ctx, pubKey, [][32]byte{signingRoot}, []*ethpb.IndexedAttestation{att},
+		))
+	}
+	save(pubKeys[0], [32]byte{1}, createAttestation(1, 2))
+	save(pubKeys[0], [32]byte{2}, createAttestation(1, 2))
+	save(pubKeys[0], [32]byte{3}, createAttestation(2, 3))
+	save(pubKeys[1], [32]byte{4}, createAttestation(1, 2))
+	save(pubKeys[1], [32]byte{4}, createAttestation(1, 2))
+
+	conflicts, err := validatorDB.FindDuplicateSigningRootConflicts(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(conflicts))
+	assert.Equal(t, pubKeys[0], conflicts[0].PubKey)
+	assert.Equal(t, types.Epoch(2), conflicts[0].TargetEpoch)
+	assert.DeepEqual(t, [][32]byte{{1}, {2}}, conflicts[0].SigningRoots)
+
+	// Finding conflicts does not modify the database.
+	signingRoots, err := validatorDB.SigningRootsAtTargetEpoch(ctx, pubKeys[0], 2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(signingRoots))
+
+	require.NoError(t, validatorDB.RepairSigningRootConflicts(ctx, conflicts))
+	require.LogsContain(t, hook, "Repaired conflicting signing roots")
+	signingRoots, err = validatorDB.SigningRootsAtTargetEpoch(ctx, pubKeys[0], 2)
+	require.NoError(t, err)
+	assert.DeepEqual(t, [][32]byte{{1}}, signingRoots)
+	signingRoots, err = validatorDB.SigningRootsAtTargetEpoch(ctx, pubKeys[0], 3)
+	require.NoError(t, err)
+	assert.DeepEqual(t, [][32]byte{{3}}, signingRoots)
+
+	conflicts, err = validatorDB.FindDuplicateSigningRootConflicts(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(conflicts))
+
+	// Repairing conflicts which were already repaired is a no-op.
+	require.NoError(t, validatorDB.RepairSigningRootConflicts(ctx, []*SigningRootConflict{
+		{PubKey: pubKeys[0], TargetEpoch: 2},
+		{PubKey: [48]byte{3}, TargetEpoch: 2},
+	}))
+}
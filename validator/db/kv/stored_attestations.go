@@ -0,0 +1,86 @@
+package kv
+
+import (
+	"sort"
+
+	types "github.com/prysmaticlabs/eth2-types"
+	"github.com/prysmaticlabs/prysm/shared/slashutil"
+)
+
+// StoredAttestations indexes the attesting history of a public key, so that attestations
+// from another history, such as an imported or merged one, can be checked for double and
+// surround votes without scanning all of it.
+type StoredAttestations struct {
+	byTarget map[types.Epoch][]*AttestationRecord
+	// Records sorted by source epoch, along with the highest target epoch of every
+	// prefix and the lowest target epoch of every suffix of the sorted records.
+	bySource        []*AttestationRecord
+	maxTargetBefore []types.Epoch
+	minTargetAfter  []types.Epoch
+}
+
+// NewStoredAttestations indexes the given attesting history.
+func NewStoredAttestations(history []*AttestationRecord) *StoredAttestations {
+	stored := &StoredAttestations{
+		byTarget:        make(map[types.Epoch][]*AttestationRecord, len(history)),
+		bySource:        make([]*AttestationRecord, len(history)),
+		maxTargetBefore: make([]types.Epoch, len(history)),
+		minTargetAfter:  make([]types.Epoch, len(history)),
+	}
+	for _, record := range history {
+		stored.byTarget[record.Target] = append(stored.byTarget[record.Target], record)
+	}
+	copy(stored.bySource, history)
+	sort.SliceStable(stored.bySource, func(i, j int) bool {
+		return stored.bySource[i].Source < stored.bySource[j].Source
+	})
+	for i, record := range stored.bySource {
+		stored.maxTargetBefore[i] = record.Target
+		if i > 0 && stored.maxTargetBefore[i-1] > record.Target {
+			stored.maxTargetBefore[i] = stored.maxTargetBefore[i-1]
+		}
+	}
+	for i := len(stored.bySource) - 1; i >= 0; i-- {
+		stored.minTargetAfter[i] = stored.bySource[i].Target
+		if i < len(stored.bySource)-1 && stored.minTargetAfter[i+1] < stored.bySource[i].Target {
+			stored.minTargetAfter[i] = stored.minTargetAfter[i+1]
+		}
+	}
+	return stored
+}
+
+// SlashingKind returns the kind of slashing an attestation would allow with respect to the
+// stored attesting history. An attestation which is already stored is not slashable.
+func (s *StoredAttestations) SlashingKind(att *AttestationRecord) SlashingKind {
+	for _, existing := range s.byTarget[att.Target] {
+		if existing.Source == att.Source && existing.SigningRoot == att.SigningRoot {
+			return NotSlashable
+		}
+	}
+	for _, existing := range s.byTarget[att.Target] {
+		if slashutil.SigningRootsDiffer(existing.SigningRoot, att.SigningRoot) {
+			return DoubleVote
+		}
+	}
+	return s.surroundKind(att)
+}
+
+// Returns the kind of surround vote an attestation would allow with respect to the stored
+// attesting history, leaving out double votes.
+func (s *StoredAttestations) surroundKind(att *AttestationRecord) SlashingKind {
+	// A stored attestation with a higher source epoch and a lower target epoch is surrounded.
+	after := sort.Search(len(s.bySource), func(i int) bool {
+		return s.bySource[i].Source > att.Source
+	})
+	if after < len(s.bySource) && s.minTargetAfter[after] < att.Target {
+		return SurroundingVote
+	}
+	// A stored attestation with a lower source epoch and a higher target epoch surrounds it.
+	before := sort.Search(len(s.bySource), func(i int) bool {
+		return s.bySource[i].Source >= att.Source
+	})
+	if before > 0 && s.maxTargetBefore[before-1] > att.Target {
+		return SurroundedVote
+	}
+	return NotSlashable
+}
@@ -0,0 +1,61 @@
+package kv
+
+import (
+	"testing"
+
+	"github.com/prysmaticlabs/prysm/shared/testutil/assert"
+)
+
+func TestStoredAttestations_SlashingKind(t *testing.T) {
+	stored := NewStoredAttestations([]*AttestationRecord{
+		{Source: 4, Target: 6, SigningRoot: [32]byte{1}},
+		{Source: 1, Target: 2, SigningRoot: [32]byte{2}},
+		{Source: 2, Target: 3},
+	})
+	tests := []struct {
+		name string
+		att  *AttestationRecord
+		want SlashingKind
+	}{
+		{
+			name: "same attestation",
+			att:  &AttestationRecord{Source: 4, Target: 6, SigningRoot: [32]byte{1}},
+			want: NotSlashable,
+		},
+		{
+			name: "same attestation without signing root",
+			att:  &AttestationRecord{Source: 2, Target: 3},
+			want: NotSlashable,
+		},
+		{
+			name: "differing signing root",
+			att:  &AttestationRecord{Source: 4, Target: 6, SigningRoot: [32]byte{3}},
+			want: DoubleVote,
+		},
+		{
+			name: "differing signing root of an attestation stored without one",
+			att:  &AttestationRecord{Source: 2, Target: 3, SigningRoot: [32]byte{3}},
+			want: DoubleVote,
+		},
+		{
+			name: "surrounding",
+			att:  &AttestationRecord{Source: 3, Target: 7},
+			want: SurroundingVote,
+		},
+		{
+			name: "surrounded",
+			att:  &AttestationRecord{Source: 5, Target: 5},
+			want: SurroundedVote,
+		},
+		{
+			name: "newer",
+			att:  &AttestationRecord{Source: 6, Target: 7},
+			want: NotSlashable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, stored.SlashingKind(tt.att))
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package kv
+
+import (
+	"context"
+	"fmt"
+
+	types "github.com/prysmaticlabs/eth2-types"
+	"github.com/prysmaticlabs/prysm/shared/bytesutil"
+	bolt "go.etcd.io/bbolt"
+	"go.opencensus.io/trace"
+)
+
+// Sync committee messages are not slashable, so only the latest signed message of each
+// validator is kept, as the slot followed by the signing root. This is enough to avoid
+// signing conflicting or repeated messages after a restart, without the history growing.
+const syncCommitteeMessageRecordLength = 8 + 32
+
+// SaveSyncCommitteeMessage records a sync committee message signed by a validator public
+// key at the given slot. Only the message with the highest slot is kept.
+func (s *Store) SaveSyncCommitteeMessage(
+	ctx context.Context, pubKey [48]byte, slot types.Slot, signingRoot [32]byte,
+) error {
+	ctx, span := trace.StartSpan(ctx, "Validator.SaveSyncCommitteeMessage")
+	defer span.End()
+	return s.update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(syncCommitteeHistoryBucket)
+		if existingSlot, _, ok := decodeSyncCommitteeMessage(bkt.Get(pubKey[:])); ok && existingSlot > slot {
+			return nil
+		}
+		enc := make([]byte, 0, syncCommitteeMessageRecordLength)
+		enc = append(enc, bytesutil.SlotToBytesBigEndian(slot)...)
+		enc = append(enc, signingRoot[:]...)
+		return bkt.Put(pubKey[:], enc)
+	})
+}
+
+// CheckSyncCommitteeMessage returns an error if signing a sync committee message at the
+// given slot would conflict with the latest message recorded for the validator public key:
+// either the slot is lower than that of the latest message, or it is the same slot with a
+// different signing root. Signing the exact same message again is allowed.
+func (s *Store) CheckSyncCommitteeMessage(
+	ctx context.Context, pubKey [48]byte, slot types.Slot, signingRoot [32]byte,
+) error {
+	ctx, span := trace.StartSpan(ctx, "Validator.CheckSyncCommitteeMessage")
+	defer span.End()
+	return s.view(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(syncCommitteeHistoryBucket)
+		// The bucket does not exist in databases opened read-only before it was introduced.
+		if bkt == nil {
+			return nil
+		}
+		existingSlot, existingRoot, ok := decodeSyncCommitteeMessage(bkt.Get(pubKey[:]))
+		if !ok {
+			return nil
+		}
+		if slot < existingSlot {
+			return fmt.Errorf(
+				"sync committee message at slot %d is older than the latest signed message at slot %d",
+				slot,
+				existingSlot,
+			)
+		}
+		if slot == existingSlot && existingRoot != signingRoot {
+			return fmt.Errorf(
+				"sync committee message already signed at slot %d with signing root %#x, incoming signing root %#x",
+				slot,
+				existingRoot,
+				signingRoot,
+			)
+		}
+		return nil
+	})
+}
+
+func decodeSyncCommitteeMessage(enc []byte) (types.Slot, [32]byte, bool) {
+	if len(enc) != syncCommitteeMessageRecordLength {
+		return 0, [32]byte{}, false
+	}
+	return bytesutil.BytesToSlotBigEndian(enc[:8]), bytesutil.ToBytes32(enc[8:]), true
+}
@@ -0,0 +1,46 @@
+package kv
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prysmaticlabs/prysm/shared/testutil/require"
+)
+
+func TestStore_CheckSyncCommitteeMessage(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	db := setupDB(t, [][48]byte{pubKey})
+	root := [32]byte{1}
+	otherRoot := [32]byte{2}
+
+	// Nothing has been signed yet.
+	require.NoError(t, db.CheckSyncCommitteeMessage(ctx, pubKey, 10, root))
+	require.NoError(t, db.SaveSyncCommitteeMessage(ctx, pubKey, 10, root))
+
+	// Signing the same message again is allowed.
+	require.NoError(t, db.CheckSyncCommitteeMessage(ctx, pubKey, 10, root))
+	// A different message at the same slot is not.
+	err := db.CheckSyncCommitteeMessage(ctx, pubKey, 10, otherRoot)
+	require.ErrorContains(t, "already signed at slot 10", err)
+	// Nor is a message at a lower slot.
+	err = db.CheckSyncCommitteeMessage(ctx, pubKey, 9, root)
+	require.ErrorContains(t, "older than the latest signed message at slot 10", err)
+	// A higher slot is allowed.
+	require.NoError(t, db.CheckSyncCommitteeMessage(ctx, pubKey, 11, otherRoot))
+
+	// Other keys are unaffected.
+	require.NoError(t, db.CheckSyncCommitteeMessage(ctx, [48]byte{2}, 9, otherRoot))
+}
+
+func TestStore_SaveSyncCommitteeMessage_KeepsHighestSlot(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	db := setupDB(t, [][48]byte{pubKey})
+	require.NoError(t, db.SaveSyncCommitteeMessage(ctx, pubKey, 20, [32]byte{1}))
+	require.NoError(t, db.SaveSyncCommitteeMessage(ctx, pubKey, 15, [32]byte{2}))
+
+	err := db.CheckSyncCommitteeMessage(ctx, pubKey, 15, [32]byte{2})
+	require.ErrorContains(t, "older than the latest signed message at slot 20", err)
+	require.NoError(t, db.CheckSyncCommitteeMessage(ctx, pubKey, 20, [32]byte{1}))
+}
@@ -1,13 +1,14 @@
 package slashingprotection
 
 import (
-	"encoding/json"
+	"os"
 	"path/filepath"
 
 	"github.com/pkg/errors"
 	"github.com/prysmaticlabs/prysm/cmd/validator/flags"
 	"github.com/prysmaticlabs/prysm/shared/cmd"
 	"github.com/prysmaticlabs/prysm/shared/fileutil"
+	"github.com/prysmaticlabs/prysm/shared/params"
 	"github.com/prysmaticlabs/prysm/validator/accounts/prompt"
 	"github.com/prysmaticlabs/prysm/validator/db/kv"
 	export "github.com/prysmaticlabs/prysm/validator/slashing-protection/local/standard-protection-format"
@@ -56,10 +57,6 @@ func ExportSlashingProtectionJSONCli(cliCtx *cli.Context) error {
 			log.WithError(err).Errorf("Could not close validator DB")
 		}
 	}()
-	eipJSON, err := export.ExportStandardProtectionJSON(cliCtx.Context, validatorDB)
-	if err != nil {
-		return errors.Wrap(err, "could not export slashing protection history")
-	}
 	outputDir, err := prompt.InputDirectory(
 		cliCtx,
 		"Enter your desired output directory for your slashing protection history",
@@ -81,9 +78,28 @@ func ExportSlashingProtectionJSONCli(cliCtx *cli.Context) error {
 		}
 	}
 	outputFilePath := filepath.Join(outputDir, jsonExportFileName)
-	encoded, err := json.MarshalIndent(eipJSON, "", "\t")
+	if fileutil.FileExists(outputFilePath) {
+		info, err := os.Stat(outputFilePath)
+		if err != nil {
+			return err
+		}
+		if info.Mode() != params.BeaconIoConfig().ReadWritePermissions {
+			return errors.New("file already exists without proper 0600 permissions")
+		}
+	}
+	f, err := os.OpenFile(
+		outputFilePath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, params.BeaconIoConfig().ReadWritePermissions,
+	)
 	if err != nil {
-		return errors.Wrap(err, "could not JSON marshal slashing protection history")
+		return errors.Wrapf(err, "could not create slashing protection file %s", outputFilePath)
+	}
+	// The history is streamed to disk to avoid holding the entire
+	// JSON in memory for databases with many validator keys.
+	if err := export.ExportInterchangeData(cliCtx.Context, validatorDB, f); err != nil {
+		if closeErr := f.Close(); closeErr != nil {
+			log.WithError(closeErr).Error("Could not close slashing protection file")
+		}
+		return errors.Wrap(err, "could not export slashing protection history")
 	}
-	return fileutil.WriteFile(outputFilePath, encoded)
+	return f.Close()
 }
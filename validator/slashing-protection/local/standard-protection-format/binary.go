@@ -0,0 +1,364 @@
+package interchangeformat
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+	types "github.com/prysmaticlabs/eth2-types"
+	"github.com/prysmaticlabs/prysm/shared/bytesutil"
+	"github.com/prysmaticlabs/prysm/validator/db"
+	"github.com/prysmaticlabs/prysm/validator/db/kv"
+)
+
+// The binary format is a Prysm specific backup format, which is much smaller and faster
+// to encode and decode than the EIP-3076 interchange JSON but is not understood by other
+// clients. All integers are encoded big-endian. The input starts with 4 magic bytes, a
+// version byte, and the genesis validators root prefixed with its length as a byte, which
+// is either 0 or 32. It is followed by the number of EIP-3076 import blacklisted public keys
+// as a uint32 and each 48 byte blacklisted public key, then by one record per public key,
+// prefixed with its length as a uint32. A record holds the 48 byte public key, its first signed
+// timestamp as uint64 nanoseconds since the Unix epoch or 0 if unknown, the number of proposals
+// as a uint32, each proposal as its uint64 slot and 32 byte signing root, the number of
+// attestations as a uint32, and each attestation as its uint64 source and target epochs, the
+// number of its signing roots as a uint32 and each 32 byte signing root, the first being the
+// one read by the database.
+//
+// Version 1 of the format, which is still imported, has neither blacklisted public keys nor
+// first signed timestamps, and holds a single signing root per attestation without count.
+const (
+	binaryFormatVersion = 2
+	binaryProposalSize  = 8 + 32
+	// Size of an attestation without its signing roots.
+	binaryAttestationSize = 8 + 8 + 4
+	// Records larger than this are rejected on import rather than allocated, as they
+	// can only come from a corrupt file.
+	maxBinaryRecordSize = 1 << 30
+)
+
+var binaryMagic = []byte("PSPB")
+
+// Slashing protection history of a single public key in the binary format.
+type binaryRecord struct {
+	pubKey       [48]byte
+	firstSigned  time.Time
+	proposals    []*kv.Proposal
+	attestations []*binaryAttestation
+}
+
+// Attestation of the binary format, with every signing root stored at its target epoch.
+type binaryAttestation struct {
+	source       types.Epoch
+	target       types.Epoch
+	signingRoots [][32]byte
+}
+
+// ExportBinary streams all slashing protection data from a validator database into the writer
+// in the Prysm specific binary format, one public key at a time and ordered by public key. It is
+// meant as a fast backup format; ExportInterchangeData should be used to move slashing protection
+// data to another client.
+func ExportBinary(ctx context.Context, validatorDB db.Database, w io.Writer) error {
+	genesisValidatorsRoot, err := validatorDB.GenesisValidatorsRoot(ctx)
+	if err != nil {
+		return err
+	}
+	if len(genesisValidatorsRoot) != 0 && len(genesisValidatorsRoot) != 32 {
+		return fmt.Errorf("genesis validators root has length %d, wanted 32", len(genesisValidatorsRoot))
+	}
+	blacklistedPublicKeys, err := validatorDB.EIPImportBlacklistedPublicKeys(ctx)
+	if err != nil {
+		return errors.Wrap(err, "could not get blacklisted public keys")
+	}
+	publicKeys, err := sortedProtectedPublicKeys(ctx, validatorDB)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	header := append(append([]byte{}, binaryMagic...), binaryFormatVersion, byte(len(genesisValidatorsRoot)))
+	header = appendUint32(append(header, genesisValidatorsRoot...), uint32(len(blacklistedPublicKeys)))
+	for _, pubKey := range blacklistedPublicKeys {
+		header = append(header, pubKey[:]...)
+	}
+	if _, err := bw.Write(header); err != nil {
+		return err
+	}
+	for _, pubKey := range publicKeys {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		record, err := binaryRecordByPubKey(ctx, validatorDB, pubKey)
+		if err != nil {
+			return err
+		}
+		if _, err := bw.Write(encodeBinaryRecord(record)); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// Retrieves the slashing protection history of a public key to export in the binary format.
+func binaryRecordByPubKey(ctx context.Context, validatorDB db.Database, pubKey [48]byte) (*binaryRecord, error) {
+	record := &binaryRecord{pubKey: pubKey}
+	firstSigned, exists, err := validatorDB.FirstSignedTimestamp(ctx, pubKey)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not get first signed timestamp for public key %#x", pubKey)
+	}
+	if exists {
+		record.firstSigned = firstSigned
+	}
+	record.proposals, err = validatorDB.ProposalHistoryForPubKey(ctx, pubKey)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not get proposal history for public key %#x", pubKey)
+	}
+	// With minimal slashing protection, a single attestation spans the signed epoch bounds.
+	if validatorDB.MinimalSlashingProtection() {
+		minimalRecord, err := minimalAttestationRecord(ctx, validatorDB, pubKey)
+		if err != nil {
+			return nil, err
+		}
+		if minimalRecord != nil {
+			record.attestations = []*binaryAttestation{{
+				source:       minimalRecord.Source,
+				target:       minimalRecord.Target,
+				signingRoots: [][32]byte{minimalRecord.SigningRoot},
+			}}
+		}
+		return record, nil
+	}
+	history, err := validatorDB.AttestationHistoryForPubKey(ctx, pubKey)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not get attestation history for public key %#x", pubKey)
+	}
+	record.attestations = make([]*binaryAttestation, len(history))
+	for i, att := range history {
+		// A database which keeps all signing roots may hold several at a target epoch.
+		signingRoots, err := validatorDB.SigningRootsAtTargetEpoch(ctx, pubKey, att.Target)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not get signing roots for public key %#x", pubKey)
+		}
+		if len(signingRoots) == 0 {
+			signingRoots = [][32]byte{att.SigningRoot}
+		}
+		record.attestations[i] = &binaryAttestation{
+			source:       att.Source,
+			target:       att.Target,
+			signingRoots: signingRoots,
+		}
+	}
+	return record, nil
+}
+
+// ImportBinary imports slashing protection data exported with ExportBinary into a validator
+// database. The whole input is decoded and validated before anything is written, and it is
+// then written in a single transaction. The genesis validators root must match the one already
+// stored, if any. As the data comes from a Prysm database, it is restored as is, without the
+// slashable public key filtering of the interchange JSON import.
+func ImportBinary(ctx context.Context, validatorDB db.Database, r io.Reader) error {
+	br := bufio.NewReader(r)
+	header := make([]byte, len(binaryMagic)+2)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return errors.Wrap(err, "could not read binary slashing protection header")
+	}
+	if !bytes.Equal(header[:len(binaryMagic)], binaryMagic) {
+		return errors.New("input is not in the binary slashing protection format")
+	}
+	version := header[len(binaryMagic)]
+	if version != 1 && version != binaryFormatVersion {
+		return fmt.Errorf("binary slashing protection version %d is not supported, wanted %d", version, binaryFormatVersion)
+	}
+	rootLength := header[len(binaryMagic)+1]
+	if rootLength != 0 && rootLength != 32 {
+		return fmt.Errorf("genesis validators root has length %d, wanted 32", rootLength)
+	}
+	genesisValidatorsRoot := make([]byte, rootLength)
+	if _, err := io.ReadFull(br, genesisValidatorsRoot); err != nil {
+		return errors.Wrap(err, "could not read genesis validators root")
+	}
+	blacklistedPublicKeys := make([][48]byte, 0)
+	if version > 1 {
+		var count [4]byte
+		if _, err := io.ReadFull(br, count[:]); err != nil {
+			return errors.Wrap(err, "could not read number of blacklisted public keys")
+		}
+		for i := uint32(0); i < binary.BigEndian.Uint32(count[:]); i++ {
+			var pubKey [48]byte
+			if _, err := io.ReadFull(br, pubKey[:]); err != nil {
+				return errors.Wrap(err, "could not read blacklisted public key")
+			}
+			blacklistedPublicKeys = append(blacklistedPublicKeys, pubKey)
+		}
+	}
+
+	data := &kv.InterchangeData{
+		GenesisValidatorsRoot: genesisValidatorsRoot,
+		Attestations:          make(map[[48]byte][]*kv.AttestationRecord),
+		Proposals:             make(map[[48]byte][]kv.Proposal),
+		FirstSignedTimestamps: make(map[[48]byte]time.Time),
+		SlashablePublicKeys:   blacklistedPublicKeys,
+	}
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var length [4]byte
+		if _, err := io.ReadFull(br, length[:]); err == io.EOF {
+			break
+		} else if err != nil {
+			return errors.Wrap(err, "could not read binary slashing protection record length")
+		}
+		size := binary.BigEndian.Uint32(length[:])
+		if size > maxBinaryRecordSize {
+			return fmt.Errorf("binary slashing protection record of %d bytes is too large", size)
+		}
+		enc := make([]byte, size)
+		if _, err := io.ReadFull(br, enc); err != nil {
+			return errors.Wrap(err, "could not read binary slashing protection record")
+		}
+		record, err := decodeBinaryRecord(enc, version)
+		if err != nil {
+			return err
+		}
+		for _, proposal := range record.proposals {
+			data.Proposals[record.pubKey] = append(data.Proposals[record.pubKey], *proposal)
+		}
+		for _, att := range record.attestations {
+			// The first signing root is written first, so that the database keeps reading it.
+			for _, signingRoot := range att.signingRoots {
+				data.Attestations[record.pubKey] = append(data.Attestations[record.pubKey], &kv.AttestationRecord{
+					PubKey:      record.pubKey,
+					Source:      att.source,
+					Target:      att.target,
+					SigningRoot: signingRoot,
+				})
+			}
+		}
+		if !record.firstSigned.IsZero() {
+			data.FirstSignedTimestamps[record.pubKey] = record.firstSigned
+		}
+	}
+
+	if len(genesisValidatorsRoot) != 0 {
+		storedRoot, err := validatorDB.GenesisValidatorsRoot(ctx)
+		if err != nil {
+			return errors.Wrap(err, "could not retrieve genesis validator root from db")
+		}
+		if storedRoot != nil && !bytes.Equal(storedRoot, genesisValidatorsRoot) {
+			return errGenesisRootMismatch
+		}
+	}
+	if err := validatorDB.ImportInterchangeData(ctx, data); err != nil {
+		return errors.Wrap(err, "could not save binary slashing protection data to database")
+	}
+	return nil
+}
+
+// Encodes the slashing protection history of a public key, prefixed with its length.
+func encodeBinaryRecord(record *binaryRecord) []byte {
+	size := 48 + 8 + 4 + len(record.proposals)*binaryProposalSize + 4
+	for _, att := range record.attestations {
+		size += binaryAttestationSize + len(att.signingRoots)*32
+	}
+	enc := make([]byte, 0, 4+size)
+	enc = appendUint32(enc, uint32(size))
+	enc = append(enc, record.pubKey[:]...)
+	var firstSigned uint64
+	if !record.firstSigned.IsZero() {
+		firstSigned = uint64(record.firstSigned.UnixNano())
+	}
+	enc = append(enc, bytesutil.Uint64ToBytesBigEndian(firstSigned)...)
+	enc = appendUint32(enc, uint32(len(record.proposals)))
+	for _, proposal := range record.proposals {
+		signingRoot := bytesutil.ToBytes32(proposal.SigningRoot)
+		enc = append(enc, bytesutil.Uint64ToBytesBigEndian(uint64(proposal.Slot))...)
+		enc = append(enc, signingRoot[:]...)
+	}
+	enc = appendUint32(enc, uint32(len(record.attestations)))
+	for _, att := range record.attestations {
+		enc = append(enc, bytesutil.Uint64ToBytesBigEndian(uint64(att.source))...)
+		enc = append(enc, bytesutil.Uint64ToBytesBigEndian(uint64(att.target))...)
+		enc = appendUint32(enc, uint32(len(att.signingRoots)))
+		for _, signingRoot := range att.signingRoots {
+			enc = append(enc, signingRoot[:]...)
+		}
+	}
+	return enc
+}
+
+// Decodes the slashing protection history of a public key in the given
+// version of the binary format, without its length prefix.
+func decodeBinaryRecord(enc []byte, version byte) (*binaryRecord, error) {
+	headerSize := 48 + 4
+	if version > 1 {
+		headerSize += 8
+	}
+	if len(enc) < headerSize {
+		return nil, fmt.Errorf("binary slashing protection record of %d bytes is too short", len(enc))
+	}
+	record := &binaryRecord{pubKey: bytesutil.ToBytes48(enc[:48])}
+	enc = enc[48:]
+	if version > 1 {
+		if firstSigned := binary.BigEndian.Uint64(enc[:8]); firstSigned != 0 {
+			record.firstSigned = time.Unix(0, int64(firstSigned))
+		}
+		enc = enc[8:]
+	}
+	numProposals := uint64(binary.BigEndian.Uint32(enc[:4]))
+	enc = enc[4:]
+	if uint64(len(enc)) < numProposals*binaryProposalSize+4 {
+		return nil, fmt.Errorf("binary slashing protection record of public key %#x is truncated", record.pubKey)
+	}
+	record.proposals = make([]*kv.Proposal, numProposals)
+	for i := range record.proposals {
+		record.proposals[i] = &kv.Proposal{
+			Slot:        types.Slot(binary.BigEndian.Uint64(enc[:8])),
+			SigningRoot: append([]byte{}, enc[8:binaryProposalSize]...),
+		}
+		enc = enc[binaryProposalSize:]
+	}
+	numAttestations := uint64(binary.BigEndian.Uint32(enc[:4]))
+	enc = enc[4:]
+	record.attestations = make([]*binaryAttestation, 0, numAttestations)
+	for i := uint64(0); i < numAttestations; i++ {
+		// Version 1 attestations hold a single signing root without count.
+		attestationSize, numRoots := uint64(8+8), uint64(1)
+		if version > 1 {
+			attestationSize = binaryAttestationSize
+			if uint64(len(enc)) >= attestationSize {
+				numRoots = uint64(binary.BigEndian.Uint32(enc[16:20]))
+			}
+		}
+		if uint64(len(enc)) < attestationSize+numRoots*32 {
+			return nil, fmt.Errorf("binary slashing protection record of public key %#x is truncated", record.pubKey)
+		}
+		att := &binaryAttestation{
+			source:       types.Epoch(binary.BigEndian.Uint64(enc[:8])),
+			target:       types.Epoch(binary.BigEndian.Uint64(enc[8:16])),
+			signingRoots: make([][32]byte, numRoots),
+		}
+		enc = enc[attestationSize:]
+		for j := range att.signingRoots {
+			att.signingRoots[j] = bytesutil.ToBytes32(enc[:32])
+			enc = enc[32:]
+		}
+		record.attestations = append(record.attestations, att)
+	}
+	if len(enc) != 0 {
+		return nil, fmt.Errorf(
+			"binary slashing protection record of public key %#x has %d trailing bytes", record.pubKey, len(enc),
+		)
+	}
+	return record, nil
+}
+
+func appendUint32(enc []byte, i uint32) []byte {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], i)
+	return append(enc, b[:]...)
+}
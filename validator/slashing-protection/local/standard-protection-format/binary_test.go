@@ -0,0 +1,194 @@
+package interchangeformat_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	types "github.com/prysmaticlabs/eth2-types"
+	ethpb "github.com/prysmaticlabs/prysm/proto/eth/v1alpha1"
+	"github.com/prysmaticlabs/prysm/shared/testutil/assert"
+	"github.com/prysmaticlabs/prysm/shared/testutil/require"
+	"github.com/prysmaticlabs/prysm/validator/db/kv"
+	dbtest "github.com/prysmaticlabs/prysm/validator/db/testing"
+	protectionFormat "github.com/prysmaticlabs/prysm/validator/slashing-protection/local/standard-protection-format"
+	slashtest "github.com/prysmaticlabs/prysm/validator/testing"
+)
+
+func TestImportExportBinary_RoundTrip(t *testing.T) {
+	ctx := context.Background()
+	numValidators := 10
+	publicKeys, err := slashtest.CreateRandomPubKeys(numValidators)
+	require.NoError(t, err)
+	validatorDB := dbtest.SetupDB(t, publicKeys)
+
+	attestingHistory, proposalHistory := slashtest.MockAttestingAndProposalHistories(numValidators)
+	wanted, err := slashtest.MockSlashingProtectionJSON(publicKeys, attestingHistory, proposalHistory)
+	require.NoError(t, err)
+	blob, err := json.Marshal(wanted)
+	require.NoError(t, err)
+	require.NoError(t, protectionFormat.ImportStandardProtectionJSON(ctx, validatorDB, bytes.NewBuffer(blob)))
+
+	interchange := new(bytes.Buffer)
+	require.NoError(t, protectionFormat.ExportInterchangeData(ctx, validatorDB, interchange))
+	binaryExport := new(bytes.Buffer)
+	require.NoError(t, protectionFormat.ExportBinary(ctx, validatorDB, binaryExport))
+	assert.Equal(t, true, binaryExport.Len() < interchange.Len())
+
+	// Importing the binary export into a fresh database restores the exact same history.
+	freshDB := dbtest.SetupDB(t, publicKeys)
+	require.NoError(t, protectionFormat.ImportBinary(ctx, freshDB, binaryExport))
+	reexported := new(bytes.Buffer)
+	require.NoError(t, protectionFormat.ExportInterchangeData(ctx, freshDB, reexported))
+	require.DeepEqual(t, interchange.Bytes(), reexported.Bytes())
+}
+
+func TestImportExportBinary_RoundTrip_Complete(t *testing.T) {
+	ctx := context.Background()
+	pubKeys := [][48]byte{{1}, {2}}
+	setupKeepAllDB := func() *kv.Store {
+		validatorDB, err := kv.NewKVStore(ctx, t.TempDir(), &kv.Config{PubKeys: pubKeys, KeepAllSigningRoots: true})
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			require.NoError(t, validatorDB.Close())
+		})
+		return validatorDB
+	}
+	validatorDB := setupKeepAllDB()
+	require.NoError(t, validatorDB.SaveGenesisValidatorsRoot(ctx, make([]byte, 32)))
+	require.NoError(t, validatorDB.SaveEIPImportBlacklistedPublicKeys(ctx, [][48]byte{{9}}))
+	require.NoError(t, validatorDB.SaveAttestationForPubKey(ctx, pubKeys[0], [32]byte{1}, &ethpb.IndexedAttestation{
+		Data: &ethpb.AttestationData{
+			Source: &ethpb.Checkpoint{Epoch: 1},
+			Target: &ethpb.Checkpoint{Epoch: 2},
+		},
+	}))
+	require.NoError(t, validatorDB.SaveAttestationRecordsForPubKey(ctx, pubKeys[0], []*kv.AttestationRecord{
+		{PubKey: pubKeys[0], Source: 1, Target: 2, SigningRoot: [32]byte{3}},
+		{PubKey: pubKeys[0], Source: 2, Target: 5},
+	}))
+	require.NoError(t, validatorDB.SaveProposalHistoryForSlot(ctx, pubKeys[1], 10, []byte{10}))
+	firstSigned, exists, err := validatorDB.FirstSignedTimestamp(ctx, pubKeys[0])
+	require.NoError(t, err)
+	require.Equal(t, true, exists)
+	binaryExport := new(bytes.Buffer)
+	require.NoError(t, protectionFormat.ExportBinary(ctx, validatorDB, binaryExport))
+
+	// Every signing root, the blacklisted public keys and the first signed timestamps are restored,
+	// so that exporting the restored database again gives the same bytes.
+	freshDB := setupKeepAllDB()
+	require.NoError(t, protectionFormat.ImportBinary(ctx, freshDB, bytes.NewReader(binaryExport.Bytes())))
+	reexported := new(bytes.Buffer)
+	require.NoError(t, protectionFormat.ExportBinary(ctx, freshDB, reexported))
+	require.DeepEqual(t, binaryExport.Bytes(), reexported.Bytes())
+	signingRoots, err := freshDB.SigningRootsAtTargetEpoch(ctx, pubKeys[0], 2)
+	require.NoError(t, err)
+	assert.DeepEqual(t, [][32]byte{{1}, {3}}, signingRoots)
+	blacklisted, err := freshDB.EIPImportBlacklistedPublicKeys(ctx)
+	require.NoError(t, err)
+	assert.DeepEqual(t, [][48]byte{{9}}, blacklisted)
+	restoredFirstSigned, exists, err := freshDB.FirstSignedTimestamp(ctx, pubKeys[0])
+	require.NoError(t, err)
+	require.Equal(t, true, exists)
+	assert.Equal(t, true, firstSigned.Equal(restoredFirstSigned))
+	_, exists, err = freshDB.FirstSignedTimestamp(ctx, pubKeys[1])
+	require.NoError(t, err)
+	assert.Equal(t, false, exists)
+	proposals, err := freshDB.ProposalHistoryForPubKey(ctx, pubKeys[1])
+	require.NoError(t, err)
+	require.Equal(t, 1, len(proposals))
+	assert.Equal(t, types.Slot(10), proposals[0].Slot)
+
+	// A database which keeps a single signing root per target epoch keeps the first one.
+	singleRootDB := dbtest.SetupDB(t, pubKeys)
+	require.NoError(t, protectionFormat.ImportBinary(ctx, singleRootDB, bytes.NewReader(binaryExport.Bytes())))
+	signingRoot, exists, err := singleRootDB.SigningRootAtTarget(ctx, pubKeys[0], 2)
+	require.NoError(t, err)
+	require.Equal(t, true, exists)
+	assert.Equal(t, [32]byte{1}, signingRoot)
+}
+
+func TestImportBinary_Version1(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	enc := append([]byte("PSPB"), 1 /* version */, 0 /* genesis validators root length */)
+	record := append(append([]byte{}, pubKey[:]...), 0, 0, 0, 0 /* proposals */, 0, 0, 0, 1 /* attestations */)
+	record = append(record, 0, 0, 0, 0, 0, 0, 0, 1 /* source */, 0, 0, 0, 0, 0, 0, 0, 2 /* target */)
+	record = append(record, bytes.Repeat([]byte{2}, 32)...)
+	enc = append(append(enc, 0, 0, 0, byte(len(record))), record...)
+
+	validatorDB := dbtest.SetupDB(t, [][48]byte{pubKey})
+	require.NoError(t, protectionFormat.ImportBinary(ctx, validatorDB, bytes.NewReader(enc)))
+	history, err := validatorDB.AttestationHistoryForPubKey(ctx, pubKey)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(history))
+	assert.Equal(t, types.Epoch(2), history[0].Target)
+	assert.DeepEqual(t, bytes.Repeat([]byte{2}, 32), history[0].SigningRoot[:])
+}
+
+func TestImportExportBinary_RoundTrip_MinimalSlashingProtection(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	validatorDB := setupMinimalDB(t, [][48]byte{pubKey})
+	require.NoError(t, validatorDB.SaveAttestationRecordsForPubKey(ctx, pubKey, []*kv.AttestationRecord{
+		{PubKey: pubKey, Source: 1, Target: 2, SigningRoot: [32]byte{2}},
+		{PubKey: pubKey, Source: 4, Target: 6, SigningRoot: [32]byte{6}},
+	}))
+	binaryExport := new(bytes.Buffer)
+	require.NoError(t, protectionFormat.ExportBinary(ctx, validatorDB, binaryExport))
+
+	// The signed epoch bounds are restored from the single attestation spanning them.
+	freshDB := setupMinimalDB(t, [][48]byte{pubKey})
+	require.NoError(t, protectionFormat.ImportBinary(ctx, freshDB, binaryExport))
+	lowestSource, exists, err := freshDB.LowestSignedSourceEpoch(ctx, pubKey)
+	require.NoError(t, err)
+	require.Equal(t, true, exists)
+	assert.Equal(t, types.Epoch(1), lowestSource)
+	highestTarget, exists, err := freshDB.HighestSignedTargetEpoch(ctx, pubKey)
+	require.NoError(t, err)
+	require.Equal(t, true, exists)
+	assert.Equal(t, types.Epoch(6), highestTarget)
+	slashingKind, err := freshDB.CheckSlashableAttestation(ctx, pubKey, [32]byte{7}, &ethpb.IndexedAttestation{
+		Data: &ethpb.AttestationData{
+			Source: &ethpb.Checkpoint{Epoch: 5},
+			Target: &ethpb.Checkpoint{Epoch: 6},
+		},
+	})
+	require.NotNil(t, err)
+	assert.Equal(t, kv.MinimalProtectionViolation, slashingKind)
+}
+
+func TestImportBinary_InvalidInput(t *testing.T) {
+	ctx := context.Background()
+	publicKeys, err := slashtest.CreateRandomPubKeys(1)
+	require.NoError(t, err)
+	validatorDB := dbtest.SetupDB(t, publicKeys)
+	attestingHistory, proposalHistory := slashtest.MockAttestingAndProposalHistories(1)
+	wanted, err := slashtest.MockSlashingProtectionJSON(publicKeys, attestingHistory, proposalHistory)
+	require.NoError(t, err)
+	blob, err := json.Marshal(wanted)
+	require.NoError(t, err)
+	require.NoError(t, protectionFormat.ImportStandardProtectionJSON(ctx, validatorDB, bytes.NewBuffer(blob)))
+	exported := new(bytes.Buffer)
+	require.NoError(t, protectionFormat.ExportBinary(ctx, validatorDB, exported))
+	enc := exported.Bytes()
+
+	freshDB := dbtest.SetupDB(t, publicKeys)
+	err = protectionFormat.ImportBinary(ctx, freshDB, bytes.NewReader(blob))
+	require.ErrorContains(t, "input is not in the binary slashing protection format", err)
+
+	err = protectionFormat.ImportBinary(ctx, freshDB, bytes.NewReader(enc[:len(enc)-1]))
+	require.ErrorContains(t, "could not read binary slashing protection record", err)
+	// Nothing is written when the input cannot be fully decoded.
+	history, err := freshDB.AttestationHistoryForPubKey(ctx, publicKeys[0])
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(history))
+
+	otherRoot := make([]byte, 32)
+	otherRoot[0] = 0xff
+	otherDB := dbtest.SetupDB(t, publicKeys)
+	require.NoError(t, otherDB.SaveGenesisValidatorsRoot(ctx, otherRoot))
+	err = protectionFormat.ImportBinary(ctx, otherDB, bytes.NewReader(enc))
+	require.ErrorContains(t, "genesis validator root doesnt match", err)
+}
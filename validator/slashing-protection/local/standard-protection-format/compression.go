@@ -0,0 +1,37 @@
+package interchangeformat
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+)
+
+// zstdMagic is the magic number every zstd frame starts with.
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// maxDecompressionMemory caps the memory the zstd decoder may allocate for the window of
+// compressed interchange data, so that a crafted file cannot make it allocate without bound.
+const maxDecompressionMemory = 256 << 20
+
+// Returns a reader of the decompressed interchange data if the data read from r is zstd
+// compressed, which is detected from its first bytes, or a reader of the data as is. A JSON
+// document can never start with the zstd magic number, so plain interchange files are never
+// mistaken for compressed ones. The returned function releases the decoder, if any.
+func maybeDecompress(r io.Reader) (io.Reader, func(), error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return nil, nil, errors.Wrap(err, "could not read slashing protection JSON file")
+	}
+	if !bytes.Equal(magic, zstdMagic) {
+		return br, func() {}, nil
+	}
+	decoder, err := zstd.NewReader(br, zstd.WithDecoderMaxMemory(maxDecompressionMemory))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "could not initialize zstd decoder")
+	}
+	return decoder, decoder.Close, nil
+}
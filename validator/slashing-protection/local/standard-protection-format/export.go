@@ -1,16 +1,24 @@
 package interchangeformat
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"sort"
 	"strings"
 
+	"github.com/klauspost/compress/zstd"
 	"github.com/pkg/errors"
+	types "github.com/prysmaticlabs/eth2-types"
+	"github.com/prysmaticlabs/prysm/beacon-chain/core/helpers"
+	"github.com/prysmaticlabs/prysm/shared/bytesutil"
 	"github.com/prysmaticlabs/prysm/shared/params"
 	"github.com/prysmaticlabs/prysm/shared/progressutil"
 	"github.com/prysmaticlabs/prysm/validator/db"
+	"github.com/prysmaticlabs/prysm/validator/db/kv"
 	"github.com/prysmaticlabs/prysm/validator/slashing-protection/local/standard-protection-format/format"
 )
 
@@ -108,7 +116,271 @@ func ExportStandardProtectionJSON(ctx context.Context, validatorDB db.Database)
 	return interchangeJSON, nil
 }
 
+// ExportOptions configures how slashing protection data is exported.
+type ExportOptions struct {
+	// Compress wraps the output in zstd compression. Compressed files are detected
+	// and decompressed automatically on import.
+	Compress bool
+}
+
+// ExportInterchangeData streams all slashing protection data from a validator database
+// into the writer as an EIP-3076 compliant, complete interchange JSON. Rather than building
+// the entire JSON in memory, the history of each public key is encoded and written one at a time.
+// Entries are ordered by public key, and within an entry attestations are ordered by target
+// epoch and blocks by slot, so that exports of the same database are byte-for-byte identical.
+func ExportInterchangeData(ctx context.Context, validatorDB db.Database, w io.Writer) error {
+	return ExportInterchangeDataWithOptions(ctx, validatorDB, w, ExportOptions{})
+}
+
+// ExportInterchangeDataWithOptions streams all slashing protection data from a validator
+// database into the writer as ExportInterchangeData does. If opts.Compress is set, the
+// interchange JSON is zstd compressed as it is written.
+func ExportInterchangeDataWithOptions(ctx context.Context, validatorDB db.Database, w io.Writer, opts ExportOptions) error {
+	publicKeys, err := sortedProtectedPublicKeys(ctx, validatorDB)
+	if err != nil {
+		return err
+	}
+	if !opts.Compress {
+		return writeInterchangeData(ctx, validatorDB, w, publicKeys, false /* skipEmpty */, 0 /* sinceEpoch */)
+	}
+	encoder, err := zstd.NewWriter(w)
+	if err != nil {
+		return errors.Wrap(err, "could not initialize zstd encoder")
+	}
+	if err := writeInterchangeData(ctx, validatorDB, encoder, publicKeys, false /* skipEmpty */, 0 /* sinceEpoch */); err != nil {
+		_ = encoder.Close()
+		return err
+	}
+	if err := encoder.Close(); err != nil {
+		return errors.Wrap(err, "could not flush zstd compressed slashing protection data")
+	}
+	return nil
+}
+
+// ExportInterchangeDataForKeys streams the slashing protection data of only the specified
+// public keys into the writer, in the same format and order as ExportInterchangeData.
+// Public keys without any slashing protection history are skipped with a warning.
+func ExportInterchangeDataForKeys(ctx context.Context, validatorDB db.Database, w io.Writer, pubKeys [][48]byte) error {
+	seen := make(map[[48]byte]bool, len(pubKeys))
+	publicKeys := make([][48]byte, 0, len(pubKeys))
+	for _, pubKey := range pubKeys {
+		if seen[pubKey] {
+			continue
+		}
+		seen[pubKey] = true
+		publicKeys = append(publicKeys, pubKey)
+	}
+	sort.Slice(publicKeys, func(i, j int) bool {
+		return bytes.Compare(publicKeys[i][:], publicKeys[j][:]) < 0
+	})
+	return writeInterchangeData(ctx, validatorDB, w, publicKeys, true /* skipEmpty */, 0 /* sinceEpoch */)
+}
+
+// ExportInterchangeDataSince streams the slashing protection data of all public keys into the
+// writer, in the same format and order as ExportInterchangeData, but only with the attestations
+// whose target epoch is at least sinceEpoch and the blocks from the start slot of sinceEpoch.
+// The output is a standalone interchange JSON, as EIP-3076 permits partial histories, which
+// makes it cheap to take frequent incremental backups. On its own it only protects against
+// slashing relative to the exported records, so it should be imported along with the earlier
+// backups it follows.
+func ExportInterchangeDataSince(ctx context.Context, validatorDB db.Database, w io.Writer, sinceEpoch types.Epoch) error {
+	publicKeys, err := sortedProtectedPublicKeys(ctx, validatorDB)
+	if err != nil {
+		return err
+	}
+	return writeInterchangeData(ctx, validatorDB, w, publicKeys, false /* skipEmpty */, sinceEpoch)
+}
+
+// ExportInterchangeNDJSON streams all slashing protection data from a validator database into
+// the writer as newline-delimited JSON, which is easier to process incrementally or to diff than
+// a single interchange JSON. Each line holds the history of one public key, encoded as an entry of
+// the "data" list of the EIP-3076 format, in the same order as ExportInterchangeData. The
+// interchange metadata is not part of the output.
+func ExportInterchangeNDJSON(ctx context.Context, validatorDB db.Database, w io.Writer) error {
+	publicKeys, err := sortedProtectedPublicKeys(ctx, validatorDB)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	// The encoder terminates every value it writes with a newline.
+	enc := json.NewEncoder(bw)
+	for _, pubKey := range publicKeys {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		item, err := protectionDataByPubKey(ctx, validatorDB, pubKey)
+		if err != nil {
+			return err
+		}
+		if err := enc.Encode(item); err != nil {
+			return errors.Wrapf(err, "could not write slashing protection data for public key %#x", pubKey)
+		}
+	}
+	return bw.Flush()
+}
+
+// Writes the EIP-3076 interchange JSON for the given public keys, encoding
+// the history of each public key one at a time. Records older than sinceEpoch
+// are left out of the history.
+func writeInterchangeData(
+	ctx context.Context, validatorDB db.Database, w io.Writer, publicKeys [][48]byte, skipEmpty bool, sinceEpoch types.Epoch,
+) error {
+	sinceSlot, err := helpers.StartSlot(sinceEpoch)
+	if err != nil {
+		return err
+	}
+	genesisValidatorsRoot, err := validatorDB.GenesisValidatorsRoot(ctx)
+	if err != nil {
+		return err
+	}
+	genesisRootHex, err := rootToHexString(genesisValidatorsRoot)
+	if err != nil {
+		return err
+	}
+	interchangeJSON := &format.EIPSlashingProtectionFormat{}
+	interchangeJSON.Metadata.GenesisValidatorsRoot = genesisRootHex
+	interchangeJSON.Metadata.InterchangeFormatVersion = format.InterchangeFormatVersion
+	encodedMetadata, err := json.Marshal(interchangeJSON.Metadata)
+	if err != nil {
+		return errors.Wrap(err, "could not marshal slashing protection metadata")
+	}
+
+	bw := bufio.NewWriter(w)
+	if _, err := fmt.Fprintf(bw, `{"metadata":%s,"data":[`, encodedMetadata); err != nil {
+		return err
+	}
+	numWritten := 0
+	for _, pubKey := range publicKeys {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		item, err := protectionDataByPubKey(ctx, validatorDB, pubKey)
+		if err != nil {
+			return err
+		}
+		if sinceEpoch > 0 {
+			if err := filterProtectionDataSince(item, sinceEpoch, sinceSlot); err != nil {
+				return err
+			}
+		}
+		if skipEmpty && len(item.SignedBlocks) == 0 && len(item.SignedAttestations) == 0 {
+			log.WithField("publicKey", fmt.Sprintf("%#x", bytesutil.Trunc(pubKey[:]))).Warn(
+				"No slashing protection history to export for public key, skipping",
+			)
+			continue
+		}
+		encodedItem, err := json.Marshal(item)
+		if err != nil {
+			return errors.Wrapf(err, "could not marshal slashing protection data for public key %#x", pubKey)
+		}
+		if numWritten > 0 {
+			if err := bw.WriteByte(','); err != nil {
+				return err
+			}
+		}
+		if _, err := bw.Write(encodedItem); err != nil {
+			return err
+		}
+		numWritten++
+	}
+	if _, err := bw.WriteString("]}"); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// Retrieves the union of all public keys with a proposal or attestation
+// history in the database, sorted in ascending byte order.
+func sortedProtectedPublicKeys(ctx context.Context, validatorDB db.Database) ([][48]byte, error) {
+	proposedPublicKeys, err := validatorDB.ProposedPublicKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	attestedPublicKeys, err := validatorDB.AttestedPublicKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[[48]byte]bool, len(proposedPublicKeys)+len(attestedPublicKeys))
+	publicKeys := make([][48]byte, 0, len(proposedPublicKeys)+len(attestedPublicKeys))
+	for _, pubKey := range append(proposedPublicKeys, attestedPublicKeys...) {
+		if seen[pubKey] {
+			continue
+		}
+		seen[pubKey] = true
+		publicKeys = append(publicKeys, pubKey)
+	}
+	sort.Slice(publicKeys, func(i, j int) bool {
+		return bytes.Compare(publicKeys[i][:], publicKeys[j][:]) < 0
+	})
+	return publicKeys, nil
+}
+
+// Retrieves the signed blocks and signed attestations of a single public key
+// in the EIP-3076 format. Empty histories are represented as empty lists.
+func protectionDataByPubKey(ctx context.Context, validatorDB db.Database, pubKey [48]byte) (*format.ProtectionData, error) {
+	pubKeyHex, err := pubKeyToHexString(pubKey[:])
+	if err != nil {
+		return nil, err
+	}
+	signedBlocks, err := signedBlocksByPubKey(ctx, validatorDB, pubKey)
+	if err != nil {
+		return nil, err
+	}
+	signedAttestations, err := signedAttestationsByPubKey(ctx, validatorDB, pubKey)
+	if err != nil {
+		return nil, err
+	}
+	if signedAttestations == nil {
+		signedAttestations = make([]*format.SignedAttestation, 0)
+	}
+	return &format.ProtectionData{
+		Pubkey:             pubKeyHex,
+		SignedBlocks:       signedBlocks,
+		SignedAttestations: signedAttestations,
+	}, nil
+}
+
+// Removes the attestations with a target epoch lower than sinceEpoch and
+// the blocks with a slot lower than sinceSlot from the history of a public key.
+func filterProtectionDataSince(item *format.ProtectionData, sinceEpoch types.Epoch, sinceSlot types.Slot) error {
+	signedAttestations := make([]*format.SignedAttestation, 0, len(item.SignedAttestations))
+	for _, att := range item.SignedAttestations {
+		target, err := EpochFromString(att.TargetEpoch)
+		if err != nil {
+			return err
+		}
+		if target >= sinceEpoch {
+			signedAttestations = append(signedAttestations, att)
+		}
+	}
+	signedBlocks := make([]*format.SignedBlock, 0, len(item.SignedBlocks))
+	for _, block := range item.SignedBlocks {
+		slot, err := SlotFromString(block.Slot)
+		if err != nil {
+			return err
+		}
+		if slot >= sinceSlot {
+			signedBlocks = append(signedBlocks, block)
+		}
+	}
+	item.SignedAttestations = signedAttestations
+	item.SignedBlocks = signedBlocks
+	return nil
+}
+
 func signedAttestationsByPubKey(ctx context.Context, validatorDB db.Database, pubKey [48]byte) ([]*format.SignedAttestation, error) {
+	// With minimal slashing protection, only the signed epoch bounds of a public key are stored,
+	// which are exported as the single attestation without signing root of the minimal EIP-3076 format.
+	if validatorDB.MinimalSlashingProtection() {
+		record, err := minimalAttestationRecord(ctx, validatorDB, pubKey)
+		if err != nil || record == nil {
+			return nil, err
+		}
+		return []*format.SignedAttestation{{
+			TargetEpoch: fmt.Sprintf("%d", record.Target),
+			SourceEpoch: fmt.Sprintf("%d", record.Source),
+		}}, nil
+	}
 	// If a key does not have an attestation history in our database, we return nil.
 	// This way, a user will be able to export their slashing protection history
 	// even if one of their keys does not have a history of signed attestations.
@@ -119,6 +391,14 @@ func signedAttestationsByPubKey(ctx context.Context, validatorDB db.Database, pu
 	if history == nil {
 		return nil, nil
 	}
+	// Records are stored by source epoch, so we order them by target epoch
+	// to produce a deterministic history.
+	sort.SliceStable(history, func(i, j int) bool {
+		if history[i].Target == history[j].Target {
+			return history[i].Source < history[j].Source
+		}
+		return history[i].Target < history[j].Target
+	})
 	signedAttestations := make([]*format.SignedAttestation, 0)
 	for _, att := range history {
 		var root string
@@ -137,6 +417,28 @@ func signedAttestationsByPubKey(ctx context.Context, validatorDB db.Database, pu
 	return signedAttestations, nil
 }
 
+// Returns an attestation record spanning the lowest signed source epoch and the highest signed
+// target epoch of a public key, without signing root, or nil if the public key has no bounds.
+// Importing it restores the bounds, which are all that minimal slashing protection checks against.
+func minimalAttestationRecord(ctx context.Context, validatorDB db.Database, pubKey [48]byte) (*kv.AttestationRecord, error) {
+	lowestSource, sourceExists, err := validatorDB.LowestSignedSourceEpoch(ctx, pubKey)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not get lowest signed source epoch for public key %#x", pubKey)
+	}
+	highestTarget, targetExists, err := validatorDB.HighestSignedTargetEpoch(ctx, pubKey)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not get highest signed target epoch for public key %#x", pubKey)
+	}
+	if !sourceExists || !targetExists {
+		return nil, nil
+	}
+	return &kv.AttestationRecord{
+		PubKey: pubKey,
+		Source: lowestSource,
+		Target: highestTarget,
+	}, nil
+}
+
 func signedBlocksByPubKey(ctx context.Context, validatorDB db.Database, pubKey [48]byte) ([]*format.SignedBlock, error) {
 	// If a key does not have a lowest or highest signed proposal history
 	// in our database, we return nil. This way, a user will be able to export their
@@ -6,7 +6,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
+	"sort"
+	"strings"
 
 	"github.com/pkg/errors"
 	types "github.com/prysmaticlabs/eth2-types"
@@ -16,40 +17,131 @@ import (
 	"github.com/prysmaticlabs/prysm/validator/db"
 	"github.com/prysmaticlabs/prysm/validator/db/kv"
 	"github.com/prysmaticlabs/prysm/validator/slashing-protection/local/standard-protection-format/format"
+	"github.com/sirupsen/logrus"
 )
 
+// ImportOptions configures how slashing protection data is imported.
+type ImportOptions struct {
+	// DryRun parses and validates the whole file, including the genesis validators
+	// root check, but does not write anything to the validator database.
+	DryRun bool
+	// AllowGenesisRootMismatch downgrades a mismatch between the genesis validators root
+	// of the file and the one stored in the validator database from an error to a warning,
+	// and imports the data anyway. The stored genesis validators root is kept.
+	//
+	// WARNING: this is only meant for ephemeral testnets which deliberately reuse a
+	// database across genesis roots. On mainnet, a mismatch almost always means the file
+	// comes from a different network, and importing it mixes the slashing protection
+	// histories of two chains. Leave this disabled unless you know exactly why the roots
+	// differ.
+	AllowGenesisRootMismatch bool
+}
+
+var errGenesisRootMismatch = errors.New("genesis validator root doesnt match the one that is stored in slashing protection db. " +
+	"Please make sure you import the protection data that is relevant to the chain you are on")
+
+// AttestationConflict describes an imported attestation which is slashable with
+// respect to the attesting history stored in the validator database.
+type AttestationConflict struct {
+	PubKey [48]byte
+	Source types.Epoch
+	Target types.Epoch
+	Kind   kv.SlashingKind
+}
+
+// ConflictError is returned, before anything is written, when imported attestations
+// conflict with the attesting history in the database. It holds the first conflicting
+// attestation of every affected public key, ordered by public key.
+type ConflictError struct {
+	Conflicts []*AttestationConflict
+}
+
+func (e *ConflictError) Error() string {
+	conflicts := make([]string, len(e.Conflicts))
+	for i, c := range e.Conflicts {
+		conflicts[i] = fmt.Sprintf("%#x (source %d, target %d)", c.PubKey, c.Source, c.Target)
+	}
+	return fmt.Sprintf(
+		"imported attestations for %d public keys conflict with existing slashing protection history: %s",
+		len(e.Conflicts),
+		strings.Join(conflicts, ", "),
+	)
+}
+
+// ImportSummary describes the slashing protection data an import added,
+// or would add in the case of a dry run.
+type ImportSummary struct {
+	// PubKeys maps each imported public key to the amount of records added for it.
+	PubKeys map[[48]byte]*PubKeyImportSummary
+	// SlashablePublicKeys are keys that were excluded from the import because
+	// their histories were slashable.
+	SlashablePublicKeys [][48]byte
+}
+
+// PubKeyImportSummary holds the imported record counts for a single public key.
+type PubKeyImportSummary struct {
+	Attestations       int
+	Blocks             int
+	LowestSourceEpoch  types.Epoch
+	HighestTargetEpoch types.Epoch
+}
+
 // ImportStandardProtectionJSON takes in EIP-3076 compliant JSON file used for slashing protection
 // by eth2 validators and imports its data into Prysm's internal representation of slashing
 // protection in the validator client's database. For more information, see the EIP document here:
 // https://eips.ethereum.org/EIPS/eip-3076.
 func ImportStandardProtectionJSON(ctx context.Context, validatorDB db.Database, r io.Reader) error {
-	encodedJSON, err := ioutil.ReadAll(r)
+	_, err := ImportStandardProtectionJSONWithOptions(ctx, validatorDB, r, ImportOptions{})
+	return err
+}
+
+// ImportStandardProtectionJSONWithOptions imports EIP-3076 slashing protection data as
+// ImportStandardProtectionJSON does, and returns a summary of the records it added. If
+// opts.DryRun is set, the data is fully validated but nothing is written to the database.
+func ImportStandardProtectionJSONWithOptions(
+	ctx context.Context, validatorDB db.Database, r io.Reader, opts ImportOptions,
+) (*ImportSummary, error) {
+	summary := &ImportSummary{
+		PubKeys:             make(map[[48]byte]*PubKeyImportSummary),
+		SlashablePublicKeys: make([][48]byte, 0),
+	}
+	// Exports may be zstd compressed, which is detected from the magic bytes of the file.
+	jsonReader, release, err := maybeDecompress(r)
 	if err != nil {
-		return errors.Wrap(err, "could not read slashing protection JSON file")
+		return nil, err
 	}
+	defer release()
 	interchangeJSON := &format.EIPSlashingProtectionFormat{}
-	if err := json.Unmarshal(encodedJSON, interchangeJSON); err != nil {
-		return errors.Wrap(err, "could not unmarshal slashing protection JSON file")
+	if err := json.NewDecoder(jsonReader).Decode(interchangeJSON); err != nil {
+		return nil, errors.Wrap(err, "could not unmarshal slashing protection JSON file")
 	}
 	if interchangeJSON.Data == nil {
 		log.Warn("No slashing protection data to import")
-		return nil
+		return summary, nil
 	}
 
-	// We validate the `MetadataV0` field of the slashing protection JSON file.
-	if err := validateMetadata(ctx, validatorDB, interchangeJSON); err != nil {
-		return errors.Wrap(err, "slashing protection JSON metadata was incorrect")
+	// We validate the `MetadataV0` field of the slashing protection JSON file. The genesis
+	// validators root is only saved once all the data in the file has been checked.
+	gvr, _, err := verifyMetadata(ctx, validatorDB, interchangeJSON)
+	if err != nil {
+		if !opts.toleratesGenesisRootMismatch(err) {
+			return nil, errors.Wrap(err, "slashing protection JSON metadata was incorrect")
+		}
+		log.WithField(
+			"genesisValidatorsRoot", interchangeJSON.Metadata.GenesisValidatorsRoot,
+		).Warn("IMPORTING SLASHING PROTECTION DATA FROM A DIFFERENT GENESIS VALIDATORS ROOT. " +
+			"This is only safe on ephemeral testnets, on mainnet it likely means the file belongs to another network")
 	}
 
 	// We need to handle duplicate public keys in the JSON file, with potentially
 	// different signing histories for both attestations and blocks.
 	signedBlocksByPubKey, err := parseBlocksForUniquePublicKeys(interchangeJSON.Data)
 	if err != nil {
-		return errors.Wrap(err, "could not parse unique entries for blocks by public key")
+		return nil, errors.Wrap(err, "could not parse unique entries for blocks by public key")
 	}
 	signedAttsByPubKey, err := parseAttestationsForUniquePublicKeys(interchangeJSON.Data)
 	if err != nil {
-		return errors.Wrap(err, "could not parse unique entries for attestations by public key")
+		return nil, errors.Wrap(err, "could not parse unique entries for attestations by public key")
 	}
 
 	attestingHistoryByPubKey := make(map[[48]byte][]*kv.AttestationRecord)
@@ -59,7 +151,7 @@ func ImportStandardProtectionJSON(ctx context.Context, validatorDB db.Database,
 		// file into the internal Prysm representation of proposal history.
 		proposalHistory, err := transformSignedBlocks(ctx, signedBlocks)
 		if err != nil {
-			return errors.Wrapf(err, "could not parse signed blocks in JSON file for key %#x", pubKey)
+			return nil, errors.Wrapf(err, "could not parse signed blocks in JSON file for key %#x", pubKey)
 		}
 		proposalHistoryByPubKey[pubKey] = *proposalHistory
 	}
@@ -69,7 +161,7 @@ func ImportStandardProtectionJSON(ctx context.Context, validatorDB db.Database,
 		// file into the internal Prysm representation of attesting history.
 		historicalAtt, err := transformSignedAttestations(pubKey, signedAtts)
 		if err != nil {
-			return errors.Wrapf(err, "could not parse signed attestations in JSON file for key %#x", pubKey)
+			return nil, errors.Wrapf(err, "could not parse signed attestations in JSON file for key %#x", pubKey)
 		}
 		attestingHistoryByPubKey[pubKey] = historicalAtt
 	}
@@ -81,7 +173,7 @@ func ImportStandardProtectionJSON(ctx context.Context, validatorDB db.Database,
 		ctx, validatorDB, attestingHistoryByPubKey,
 	)
 	if err != nil {
-		return errors.Wrap(err, "could not filter slashable attester public keys from JSON data")
+		return nil, errors.Wrap(err, "could not filter slashable attester public keys from JSON data")
 	}
 
 	slashablePublicKeys := make([][48]byte, 0, len(slashableAttesterKeys)+len(slashableProposerKeys))
@@ -94,54 +186,80 @@ func ImportStandardProtectionJSON(ctx context.Context, validatorDB db.Database,
 		slashablePublicKeys = append(slashablePublicKeys, pubKey)
 	}
 
-	if err := validatorDB.SaveEIPImportBlacklistedPublicKeys(ctx, slashablePublicKeys); err != nil {
-		return errors.Wrap(err, "could not save slashable public keys to database")
-	}
-
-	// We save the histories to disk as atomic operations, ensuring that this only occurs
-	// until after we successfully parse all data from the JSON file. If there is any error
-	// in parsing the JSON proposal and attesting histories, we will not reach this point.
+	summary.SlashablePublicKeys = slashablePublicKeys
 	for pubKey, proposalHistory := range proposalHistoryByPubKey {
-		bar := initializeProgressBar(
-			len(proposalHistory.Proposals),
-			fmt.Sprintf("Importing proposals for validator public key %#x", bytesutil.Trunc(pubKey[:])),
-		)
-		for _, proposal := range proposalHistory.Proposals {
-			if err := bar.Add(1); err != nil {
-				log.WithError(err).Debug("Could not increase progress bar")
-			}
-			if err = validatorDB.SaveProposalHistoryForSlot(ctx, pubKey, proposal.Slot, proposal.SigningRoot); err != nil {
-				return errors.Wrap(err, "could not save proposal history from imported JSON to database")
-			}
-		}
+		summaryForPubKey(summary, pubKey).Blocks = len(proposalHistory.Proposals)
 	}
-	bar := initializeProgressBar(
-		len(attestingHistoryByPubKey),
-		"Importing attesting history for validator public keys",
-	)
 	for pubKey, attestations := range attestingHistoryByPubKey {
-		if err := bar.Add(1); err != nil {
-			log.WithError(err).Debug("Could not increase progress bar")
-		}
-		indexedAtts := make([]*ethpb.IndexedAttestation, len(attestations))
-		signingRoots := make([][32]byte, len(attestations))
+		keySummary := summaryForPubKey(summary, pubKey)
+		keySummary.Attestations = len(attestations)
 		for i, att := range attestations {
-			indexedAtt := createAttestation(att.Source, att.Target)
-			indexedAtts[i] = indexedAtt
-			signingRoots[i] = att.SigningRoot
+			if i == 0 || att.Source < keySummary.LowestSourceEpoch {
+				keySummary.LowestSourceEpoch = att.Source
+			}
+			if i == 0 || att.Target > keySummary.HighestTargetEpoch {
+				keySummary.HighestTargetEpoch = att.Target
+			}
 		}
-		if err := validatorDB.SaveAttestationsForPubKey(ctx, pubKey, signingRoots, indexedAtts); err != nil {
-			return errors.Wrap(err, "could not save attestations from imported JSON to database")
+	}
+	if opts.DryRun {
+		for pubKey, keySummary := range summary.PubKeys {
+			log.WithFields(logrus.Fields{
+				"pubKey":             fmt.Sprintf("%#x", bytesutil.Trunc(pubKey[:])),
+				"attestations":       keySummary.Attestations,
+				"blocks":             keySummary.Blocks,
+				"lowestSourceEpoch":  keySummary.LowestSourceEpoch,
+				"highestTargetEpoch": keySummary.HighestTargetEpoch,
+			}).Info("Dry run: would import slashing protection history")
 		}
+		return summary, nil
+	}
+
+	// We save the histories to disk in a single transaction along with the genesis validators
+	// root and the slashable public keys, ensuring that this only occurs after we successfully
+	// parse all data from the JSON file and check it for conflicts with the stored histories.
+	// If the import fails, the database is left unchanged.
+	proposalsByPubKey := make(map[[48]byte][]kv.Proposal, len(proposalHistoryByPubKey))
+	for pubKey, proposalHistory := range proposalHistoryByPubKey {
+		proposalsByPubKey[pubKey] = proposalHistory.Proposals
+	}
+	if err := validatorDB.ImportInterchangeData(ctx, &kv.InterchangeData{
+		GenesisValidatorsRoot:    gvr[:],
+		Attestations:             attestingHistoryByPubKey,
+		Proposals:                proposalsByPubKey,
+		SlashablePublicKeys:      slashablePublicKeys,
+		AllowGenesisRootMismatch: opts.AllowGenesisRootMismatch,
+	}); err != nil {
+		return nil, errors.Wrap(err, "could not save slashing protection history from imported JSON to database")
 	}
-	return nil
+	return summary, nil
 }
 
-func validateMetadata(ctx context.Context, validatorDB db.Database, interchangeJSON *format.EIPSlashingProtectionFormat) error {
+func summaryForPubKey(summary *ImportSummary, pubKey [48]byte) *PubKeyImportSummary {
+	keySummary, ok := summary.PubKeys[pubKey]
+	if !ok {
+		keySummary = &PubKeyImportSummary{}
+		summary.PubKeys[pubKey] = keySummary
+	}
+	return keySummary
+}
+
+// toleratesGenesisRootMismatch returns true if err is a genesis validators root mismatch
+// which the import options allow to proceed with.
+func (opts ImportOptions) toleratesGenesisRootMismatch(err error) bool {
+	return opts.AllowGenesisRootMismatch && errors.Is(err, errGenesisRootMismatch)
+}
+
+// verifyMetadata checks the metadata of the JSON file against the database without writing
+// to it. It returns the genesis validators root from the JSON file and whether the database
+// already had a genesis validators root stored.
+func verifyMetadata(
+	ctx context.Context, validatorDB db.Database, interchangeJSON *format.EIPSlashingProtectionFormat,
+) ([32]byte, bool, error) {
 	// We need to ensure the version in the metadata field matches the one we support.
 	version := interchangeJSON.Metadata.InterchangeFormatVersion
 	if version != format.InterchangeFormatVersion {
-		return fmt.Errorf(
+		return [32]byte{}, false, fmt.Errorf(
 			"slashing protection JSON version '%s' is not supported, wanted '%s'",
 			version,
 			format.InterchangeFormatVersion,
@@ -152,23 +270,19 @@ func validateMetadata(ctx context.Context, validatorDB db.Database, interchangeJ
 	// the imported slashing protection JSON was created on a different chain.
 	gvr, err := RootFromHex(interchangeJSON.Metadata.GenesisValidatorsRoot)
 	if err != nil {
-		return fmt.Errorf("%#x is not a valid root: %w", interchangeJSON.Metadata.GenesisValidatorsRoot, err)
+		return [32]byte{}, false, fmt.Errorf("%#x is not a valid root: %w", interchangeJSON.Metadata.GenesisValidatorsRoot, err)
 	}
 	dbGvr, err := validatorDB.GenesisValidatorsRoot(ctx)
 	if err != nil {
-		return errors.Wrap(err, "could not retrieve genesis validator root to db")
+		return [32]byte{}, false, errors.Wrap(err, "could not retrieve genesis validator root to db")
 	}
 	if dbGvr == nil {
-		if err = validatorDB.SaveGenesisValidatorsRoot(ctx, gvr[:]); err != nil {
-			return errors.Wrap(err, "could not save genesis validator root to db")
-		}
-		return nil
+		return gvr, false, nil
 	}
 	if !bytes.Equal(dbGvr, gvr[:]) {
-		return errors.New("genesis validator root doesnt match the one that is stored in slashing protection db. " +
-			"Please make sure you import the protection data that is relevant to the chain you are on")
+		return [32]byte{}, true, errGenesisRootMismatch
 	}
-	return nil
+	return gvr, true, nil
 }
 
 // We create a map of pubKey -> []*SignedBlock. Then, for each public key we observe,
@@ -294,21 +408,54 @@ func filterSlashablePubKeysFromAttestations(
 		}
 	}
 	// Then, we need to find attestations that are slashable with respect to our database.
+	// Importing those could lower the protection already in place, so the import is
+	// rejected, reporting every conflicting public key at once.
+	conflicts, err := findDatabaseConflicts(ctx, validatorDB, signedAttsByPubKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(conflicts) > 0 {
+		return nil, &ConflictError{Conflicts: conflicts}
+	}
+	return slashablePubKeys, nil
+}
+
+// Compares every attestation against the attesting history stored in the database and
+// returns the first conflicting attestation for each public key, ordered by public key.
+// The stored history is compared against directly, rather than through the slashing
+// protection checks of the database, so that a file can be imported again over itself
+// regardless of the database configuration.
+func findDatabaseConflicts(
+	ctx context.Context,
+	validatorDB db.Database,
+	signedAttsByPubKey map[[48]byte][]*kv.AttestationRecord,
+) ([]*AttestationConflict, error) {
+	conflicts := make([]*AttestationConflict, 0)
 	for pubKey, signedAtts := range signedAttsByPubKey {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		history, err := validatorDB.AttestationHistoryForPubKey(ctx, pubKey)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not get attesting history for public key %#x", pubKey)
+		}
+		stored := kv.NewStoredAttestations(history)
 		for _, att := range signedAtts {
-			indexedAtt := createAttestation(att.Source, att.Target)
-			slashable, err := validatorDB.CheckSlashableAttestation(ctx, pubKey, att.SigningRoot, indexedAtt)
-			if err != nil {
-				return nil, err
-			}
-			// Malformed data should not prevent us from completing this function.
-			if slashable != kv.NotSlashable {
-				slashablePubKeys = append(slashablePubKeys, pubKey)
+			if kind := stored.SlashingKind(att); kind != kv.NotSlashable {
+				conflicts = append(conflicts, &AttestationConflict{
+					PubKey: pubKey,
+					Source: att.Source,
+					Target: att.Target,
+					Kind:   kind,
+				})
 				break
 			}
 		}
 	}
-	return slashablePubKeys, nil
+	sort.Slice(conflicts, func(i, j int) bool {
+		return bytes.Compare(conflicts[i].PubKey[:], conflicts[j].PubKey[:]) < 0
+	})
+	return conflicts, nil
 }
 
 func transformSignedBlocks(ctx context.Context, signedBlocks []*format.SignedBlock) (*kv.ProposalHistoryForPubkey, error) {
@@ -316,14 +463,14 @@ func transformSignedBlocks(ctx context.Context, signedBlocks []*format.SignedBlo
 	for i, proposal := range signedBlocks {
 		slot, err := SlotFromString(proposal.Slot)
 		if err != nil {
-			return nil, fmt.Errorf("%d is not a valid slot: %w", slot, err)
+			return nil, fmt.Errorf("%s is not a valid slot: %w", proposal.Slot, err)
 		}
 		var signingRoot [32]byte
 		// Signing roots are optional in the standard JSON file.
 		if proposal.SigningRoot != "" {
 			signingRoot, err = RootFromHex(proposal.SigningRoot)
 			if err != nil {
-				return nil, fmt.Errorf("%#x is not a valid root: %w", signingRoot, err)
+				return nil, fmt.Errorf("%s is not a valid root: %w", proposal.SigningRoot, err)
 			}
 		}
 		proposals[i] = kv.Proposal{
@@ -341,18 +488,18 @@ func transformSignedAttestations(pubKey [48]byte, atts []*format.SignedAttestati
 	for _, attestation := range atts {
 		target, err := EpochFromString(attestation.TargetEpoch)
 		if err != nil {
-			return nil, fmt.Errorf("%d is not a valid epoch: %w", target, err)
+			return nil, fmt.Errorf("%s is not a valid epoch: %w", attestation.TargetEpoch, err)
 		}
 		source, err := EpochFromString(attestation.SourceEpoch)
 		if err != nil {
-			return nil, fmt.Errorf("%d is not a valid epoch: %w", source, err)
+			return nil, fmt.Errorf("%s is not a valid epoch: %w", attestation.SourceEpoch, err)
 		}
 		var signingRoot [32]byte
 		// Signing roots are optional in the standard JSON file.
 		if attestation.SigningRoot != "" {
 			signingRoot, err = RootFromHex(attestation.SigningRoot)
 			if err != nil {
-				return nil, fmt.Errorf("%#x is not a valid root: %w", signingRoot, err)
+				return nil, fmt.Errorf("%s is not a valid root: %w", attestation.SigningRoot, err)
 			}
 		}
 		historicalAtts = append(historicalAtts, &kv.AttestationRecord{
@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"reflect"
 	"testing"
@@ -167,6 +168,284 @@ func TestStore_ImportInterchangeData_OK(t *testing.T) {
 	}
 }
 
+func TestStore_ImportInterchangeData_DryRun(t *testing.T) {
+	ctx := context.Background()
+	numValidators := 10
+	publicKeys, err := valtest.CreateRandomPubKeys(numValidators)
+	require.NoError(t, err)
+	validatorDB := dbtest.SetupDB(t, publicKeys)
+
+	attestingHistory, proposalHistory := valtest.MockAttestingAndProposalHistories(numValidators)
+	standardProtectionFormat, err := valtest.MockSlashingProtectionJSON(publicKeys, attestingHistory, proposalHistory)
+	require.NoError(t, err)
+	blob, err := json.Marshal(standardProtectionFormat)
+	require.NoError(t, err)
+
+	summary, err := ImportStandardProtectionJSONWithOptions(
+		ctx, validatorDB, bytes.NewBuffer(blob), ImportOptions{DryRun: true},
+	)
+	require.NoError(t, err)
+	require.Equal(t, numValidators, len(summary.PubKeys))
+	assert.Equal(t, 0, len(summary.SlashablePublicKeys))
+	for i, pubKey := range publicKeys {
+		keySummary, ok := summary.PubKeys[pubKey]
+		require.Equal(t, true, ok)
+		assert.Equal(t, len(attestingHistory[i]), keySummary.Attestations)
+		assert.Equal(t, len(proposalHistory[i].Proposals), keySummary.Blocks)
+	}
+
+	// Nothing should have been written to the database, including the genesis validators root.
+	gvr, err := validatorDB.GenesisValidatorsRoot(ctx)
+	require.NoError(t, err)
+	require.Equal(t, true, gvr == nil)
+	for i := 0; i < len(publicKeys); i++ {
+		for _, att := range attestingHistory[i] {
+			slashingKind, err := validatorDB.CheckSlashableAttestation(
+				ctx, publicKeys[i], [32]byte{}, createAttestation(att.Source, att.Target),
+			)
+			require.NoError(t, err)
+			require.Equal(t, kv.NotSlashable, slashingKind)
+		}
+		receivedHistory, err := validatorDB.ProposalHistoryForPubKey(ctx, publicKeys[i])
+		require.NoError(t, err)
+		require.DeepEqual(t, make([]*kv.Proposal, 0), receivedHistory)
+	}
+
+	// A real import afterwards should add exactly what the dry run reported.
+	realSummary, err := ImportStandardProtectionJSONWithOptions(
+		ctx, validatorDB, bytes.NewBuffer(blob), ImportOptions{},
+	)
+	require.NoError(t, err)
+	require.DeepEqual(t, summary, realSummary)
+}
+
+func TestStore_ImportInterchangeData_DryRun_GenesisRootMismatch(t *testing.T) {
+	ctx := context.Background()
+	numValidators := 2
+	publicKeys, err := valtest.CreateRandomPubKeys(numValidators)
+	require.NoError(t, err)
+	validatorDB := dbtest.SetupDB(t, publicKeys)
+	dbRoot := [32]byte{2}
+	require.NoError(t, validatorDB.SaveGenesisValidatorsRoot(ctx, dbRoot[:]))
+
+	attestingHistory, proposalHistory := valtest.MockAttestingAndProposalHistories(numValidators)
+	standardProtectionFormat, err := valtest.MockSlashingProtectionJSON(publicKeys, attestingHistory, proposalHistory)
+	require.NoError(t, err)
+	otherRoot := [32]byte{3}
+	standardProtectionFormat.Metadata.GenesisValidatorsRoot = fmt.Sprintf("%#x", otherRoot)
+	blob, err := json.Marshal(standardProtectionFormat)
+	require.NoError(t, err)
+
+	_, err = ImportStandardProtectionJSONWithOptions(
+		ctx, validatorDB, bytes.NewBuffer(blob), ImportOptions{DryRun: true},
+	)
+	require.ErrorContains(t, "genesis validator root doesnt match", err)
+}
+
+func TestStore_ImportInterchangeData_AllowGenesisRootMismatch(t *testing.T) {
+	ctx := context.Background()
+	numValidators := 2
+	publicKeys, err := valtest.CreateRandomPubKeys(numValidators)
+	require.NoError(t, err)
+	validatorDB := dbtest.SetupDB(t, publicKeys)
+	dbRoot := [32]byte{2}
+	require.NoError(t, validatorDB.SaveGenesisValidatorsRoot(ctx, dbRoot[:]))
+
+	attestingHistory, proposalHistory := valtest.MockAttestingAndProposalHistories(numValidators)
+	standardProtectionFormat, err := valtest.MockSlashingProtectionJSON(publicKeys, attestingHistory, proposalHistory)
+	require.NoError(t, err)
+	otherRoot := [32]byte{3}
+	standardProtectionFormat.Metadata.GenesisValidatorsRoot = fmt.Sprintf("%#x", otherRoot)
+	blob, err := json.Marshal(standardProtectionFormat)
+	require.NoError(t, err)
+
+	// The mismatch is a hard error by default.
+	_, err = ImportStandardProtectionJSONWithOptions(ctx, validatorDB, bytes.NewBuffer(blob), ImportOptions{})
+	require.ErrorContains(t, "genesis validator root doesnt match", err)
+
+	hook := logTest.NewGlobal()
+	summary, err := ImportStandardProtectionJSONWithOptions(
+		ctx, validatorDB, bytes.NewBuffer(blob), ImportOptions{AllowGenesisRootMismatch: true},
+	)
+	require.NoError(t, err)
+	require.Equal(t, numValidators, len(summary.PubKeys))
+	require.LogsContain(t, hook, "DIFFERENT GENESIS VALIDATORS ROOT")
+
+	// The stored genesis validators root is kept, and the data was imported.
+	gvr, err := validatorDB.GenesisValidatorsRoot(ctx)
+	require.NoError(t, err)
+	require.DeepEqual(t, dbRoot[:], gvr)
+	for i := 0; i < len(publicKeys); i++ {
+		receivedHistory, err := validatorDB.ProposalHistoryForPubKey(ctx, publicKeys[i])
+		require.NoError(t, err)
+		require.NotEqual(t, 0, len(receivedHistory))
+	}
+}
+
+func TestStore_ImportInterchangeData_DatabaseConflicts(t *testing.T) {
+	ctx := context.Background()
+	publicKeys := [][48]byte{{1}, {2}, {3}}
+	validatorDB := dbtest.SetupDB(t, publicKeys)
+	existingRoot := [32]byte{1}
+	require.NoError(t, validatorDB.SaveAttestationForPubKey(ctx, publicKeys[0], existingRoot, createAttestation(2, 4)))
+	require.NoError(t, validatorDB.SaveAttestationForPubKey(ctx, publicKeys[1], existingRoot, createAttestation(1, 5)))
+
+	interchange := &format.EIPSlashingProtectionFormat{}
+	interchange.Metadata.InterchangeFormatVersion = format.InterchangeFormatVersion
+	interchange.Metadata.GenesisValidatorsRoot = fmt.Sprintf("%#x", [32]byte{4})
+	interchange.Data = []*format.ProtectionData{
+		{
+			// Double vote with the existing attestation at target 4.
+			Pubkey: fmt.Sprintf("%#x", publicKeys[0]),
+			SignedAttestations: []*format.SignedAttestation{
+				{SourceEpoch: "2", TargetEpoch: "4", SigningRoot: fmt.Sprintf("%#x", [32]byte{2})},
+			},
+		},
+		{
+			// Surrounded by the existing attestation with source 1 and target 5.
+			Pubkey: fmt.Sprintf("%#x", publicKeys[1]),
+			SignedAttestations: []*format.SignedAttestation{
+				{SourceEpoch: "6", TargetEpoch: "7"},
+				{SourceEpoch: "2", TargetEpoch: "3"},
+			},
+		},
+		{
+			Pubkey: fmt.Sprintf("%#x", publicKeys[2]),
+			SignedAttestations: []*format.SignedAttestation{
+				{SourceEpoch: "1", TargetEpoch: "2"},
+			},
+		},
+	}
+	blob, err := json.Marshal(interchange)
+	require.NoError(t, err)
+
+	err = ImportStandardProtectionJSON(ctx, validatorDB, bytes.NewBuffer(blob))
+	conflictErr := &ConflictError{}
+	require.Equal(t, true, errors.As(err, &conflictErr))
+	require.Equal(t, 2, len(conflictErr.Conflicts))
+	assert.DeepEqual(t, &AttestationConflict{
+		PubKey: publicKeys[0],
+		Source: 2,
+		Target: 4,
+		Kind:   kv.DoubleVote,
+	}, conflictErr.Conflicts[0])
+	assert.DeepEqual(t, &AttestationConflict{
+		PubKey: publicKeys[1],
+		Source: 2,
+		Target: 3,
+		Kind:   kv.SurroundedVote,
+	}, conflictErr.Conflicts[1])
+	assert.ErrorContains(t, fmt.Sprintf("%#x (source 2, target 4)", publicKeys[0]), err)
+	assert.ErrorContains(t, fmt.Sprintf("%#x (source 2, target 3)", publicKeys[1]), err)
+
+	// Nothing should have been written, including the history of the non-conflicting key.
+	gvr, err := validatorDB.GenesisValidatorsRoot(ctx)
+	require.NoError(t, err)
+	require.Equal(t, true, gvr == nil)
+	history, err := validatorDB.AttestationHistoryForPubKey(ctx, publicKeys[2])
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(history))
+}
+
+func TestStore_ImportInterchangeData_Reimport(t *testing.T) {
+	for _, minimal := range []bool{false, true} {
+		t.Run(fmt.Sprintf("minimal slashing protection %v", minimal), func(t *testing.T) {
+			ctx := context.Background()
+			pubKey := [48]byte{1}
+			validatorDB, err := kv.NewKVStore(ctx, t.TempDir(), &kv.Config{
+				PubKeys:                   [][48]byte{pubKey},
+				MinimalSlashingProtection: minimal,
+			})
+			require.NoError(t, err, "Failed to instantiate DB")
+			t.Cleanup(func() {
+				require.NoError(t, validatorDB.Close(), "Failed to close database")
+			})
+			interchange := &format.EIPSlashingProtectionFormat{}
+			interchange.Metadata.InterchangeFormatVersion = format.InterchangeFormatVersion
+			interchange.Metadata.GenesisValidatorsRoot = fmt.Sprintf("%#x", [32]byte{4})
+			interchange.Data = []*format.ProtectionData{
+				{
+					Pubkey: fmt.Sprintf("%#x", pubKey),
+					SignedAttestations: []*format.SignedAttestation{
+						{SourceEpoch: "1", TargetEpoch: "2", SigningRoot: fmt.Sprintf("%#x", [32]byte{2})},
+						// Signing roots are optional.
+						{SourceEpoch: "2", TargetEpoch: "3"},
+					},
+				},
+			}
+			blob, err := json.Marshal(interchange)
+			require.NoError(t, err)
+
+			// Importing a file over itself finds no conflict with the attestations it already imported.
+			require.NoError(t, ImportStandardProtectionJSON(ctx, validatorDB, bytes.NewBuffer(blob)))
+			require.NoError(t, ImportStandardProtectionJSON(ctx, validatorDB, bytes.NewBuffer(blob)))
+		})
+	}
+}
+
+func BenchmarkImportInterchangeData(b *testing.B) {
+	tests := []struct {
+		numValidators int
+		numEpochs     int
+	}{
+		{numValidators: 10, numEpochs: 100},
+		{numValidators: 100, numEpochs: 1000},
+		// Roughly a large mainnet operator keeping a full pruning window of history.
+		{numValidators: 1000, numEpochs: 512},
+	}
+	for _, tt := range tests {
+		b.Run(fmt.Sprintf("%d_validators_%d_epochs", tt.numValidators, tt.numEpochs), func(b *testing.B) {
+			benchImportInterchangeData(b, tt.numValidators, tt.numEpochs)
+		})
+	}
+}
+
+// benchImportInterchangeData measures importing a synthetic interchange file in which
+// each of numValidators validators signed an attestation in each of numEpochs epochs.
+func benchImportInterchangeData(b *testing.B, numValidators, numEpochs int) {
+	ctx := context.Background()
+	publicKeys, err := valtest.CreateRandomPubKeys(numValidators)
+	require.NoError(b, err)
+	blob, err := json.Marshal(mockInterchangeData(publicKeys, numEpochs))
+	require.NoError(b, err)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		validatorDB := dbtest.SetupDB(b, publicKeys)
+		b.StartTimer()
+
+		require.NoError(b, ImportStandardProtectionJSON(ctx, validatorDB, bytes.NewReader(blob)))
+	}
+}
+
+// mockInterchangeData creates an interchange file in which every public key attested
+// to each sequential (source, target) pair up to numEpochs.
+func mockInterchangeData(publicKeys [][48]byte, numEpochs int) *format.EIPSlashingProtectionFormat {
+	interchangeJSON := &format.EIPSlashingProtectionFormat{
+		Data: make([]*format.ProtectionData, len(publicKeys)),
+	}
+	interchangeJSON.Metadata.InterchangeFormatVersion = format.InterchangeFormatVersion
+	interchangeJSON.Metadata.GenesisValidatorsRoot = fmt.Sprintf("%#x", [32]byte{1})
+	for i, pubKey := range publicKeys {
+		atts := make([]*format.SignedAttestation, numEpochs)
+		for epoch := range atts {
+			atts[epoch] = &format.SignedAttestation{
+				SourceEpoch: fmt.Sprintf("%d", epoch),
+				TargetEpoch: fmt.Sprintf("%d", epoch+1),
+				SigningRoot: fmt.Sprintf("%#x", [32]byte{byte(epoch), byte(epoch >> 8)}),
+			}
+		}
+		interchangeJSON.Data[i] = &format.ProtectionData{
+			Pubkey:             fmt.Sprintf("%#x", pubKey),
+			SignedBlocks:       make([]*format.SignedBlock, 0),
+			SignedAttestations: atts,
+		}
+	}
+	return interchangeJSON
+}
+
 func Test_validateMetadata(t *testing.T) {
 	goodRoot := [32]byte{1}
 	goodStr := make([]byte, hex.EncodedLen(len(goodRoot)))
@@ -222,8 +501,8 @@ func Test_validateMetadata(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			validatorDB := dbtest.SetupDB(t, nil)
 			ctx := context.Background()
-			if err := validateMetadata(ctx, validatorDB, tt.interchangeJSON); (err != nil) != tt.wantErr {
-				t.Errorf("validateMetadata() error = %v, wantErr %v", err, tt.wantErr)
+			if _, _, err := verifyMetadata(ctx, validatorDB, tt.interchangeJSON); (err != nil) != tt.wantErr {
+				t.Errorf("verifyMetadata() error = %v, wantErr %v", err, tt.wantErr)
 			}
 
 		})
@@ -278,7 +557,7 @@ func Test_validateMetadataGenesisValidatorRoot(t *testing.T) {
 			validatorDB := dbtest.SetupDB(t, nil)
 			ctx := context.Background()
 			require.NoError(t, validatorDB.SaveGenesisValidatorsRoot(ctx, tt.dbGenesisValidatorRoot))
-			err := validateMetadata(ctx, validatorDB, tt.interchangeJSON)
+			_, _, err := verifyMetadata(ctx, validatorDB, tt.interchangeJSON)
 			if tt.wantErr {
 				require.ErrorContains(t, "genesis validator root doesnt match the one that is stored", err)
 			} else {
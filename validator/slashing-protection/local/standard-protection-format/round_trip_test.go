@@ -8,13 +8,17 @@ import (
 	"testing"
 
 	types "github.com/prysmaticlabs/eth2-types"
+	ethpb "github.com/prysmaticlabs/prysm/proto/eth/v1alpha1"
+	"github.com/prysmaticlabs/prysm/shared/params"
 	"github.com/prysmaticlabs/prysm/shared/testutil/assert"
 	"github.com/prysmaticlabs/prysm/shared/testutil/require"
+	"github.com/prysmaticlabs/prysm/validator/db"
 	"github.com/prysmaticlabs/prysm/validator/db/kv"
 	dbtest "github.com/prysmaticlabs/prysm/validator/db/testing"
 	protectionFormat "github.com/prysmaticlabs/prysm/validator/slashing-protection/local/standard-protection-format"
 	"github.com/prysmaticlabs/prysm/validator/slashing-protection/local/standard-protection-format/format"
 	slashtest "github.com/prysmaticlabs/prysm/validator/testing"
+	logTest "github.com/sirupsen/logrus/hooks/test"
 )
 
 func TestImportExport_RoundTrip(t *testing.T) {
@@ -74,6 +78,242 @@ func TestImportExport_RoundTrip(t *testing.T) {
 	}
 }
 
+// setupMinimalDB instantiates a validator database with minimal slashing protection.
+func setupMinimalDB(t testing.TB, pubKeys [][48]byte) *kv.Store {
+	validatorDB, err := kv.NewKVStore(context.Background(), t.TempDir(), &kv.Config{
+		PubKeys:                   pubKeys,
+		MinimalSlashingProtection: true,
+	})
+	require.NoError(t, err, "Failed to instantiate DB")
+	t.Cleanup(func() {
+		require.NoError(t, validatorDB.Close(), "Failed to close database")
+	})
+	return validatorDB
+}
+
+func TestImportExport_RoundTrip_MinimalSlashingProtection(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	validatorDB := setupMinimalDB(t, [][48]byte{pubKey})
+	require.NoError(t, validatorDB.SaveGenesisValidatorsRoot(ctx, make([]byte, 32)))
+	require.NoError(t, validatorDB.SaveAttestationRecordsForPubKey(ctx, pubKey, []*kv.AttestationRecord{
+		{PubKey: pubKey, Source: 1, Target: 2, SigningRoot: [32]byte{2}},
+		{PubKey: pubKey, Source: 3, Target: 5, SigningRoot: [32]byte{5}},
+		{PubKey: pubKey, Source: 4, Target: 6, SigningRoot: [32]byte{6}},
+	}))
+
+	// Only the signed epoch bounds are stored, which are exported as a single attestation.
+	exported := new(bytes.Buffer)
+	require.NoError(t, protectionFormat.ExportInterchangeData(ctx, validatorDB, exported))
+	interchange := &format.EIPSlashingProtectionFormat{}
+	require.NoError(t, json.Unmarshal(exported.Bytes(), interchange))
+	require.Equal(t, 1, len(interchange.Data))
+	require.DeepEqual(t, []*format.SignedAttestation{{SourceEpoch: "1", TargetEpoch: "6"}}, interchange.Data[0].SignedAttestations)
+
+	// Importing the export restores the bounds, into a minimal as well as a full database.
+	for _, freshDB := range []db.Database{setupMinimalDB(t, [][48]byte{pubKey}), dbtest.SetupDB(t, [][48]byte{pubKey})} {
+		require.NoError(t, protectionFormat.ImportStandardProtectionJSON(ctx, freshDB, bytes.NewReader(exported.Bytes())))
+		lowestSource, exists, err := freshDB.LowestSignedSourceEpoch(ctx, pubKey)
+		require.NoError(t, err)
+		require.Equal(t, true, exists)
+		assert.Equal(t, types.Epoch(1), lowestSource)
+		highestTarget, exists, err := freshDB.HighestSignedTargetEpoch(ctx, pubKey)
+		require.NoError(t, err)
+		require.Equal(t, true, exists)
+		assert.Equal(t, types.Epoch(6), highestTarget)
+		reexported := new(bytes.Buffer)
+		require.NoError(t, protectionFormat.ExportInterchangeData(ctx, freshDB, reexported))
+		require.DeepEqual(t, exported.Bytes(), reexported.Bytes())
+	}
+}
+
+func TestImportExport_RoundTrip_Streaming(t *testing.T) {
+	ctx := context.Background()
+	numValidators := 10
+	publicKeys, err := slashtest.CreateRandomPubKeys(numValidators)
+	require.NoError(t, err)
+	validatorDB := dbtest.SetupDB(t, publicKeys)
+
+	attestingHistory, proposalHistory := slashtest.MockAttestingAndProposalHistories(numValidators)
+	wanted, err := slashtest.MockSlashingProtectionJSON(publicKeys, attestingHistory, proposalHistory)
+	require.NoError(t, err)
+	blob, err := json.Marshal(wanted)
+	require.NoError(t, err)
+	require.NoError(t, protectionFormat.ImportStandardProtectionJSON(ctx, validatorDB, bytes.NewBuffer(blob)))
+
+	// Exporting the same database twice should yield identical bytes.
+	first := new(bytes.Buffer)
+	require.NoError(t, protectionFormat.ExportInterchangeData(ctx, validatorDB, first))
+	second := new(bytes.Buffer)
+	require.NoError(t, protectionFormat.ExportInterchangeData(ctx, validatorDB, second))
+	require.DeepEqual(t, first.Bytes(), second.Bytes())
+
+	// The streamed export should decode into the same data as the in-memory export.
+	streamed := &format.EIPSlashingProtectionFormat{}
+	require.NoError(t, json.Unmarshal(first.Bytes(), streamed))
+	eipStandard, err := protectionFormat.ExportStandardProtectionJSON(ctx, validatorDB)
+	require.NoError(t, err)
+	require.DeepEqual(t, eipStandard, streamed)
+
+	// The streamed export can be imported back into a fresh database.
+	freshDB := dbtest.SetupDB(t, publicKeys)
+	require.NoError(t, protectionFormat.ImportStandardProtectionJSON(ctx, freshDB, first))
+}
+
+func TestImportExport_RoundTrip_Compressed(t *testing.T) {
+	ctx := context.Background()
+	numValidators := 10
+	publicKeys, err := slashtest.CreateRandomPubKeys(numValidators)
+	require.NoError(t, err)
+	validatorDB := dbtest.SetupDB(t, publicKeys)
+
+	attestingHistory, proposalHistory := slashtest.MockAttestingAndProposalHistories(numValidators)
+	wanted, err := slashtest.MockSlashingProtectionJSON(publicKeys, attestingHistory, proposalHistory)
+	require.NoError(t, err)
+	blob, err := json.Marshal(wanted)
+	require.NoError(t, err)
+	require.NoError(t, protectionFormat.ImportStandardProtectionJSON(ctx, validatorDB, bytes.NewBuffer(blob)))
+
+	plain := new(bytes.Buffer)
+	require.NoError(t, protectionFormat.ExportInterchangeData(ctx, validatorDB, plain))
+	compressed := new(bytes.Buffer)
+	require.NoError(t, protectionFormat.ExportInterchangeDataWithOptions(
+		ctx, validatorDB, compressed, protectionFormat.ExportOptions{Compress: true},
+	))
+	assert.Equal(t, true, compressed.Len() < plain.Len())
+	assert.DeepEqual(t, []byte{0x28, 0xb5, 0x2f, 0xfd}, compressed.Bytes()[:4])
+
+	// The compressed export is detected and decompressed on import, and exporting
+	// the fresh database again yields the same plain interchange JSON.
+	freshDB := dbtest.SetupDB(t, publicKeys)
+	require.NoError(t, protectionFormat.ImportStandardProtectionJSON(ctx, freshDB, compressed))
+	reexported := new(bytes.Buffer)
+	require.NoError(t, protectionFormat.ExportInterchangeData(ctx, freshDB, reexported))
+	require.DeepEqual(t, plain.Bytes(), reexported.Bytes())
+}
+
+func TestImportExport_RoundTrip_ForKeys(t *testing.T) {
+	hook := logTest.NewGlobal()
+	ctx := context.Background()
+	numValidators := 10
+	publicKeys, err := slashtest.CreateRandomPubKeys(numValidators + 1)
+	require.NoError(t, err)
+	validatorDB := dbtest.SetupDB(t, publicKeys)
+
+	// The last public key has no slashing protection history.
+	attestingHistory, proposalHistory := slashtest.MockAttestingAndProposalHistories(numValidators)
+	wanted, err := slashtest.MockSlashingProtectionJSON(publicKeys[:numValidators], attestingHistory, proposalHistory)
+	require.NoError(t, err)
+	blob, err := json.Marshal(wanted)
+	require.NoError(t, err)
+	require.NoError(t, protectionFormat.ImportStandardProtectionJSON(ctx, validatorDB, bytes.NewBuffer(blob)))
+
+	requested := [][48]byte{publicKeys[3], publicKeys[numValidators], publicKeys[1], publicKeys[3]}
+	buf := new(bytes.Buffer)
+	require.NoError(t, protectionFormat.ExportInterchangeDataForKeys(ctx, validatorDB, buf, requested))
+	require.LogsContain(t, hook, "No slashing protection history to export for public key")
+
+	exported := &format.EIPSlashingProtectionFormat{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), exported))
+	require.Equal(t, wanted.Metadata, exported.Metadata)
+	require.Equal(t, 2, len(exported.Data))
+
+	// Entries are the full histories of the requested keys, ordered by public key.
+	full := &format.EIPSlashingProtectionFormat{}
+	fullBuf := new(bytes.Buffer)
+	require.NoError(t, protectionFormat.ExportInterchangeData(ctx, validatorDB, fullBuf))
+	require.NoError(t, json.Unmarshal(fullBuf.Bytes(), full))
+	fullByPubKey := make(map[string]*format.ProtectionData)
+	for _, item := range full.Data {
+		fullByPubKey[item.Pubkey] = item
+	}
+	wantedKeys := []string{fmt.Sprintf("%#x", publicKeys[1]), fmt.Sprintf("%#x", publicKeys[3])}
+	if wantedKeys[0] > wantedKeys[1] {
+		wantedKeys[0], wantedKeys[1] = wantedKeys[1], wantedKeys[0]
+	}
+	for i, item := range exported.Data {
+		assert.Equal(t, wantedKeys[i], item.Pubkey)
+		require.DeepEqual(t, fullByPubKey[item.Pubkey], item)
+	}
+
+	// The filtered export can be imported into a fresh database.
+	freshDB := dbtest.SetupDB(t, publicKeys)
+	require.NoError(t, protectionFormat.ImportStandardProtectionJSON(ctx, freshDB, buf))
+}
+
+func TestImportExport_RoundTrip_Since(t *testing.T) {
+	ctx := context.Background()
+	pubKey := [48]byte{1}
+	validatorDB := dbtest.SetupDB(t, [][48]byte{pubKey})
+	genesisValidatorsRoot := [32]byte{1}
+	require.NoError(t, validatorDB.SaveGenesisValidatorsRoot(ctx, genesisValidatorsRoot[:]))
+	for epoch := types.Epoch(1); epoch <= 10; epoch++ {
+		att := &ethpb.IndexedAttestation{
+			Data: &ethpb.AttestationData{
+				Source: &ethpb.Checkpoint{Epoch: epoch - 1},
+				Target: &ethpb.Checkpoint{Epoch: epoch},
+			},
+		}
+		signingRoot := [32]byte{byte(epoch)}
+		require.NoError(t, validatorDB.SaveAttestationForPubKey(ctx, pubKey, signingRoot, att))
+		slot := params.BeaconConfig().SlotsPerEpoch.Mul(uint64(epoch))
+		require.NoError(t, validatorDB.SaveProposalHistoryForSlot(ctx, pubKey, slot, signingRoot[:]))
+	}
+	// The last slot of the epoch before the requested one is left out.
+	sinceSlot := params.BeaconConfig().SlotsPerEpoch.Mul(6)
+	require.NoError(t, validatorDB.SaveProposalHistoryForSlot(ctx, pubKey, sinceSlot-1, make([]byte, 32)))
+
+	buf := new(bytes.Buffer)
+	require.NoError(t, protectionFormat.ExportInterchangeDataSince(ctx, validatorDB, buf, 6))
+	exported := &format.EIPSlashingProtectionFormat{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), exported))
+	require.Equal(t, 1, len(exported.Data))
+	require.Equal(t, 5, len(exported.Data[0].SignedAttestations))
+	for i, att := range exported.Data[0].SignedAttestations {
+		assert.Equal(t, fmt.Sprintf("%d", 6+i), att.TargetEpoch)
+	}
+	require.Equal(t, 5, len(exported.Data[0].SignedBlocks))
+	assert.Equal(t, fmt.Sprintf("%d", sinceSlot), exported.Data[0].SignedBlocks[0].Slot)
+
+	// The partial history is a standalone interchange file.
+	freshDB := dbtest.SetupDB(t, [][48]byte{pubKey})
+	require.NoError(t, protectionFormat.ImportStandardProtectionJSON(ctx, freshDB, buf))
+	history, err := freshDB.AttestationHistoryForPubKey(ctx, pubKey)
+	require.NoError(t, err)
+	assert.Equal(t, 5, len(history))
+}
+
+func TestExportInterchangeNDJSON(t *testing.T) {
+	ctx := context.Background()
+	numValidators := 10
+	publicKeys, err := slashtest.CreateRandomPubKeys(numValidators)
+	require.NoError(t, err)
+	validatorDB := dbtest.SetupDB(t, publicKeys)
+
+	attestingHistory, proposalHistory := slashtest.MockAttestingAndProposalHistories(numValidators)
+	wanted, err := slashtest.MockSlashingProtectionJSON(publicKeys, attestingHistory, proposalHistory)
+	require.NoError(t, err)
+	blob, err := json.Marshal(wanted)
+	require.NoError(t, err)
+	require.NoError(t, protectionFormat.ImportStandardProtectionJSON(ctx, validatorDB, bytes.NewBuffer(blob)))
+
+	buf := new(bytes.Buffer)
+	require.NoError(t, protectionFormat.ExportInterchangeNDJSON(ctx, validatorDB, buf))
+
+	// Every line holds the same entry as the data list of the complete export.
+	full := &format.EIPSlashingProtectionFormat{}
+	fullBuf := new(bytes.Buffer)
+	require.NoError(t, protectionFormat.ExportInterchangeData(ctx, validatorDB, fullBuf))
+	require.NoError(t, json.Unmarshal(fullBuf.Bytes(), full))
+	lines := bytes.Split(bytes.TrimSuffix(buf.Bytes(), []byte("\n")), []byte("\n"))
+	require.Equal(t, len(full.Data), len(lines))
+	for i, line := range lines {
+		item := &format.ProtectionData{}
+		require.NoError(t, json.Unmarshal(line, item))
+		require.DeepEqual(t, full.Data[i], item)
+	}
+}
+
 func TestImportExport_RoundTrip_SkippedAttestationEpochs(t *testing.T) {
 	ctx := context.Background()
 	numValidators := 1